@@ -0,0 +1,332 @@
+// Command loadgen simulates chat users against a running instance: each
+// user opens a room, holds a WebSocket connection and posts messages the way
+// the composer does, while the latencies of every step are recorded and
+// reported as percentiles when the run ends.
+//
+//	go run ./cmd/loadgen -target http://localhost:8080 -users 200 -duration 1m
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// options are the settings of a run
+type options struct {
+	target   *url.URL
+	users    int
+	rooms    int
+	duration time.Duration
+	ramp     time.Duration
+	interval time.Duration
+	fetch    bool
+}
+
+// hubMessage is the part of a message pushed over the WebSocket a user
+// looks at
+type hubMessage struct {
+	Type     string `json:"type"`
+	RoomID   string `json:"room_id"`
+	ChatID   string `json:"chat_id"`
+	ClientID string `json:"client_id"`
+}
+
+// run is the state shared by the simulated users
+type run struct {
+	options
+	client *http.Client
+	stats  *stats
+	// posted is when each message was posted, by client ID, to time its
+	// delivery to every connection
+	posted sync.Map
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "URL of the instance")
+	var opts options
+	flag.IntVar(&opts.users, "users", 50, "number of simulated users")
+	flag.IntVar(&opts.rooms, "rooms", 5, "number of rooms the users are spread over, created when missing")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "how long the users post messages")
+	flag.DurationVar(&opts.ramp, "ramp", 5*time.Second, "time over which the users join")
+	flag.DurationVar(&opts.interval, "interval", 2*time.Second, "average time between the messages of a user")
+	flag.BoolVar(&opts.fetch, "fetch", true, "fetch each new message of its room, as pages do")
+	flag.Parse()
+
+	u, err := url.Parse(strings.TrimSuffix(*target, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		fmt.Fprintf(os.Stderr, "loadgen: -target must be an http or https URL\n")
+		os.Exit(2)
+	}
+	if opts.users < 1 || opts.rooms < 1 || opts.interval <= 0 {
+		fmt.Fprintf(os.Stderr, "loadgen: -users, -rooms and -interval must be positive\n")
+		os.Exit(2)
+	}
+	opts.target = u
+
+	if err := start(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// start runs the users until the duration is over or the run is
+// interrupted, then prints the report
+func start(opts options) error {
+	r := &run{
+		options: opts,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		stats:   newStats(),
+	}
+	rooms, err := r.prepareRooms()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, opts.ramp+opts.duration)
+	defer cancel()
+
+	fmt.Printf("%d users in %d rooms against %s for %s\n", opts.users, len(rooms), opts.target, opts.ramp+opts.duration)
+	began := time.Now()
+	var wg sync.WaitGroup
+	for i := range opts.users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Spread the joins over the ramp rather than connecting at once
+			delay := opts.ramp * time.Duration(i) / time.Duration(opts.users)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			r.user(ctx, i, rooms[i%len(rooms)])
+		}()
+	}
+	wg.Wait()
+
+	r.stats.report(os.Stdout, time.Since(began))
+	return nil
+}
+
+// prepareRooms returns the IDs of the rooms to spread the users over,
+// creating rooms when the instance has fewer
+func (r *run) prepareRooms() ([]string, error) {
+	resp, err := r.client.Get(r.endpoint("/api/v1/rooms?fields=id&limit=" + strconv.Itoa(r.rooms)))
+	if err != nil {
+		return nil, fmt.Errorf("listing rooms: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing rooms: %s", resp.Status)
+	}
+	var rooms []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		return nil, fmt.Errorf("listing rooms: %w", err)
+	}
+
+	ids := make([]string, 0, r.rooms)
+	for _, room := range rooms {
+		ids = append(ids, room.ID)
+	}
+	for len(ids) < r.rooms {
+		id, err := r.createRoom(fmt.Sprintf("Load test %d", len(ids)+1))
+		if err != nil {
+			return nil, fmt.Errorf("creating room: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// createRoom creates a room through the JSON API and returns its ID
+func (r *run) createRoom(name string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"name": name})
+	resp, err := r.client.Post(r.endpoint("/api/v1/rooms"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	var room struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&room); err != nil {
+		return "", err
+	}
+	return room.ID, nil
+}
+
+// user simulates a visitor: it opens the page of a room, connects to the
+// hub and posts messages until the run is over
+func (r *run) user(ctx context.Context, n int, roomID string) {
+	if err := r.get(ctx, "join", "/rooms/"+roomID, false); err != nil {
+		return
+	}
+
+	began := time.Now()
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, r.wsURL(), nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	r.stats.record("connect", time.Since(began), err)
+	if err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.listen(ctx, conn, roomID)
+	}()
+	// Closing the connection ends the listener when the run is over
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	username := "loadgen-" + strconv.Itoa(n)
+	for i := 0; ; i++ {
+		// Vary the wait by up to half the interval either way, so the users
+		// do not post in lockstep
+		wait := r.interval/2 + rand.N(r.interval)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			<-done
+			return
+		}
+		r.post(ctx, roomID, username, fmt.Sprintf("Message %d from %s", i+1, username))
+	}
+}
+
+// listen reads the messages pushed to a connection, timing the delivery of
+// every posted message and fetching the new messages of the room
+func (r *run) listen(ctx context.Context, conn *websocket.Conn, roomID string) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil {
+				r.stats.record("deliver", 0, err)
+			}
+			return
+		}
+		for _, message := range decodeHubMessages(data) {
+			if message.Type != "new-chat" {
+				continue
+			}
+			if posted, ok := r.posted.Load(message.ClientID); ok {
+				r.stats.record("deliver", time.Since(posted.(time.Time)), nil)
+			}
+			if r.fetch && message.RoomID == roomID && message.ChatID != "" {
+				r.get(ctx, "fetch", "/api/rooms/"+roomID+"/chats/"+message.ChatID, true)
+			}
+		}
+	}
+}
+
+// decodeHubMessages decodes a message pushed over the WebSocket, which is a
+// single update or, for the new messages of a room flushed together, an
+// array of them
+func decodeHubMessages(data []byte) []hubMessage {
+	var messages []hubMessage
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		json.Unmarshal(data, &messages)
+		return messages
+	}
+	var message hubMessage
+	if json.Unmarshal(data, &message) != nil {
+		return nil
+	}
+	return []hubMessage{message}
+}
+
+// post sends a message as the composer does, with a client ID its delivery
+// is recognised by
+func (r *run) post(ctx context.Context, roomID, username, message string) {
+	clientID := strconv.FormatUint(rand.Uint64(), 36)
+	form := url.Values{"username": {username}, "message": {message}, "client_id": {clientID}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint("/api/rooms/"+roomID+"/chats"), strings.NewReader(form.Encode()))
+	if err != nil {
+		r.stats.record("post", 0, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+
+	began := time.Now()
+	r.posted.Store(clientID, began)
+	err = r.do(req)
+	if ctx.Err() != nil {
+		return
+	}
+	r.stats.record("post", time.Since(began), err)
+}
+
+// get requests a page or partial, timed as op
+func (r *run) get(ctx context.Context, op, path string, htmx bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint(path), nil)
+	if err != nil {
+		r.stats.record(op, 0, err)
+		return err
+	}
+	if htmx {
+		req.Header.Set("HX-Request", "true")
+	}
+
+	began := time.Now()
+	err = r.do(req)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.stats.record(op, time.Since(began), err)
+	return err
+}
+
+// do sends a request and reads the whole response, failing on an error
+// status
+func (r *run) do(req *http.Request) error {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return nil
+}
+
+// endpoint returns the URL of a path of the instance
+func (r *run) endpoint(path string) string {
+	return r.target.String() + path
+}
+
+// wsURL returns the URL of the hub of the instance
+func (r *run) wsURL() string {
+	u := *r.target
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += "/ws"
+	return u.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// operations are the steps timed by a run, in the order they are reported
+var operations = []string{"join", "connect", "post", "deliver", "fetch"}
+
+// descriptions explain the operations in the report
+var descriptions = map[string]string{
+	"join":    "GET of the room page",
+	"connect": "WebSocket handshake",
+	"post":    "message form submission",
+	"deliver": "post to new-chat on each connection",
+	"fetch":   "GET of a new message fragment",
+}
+
+// stats collects the latencies and errors of the operations
+type stats struct {
+	samples   map[string][]time.Duration
+	errors    map[string]int
+	lastError map[string]error
+	mutex     sync.Mutex
+}
+
+// newStats creates empty stats
+func newStats() *stats {
+	return &stats{
+		samples:   make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		lastError: make(map[string]error),
+	}
+}
+
+// record adds the latency of an operation, or its error
+func (s *stats) record(op string, latency time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.errors[op]++
+		s.lastError[op] = err
+		return
+	}
+	s.samples[op] = append(s.samples[op], latency)
+}
+
+// report writes the count, errors and latency percentiles of every
+// operation, then the last error of each failing one
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fmt.Fprintf(w, "\nran for %s\n\n", elapsed.Round(time.Millisecond))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\tcount\terrors\trate/s\tp50\tp90\tp99\tmax\t")
+	for _, op := range operations {
+		samples := s.samples[op]
+		slices.Sort(samples)
+		rate := float64(len(samples)) / elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", op, len(samples), s.errors[op], rate,
+			percentile(samples, 50), percentile(samples, 90), percentile(samples, 99), percentile(samples, 100))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	for _, op := range operations {
+		fmt.Fprintf(w, "  %-8s %s\n", op, descriptions[op])
+	}
+	for _, op := range operations {
+		if err := s.lastError[op]; err != nil {
+			fmt.Fprintf(w, "\nlast %s error: %v", op, err)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// percentile returns the p-th percentile of sorted latencies, by the
+// nearest rank, or "-" without any
+func percentile(sorted []time.Duration, p int) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	rank := (len(sorted)*p + 99) / 100
+	return sorted[max(rank, 1)-1].Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"htmx/internal/version"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// runMigrate applies the schema migrations of the configured store
+func runMigrate(args []string) error {
+	fs, configPath := newFlagSet("migrate")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if !app.Persistent(cfg) {
+		log.Printf("Store backend %q has no schema, nothing to migrate", cfg.Store.Backend)
+		return nil
+	}
+	log.Println("Migrations applied")
+	return nil
+}
+
+// runSeed adds the sample rooms and messages to an empty store
+func runSeed(args []string) error {
+	fs, configPath := newFlagSet("seed")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if !app.Persistent(cfg) {
+		return fmt.Errorf("store backend %q does not keep data between runs; use 'serve -seed' instead", cfg.Store.Backend)
+	}
+
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	if len(st.Rooms.GetRooms()) > 0 {
+		return errors.New("store already contains rooms")
+	}
+
+	if err := addSampleData(st.Rooms, st.Chats); err != nil {
+		return err
+	}
+	log.Println("Sample data added")
+	return nil
+}
+
+// runExport writes every room and message of the store as JSON
+func runExport(args []string) error {
+	fs, configPath := newFlagSet("export")
+	output := fs.String("o", "-", "output file, - for stdout")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	if !app.Persistent(cfg) {
+		log.Printf("Store backend %q does not keep data between runs, the export will be empty", cfg.Store.Backend)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return app.WriteExport(w, st.Rooms, st.Chats)
+}
+
+// runCreateAdmin adds an admin account to the database, which the server
+// loads at startup
+func runCreateAdmin(args []string) error {
+	fs, configPath := newFlagSet("create-admin")
+	username := fs.String("username", "", "admin username (required)")
+	password := fs.String("password", "", "admin password (required)")
+	fs.Parse(args)
+
+	if *username == "" || *password == "" {
+		fs.Usage()
+		return errors.New("-username and -password are required")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if !app.Persistent(cfg) {
+		return fmt.Errorf("store backend %q does not keep data between runs; set admin.username and admin.password in the config instead", cfg.Store.Backend)
+	}
+
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	admin, err := models.NewAdmin(*username, *password, time.Now())
+	if err != nil {
+		return err
+	}
+	added, err := st.DB.AddAdmin(admin)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return fmt.Errorf("admin %q already exists", *username)
+	}
+
+	log.Printf("Admin %q created", *username)
+	return nil
+}
+
+// runVersion prints the build info of the binary
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Parse(args)
+
+	info := version.Get()
+	fmt.Printf("htmx %s\n", info.Version)
+	if info.Commit != "" {
+		fmt.Printf("commit:   %s\n", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Printf("built:    %s\n", info.BuildDate)
+	}
+	fmt.Printf("go:       %s %s\n", info.GoVersion, info.Platform)
+	return nil
+}
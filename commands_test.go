@@ -0,0 +1,41 @@
+package main
+
+import (
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateAdmin(t *testing.T) {
+	t.Setenv("HTMX_STORE_BACKEND", "sqlite")
+	t.Setenv("HTMX_STORE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if err := runCreateAdmin([]string{"-username", "alice", "-password", "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCreateAdmin([]string{"-username", "alice", "-password", "other"}); err == nil {
+		t.Error("creating an admin twice succeeded")
+	}
+
+	// The server loads the account when it opens the stores
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	admin, ok := st.Admins.GetAdmin("alice")
+	if !ok || !admin.CheckPassword("secret") {
+		t.Errorf("admin after opening the stores = %+v, %v", admin, ok)
+	}
+}
+
+func TestCreateAdminMemory(t *testing.T) {
+	t.Setenv("HTMX_STORE_BACKEND", "memory")
+	if err := runCreateAdmin([]string{"-username", "alice", "-password", "secret"}); err == nil {
+		t.Error("created an admin in a store lost on exit")
+	}
+}
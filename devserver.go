@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/config"
+	"htmx/internal/dev"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// devReadyTimeout bounds how long a rebuilt server may take to answer
+	devReadyTimeout = 30 * time.Second
+	// devStopTimeout bounds how long a server may take to stop before it is killed
+	devStopTimeout = 5 * time.Second
+)
+
+// runDev builds and runs the server in dev mode behind a proxy, rebuilding
+// and restarting it when Go sources change, with browsers refreshed after
+// each restart and on every template or static file change
+func runDev(args []string) error {
+	fs, configPath := newFlagSet("dev")
+	addr := fs.String("addr", "", "address the proxy listens on, server.addr by default")
+	css := fs.Bool("css", true, "run Tailwind in watch mode alongside, when its npm packages are installed")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: htmx dev [flags] [-- serve flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if *addr != "" {
+		cfg.Server.Addr = *addr
+	}
+	// Keep the same secrets across restarts, so sessions survive them
+	generateSecrets(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dir, err := os.MkdirTemp("", "htmx-dev-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if *css {
+		if tailwind := startTailwind(ctx); tailwind != nil {
+			defer tailwind.Wait()
+		}
+	}
+
+	reloader := dev.NewReloader()
+	proxy := dev.NewProxy()
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/__dev/reload", reloader.Handler)
+	router.NoRoute(gin.WrapH(proxy))
+
+	ln, err := listen("dev", config.ServerConfig{Addr: cfg.Server.Addr, SocketMode: cfg.Server.SocketMode})
+	if err != nil {
+		return fmt.Errorf("dev proxy listener: %w", err)
+	}
+	server := &http.Server{Handler: router, ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Dev proxy listening on %s", cfg.Server.Addr)
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+	defer server.Close()
+
+	d := &devServer{
+		configPath: *configPath,
+		cfg:        cfg,
+		serveArgs:  fs.Args(),
+		binary:     filepath.Join(dir, "htmx"),
+		proxy:      proxy,
+		reloader:   reloader,
+	}
+	if err := d.restart(); err != nil {
+		return err
+	}
+	defer d.stop()
+
+	changes := make(chan []string, 1)
+	go dev.NewWatcher(500*time.Millisecond, ".").Watch(ctx, func(paths []string) {
+		select {
+		case changes <- paths:
+		default:
+		}
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Dev proxy shutting down")
+			return nil
+		case err := <-serveErr:
+			return fmt.Errorf("dev proxy: %w", err)
+		case paths := <-changes:
+			if !needsRebuild(paths) {
+				continue
+			}
+			log.Printf("Dev: %d Go source(s) changed, rebuilding", len(paths))
+			if err := d.restart(); err != nil {
+				log.Printf("Dev: %v", err)
+			}
+		}
+	}
+}
+
+// devServer is the server run by the dev command, replaced on every rebuild
+type devServer struct {
+	configPath string
+	cfg        *config.Config
+	// serveArgs are passed on to the serve command
+	serveArgs []string
+	binary    string
+	proxy     *dev.Proxy
+	reloader  *dev.Reloader
+	cmd       *exec.Cmd
+	exited    chan struct{}
+}
+
+// restart builds the server and, when it compiles, replaces the running one
+// and refreshes the browsers once it answers. A build error keeps the
+// running server
+func (d *devServer) restart() error {
+	build := exec.Command("go", "build", "-o", d.binary+".next", ".")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("build failed, keeping the running server: %w", err)
+	}
+
+	d.stop()
+	if err := os.Rename(d.binary+".next", d.binary); err != nil {
+		return err
+	}
+
+	addr, err := freeAddr()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"serve", "-dev"}, d.serveArgs...)
+	if d.configPath != "" {
+		args = append(args, "-config", d.configPath)
+	}
+	cmd := exec.Command(d.binary, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"HTMX_ADDR="+addr,
+		"HTMX_ADMIN_PASSWORD="+d.cfg.Admin.Password,
+		"HTMX_FEATURES_SECRET="+d.cfg.Features.Secret,
+	)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting the server: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	d.cmd, d.exited = cmd, exited
+
+	target := &url.URL{Scheme: "http", Host: addr}
+	if err := waitReady(target, exited); err != nil {
+		return err
+	}
+	d.proxy.SetTarget(target)
+	go dev.RelayReloads(target, d.reloader)
+	d.reloader.Reload()
+	return nil
+}
+
+// stop interrupts the running server, killing it if it does not stop in time
+func (d *devServer) stop() {
+	d.proxy.SetTarget(nil)
+	if d.cmd == nil {
+		return
+	}
+	if err := d.cmd.Process.Signal(os.Interrupt); err != nil {
+		// Windows cannot interrupt another process
+		d.cmd.Process.Kill()
+	}
+	select {
+	case <-d.exited:
+	case <-time.After(devStopTimeout):
+		d.cmd.Process.Kill()
+		<-d.exited
+	}
+	d.cmd = nil
+}
+
+// waitReady polls the readiness probe of the server at target until it
+// answers, failing if the server exits first
+func waitReady(target *url.URL, exited <-chan struct{}) error {
+	deadline := time.After(devReadyTimeout)
+	for {
+		if res, err := http.Get(target.String() + "/readyz"); err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-exited:
+			return errors.New("the server exited while starting")
+		case <-deadline:
+			return fmt.Errorf("the server did not become ready within %s", devReadyTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// freeAddr returns a loopback address with a port nothing listens on
+func freeAddr() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return ln.Addr().String(), nil
+}
+
+// needsRebuild reports whether any of the changed paths is compiled into the
+// server. Templates and static files are not: the server reloads them
+// itself in dev mode
+func needsRebuild(paths []string) bool {
+	for _, path := range paths {
+		path = filepath.ToSlash(path)
+		switch {
+		case strings.HasPrefix(path, "internal/templates/"), strings.HasPrefix(path, "static/"):
+		case strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go"):
+			return true
+		case path == "go.mod", path == "go.sum", strings.HasPrefix(path, "internal/"):
+			return true
+		}
+	}
+	return false
+}
+
+// startTailwind runs the Tailwind watcher of package.json until ctx is
+// done, or returns nil when npm or its packages are not installed
+func startTailwind(ctx context.Context) *exec.Cmd {
+	if _, err := exec.LookPath("npm"); err != nil {
+		log.Println("Dev: npm not found, not rebuilding output.css")
+		return nil
+	}
+	if _, err := os.Stat("node_modules"); err != nil {
+		log.Println("Dev: run 'npm install' to rebuild output.css on changes")
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "npm", "run", "build-css")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Printf("Dev: starting Tailwind: %v", err)
+		return nil
+	}
+	return cmd
+}
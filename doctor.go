@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/templates"
+	"htmx/static"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// certExpiryWarning is how long before it expires a certificate is reported,
+// leaving time to renew it
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// diagnosis is the outcome of a doctor check
+type diagnosis struct {
+	// detail tells what was checked or found
+	detail string
+	// skipped marks a check that does not apply to the configuration
+	skipped bool
+	err     error
+	// fix tells how to resolve err
+	fix string
+}
+
+// doctorCheck is a check of the doctor command
+type doctorCheck struct {
+	name string
+	run  func() diagnosis
+}
+
+// runDoctor checks the configuration and the environment the server would
+// run in, printing how to fix each problem found
+func runDoctor(args []string) error {
+	fs, configPath := newFlagSet("doctor")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		printDiagnosis("config", diagnosis{
+			err: err,
+			fix: "correct the settings named above in the config file or their HTMX_* variables; config.example.yaml documents each",
+		})
+		return errors.New("invalid configuration, the other checks need a valid one")
+	}
+	source := "defaults and environment"
+	if *configPath != "" {
+		source = *configPath
+	}
+	printDiagnosis("config", diagnosis{detail: source})
+
+	checks := doctorChecks(cfg)
+	failed := 0
+	for _, check := range checks {
+		d := check.run()
+		printDiagnosis(check.name, d)
+		if d.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks)+1)
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+// printDiagnosis prints the status line of a check, followed by the error
+// and its fix when it failed
+func printDiagnosis(name string, d diagnosis) {
+	switch {
+	case d.err != nil:
+		fmt.Printf("FAIL  %-16s %s\n", name, d.detail)
+		for _, line := range strings.Split(d.err.Error(), "\n") {
+			fmt.Printf("      %s\n", line)
+		}
+		fmt.Printf("      fix: %s\n", d.fix)
+	case d.skipped:
+		fmt.Printf("skip  %-16s %s\n", name, d.detail)
+	default:
+		fmt.Printf("ok    %-16s %s\n", name, d.detail)
+	}
+}
+
+// doctorChecks lists the checks of the configuration, in the order they run
+func doctorChecks(cfg *config.Config) []doctorCheck {
+	tlsCfg := cfg.Server.TLS
+	autocertCfg := tlsCfg.Autocert
+	return []doctorCheck{
+		{"templates", func() diagnosis { return checkTemplates(cfg) }},
+		{"stylesheet", checkStylesheet},
+		{"store", func() diagnosis { return checkStore(cfg) }},
+		{"archive dir", func() diagnosis {
+			if cfg.Store.MemoryBudget == 0 {
+				return diagnosis{skipped: true, detail: "no store.memory_budget"}
+			}
+			return checkWritableDir(cfg.Store.ArchiveDir, "store.archive_dir (HTMX_STORE_ARCHIVE_DIR)")
+		}},
+		{"backup dir", func() diagnosis {
+			if cfg.Jobs.Backup.Dir == "" {
+				return diagnosis{skipped: true, detail: "no jobs.backup.dir"}
+			}
+			return checkWritableDir(cfg.Jobs.Backup.Dir, "jobs.backup.dir (HTMX_JOBS_BACKUP_DIR)")
+		}},
+		{"certificate dir", func() diagnosis {
+			if !autocertCfg.Enabled {
+				return diagnosis{skipped: true, detail: "autocert disabled"}
+			}
+			return checkWritableDir(autocertCfg.CacheDir, "server.tls.autocert.cache_dir (HTMX_AUTOCERT_CACHE_DIR)")
+		}},
+		{"server addr", func() diagnosis {
+			return checkAddr(cfg.Server.Addr, "server.addr (HTMX_ADDR)")
+		}},
+		{"admin addr", func() diagnosis {
+			return checkAddr(cfg.Admin.Addr, "admin.addr (HTMX_ADMIN_ADDR)")
+		}},
+		{"grpc addr", func() diagnosis {
+			return checkAddr(cfg.GRPC.Addr, "grpc.addr (HTMX_GRPC_ADDR)")
+		}},
+		{"irc addr", func() diagnosis {
+			return checkAddr(cfg.IRC.Addr, "irc.addr (HTMX_IRC_ADDR)")
+		}},
+		{"acme addr", func() diagnosis {
+			if !autocertCfg.Enabled {
+				return diagnosis{skipped: true, detail: "autocert disabled"}
+			}
+			return checkAddr(autocertCfg.HTTPAddr, "server.tls.autocert.http_addr (HTMX_AUTOCERT_HTTP_ADDR)")
+		}},
+		{"tls certificate", func() diagnosis { return checkCertificate(tlsCfg, time.Now()) }},
+	}
+}
+
+// checkTemplates parses the templates as the server does, from disk in dev
+// mode
+func checkTemplates(cfg *config.Config) diagnosis {
+	source := "embedded"
+	fix := "correct the template named above and rebuild the binary"
+	if cfg.Dev {
+		source = "internal/templates"
+		fix = "correct the template named above, or run from the repository root where internal/templates is"
+	}
+	if _, err := templates.Load(cfg, nil); err != nil {
+		return diagnosis{detail: source, err: err, fix: fix}
+	}
+	return diagnosis{detail: source}
+}
+
+// checkStylesheet verifies the binary embeds the Tailwind output and, when run
+// from the source tree, that it was built after its sources last changed
+func checkStylesheet() diagnosis {
+	const output = "css/output.css"
+	if _, err := fs.Stat(static.FS, output); err != nil {
+		return diagnosis{
+			detail: output,
+			err:    fmt.Errorf("%s is not embedded, pages render unstyled", output),
+			fix:    "run 'npm install && npm run build', then rebuild the binary",
+		}
+	}
+
+	built, err := os.Stat(filepath.Join("static", output))
+	if err != nil {
+		return diagnosis{detail: "embedded, sources not found to compare"}
+	}
+	sources, _ := filepath.Glob("internal/templates/*/*.gohtml")
+	sources = append(sources, "static/css/input.css", "tailwind.config.js")
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err == nil && info.ModTime().After(built.ModTime()) {
+			return diagnosis{
+				detail: "static/" + output,
+				err:    fmt.Errorf("%s changed after static/%s was built", source, output),
+				fix:    "run 'npm run build', then rebuild the binary",
+			}
+		}
+	}
+	return diagnosis{detail: "static/" + output + " up to date"}
+}
+
+// checkStore opens the configured store and pings it
+func checkStore(cfg *config.Config) diagnosis {
+	st, err := app.OpenStores(cfg)
+	if err == nil {
+		err = errors.Join(st.Rooms.Ping(), st.Chats.Ping(), st.Close())
+	}
+	if err != nil {
+		return diagnosis{
+			detail: cfg.Store.Backend,
+			err:    err,
+			fix:    "check store.backend and store.path (HTMX_STORE_BACKEND, HTMX_STORE_PATH), and that the store is reachable",
+		}
+	}
+	return diagnosis{detail: cfg.Store.Backend}
+}
+
+// checkWritableDir verifies the server can create files in dir, or create dir
+// when it does not exist yet. setting names where dir is configured
+func checkWritableDir(dir, setting string) diagnosis {
+	// The server creates missing directories, so test the closest existing one
+	existing := dir
+	for {
+		info, err := os.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				return diagnosis{
+					detail: dir,
+					err:    fmt.Errorf("%s is not a directory", existing),
+					fix:    "point " + setting + " at a directory, or remove the file in its way",
+				}
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(existing) == existing {
+			return diagnosis{detail: dir, err: err, fix: "point " + setting + " at a directory the server can access"}
+		}
+		existing = filepath.Dir(existing)
+	}
+
+	f, err := os.CreateTemp(existing, ".doctor-*")
+	if err != nil {
+		return diagnosis{
+			detail: dir,
+			err:    err,
+			fix:    "give the user running the server write access to " + existing + ", or change " + setting,
+		}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return diagnosis{detail: dir}
+}
+
+// checkAddr verifies the listener of a TCP address or unix:// socket can be
+// opened, that is nothing else uses it. setting names where addr is
+// configured; an empty addr is off
+func checkAddr(addr, setting string) diagnosis {
+	if addr == "" {
+		return diagnosis{skipped: true, detail: "off"}
+	}
+	busy := "stop the process using it, such as a server already running, or change " + setting
+
+	path, ok := config.ServerConfig{Addr: addr}.SocketPath()
+	if !ok {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return diagnosis{detail: addr, err: err, fix: busy}
+		}
+		ln.Close()
+		return diagnosis{detail: addr}
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket == 0:
+		return diagnosis{detail: addr, err: fmt.Errorf("%s exists and is not a socket", path), fix: "remove the file or change " + setting}
+	case err == nil:
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return diagnosis{detail: addr, err: fmt.Errorf("%s is in use by another process", path), fix: busy}
+		}
+		// A stale socket, which the server removes
+	}
+
+	// The server does not create the directory of the socket
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return diagnosis{detail: addr, err: fmt.Errorf("%s is not a directory", dir), fix: "create " + dir + " or change " + setting}
+	}
+	if d := checkWritableDir(dir, setting); d.err != nil {
+		d.detail = addr
+		return d
+	}
+	return diagnosis{detail: addr}
+}
+
+// checkCertificate verifies the configured certificate and key load, belong
+// together and are valid at now
+func checkCertificate(cfg config.TLSConfig, now time.Time) diagnosis {
+	if cfg.CertFile == "" {
+		if cfg.Autocert.Enabled {
+			return diagnosis{skipped: true, detail: "obtained by autocert"}
+		}
+		return diagnosis{skipped: true, detail: "TLS disabled"}
+	}
+	setting := "server.tls.cert_file and server.tls.key_file (HTMX_TLS_CERT_FILE, HTMX_TLS_KEY_FILE)"
+
+	pair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return diagnosis{
+			detail: cfg.CertFile,
+			err:    err,
+			fix:    "point " + setting + " at a readable PEM certificate and its private key",
+		}
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return diagnosis{detail: cfg.CertFile, err: err, fix: "replace the certificate with a valid X.509 one"}
+	}
+
+	switch {
+	case now.Before(leaf.NotBefore):
+		return diagnosis{
+			detail: cfg.CertFile,
+			err:    fmt.Errorf("not valid before %s", leaf.NotBefore.Format(time.RFC3339)),
+			fix:    "check the system clock, or wait until the certificate becomes valid",
+		}
+	case now.After(leaf.NotAfter):
+		return diagnosis{
+			detail: cfg.CertFile,
+			err:    fmt.Errorf("expired on %s", leaf.NotAfter.Format(time.RFC3339)),
+			fix:    "renew the certificate and restart the server, or enable server.tls.autocert",
+		}
+	case leaf.NotAfter.Sub(now) < certExpiryWarning:
+		return diagnosis{
+			detail: cfg.CertFile,
+			err:    fmt.Errorf("expires on %s", leaf.NotAfter.Format(time.RFC3339)),
+			fix:    "renew the certificate before it expires and restart the server",
+		}
+	}
+	return diagnosis{detail: fmt.Sprintf("%s, valid until %s", cfg.CertFile, leaf.NotAfter.Format(time.DateOnly))}
+}
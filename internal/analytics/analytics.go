@@ -0,0 +1,216 @@
+// Package analytics aggregates message activity over a time range.
+package analytics
+
+import (
+	"fmt"
+	"htmx/internal/models"
+	"slices"
+	"time"
+)
+
+// Intervals lists the supported bucket sizes
+var Intervals = []string{"hour", "day", "week"}
+
+// Range is a half-open time range [From, To) split into buckets of Interval
+type Range struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+}
+
+// ParseRange reads a range from dates formatted as 2006-01-02, in UTC. to is
+// inclusive; empty dates default to the 30 days up to today
+func ParseRange(from, to, interval string, now time.Time) (Range, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	r := Range{From: today.AddDate(0, 0, -29), To: today.AddDate(0, 0, 1), Interval: interval}
+	if r.Interval == "" {
+		r.Interval = "day"
+	}
+	if !slices.Contains(Intervals, r.Interval) {
+		return Range{}, fmt.Errorf("interval %q is not supported (want hour, day or week)", interval)
+	}
+
+	if from != "" {
+		t, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return Range{}, fmt.Errorf("from %q is not a date like 2006-01-02", from)
+		}
+		r.From = t
+	}
+	if to != "" {
+		t, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return Range{}, fmt.Errorf("to %q is not a date like 2006-01-02", to)
+		}
+		r.To = t.AddDate(0, 0, 1)
+	}
+	if !r.From.Before(r.To) {
+		return Range{}, fmt.Errorf("from must not be after to")
+	}
+	return r, nil
+}
+
+// Contains reports whether t falls within the range
+func (r Range) Contains(t time.Time) bool {
+	return !t.Before(r.From) && t.Before(r.To)
+}
+
+// bucket returns the start of the bucket t falls into
+func (r Range) bucket(t time.Time) time.Time {
+	t = t.UTC()
+	switch r.Interval {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := t.Truncate(24 * time.Hour)
+		// Weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return t.Truncate(24 * time.Hour)
+	}
+}
+
+// next returns the start of the bucket after the one starting at t
+func (r Range) next(t time.Time) time.Time {
+	switch r.Interval {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// Buckets calls fn with the start of every bucket in the range, in order
+func (r Range) Buckets(fn func(start time.Time)) {
+	for t := r.bucket(r.From); t.Before(r.To); t = r.next(t) {
+		fn(t)
+	}
+}
+
+// Volume is the number of messages posted in a bucket
+type Volume struct {
+	Start    time.Time
+	Messages int
+	// Bot counts the messages posted by integrations
+	Bot int
+}
+
+// MessageVolume counts the messages per bucket, including empty buckets
+func MessageVolume(chats []*models.Chat, r Range) []Volume {
+	counts := make(map[time.Time]*Volume)
+	for _, chat := range chats {
+		if !r.Contains(chat.CreatedAt) {
+			continue
+		}
+		start := r.bucket(chat.CreatedAt)
+		v, ok := counts[start]
+		if !ok {
+			v = &Volume{Start: start}
+			counts[start] = v
+		}
+		v.Messages++
+		if chat.Bot {
+			v.Bot++
+		}
+	}
+
+	var rows []Volume
+	r.Buckets(func(start time.Time) {
+		if v, ok := counts[start]; ok {
+			rows = append(rows, *v)
+		} else {
+			rows = append(rows, Volume{Start: start})
+		}
+	})
+	return rows
+}
+
+// Users is the number of people who posted in a bucket
+type Users struct {
+	Start  time.Time
+	Active int
+	// New counts the people whose first message in the range is in the bucket
+	New int
+}
+
+// ActiveUsers counts the distinct authors per bucket, leaving out bots
+func ActiveUsers(chats []*models.Chat, r Range) []Users {
+	active := make(map[time.Time]map[string]bool)
+	first := make(map[string]time.Time)
+	for _, chat := range chats {
+		if chat.Bot || !r.Contains(chat.CreatedAt) {
+			continue
+		}
+		start := r.bucket(chat.CreatedAt)
+		if active[start] == nil {
+			active[start] = make(map[string]bool)
+		}
+		active[start][chat.Username] = true
+		if seen, ok := first[chat.Username]; !ok || start.Before(seen) {
+			first[chat.Username] = start
+		}
+	}
+
+	newUsers := make(map[time.Time]int)
+	for _, start := range first {
+		newUsers[start]++
+	}
+
+	var rows []Users
+	r.Buckets(func(start time.Time) {
+		rows = append(rows, Users{Start: start, Active: len(active[start]), New: newUsers[start]})
+	})
+	return rows
+}
+
+// Activity summarizes a room over the range
+type Activity struct {
+	Room        *models.Room
+	Messages    int
+	ActiveUsers int
+	// FirstMessage and LastMessage are zero when the room had no messages
+	FirstMessage time.Time
+	LastMessage  time.Time
+}
+
+// RoomActivity summarizes every room, busiest first
+func RoomActivity(rooms []*models.Room, chats []*models.Chat, r Range) []Activity {
+	byRoom := make(map[string]*Activity, len(rooms))
+	users := make(map[string]map[string]bool, len(rooms))
+	for _, room := range rooms {
+		byRoom[room.ID] = &Activity{Room: room}
+		users[room.ID] = make(map[string]bool)
+	}
+
+	for _, chat := range chats {
+		a, ok := byRoom[chat.RoomID]
+		if !ok || !r.Contains(chat.CreatedAt) {
+			continue
+		}
+		a.Messages++
+		if !chat.Bot {
+			users[chat.RoomID][chat.Username] = true
+		}
+		if a.FirstMessage.IsZero() || chat.CreatedAt.Before(a.FirstMessage) {
+			a.FirstMessage = chat.CreatedAt
+		}
+		if chat.CreatedAt.After(a.LastMessage) {
+			a.LastMessage = chat.CreatedAt
+		}
+	}
+
+	rows := make([]Activity, 0, len(byRoom))
+	for id, a := range byRoom {
+		a.ActiveUsers = len(users[id])
+		rows = append(rows, *a)
+	}
+	slices.SortFunc(rows, func(a, b Activity) int {
+		if a.Messages != b.Messages {
+			return b.Messages - a.Messages
+		}
+		return a.Room.CreatedAt.Compare(b.Room.CreatedAt)
+	})
+	return rows
+}
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"sync"
+	"time"
+)
+
+// connectionsRetention is how long the hourly connection counts are kept
+const connectionsRetention = 366 * 24 * time.Hour
+
+// Connections collects the number of concurrent WebSocket connections over
+// time, which unlike messages is not kept by the stores. It keeps the
+// highest and the last count of every hour a count was observed in
+type Connections struct {
+	hours []connectionsHour
+	mutex sync.Mutex
+}
+
+// connectionsHour is the counts observed in an hour
+type connectionsHour struct {
+	start time.Time
+	peak  int
+	last  int
+}
+
+// NewConnections creates an empty connections collector
+func NewConnections() *Connections {
+	return &Connections{}
+}
+
+// Observe records the number of connections now, whenever it changes
+func (c *Connections) Observe(count int) {
+	c.observe(count, time.Now())
+}
+
+// observe records the number of connections at a time
+func (c *Connections) observe(count int, at time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	start := at.UTC().Truncate(time.Hour)
+	if n := len(c.hours); n > 0 && c.hours[n-1].start.Equal(start) {
+		hour := &c.hours[n-1]
+		hour.peak = max(hour.peak, count)
+		hour.last = count
+		return
+	}
+
+	// A new hour drops the hours past the retention
+	cutoff := start.Add(-connectionsRetention)
+	i := 0
+	for i < len(c.hours) && c.hours[i].start.Before(cutoff) {
+		i++
+	}
+	c.hours = append(c.hours[i:], connectionsHour{start: start, peak: count, last: count})
+}
+
+// Peak is the highest number of concurrent connections in a bucket
+type Peak struct {
+	Start       time.Time
+	Connections int
+}
+
+// PeakConnections returns the highest number of concurrent connections per
+// bucket, including empty buckets. Hours without a change keep the count
+// the previous hour ended with, up to the current hour
+func (c *Connections) PeakConnections(r Range) []Peak {
+	c.mutex.Lock()
+	hours := append([]connectionsHour(nil), c.hours...)
+	c.mutex.Unlock()
+
+	end := r.To
+	if now := time.Now(); now.Before(end) {
+		end = now
+	}
+	peaks := make(map[time.Time]int)
+	i, carried := 0, 0
+	for t := r.From.UTC().Truncate(time.Hour); t.Before(end); t = t.Add(time.Hour) {
+		// Skip to the hour, carrying the count of the hours before it
+		for i < len(hours) && hours[i].start.Before(t) {
+			carried = hours[i].last
+			i++
+		}
+		peak := carried
+		if i < len(hours) && hours[i].start.Equal(t) {
+			peak = hours[i].peak
+			carried = hours[i].last
+			i++
+		}
+		start := r.bucket(t)
+		peaks[start] = max(peaks[start], peak)
+	}
+
+	var rows []Peak
+	r.Buckets(func(start time.Time) {
+		rows = append(rows, Peak{Start: start, Connections: peaks[start]})
+	})
+	return rows
+}
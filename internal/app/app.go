@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"htmx/internal/assets"
+	"htmx/internal/config"
+	"htmx/internal/dev"
+	"htmx/internal/errorreport"
+	"htmx/internal/handlers"
+	"htmx/internal/jobs"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/templates"
+	"htmx/static"
+	"io"
+)
+
+// App is the application wired up over its stores, ready to serve Router
+type App struct {
+	Config    *config.Config
+	Stores    *Stores
+	Handler   *handlers.Handler
+	Router    *gin.Engine
+	Templates *dev.Templates
+}
+
+// Options changes how New wires the application up; the zero value is fine
+type Options struct {
+	// Reporter receives panics and server errors, none when nil
+	Reporter *errorreport.Reporter
+	// AccessLog is where every request is logged, none when nil
+	AccessLog io.Writer
+	// Middleware runs ahead of the routes, after the standard middleware
+	Middleware []gin.HandlerFunc
+}
+
+// New builds the handler over the stores, fingerprints the static files
+// outside dev mode, loads the templates and sets the routes up, leaving the
+// hub and the background work to Start
+func New(cfg *config.Config, st *Stores, opts Options) (*App, error) {
+	handler := handlers.NewHandler(cfg, st.Rooms, st.Chats, st.Audit, st.Admins, st.Webhooks, st.Bots, st.Shortcuts, st.Notifications, st.Emoji, st.Bans, st.Moderation, st.Filters, st.IPBans, st.Announcements, st.Quotas, st.Settings)
+	if st.DB != nil {
+		handler.Database = st.DB
+	}
+
+	// Fingerprint the embedded static files; dev mode serves them from disk
+	if !cfg.Dev {
+		manifest, err := assets.New(static.FS)
+		if err != nil {
+			return nil, fmt.Errorf("fingerprinting static files: %w", err)
+		}
+		handler.Assets = manifest
+	}
+
+	router, err := NewRouter(cfg.Server, opts.Reporter, opts.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load all templates in one go, timing every render
+	renderer, err := dev.NewTemplates(func() (*template.Template, error) {
+		return templates.Load(cfg, handler.Assets)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading templates: %w", err)
+	}
+	router.HTMLRender = metrics.InstrumentHTML(renderer)
+
+	router.Use(opts.Middleware...)
+	handler.SetupRoutes(router)
+
+	return &App{Config: cfg, Stores: st, Handler: handler, Router: router, Templates: renderer}, nil
+}
+
+// Start starts the WebSocket hub and its overload monitor, webhook delivery,
+// the announcement schedule and the background jobs, with the backups when
+// they have a directory, and the simulated people of demo mode, all running
+// until ctx is done
+func (a *App) Start(ctx context.Context) error {
+	cfg, h := a.Config, a.Handler
+	if b := cfg.Jobs.Backup; b.Dir != "" && b.Schedule != "" {
+		schedule, err := jobs.Parse(b.Schedule)
+		if err != nil {
+			return fmt.Errorf("jobs.backup.schedule: %w", err)
+		}
+		h.Jobs.Add("backup", b.Schedule, schedule, Backup(b, a.Stores.Rooms, a.Stores.Chats))
+	}
+
+	h.StartHub()
+	h.StartOverloadMonitor(ctx)
+	h.StartWebhooks(ctx)
+	h.StartAnnouncements(ctx)
+	h.StartJobs(ctx)
+	if cfg.Demo.Enabled {
+		h.StartDemo(ctx)
+	}
+	return nil
+}
+
+// NewRouter creates a Gin engine with request IDs, request logging to
+// accessLog when it is not nil, panic recovery and error reporting. Client
+// addresses are read from forwarding headers only when sent by one of the
+// trusted proxies of cfg
+func NewRouter(cfg config.ServerConfig, reporter *errorreport.Reporter, accessLog io.Writer) (*gin.Engine, error) {
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("server.trusted_proxies: %w", err)
+	}
+	router.Use(middleware.RequestID())
+	if accessLog != nil {
+		router.Use(gin.LoggerWithWriter(accessLog))
+	}
+	router.Use(middleware.Recovery(reporter), middleware.ReportErrors(reporter))
+	return router, nil
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// backupPattern matches the snapshots written by Backup, which sort by time
+const backupPattern = "snapshot-*.json.gz"
+
+// Backup returns the backup job, which writes a gzipped snapshot of every
+// room and message, in the format of the export command, into the backup
+// directory, then deletes the oldest snapshots beyond jobs.backup.keep. The
+// snapshot is written to a temporary file first, so an interrupted backup
+// leaves no partial snapshot
+func Backup(cfg config.BackupJobConfig, rooms models.RoomRepository, chats models.ChatRepository) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return err
+		}
+		name := filepath.Join(cfg.Dir, "snapshot-"+time.Now().UTC().Format("20060102T150405Z")+".json.gz")
+		f, err := os.CreateTemp(cfg.Dir, ".snapshot-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		zw := gzip.NewWriter(f)
+		err = WriteExport(zw, rooms, chats)
+		if err == nil {
+			err = zw.Close()
+		}
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), name)
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		slog.Info("backup written", "file", name)
+
+		if cfg.Keep > 0 {
+			snapshots, _ := filepath.Glob(filepath.Join(cfg.Dir, backupPattern))
+			slices.Sort(snapshots)
+			for _, old := range snapshots[:max(0, len(snapshots)-cfg.Keep)] {
+				if err := os.Remove(old); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
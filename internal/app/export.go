@@ -0,0 +1,98 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"htmx/internal/models"
+	"io"
+)
+
+// WriteExport writes the export document, {"rooms": [...], "chats": [...]},
+// one record at a time as it walks the stores, so exporting a large store
+// does not hold a copy of every message and the whole document in memory.
+// The messages are grouped by room, oldest first
+func WriteExport(w io.Writer, rooms models.RoomRepository, chats models.ChatRepository) error {
+	bw := bufio.NewWriter(w)
+	ew := &exportWriter{w: bw}
+	ew.begin("rooms")
+	rooms.ForEachRoom(func(room *models.Room) bool {
+		return ew.record(room)
+	})
+	ew.begin("chats")
+	rooms.ForEachRoom(func(room *models.Room) bool {
+		chats.ForEachChatInRoom(room.ID, func(chat *models.Chat) bool {
+			return ew.record(chat)
+		})
+		return ew.err == nil
+	})
+	ew.end()
+	if ew.err != nil {
+		return ew.err
+	}
+	return bw.Flush()
+}
+
+// exportWriter writes the arrays of the export document, indented as
+// json.Encoder with SetIndent("", "  ") would, remembering the first error
+type exportWriter struct {
+	w       *bufio.Writer
+	records int
+	arrays  int
+	err     error
+}
+
+// begin ends the current array, if any, and starts the named one
+func (ew *exportWriter) begin(name string) {
+	if ew.arrays == 0 {
+		ew.write("{\n")
+	} else {
+		ew.closeArray()
+		ew.write(",\n")
+	}
+	ew.arrays++
+	ew.records = 0
+	ew.write(`  "` + name + `": [`)
+}
+
+// record writes a record of the current array, and returns false once
+// writing failed
+func (ew *exportWriter) record(v any) bool {
+	if ew.err != nil {
+		return false
+	}
+	data, err := json.MarshalIndent(v, "    ", "  ")
+	if err != nil {
+		ew.err = err
+		return false
+	}
+	if ew.records > 0 {
+		ew.write(",")
+	}
+	ew.records++
+	ew.write("\n    ")
+	if ew.err == nil {
+		_, ew.err = ew.w.Write(data)
+	}
+	return ew.err == nil
+}
+
+// end ends the last array and the document
+func (ew *exportWriter) end() {
+	ew.closeArray()
+	ew.write("\n}\n")
+}
+
+// closeArray ends the current array, on its own line unless it is empty
+func (ew *exportWriter) closeArray() {
+	if ew.records > 0 {
+		ew.write("\n  ")
+	}
+	ew.write("]")
+}
+
+// write writes text, unless writing already failed
+func (ew *exportWriter) write(text string) {
+	if ew.err == nil {
+		_, ew.err = ew.w.WriteString(text)
+	}
+}
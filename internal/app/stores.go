@@ -0,0 +1,110 @@
+// Package app wires the application up from its configuration: it opens the
+// stores of the configured backend, builds the handler, templates and routes,
+// and starts the hub and the background work. The serve command and the
+// end-to-end tests of testutil start the application through it.
+package app
+
+import (
+	"fmt"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"htmx/internal/models/sqlite"
+)
+
+// Stores holds every data store used by the application
+type Stores struct {
+	Rooms         models.RoomRepository
+	Chats         models.ChatRepository
+	Audit         *models.AuditStore
+	Admins        *models.AdminStore
+	Webhooks      *models.WebhookStore
+	Bots          *models.BotStore
+	Shortcuts     *models.ShortcutStore
+	Notifications *models.NotificationStore
+	Emoji         *models.EmojiStore
+	Bans          *models.BanStore
+	Moderation    *models.ModerationQueue
+	Filters       *models.FilterRuleStore
+	IPBans        *models.IPBanStore
+	Announcements *models.AnnouncementStore
+	Quotas        *models.QuotaStore
+	Settings      *models.SettingsStore
+	// DB is the database of the sqlite backend, nil for the memory one
+	DB *sqlite.DB
+}
+
+// NewStores creates the stores around the rooms and messages of a backend,
+// with the others empty and in memory and the settings taken from cfg
+func NewStores(cfg *config.Config, rooms models.RoomRepository, chats models.ChatRepository) *Stores {
+	return &Stores{
+		Rooms:         rooms,
+		Chats:         chats,
+		Audit:         models.NewAuditStore(),
+		Admins:        models.NewAdminStore(),
+		Webhooks:      models.NewWebhookStore(),
+		Bots:          models.NewBotStore(),
+		Shortcuts:     models.NewShortcutStore(),
+		Notifications: models.NewNotificationStore(),
+		Emoji:         models.NewEmojiStore(),
+		Bans:          models.NewBanStore(),
+		Moderation:    models.NewModerationQueue(),
+		Filters:       models.NewFilterRuleStore(),
+		IPBans:        models.NewIPBanStore(),
+		Announcements: models.NewAnnouncementStore(),
+		Quotas:        models.NewQuotaStore(),
+		Settings: models.NewSettingsStore(models.Settings{
+			MessageRetentionDays: cfg.Retention.MessageDays,
+			AuditRetentionDays:   cfg.Retention.AuditDays,
+		}),
+	}
+}
+
+// OpenStores opens the data stores for the configured backend. The backend
+// keeps the rooms and messages, and the sqlite one the admin accounts made
+// by create-admin; the other stores are in memory
+func OpenStores(cfg *config.Config) (*Stores, error) {
+	switch cfg.Store.Backend {
+	case "memory":
+		chats := models.NewChatStore()
+		if cfg.Store.MemoryBudget > 0 {
+			archive, err := models.NewFileArchive(cfg.Store.ArchiveDir)
+			if err != nil {
+				return nil, fmt.Errorf("opening chat archive: %w", err)
+			}
+			chats.SetMemoryBudget(int64(cfg.Store.MemoryBudget), archive)
+		}
+		return NewStores(cfg, models.NewRoomStore(), chats), nil
+	case "sqlite":
+		db, err := sqlite.Open(cfg.Store.Path)
+		if err != nil {
+			return nil, fmt.Errorf("opening database: %w", err)
+		}
+		admins, err := db.Admins()
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		st := NewStores(cfg, db.Rooms(), db.Chats())
+		for _, admin := range admins {
+			st.Admins.AddAdmin(admin)
+		}
+		st.DB = db
+		return st, nil
+	default:
+		return nil, fmt.Errorf("unsupported store backend %q", cfg.Store.Backend)
+	}
+}
+
+// Close closes the database of the backend, if it has one
+func (st *Stores) Close() error {
+	if st.DB == nil {
+		return nil
+	}
+	return st.DB.Close()
+}
+
+// Persistent reports whether the configured backend keeps the rooms and
+// messages between runs
+func Persistent(cfg *config.Config) bool {
+	return cfg.Store.Backend != "memory"
+}
@@ -0,0 +1,97 @@
+// Package assets fingerprints the static files: each is served under
+// /static/<hash>/<name>, where the hash is taken from its content at
+// startup, so browsers can keep it forever and a new build changes its URL.
+// Templates get the URLs through the asset template function.
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Prefix is the path the static files are served under
+const Prefix = "/static/"
+
+// hashLength is the number of hex digits of a fingerprint
+const hashLength = 16
+
+// immutable is the Cache-Control of fingerprinted files: a year, the
+// longest caches honour, without revalidation
+const immutable = "public, max-age=31536000, immutable"
+
+// Manifest holds the fingerprints of the static files
+type Manifest struct {
+	hashes map[string]string
+	files  http.Handler
+}
+
+// New fingerprints every file of fsys
+func New(fsys fs.FS) (*Manifest, error) {
+	m := &Manifest{hashes: make(map[string]string), files: http.FileServer(http.FS(fsys))}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		m.hashes[name] = hex.EncodeToString(sum[:])[:hashLength]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// URL returns the URL of a static file, such as "css/output.css". Without
+// a manifest, as in dev mode where the files change, and for unknown
+// files, it is the plain /static/<name> URL
+func (m *Manifest) URL(name string) string {
+	if m != nil {
+		if hash, ok := m.hashes[name]; ok {
+			return Prefix + hash + "/" + name
+		}
+	}
+	return Prefix + name
+}
+
+// Rewrite replaces the quoted plain URLs of the static files in a script,
+// such as the list of files a service worker precaches, with their
+// fingerprinted URLs
+func (m *Manifest) Rewrite(script []byte) []byte {
+	for name := range m.hashes {
+		script = bytes.ReplaceAll(script, []byte(`"`+Prefix+name+`"`), []byte(`"`+m.URL(name)+`"`))
+	}
+	return script
+}
+
+// ServeHTTP serves the static files. Fingerprinted URLs are cached for good;
+// those of another build, requested by pages loaded before a deploy, get the
+// current file without caching it. Plain URLs are served as before, and
+// directories are not listed
+func (m *Manifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, Prefix)
+	if hash, name, ok := strings.Cut(path, "/"); ok && len(hash) == hashLength && m.hashes[name] != "" {
+		if hash == m.hashes[name] {
+			w.Header().Set("Cache-Control", immutable)
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		path = name
+	}
+	if m.hashes[path] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + path
+	m.files.ServeHTTP(w, r2)
+}
@@ -0,0 +1,62 @@
+// Package avatars builds the avatars shown next to usernames: the image a
+// message was posted with, or else a badge of the name's initials in a color
+// derived from the name, so that a name looks the same on every page
+package avatars
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Avatar is what partials/avatar.html renders for a name
+type Avatar struct {
+	Name string
+	// URL is the image of the avatar; empty for an initials badge
+	URL      string
+	Initials string
+	// Color holds the classes of the badge background and text
+	Color string
+}
+
+// colors are the badge colors names are spread over. The partial lists them
+// too, for Tailwind to keep the classes
+var colors = []string{
+	"bg-primary text-primary-content",
+	"bg-secondary text-secondary-content",
+	"bg-accent text-accent-content",
+	"bg-info text-info-content",
+	"bg-success text-success-content",
+	"bg-warning text-warning-content",
+	"bg-error text-error-content",
+}
+
+// unknown is the color of the badge of an empty name
+const unknown = "bg-neutral text-neutral-content"
+
+// For returns the avatar of a name, the image at url when there is one
+func For(name, url string) Avatar {
+	avatar := Avatar{Name: name, URL: url, Initials: Initials(name), Color: unknown}
+	if strings.TrimSpace(name) != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(strings.ToLower(strings.TrimSpace(name))))
+		avatar.Color = colors[hash.Sum32()%uint32(len(colors))]
+	}
+	return avatar
+}
+
+// Initials returns the first letters of the first and last words of a name,
+// such as "AL" for "ada lovelace" or "ada.lovelace", or "?" for an empty name
+func Initials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	switch len(words) {
+	case 0:
+		return "?"
+	case 1:
+		return strings.ToUpper(string([]rune(words[0])[:1]))
+	default:
+		return strings.ToUpper(string([]rune(words[0])[:1]) + string([]rune(words[len(words)-1])[:1]))
+	}
+}
@@ -0,0 +1,180 @@
+// Package bots delivers new messages to bots and posts their replies.
+//
+// Bots are either registered by admins with a callback URL, or implemented in
+// Go and registered in-process with Dispatcher.Register.
+package bots
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"htmx/internal/models"
+	"htmx/internal/webhooks"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a callback body keyed with the bot's API key
+const SignatureHeader = "X-Bot-Signature"
+
+// maxReplySize bounds the callback response read for a reply
+const maxReplySize = 64 << 10
+
+// Message is a chat message delivered to a bot
+type Message struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"room_id"`
+	Username  string    `json:"username"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Reply is what a bot answers with; an empty Text posts nothing
+type Reply struct {
+	Text string `json:"text"`
+}
+
+// Bot is implemented by in-process bots
+type Bot interface {
+	// Name is the username of the bot's replies
+	Name() string
+	// OnMessage is called for every message posted by a person in the bot's rooms
+	OnMessage(ctx context.Context, msg Message) (Reply, error)
+}
+
+// PostFunc posts a bot message into a room
+type PostFunc func(roomID, username, text string)
+
+// callback is the JSON body sent to a bot's callback URL
+type callback struct {
+	Event string  `json:"event"`
+	BotID string  `json:"bot_id"`
+	Data  Message `json:"data"`
+}
+
+// registered is an in-process bot and its rooms
+type registered struct {
+	bot   Bot
+	rooms []string
+}
+
+// Dispatcher fans new messages out to the subscribed bots
+type Dispatcher struct {
+	store   *models.BotStore
+	client  *http.Client
+	timeout time.Duration
+	post    PostFunc
+	builtin []registered
+}
+
+// NewDispatcher creates a dispatcher for the bots in the store, posting their
+// replies with post
+func NewDispatcher(store *models.BotStore, timeout time.Duration, post PostFunc) *Dispatcher {
+	return &Dispatcher{
+		store:   store,
+		client:  &http.Client{Timeout: timeout},
+		timeout: timeout,
+		post:    post,
+	}
+}
+
+// Register adds an in-process bot for the given rooms, or every room when none
+// are given. It must be called before the server starts
+func (d *Dispatcher) Register(bot Bot, rooms ...string) {
+	d.builtin = append(d.builtin, registered{bot: bot, rooms: rooms})
+}
+
+// Notify delivers a message to every subscribed bot in the background.
+// Messages posted by bots are not delivered, so bots cannot loop
+func (d *Dispatcher) Notify(chat *models.Chat) {
+	if chat.Bot {
+		return
+	}
+
+	msg := Message{
+		ID:        chat.ID,
+		RoomID:    chat.RoomID,
+		Username:  chat.Username,
+		Text:      chat.Message,
+		CreatedAt: chat.CreatedAt,
+	}
+
+	for _, r := range d.builtin {
+		if len(r.rooms) == 0 || slices.Contains(r.rooms, msg.RoomID) {
+			go d.callBuiltin(r.bot, msg)
+		}
+	}
+	for _, bot := range d.store.GetBots() {
+		if bot.CallbackURL != "" && bot.Subscribed(msg.RoomID) {
+			go d.callRemote(bot, msg)
+		}
+	}
+}
+
+// callBuiltin passes the message to an in-process bot and posts its reply
+func (d *Dispatcher) callBuiltin(bot Bot, msg Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	reply, err := bot.OnMessage(ctx, msg)
+	if err != nil {
+		slog.Warn("bot failed to handle message", "bot", bot.Name(), "room", msg.RoomID, "error", err)
+		return
+	}
+	if reply.Text != "" {
+		d.post(msg.RoomID, bot.Name(), reply.Text)
+	}
+}
+
+// callRemote posts the message to a bot's callback URL and posts the reply in
+// its response, if any
+func (d *Dispatcher) callRemote(bot *models.Bot, msg Message) {
+	reply, err := d.request(bot, msg)
+	if err != nil {
+		slog.Warn("bot callback failed", "bot", bot.Name, "room", msg.RoomID, "error", err)
+		return
+	}
+	if reply.Text != "" {
+		d.post(msg.RoomID, bot.Name, reply.Text)
+	}
+}
+
+// request sends the signed callback and decodes the reply
+func (d *Dispatcher) request(bot *models.Bot, msg Message) (Reply, error) {
+	body, err := json.Marshal(callback{Event: models.EventChatCreated, BotID: bot.ID, Data: msg})
+	if err != nil {
+		return Reply{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, bot.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return Reply{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "htmx-chat-bots")
+	req.Header.Set(SignatureHeader, "sha256="+webhooks.Sign(bot.APIKey, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return Reply{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Reply{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var reply Reply
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReplySize))
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return Reply{}, err
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return Reply{}, fmt.Errorf("decoding reply: %w", err)
+	}
+	return reply, nil
+}
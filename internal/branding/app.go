@@ -0,0 +1,147 @@
+package branding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"htmx/internal/config"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// DefaultColor is the theme color of the installed app when no primary
+// color is configured
+const DefaultColor = "#4f46e5"
+
+// IconSizes are the sizes, in pixels, of the app icons listed in the manifest
+var IconSizes = []int{192, 512}
+
+// ThemeColor returns the color browsers tint the installed app with
+func ThemeColor(cfg config.BrandingConfig) string {
+	if _, _, _, err := parseHex(cfg.PrimaryColor); err == nil {
+		return cfg.PrimaryColor
+	}
+	return DefaultColor
+}
+
+// manifestIcon is an icon of a web app manifest
+type manifestIcon struct {
+	Src     string `json:"src"`
+	Sizes   string `json:"sizes"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// Manifest returns the web app manifest that lets browsers install the chat
+// as an app, named and colored after the branding
+func Manifest(cfg config.BrandingConfig) []byte {
+	var icons []manifestIcon
+	for _, size := range IconSizes {
+		icons = append(icons, manifestIcon{Src: fmt.Sprintf("/icons/icon-%d.png", size), Sizes: fmt.Sprintf("%dx%d", size, size), Type: "image/png"})
+	}
+	for _, size := range IconSizes {
+		icons = append(icons, manifestIcon{Src: fmt.Sprintf("/icons/maskable-%d.png", size), Sizes: fmt.Sprintf("%dx%d", size, size), Type: "image/png", Purpose: "maskable"})
+	}
+
+	data, _ := json.MarshalIndent(map[string]any{
+		"name":             cfg.Name,
+		"short_name":       cfg.Name,
+		"start_url":        "/",
+		"scope":            "/",
+		"display":          "standalone",
+		"theme_color":      ThemeColor(cfg),
+		"background_color": ThemeColor(cfg),
+		"icons":            icons,
+	}, "", "  ")
+	return data
+}
+
+// Icon draws the app icon as a PNG of size pixels: a white chat bubble on
+// the theme color. Maskable icons fill the square and keep the bubble in the
+// center safe zone, for platforms that crop icons to their own shape
+func Icon(cfg config.BrandingConfig, size int, maskable bool) []byte {
+	r, g, b, _ := parseHex(ThemeColor(cfg))
+	background := color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	// The bubble is drawn in unit coordinates, scaled into the safe zone of
+	// maskable icons
+	scale := 1.0
+	if maskable {
+		scale = 0.8
+	}
+	inBubble := func(x, y float64) bool {
+		x, y = (x-0.5)/scale+0.5, (y-0.5)/scale+0.5
+		dx, dy := (x-0.5)/0.32, (y-0.46)/0.25
+		return dx*dx+dy*dy <= 1 || inTriangle(x, y, 0.3, 0.6, 0.24, 0.8, 0.46, 0.68)
+	}
+	inDot := func(x, y float64) bool {
+		x, y = (x-0.5)/scale+0.5, (y-0.5)/scale+0.5
+		for _, cx := range []float64{0.37, 0.5, 0.63} {
+			if dx, dy := x-cx, y-0.46; dx*dx+dy*dy <= 0.045*0.045 {
+				return true
+			}
+		}
+		return false
+	}
+	inBackground := func(x, y float64) bool {
+		return maskable || inRoundedSquare(x, y, 0.22)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	// Each pixel blends 4x4 samples, to smooth the edges
+	const samples = 4
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			var sr, sg, sb, sa float64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					x := (float64(px) + (float64(sx)+0.5)/samples) / float64(size)
+					y := (float64(py) + (float64(sy)+0.5)/samples) / float64(size)
+					var c color.RGBA
+					switch {
+					case !inBackground(x, y):
+						continue
+					case inBubble(x, y) && !inDot(x, y):
+						c = white
+					default:
+						c = background
+					}
+					sr, sg, sb, sa = sr+float64(c.R), sg+float64(c.G), sb+float64(c.B), sa+1
+				}
+			}
+			if sa == 0 {
+				continue
+			}
+			// Premultiplied by the coverage of the samples
+			n := float64(samples * samples)
+			img.SetRGBA(px, py, color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), uint8(255 * sa / n)})
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// inRoundedSquare reports whether a point of the unit square lies inside it
+// once its corners are rounded with the radius
+func inRoundedSquare(x, y, radius float64) bool {
+	cx := min(max(x, radius), 1-radius)
+	cy := min(max(y, radius), 1-radius)
+	dx, dy := x-cx, y-cy
+	return dx*dx+dy*dy <= radius*radius
+}
+
+// inTriangle reports whether the point (x, y) lies inside the triangle of
+// the three other points
+func inTriangle(x, y, ax, ay, bx, by, cx, cy float64) bool {
+	side := func(px, py, qx, qy float64) float64 {
+		return (x-qx)*(py-qy) - (px-qx)*(y-qy)
+	}
+	d1, d2, d3 := side(ax, ay, bx, by), side(bx, by, cx, cy), side(cx, cy, ax, ay)
+	negative := d1 < 0 || d2 < 0 || d3 < 0
+	positive := d1 > 0 || d2 > 0 || d3 > 0
+	return !(negative && positive)
+}
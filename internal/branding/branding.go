@@ -0,0 +1,119 @@
+// Package branding renders the configured branding of an instance into a
+// stylesheet of CSS variables, loaded by every layout after the theme
+// stylesheet so it overrides the colors and font of all DaisyUI themes, and
+// into the manifest and icons of the installable app.
+package branding
+
+import (
+	"bytes"
+	"fmt"
+	"htmx/internal/config"
+	"math"
+	"strconv"
+)
+
+// CSS returns the stylesheet for the branding; it is empty apart from a
+// comment when nothing is customized
+func CSS(cfg config.BrandingConfig) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("/* Generated from the branding configuration */\n")
+
+	colors := []struct {
+		name, base, content, value string
+	}{
+		{"primary", "--p", "--pc", cfg.PrimaryColor},
+		{"secondary", "--s", "--sc", cfg.SecondaryColor},
+		{"accent", "--a", "--ac", cfg.AccentColor},
+	}
+
+	var brand, themes bytes.Buffer
+	for _, color := range colors {
+		if color.value == "" {
+			continue
+		}
+		l, c, h, err := oklch(color.value)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&brand, "  --brand-%s: %s;\n", color.name, color.value)
+		// DaisyUI themes hold colors as OKLCH components
+		fmt.Fprintf(&themes, "  %s: %s;\n  %s: %s;\n", color.base, components(l, c, h), color.content, components(contentLightness(l), c*0.2, h))
+	}
+	if cfg.Font != "" {
+		fmt.Fprintf(&brand, "  --brand-font: %s;\n", cfg.Font)
+	}
+
+	if brand.Len() > 0 {
+		fmt.Fprintf(&buf, ":root {\n%s}\n", brand.String())
+	}
+	if themes.Len() > 0 {
+		fmt.Fprintf(&buf, ":root, [data-theme] {\n%s}\n", themes.String())
+	}
+	if cfg.Font != "" {
+		buf.WriteString("body {\n  font-family: var(--brand-font);\n}\n")
+	}
+	return buf.Bytes()
+}
+
+// components formats an OKLCH color the way DaisyUI variables hold it
+func components(l, c, h float64) string {
+	return fmt.Sprintf("%.2f%% %.4f %.2f", l*100, c, h)
+}
+
+// contentLightness returns the lightness of text shown on a color: dark on
+// light colors and light on dark ones
+func contentLightness(l float64) float64 {
+	if l > 0.6 {
+		return l * 0.2
+	}
+	return l + (1-l)*0.8
+}
+
+// oklch converts a hex color such as "#4f46e5" or "#fff" to OKLCH
+func oklch(hex string) (l, c, h float64, err error) {
+	r, g, b, err := parseHex(hex)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	r, g, b = linear(r), linear(g), linear(b)
+
+	// Linear sRGB to OKLab, from https://bottosson.github.io/posts/oklab/
+	lms := [3]float64{
+		math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b),
+		math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b),
+		math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b),
+	}
+	l = 0.2104542553*lms[0] + 0.7936177850*lms[1] - 0.0040720468*lms[2]
+	a := 1.9779984951*lms[0] - 2.4285922050*lms[1] + 0.4505937099*lms[2]
+	bb := 0.0259040371*lms[0] + 0.7827717662*lms[1] - 0.8086757660*lms[2]
+
+	c = math.Hypot(a, bb)
+	h = math.Atan2(bb, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return l, c, h, nil
+}
+
+// parseHex reads the channels of a hex color, between 0 and 1
+func parseHex(hex string) (r, g, b float64, err error) {
+	if len(hex) == 4 && hex[0] == '#' {
+		hex = string([]byte{'#', hex[1], hex[1], hex[2], hex[2], hex[3], hex[3]})
+	}
+	if len(hex) != 7 || hex[0] != '#' {
+		return 0, 0, 0, fmt.Errorf("%q is not a hex color", hex)
+	}
+	v, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("%q is not a hex color", hex)
+	}
+	return float64(v>>16&0xff) / 255, float64(v>>8&0xff) / 255, float64(v&0xff) / 255, nil
+}
+
+// linear converts a gamma-encoded sRGB channel to linear light
+func linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
@@ -0,0 +1,35 @@
+// Package bufpool reuses the byte buffers that templates and hub messages
+// are rendered into before they are written out, so busy renders and
+// broadcasts do not allocate and grow a new buffer every time.
+package bufpool
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxSize is the capacity above which buffers are dropped instead of
+// pooled, so a rare large render does not stay in memory
+const maxSize = 64 << 10
+
+var pool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// Get returns an empty buffer from the pool
+func Get() *bytes.Buffer {
+	buf := pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// Put returns a buffer to the pool. The buffer, and any slice of its
+// bytes, must not be used afterwards
+func Put(buf *bytes.Buffer) {
+	if buf.Cap() > maxSize {
+		return
+	}
+	pool.Put(buf)
+}
@@ -0,0 +1,50 @@
+package bufpool
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestPutDropsLargeBuffers(t *testing.T) {
+	buf := Get()
+	buf.Grow(2 * maxSize)
+	Put(buf)
+	if got := Get(); got == buf {
+		t.Error("a buffer over maxSize was pooled")
+	}
+	if got := Get(); got.Len() != 0 {
+		t.Errorf("Get returned a buffer holding %d bytes", got.Len())
+	}
+}
+
+// BenchmarkRender renders a fragment of a few KiB, as the messages list of a
+// busy room, into a new buffer as before the pool and into a pooled one
+func BenchmarkRender(b *testing.B) {
+	tmpl := template.Must(template.New("list").Parse(`{{ range . }}<article><p>{{ . }}</p></article>{{ end }}`))
+	messages := make([]string, 50)
+	for i := range messages {
+		messages[i] = strings.Repeat("message ", i%10+1)
+	}
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := new(bytes.Buffer)
+			if err := tmpl.Execute(buf, messages); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := Get()
+			if err := tmpl.Execute(buf, messages); err != nil {
+				b.Fatal(err)
+			}
+			Put(buf)
+		}
+	})
+}
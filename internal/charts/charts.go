@@ -0,0 +1,156 @@
+// Package charts lays out bar charts on the server, for templates to draw
+// as inline SVG without a charting library in the browser.
+package charts
+
+import (
+	"math"
+	"strconv"
+)
+
+// The viewBox of a chart and the margins around its plot, which hold the
+// axis labels
+const (
+	width        = 640
+	height       = 220
+	marginLeft   = 44
+	marginRight  = 8
+	marginTop    = 8
+	marginBottom = 24
+	// maxLabels is how many labels at most the time axis shows
+	maxLabels = 8
+	// ticks is how many steps the value axis is divided into
+	ticks = 4
+)
+
+// Series is a named set of values, one per label of the chart
+type Series struct {
+	Name   string
+	Values []int
+}
+
+// Chart is a bar chart laid out in a width by height viewBox; the bars of
+// several series are stacked, the first at the bottom
+type Chart struct {
+	Title  string
+	Width  float64
+	Height float64
+	// Left, Right, Top and Bottom bound the plot
+	Left, Right, Top, Bottom float64
+	Bars                     []Bar
+	Ticks                    []Tick
+	Labels                   []Label
+	Series                   []string
+	// Rows hold the values by label, for a table alongside the chart
+	Rows []Row
+}
+
+// Bar is one value drawn as a rectangle
+type Bar struct {
+	X, Y, W, H float64
+	// Series is the index of the series of the value, to color it by
+	Series int
+	Title  string
+}
+
+// Tick is a line of the value axis
+type Tick struct {
+	Y     float64
+	Value string
+}
+
+// Label is a label of the time axis, centered on X
+type Label struct {
+	X    float64
+	Text string
+}
+
+// Row is the values of every series at a label
+type Row struct {
+	Label  string
+	Values []int
+}
+
+// Stacked lays out a chart of the series over the labels
+func Stacked(title string, labels []string, series ...Series) Chart {
+	chart := Chart{
+		Title:  title,
+		Width:  width,
+		Height: height,
+		Left:   marginLeft,
+		Right:  width - marginRight,
+		Top:    marginTop,
+		Bottom: height - marginBottom,
+	}
+	for _, s := range series {
+		chart.Series = append(chart.Series, s.Name)
+	}
+
+	highest := 0
+	for i, label := range labels {
+		row := Row{Label: label}
+		total := 0
+		for _, s := range series {
+			row.Values = append(row.Values, s.Values[i])
+			total += s.Values[i]
+		}
+		chart.Rows = append(chart.Rows, row)
+		highest = max(highest, total)
+	}
+	top := niceCeil(highest)
+
+	plotHeight := chart.Bottom - chart.Top
+	for i := range ticks + 1 {
+		value := top * i / ticks
+		chart.Ticks = append(chart.Ticks, Tick{
+			Y:     chart.Bottom - plotHeight*float64(value)/float64(top),
+			Value: strconv.Itoa(value),
+		})
+	}
+	if len(labels) == 0 {
+		return chart
+	}
+
+	slot := (chart.Right - chart.Left) / float64(len(labels))
+	// Bars fill most of their slot, leaving a gap to the next
+	barWidth := slot * 0.8
+	every := (len(labels) + maxLabels - 1) / maxLabels
+	for i, row := range chart.Rows {
+		x := chart.Left + slot*float64(i) + (slot-barWidth)/2
+		if i%every == 0 {
+			chart.Labels = append(chart.Labels, Label{X: x + barWidth/2, Text: row.Label})
+		}
+		y := chart.Bottom
+		for j, value := range row.Values {
+			if value == 0 {
+				continue
+			}
+			h := plotHeight * float64(value) / float64(top)
+			y -= h
+			chart.Bars = append(chart.Bars, Bar{
+				X:      x,
+				Y:      y,
+				W:      barWidth,
+				H:      h,
+				Series: j,
+				Title:  row.Label + ": " + strconv.Itoa(value) + " " + series[j].Name,
+			})
+		}
+	}
+	return chart
+}
+
+// niceCeil returns the smallest of 1, 2 or 5 times a power of ten, times
+// the ticks, reaching n, so each tick is a round number
+func niceCeil(n int) int {
+	if n <= ticks {
+		return ticks
+	}
+	step := float64(n) / ticks
+	magnitude := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, factor := range []float64{1, 2, 5, 10} {
+		if factor*magnitude >= step {
+			return int(factor*magnitude) * ticks
+		}
+	}
+	return n
+}
@@ -0,0 +1,146 @@
+// Package clock tells the time to the code whose behaviour depends on it,
+// such as retention, schedules and rate limits, so tests can replace the
+// system clock with a fake one they move forward themselves.
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for it
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a timer firing once d has passed
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer sends the time on its channel once, unless stopped first
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, reporting false when it already
+	// fired or was stopped
+	Stop() bool
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// Fake is a clock that only moves when Advance is called, firing the timers
+// that come due on the way
+type Fake struct {
+	now    time.Time
+	timers []*fakeTimer
+	mutex  sync.Mutex
+	// changed is broadcast whenever a timer is added or removed, for
+	// BlockUntil
+	changed *sync.Cond
+}
+
+// NewFake creates a fake clock showing now
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed = sync.NewCond(&f.mutex)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	t := &fakeTimer{clock: f, at: f.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- f.now
+		return t
+	}
+	f.timers = append(f.timers, t)
+	f.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers due by then in
+// the order they come due, each with the time it was due
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	end := f.now.Add(d)
+	slices.SortStableFunc(f.timers, func(a, b *fakeTimer) int {
+		return a.at.Compare(b.at)
+	})
+	fired := 0
+	for _, t := range f.timers {
+		if t.at.After(end) {
+			break
+		}
+		f.now = t.at
+		t.c <- t.at
+		fired++
+	}
+	f.timers = f.timers[fired:]
+	f.now = end
+	if fired > 0 {
+		f.changed.Broadcast()
+	}
+}
+
+// BlockUntil waits until n timers are pending, such as a background loop
+// waiting for its next run, so a test advances the clock only once the
+// loop is waiting
+func (f *Fake) BlockUntil(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for len(f.timers) < n {
+		f.changed.Wait()
+	}
+}
+
+// fakeTimer is a timer of a fake clock
+type fakeTimer struct {
+	clock *Fake
+	at    time.Time
+	c     chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	f := t.clock
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := slices.Index(f.timers, t)
+	if i < 0 {
+		return false
+	}
+	f.timers = slices.Delete(f.timers, i, i+1)
+	f.changed.Broadcast()
+	return true
+}
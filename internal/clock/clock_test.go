@@ -0,0 +1,65 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestFakeAdvance(t *testing.T) {
+	f := NewFake(start)
+	later := f.NewTimer(2 * time.Second)
+	sooner := f.NewTimer(time.Second)
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Error("Stop of a pending timer reported false")
+	}
+
+	f.Advance(1500 * time.Millisecond)
+	if got := f.Now(); !got.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Errorf("Now = %s after advancing 1.5s", got)
+	}
+	select {
+	case at := <-sooner.C():
+		if !at.Equal(start.Add(time.Second)) {
+			t.Errorf("timer fired with %s, want the time it was due", at)
+		}
+	default:
+		t.Error("timer due within the advance did not fire")
+	}
+	select {
+	case <-later.C():
+		t.Error("timer fired before it was due")
+	case <-stopped.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case <-later.C():
+	default:
+		t.Error("timer did not fire once due")
+	}
+	if later.Stop() {
+		t.Error("Stop of a fired timer reported true")
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(start)
+	fired := make(chan time.Time)
+	go func() {
+		fired <- <-f.NewTimer(time.Minute).C()
+	}()
+
+	// Advancing once the loop waits cannot miss its timer
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("waiting timer did not fire")
+	}
+}
@@ -0,0 +1,131 @@
+// Package components lets optional modules, such as polls, reactions or
+// integrations, add to the pages without editing the core templates. A
+// module registers components, templates it defines, into the named slots
+// the core templates render; components behind a feature flag only render
+// for the visitors the flag is on for.
+package components
+
+import (
+	"fmt"
+	"html/template"
+	"htmx/internal/bufpool"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// Slot is a named place of the pages that renders the components
+// registered into it
+type Slot string
+
+// The slots of the core templates, each rendered with its own item
+const (
+	// MessageFooter is below each message; the item is the *models.Chat
+	MessageFooter Slot = "message-footer"
+	// RoomHeader is next to the name above the messages of a room; the item
+	// is the *models.Room
+	RoomHeader Slot = "room-header"
+	// RoomSection is beside the messages of a room, for sections such as the
+	// members list that load once revealed; the item is the *models.Room
+	RoomSection Slot = "room-section"
+	// SidebarSection is below the rooms list of the sidebar; there is no item
+	SidebarSection Slot = "sidebar-section"
+)
+
+// Component is a part of the pages rendered into a slot
+type Component struct {
+	// Name identifies the component within its slot
+	Name string
+	// Template is the name of the template rendered for the component. It
+	// gets the "locale" and "flags" of the page, the whole "page" data and
+	// the "item" of the slot
+	Template string
+	// Flag, when set, is the feature flag the component renders behind
+	Flag string
+	// Order sorts the components of a slot, lowest first, then by name
+	Order int
+}
+
+// Source is a set of template files a module defines its components in
+type Source struct {
+	FS       fs.FS
+	Patterns []string
+}
+
+var (
+	slots   = make(map[Slot][]Component)
+	sources []Source
+	mutex   sync.RWMutex
+)
+
+// Register adds a component to a slot. Modules register their components
+// at startup, before the templates are loaded; registering a name twice in
+// a slot panics
+func Register(slot Slot, component Component) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, registered := range slots[slot] {
+		if registered.Name == component.Name {
+			panic(fmt.Sprintf("components: %q registered twice in slot %q", component.Name, slot))
+		}
+	}
+	registered := append(slots[slot], component)
+	sort.SliceStable(registered, func(i, j int) bool {
+		if registered[i].Order != registered[j].Order {
+			return registered[i].Order < registered[j].Order
+		}
+		return registered[i].Name < registered[j].Name
+	})
+	slots[slot] = registered
+}
+
+// AddTemplates adds the template files of a module, parsed along with
+// the core templates
+func AddTemplates(fsys fs.FS, patterns ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	sources = append(sources, Source{FS: fsys, Patterns: patterns})
+}
+
+// Sources returns the template files added by modules
+func Sources() []Source {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return append([]Source(nil), sources...)
+}
+
+// Enabled returns the components of a slot that render for the flags of a
+// visitor, in order
+func Enabled(slot Slot, flags map[string]bool) []Component {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	var enabled []Component
+	for _, component := range slots[slot] {
+		if component.Flag == "" || flags[component.Flag] {
+			enabled = append(enabled, component)
+		}
+	}
+	return enabled
+}
+
+// Render renders the components of a slot enabled for the page, with the
+// item of the slot, from the template set
+func Render(tmpl *template.Template, slot Slot, page map[string]any, item any) (template.HTML, error) {
+	flags, _ := page["flags"].(map[string]bool)
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	for _, component := range Enabled(slot, flags) {
+		data := map[string]any{
+			"locale": page["locale"],
+			"flags":  flags,
+			"page":   page,
+			"item":   item,
+		}
+		if err := tmpl.ExecuteTemplate(buf, component.Template, data); err != nil {
+			return "", fmt.Errorf("component %q of slot %q: %w", component.Name, slot, err)
+		}
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,1095 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"htmx/internal/jobs"
+	"htmx/internal/logging"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds all runtime settings of the application
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Store     StoreConfig     `yaml:"store"`
+	WebSocket WebSocketConfig `yaml:"websocket"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Features  FeaturesConfig  `yaml:"features"`
+	Errors    ErrorsConfig    `yaml:"error_reporting"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	// Quotas cap what each user may do per day, week or month
+	Quotas QuotasConfig `yaml:"quotas"`
+	// Retention purges old messages and audit entries
+	Retention RetentionConfig `yaml:"retention"`
+	// Jobs schedules the background jobs
+	Jobs JobsConfig `yaml:"jobs"`
+	// Moderation holds flagged messages for review
+	Moderation ModerationConfig `yaml:"moderation"`
+	Webhooks   WebhooksConfig   `yaml:"webhooks"`
+	Bots       BotsConfig       `yaml:"bots"`
+	GRPC       GRPCConfig       `yaml:"grpc"`
+	IRC        IRCConfig        `yaml:"irc"`
+	Embed      EmbedConfig      `yaml:"embed"`
+	// Federation links rooms with other instances (experimental)
+	Federation FederationConfig `yaml:"federation"`
+	// Integrations configures receivers for third-party services
+	Integrations IntegrationsConfig `yaml:"integrations"`
+	// Branding customizes the name, logo, colors and font of the instance
+	Branding BrandingConfig `yaml:"branding"`
+	// Compression gzips responses for the browsers accepting it
+	Compression CompressionConfig `yaml:"compression"`
+	// LogLevel is one of debug, info, warn or error and can be changed at runtime
+	LogLevel string `yaml:"log_level"`
+	// Dev reloads templates and refreshes browsers when source files change
+	Dev bool `yaml:"dev"`
+	// Chaos injects latency, errors and disconnects in dev mode
+	Chaos ChaosConfig `yaml:"chaos"`
+	// Demo simulates people chatting, to show the instance off without real users
+	Demo DemoConfig `yaml:"demo"`
+	// Telemetry reports anonymous usage statistics, on unless turned off
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	// Addr is a TCP address such as ":8080" or a socket path such as "unix:///run/htmx.sock"
+	Addr string `yaml:"addr"`
+	// SocketMode sets the permissions of a Unix socket, in octal
+	SocketMode        string        `yaml:"socket_mode"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	TLS               TLSConfig     `yaml:"tls"`
+	// TrustedProxies lists the addresses or CIDR ranges of the reverse
+	// proxies whose X-Forwarded-For and X-Real-IP headers name the client.
+	// Empty trusts none, so clients cannot choose the address that bans,
+	// rate limits and quotas apply to
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// SocketPath returns the Unix socket path when Addr uses the unix:// scheme
+func (s ServerConfig) SocketPath() (string, bool) {
+	return strings.CutPrefix(s.Addr, "unix://")
+}
+
+// SocketFileMode returns the parsed SocketMode
+func (s ServerConfig) SocketFileMode() os.FileMode {
+	mode, _ := strconv.ParseUint(s.SocketMode, 8, 32)
+	return os.FileMode(mode)
+}
+
+// TLSConfig enables HTTPS, either from certificate files or via Let's Encrypt
+type TLSConfig struct {
+	CertFile string         `yaml:"cert_file"`
+	KeyFile  string         `yaml:"key_file"`
+	Autocert AutocertConfig `yaml:"autocert"`
+}
+
+// AutocertConfig obtains certificates from Let's Encrypt for the listed domains
+type AutocertConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Domains  []string `yaml:"domains"`
+	CacheDir string   `yaml:"cache_dir"`
+	Email    string   `yaml:"email"`
+	// HTTPAddr serves ACME HTTP challenges and redirects plain HTTP to HTTPS
+	HTTPAddr string `yaml:"http_addr"`
+}
+
+// Enabled reports whether the server terminates HTTPS itself
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.Autocert.Enabled
+}
+
+// StoreConfig selects the data store backend
+type StoreConfig struct {
+	// Backend is "memory", losing rooms and messages on restart, or
+	// "sqlite", keeping them in the database at Path
+	Backend string `yaml:"backend"`
+	// Path is the SQLite database file, created if missing
+	Path string `yaml:"path"`
+	// MemoryBudget caps the memory used by messages, in bytes; over it the
+	// oldest messages of the least recently viewed rooms move to the archive.
+	// 0 keeps every message in memory
+	MemoryBudget int `yaml:"memory_budget"`
+	// ArchiveDir is the directory evicted messages are written to, needed
+	// with a memory budget
+	ArchiveDir string `yaml:"archive_dir"`
+}
+
+// WebSocketConfig holds the WebSocket and hub settings
+type WebSocketConfig struct {
+	// AllowedOrigins lists the origins allowed to open a WebSocket; empty means
+	// same-origin only and "*" allows any origin
+	AllowedOrigins  []string `yaml:"allowed_origins"`
+	ReadBufferSize  int      `yaml:"read_buffer_size"`
+	WriteBufferSize int      `yaml:"write_buffer_size"`
+	// FlushInterval is how long the hub collects the new messages of a room
+	// before writing them to each client at once; 0 writes every message
+	// as it comes
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// BroadcastQueue is how many events wait for the hub loop before
+	// broadcasting blocks the handlers
+	BroadcastQueue int            `yaml:"broadcast_queue"`
+	Overload       OverloadConfig `yaml:"overload"`
+}
+
+// OverloadConfig sets when the hub counts as overloaded, which warns
+// operators and tells clients that live updates are degraded
+type OverloadConfig struct {
+	// Interval is how often the hub is checked, over the events since
+	Interval time.Duration `yaml:"interval"`
+	// QueueDepth is the depth of the broadcast queue, reached within an
+	// interval, at which the hub is overloaded; 0 disables the check
+	QueueDepth int `yaml:"queue_depth"`
+	// DropPercent is the share of the writes to clients and subscribers
+	// failed or skipped within an interval, in percent, at which the hub
+	// is overloaded; 0 disables the check
+	DropPercent int `yaml:"drop_percent"`
+}
+
+// CompressionConfig controls the gzip compression of responses
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Level is the gzip level, from 1 (fastest) to 9 (smallest)
+	Level int `yaml:"level"`
+	// MinSizes maps the content types compressed, such as "text/html", to
+	// the size in bytes below which their responses are sent as they are;
+	// other types are never compressed
+	MinSizes map[string]int `yaml:"min_sizes"`
+	// CacheEntries caps the responses kept compressed because they are served
+	// identically again and again, such as empty states; 0 keeps none
+	CacheEntries int `yaml:"cache_entries"`
+}
+
+// EmbedConfig controls embedding rooms into other websites
+type EmbedConfig struct {
+	// AllowedOrigins lists the sites allowed to frame the embeddable room view;
+	// empty means only this site and "*" allows any site
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// BrandingConfig customizes the look of the instance; empty colors and font
+// keep those of the picked theme
+type BrandingConfig struct {
+	// Name is shown in page headers and titles
+	Name string `yaml:"name"`
+	// LogoURL is an image shown next to the name, either an absolute http(s)
+	// URL or a path on this site
+	LogoURL string `yaml:"logo_url"`
+	// PrimaryColor, SecondaryColor and AccentColor are hex colors such as
+	// "#4f46e5" replacing those of every theme
+	PrimaryColor   string `yaml:"primary_color"`
+	SecondaryColor string `yaml:"secondary_color"`
+	AccentColor    string `yaml:"accent_color"`
+	// Font is a CSS font-family list such as "Inter, sans-serif"
+	Font string `yaml:"font"`
+}
+
+// LimitsConfig caps resource usage; a zero value disables that limit
+type LimitsConfig struct {
+	MaxRooms           int `yaml:"max_rooms"`
+	MaxMessagesPerRoom int `yaml:"max_messages_per_room"`
+	// MaxUploadSize caps request bodies, in bytes
+	MaxUploadSize int `yaml:"max_upload_size"`
+	MaxWSClients  int `yaml:"max_ws_clients"`
+}
+
+// QuotasConfig caps the usage of each user over calendar periods in the
+// server's time zone; a zero value disables that quota
+type QuotasConfig struct {
+	MessagesPerDay int `yaml:"messages_per_day"`
+	// RoomsPerWeek counts weeks from Monday
+	RoomsPerWeek int `yaml:"rooms_per_week"`
+	// UploadBytesPerMonth caps the bytes of the messages posted per month
+	UploadBytesPerMonth int `yaml:"upload_bytes_per_month"`
+}
+
+// RetentionConfig sets how long data is kept before it is purged. The
+// admin settings page changes the ages at runtime, starting from these; 0
+// keeps the data forever
+type RetentionConfig struct {
+	MessageDays int `yaml:"message_days"`
+	AuditDays   int `yaml:"audit_days"`
+	// Interval is how often the data past its age is purged
+	Interval time.Duration `yaml:"interval"`
+}
+
+// JobsConfig schedules the background jobs besides the purge of old data,
+// which runs every retention.interval. A schedule is "@every" and a
+// duration, a shorthand such as "@daily" or a cron expression of five
+// fields in the server's time zone; an empty schedule disables the job
+type JobsConfig struct {
+	Backup BackupJobConfig `yaml:"backup"`
+	// Analytics rolls up the charts the analytics page opens on
+	Analytics      string                  `yaml:"analytics"`
+	WebhookRetries WebhookRetriesJobConfig `yaml:"webhook_retries"`
+}
+
+// BackupJobConfig writes snapshots of the rooms and messages, in the format
+// of the export command, to a directory
+type BackupJobConfig struct {
+	Schedule string `yaml:"schedule"`
+	// Dir is where the snapshots are written; empty disables the backups
+	Dir string `yaml:"dir"`
+	// Keep is how many snapshots are kept, the oldest deleted first; 0
+	// keeps them all
+	Keep int `yaml:"keep"`
+}
+
+// WebhookRetriesJobConfig queues the dead-lettered webhook deliveries again
+type WebhookRetriesJobConfig struct {
+	Schedule string `yaml:"schedule"`
+	// MaxRetries is how many times a dead letter is queued again before it
+	// is left to the admins
+	MaxRetries int `yaml:"max_retries"`
+}
+
+// ModerationConfig sets the filters the messages people post go through;
+// the messages they flag are held in the moderation queue until reviewed
+type ModerationConfig struct {
+	// Words flags the messages containing any of these words, ignoring case
+	Words []string `yaml:"words"`
+	// MaxLinks flags the messages with more links; 0 allows any number
+	MaxLinks int `yaml:"max_links"`
+	// MaxRepeats flags a message posted under the same name more than this
+	// many times within RepeatWindow; 0 allows any number
+	MaxRepeats   int           `yaml:"max_repeats"`
+	RepeatWindow time.Duration `yaml:"repeat_window"`
+	// ReportsPerHour caps the messages a client may report per hour; 0
+	// allows any number
+	ReportsPerHour int `yaml:"reports_per_hour"`
+	// MessagesPerMinute caps the messages a client may post per minute; 0
+	// allows any number
+	MessagesPerMinute int `yaml:"messages_per_minute"`
+	// AutoBanViolations bans the address of a client refused by the limits
+	// above more than this many times within AutoBanWindow, for
+	// AutoBanDuration; 0 never bans automatically
+	AutoBanViolations int           `yaml:"auto_ban_violations"`
+	AutoBanWindow     time.Duration `yaml:"auto_ban_window"`
+	AutoBanDuration   time.Duration `yaml:"auto_ban_duration"`
+}
+
+// WebhooksConfig controls the delivery of outgoing webhooks
+type WebhooksConfig struct {
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is how often a delivery is tried before it is dead-lettered
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// ChaosConfig controls the faults injected in dev mode, to exercise how the
+// pages handle slow responses, failed requests and dropped connections
+type ChaosConfig struct {
+	// Routes are the paths faults are injected on, each matching the paths
+	// it is a prefix of by segment, with * matching any one segment; empty
+	// is every route
+	Routes []string `yaml:"routes"`
+	// Latency delays every response, by up to Jitter more
+	Latency time.Duration `yaml:"latency"`
+	Jitter  time.Duration `yaml:"jitter"`
+	// ErrorPercent is the share of requests failing with a 503
+	ErrorPercent int `yaml:"error_percent"`
+	// DisconnectAfter is the average time WebSocket connections stay open
+	// before they are cut; zero keeps them
+	DisconnectAfter time.Duration `yaml:"disconnect_after"`
+}
+
+// Enabled reports whether any fault is injected
+func (c ChaosConfig) Enabled() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.ErrorPercent > 0 || c.DisconnectAfter > 0
+}
+
+// DemoConfig controls the simulated people of demo mode
+type DemoConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Users is how many simulated people chat at the same time
+	Users int `yaml:"users"`
+	// Rooms is how many rooms they chat in, created when there are fewer
+	Rooms int `yaml:"rooms"`
+	// MessageInterval is the average time between the messages of each person
+	MessageInterval time.Duration `yaml:"message_interval"`
+	// JoinInterval is the average time each person stays in a room before
+	// moving to another one
+	JoinInterval time.Duration `yaml:"join_interval"`
+}
+
+// TelemetryConfig controls the anonymous usage statistics sent to help
+// prioritize development
+type TelemetryConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint receives the reports; empty uses the one the build was made
+	// with, and nothing is sent when there is none
+	Endpoint string `yaml:"endpoint"`
+	// Interval is the time between two reports
+	Interval time.Duration `yaml:"interval"`
+}
+
+// BotsConfig controls the delivery of messages to bots
+type BotsConfig struct {
+	// Timeout bounds each bot callback, including the reply
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// IntegrationsConfig configures receivers for third-party services
+type IntegrationsConfig struct {
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"`
+}
+
+// AlertmanagerConfig routes Prometheus Alertmanager notifications into a room
+type AlertmanagerConfig struct {
+	// Room is the ID or name of the room alerts are posted to, unless the
+	// receiver URL sets ?room=; a room given by name is created when missing
+	Room string `yaml:"room"`
+	// Token, when set, must be sent as "Authorization: Bearer <token>"
+	Token string `yaml:"token"`
+	// Username is shown as the author of alert messages
+	Username string `yaml:"username"`
+}
+
+// FederationConfig links shared rooms with peer instances
+type FederationConfig struct {
+	// Enabled turns on the federation endpoint and the relaying of messages
+	Enabled bool `yaml:"enabled"`
+	// Name identifies this instance to its peers and must be unique among them
+	Name  string       `yaml:"name"`
+	Peers []PeerConfig `yaml:"peers"`
+}
+
+// PeerConfig is an instance messages are exchanged with
+type PeerConfig struct {
+	// Name is the peer's federation.name
+	Name string `yaml:"name"`
+	// URL is the peer's base URL; events are POSTed to URL/federation/events
+	URL string `yaml:"url"`
+	// Secret is shared with the peer and signs the events sent both ways
+	Secret string `yaml:"secret"`
+	// Rooms lists the names of the rooms shared with the peer
+	Rooms []string `yaml:"rooms"`
+}
+
+// GRPCConfig holds the listener of the gRPC service for server-to-server clients
+type GRPCConfig struct {
+	// Addr is a TCP address or unix:// socket; the service is off when empty
+	Addr string `yaml:"addr"`
+	// Token must be sent by clients as "authorization: Bearer <token>"
+	// metadata; it is required when the service is on
+	Token string `yaml:"token"`
+}
+
+// IRCConfig holds the listener of the IRC gateway for terminal clients
+type IRCConfig struct {
+	// Addr is a TCP address or unix:// socket; the gateway is off when empty
+	Addr string `yaml:"addr"`
+	// Password, when set, must be sent by clients with PASS before registering
+	Password string `yaml:"password"`
+}
+
+// AdminConfig holds the listener and credentials for the admin pages
+type AdminConfig struct {
+	// Addr serves the admin pages, metrics and profiling on a separate listener
+	// (TCP address or unix:// socket) instead of the public one
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	// Password is generated at startup when left empty
+	Password string `yaml:"password"`
+}
+
+// FeaturesConfig holds the feature flag definitions
+type FeaturesConfig struct {
+	Flags map[string]FlagConfig `yaml:"flags"`
+	// Secret signs flag override cookies; generated at startup when left empty
+	Secret string `yaml:"secret"`
+}
+
+// ErrorsConfig sends recovered panics and 5xx responses to a Sentry-compatible service
+type ErrorsConfig struct {
+	// DSN of the form https://key@host/project; reporting is off when empty
+	DSN         string `yaml:"dsn"`
+	Environment string `yaml:"environment"`
+}
+
+// FlagConfig defines a feature flag. In YAML it is either a bool, shorthand
+// for Enabled, or a mapping of the fields below
+type FlagConfig struct {
+	Description string `yaml:"description"`
+	// Enabled turns the flag on for everyone
+	Enabled bool `yaml:"enabled"`
+	// Rollout turns the flag on for this percentage of visitors
+	Rollout int `yaml:"rollout"`
+}
+
+// UnmarshalYAML accepts both the bool shorthand and the full mapping
+func (f *FlagConfig) UnmarshalYAML(node *yaml.Node) error {
+	var enabled bool
+	if err := node.Decode(&enabled); err == nil {
+		f.Enabled = enabled
+		return nil
+	}
+
+	type plain FlagConfig
+	return node.Decode((*plain)(f))
+}
+
+// storeBackends lists the supported store backends
+var storeBackends = []string{"memory", "sqlite"}
+
+// Default returns the configuration used when no file or environment overrides are given
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			SocketMode:        "0660",
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+			TLS: TLSConfig{
+				Autocert: AutocertConfig{
+					CacheDir: "certs",
+					HTTPAddr: ":80",
+				},
+			},
+		},
+		Store: StoreConfig{
+			Backend: "memory",
+			Path:    "htmx.db",
+		},
+		WebSocket: WebSocketConfig{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			FlushInterval:   50 * time.Millisecond,
+			BroadcastQueue:  256,
+			Overload: OverloadConfig{
+				Interval:    10 * time.Second,
+				QueueDepth:  128,
+				DropPercent: 5,
+			},
+		},
+		Admin: AdminConfig{
+			Username: "admin",
+		},
+		Errors: ErrorsConfig{
+			Environment: "production",
+		},
+		Limits: LimitsConfig{
+			MaxRooms:           1000,
+			MaxMessagesPerRoom: 10000,
+			MaxUploadSize:      1 << 20,
+			MaxWSClients:       1000,
+		},
+		Quotas: QuotasConfig{
+			MessagesPerDay:      1000,
+			RoomsPerWeek:        20,
+			UploadBytesPerMonth: 10 << 20,
+		},
+		Retention: RetentionConfig{
+			Interval: time.Hour,
+		},
+		Jobs: JobsConfig{
+			Backup: BackupJobConfig{
+				Schedule: "0 3 * * *",
+				Keep:     7,
+			},
+			Analytics: "*/5 * * * *",
+			WebhookRetries: WebhookRetriesJobConfig{
+				Schedule:   "*/15 * * * *",
+				MaxRetries: 3,
+			},
+		},
+		Moderation: ModerationConfig{
+			MaxLinks:          5,
+			MaxRepeats:        3,
+			RepeatWindow:      time.Minute,
+			ReportsPerHour:    10,
+			MessagesPerMinute: 30,
+			AutoBanViolations: 10,
+			AutoBanWindow:     10 * time.Minute,
+			AutoBanDuration:   time.Hour,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:     10 * time.Second,
+			MaxAttempts: 5,
+		},
+		Bots: BotsConfig{
+			Timeout: 5 * time.Second,
+		},
+		Demo: DemoConfig{
+			Users:           10,
+			Rooms:           3,
+			MessageInterval: 20 * time.Second,
+			JoinInterval:    5 * time.Minute,
+		},
+		Telemetry: TelemetryConfig{
+			Enabled:  true,
+			Interval: 24 * time.Hour,
+		},
+		Integrations: IntegrationsConfig{
+			Alertmanager: AlertmanagerConfig{Username: "Alertmanager"},
+		},
+		Branding: BrandingConfig{
+			Name: "Chat Rooms",
+		},
+		Compression: CompressionConfig{
+			Enabled: true,
+			Level:   5,
+			MinSizes: map[string]int{
+				"text/html":                 1024,
+				"text/css":                  512,
+				"text/javascript":           512,
+				"application/javascript":    512,
+				"application/json":          1024,
+				"application/manifest+json": 1024,
+				"image/svg+xml":             512,
+				"text/plain":                1024,
+				"text/csv":                  1024,
+			},
+			CacheEntries: 256,
+		},
+		LogLevel: "info",
+		Features: FeaturesConfig{
+			Flags: map[string]FlagConfig{
+				"threads":   {Description: "Reply threads on messages"},
+				"reactions": {Description: "Emoji reactions on messages"},
+			},
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (if
+// any) and HTMX_* environment variables, in that order, and validates it
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings from HTMX_* environment variables
+func (c *Config) applyEnv() error {
+	texts := map[string]*string{
+		"HTMX_SOCKET_MODE":              &c.Server.SocketMode,
+		"HTMX_ADDR":                     &c.Server.Addr,
+		"HTMX_STORE_BACKEND":            &c.Store.Backend,
+		"HTMX_STORE_ARCHIVE_DIR":        &c.Store.ArchiveDir,
+		"HTMX_STORE_PATH":               &c.Store.Path,
+		"HTMX_ADMIN_ADDR":               &c.Admin.Addr,
+		"HTMX_ADMIN_USERNAME":           &c.Admin.Username,
+		"HTMX_ADMIN_PASSWORD":           &c.Admin.Password,
+		"HTMX_FEATURES_SECRET":          &c.Features.Secret,
+		"HTMX_ERROR_DSN":                &c.Errors.DSN,
+		"HTMX_ERROR_ENVIRONMENT":        &c.Errors.Environment,
+		"HTMX_LOG_LEVEL":                &c.LogLevel,
+		"HTMX_GRPC_ADDR":                &c.GRPC.Addr,
+		"HTMX_GRPC_TOKEN":               &c.GRPC.Token,
+		"HTMX_IRC_ADDR":                 &c.IRC.Addr,
+		"HTMX_IRC_PASSWORD":             &c.IRC.Password,
+		"HTMX_ALERTMANAGER_ROOM":        &c.Integrations.Alertmanager.Room,
+		"HTMX_ALERTMANAGER_TOKEN":       &c.Integrations.Alertmanager.Token,
+		"HTMX_FEDERATION_NAME":          &c.Federation.Name,
+		"HTMX_TLS_CERT_FILE":            &c.Server.TLS.CertFile,
+		"HTMX_TLS_KEY_FILE":             &c.Server.TLS.KeyFile,
+		"HTMX_AUTOCERT_CACHE_DIR":       &c.Server.TLS.Autocert.CacheDir,
+		"HTMX_AUTOCERT_EMAIL":           &c.Server.TLS.Autocert.Email,
+		"HTMX_AUTOCERT_HTTP_ADDR":       &c.Server.TLS.Autocert.HTTPAddr,
+		"HTMX_BRANDING_NAME":            &c.Branding.Name,
+		"HTMX_BRANDING_LOGO_URL":        &c.Branding.LogoURL,
+		"HTMX_BRANDING_PRIMARY_COLOR":   &c.Branding.PrimaryColor,
+		"HTMX_BRANDING_SECONDARY_COLOR": &c.Branding.SecondaryColor,
+		"HTMX_BRANDING_ACCENT_COLOR":    &c.Branding.AccentColor,
+		"HTMX_BRANDING_FONT":            &c.Branding.Font,
+		"HTMX_JOBS_BACKUP_SCHEDULE":     &c.Jobs.Backup.Schedule,
+		"HTMX_JOBS_BACKUP_DIR":          &c.Jobs.Backup.Dir,
+		"HTMX_JOBS_ANALYTICS":           &c.Jobs.Analytics,
+		"HTMX_JOBS_WEBHOOK_RETRIES":     &c.Jobs.WebhookRetries.Schedule,
+		"HTMX_TELEMETRY_ENDPOINT":       &c.Telemetry.Endpoint,
+	}
+	for name, target := range texts {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"HTMX_READ_TIMEOUT":                 &c.Server.ReadTimeout,
+		"HTMX_READ_HEADER_TIMEOUT":          &c.Server.ReadHeaderTimeout,
+		"HTMX_WRITE_TIMEOUT":                &c.Server.WriteTimeout,
+		"HTMX_IDLE_TIMEOUT":                 &c.Server.IdleTimeout,
+		"HTMX_SHUTDOWN_TIMEOUT":             &c.Server.ShutdownTimeout,
+		"HTMX_WEBHOOK_TIMEOUT":              &c.Webhooks.Timeout,
+		"HTMX_BOT_TIMEOUT":                  &c.Bots.Timeout,
+		"HTMX_WS_FLUSH_INTERVAL":            &c.WebSocket.FlushInterval,
+		"HTMX_WS_OVERLOAD_INTERVAL":         &c.WebSocket.Overload.Interval,
+		"HTMX_MODERATION_REPEAT_WINDOW":     &c.Moderation.RepeatWindow,
+		"HTMX_MODERATION_AUTO_BAN_WINDOW":   &c.Moderation.AutoBanWindow,
+		"HTMX_MODERATION_AUTO_BAN_DURATION": &c.Moderation.AutoBanDuration,
+		"HTMX_RETENTION_INTERVAL":           &c.Retention.Interval,
+		"HTMX_CHAOS_LATENCY":                &c.Chaos.Latency,
+		"HTMX_CHAOS_JITTER":                 &c.Chaos.Jitter,
+		"HTMX_CHAOS_DISCONNECT_AFTER":       &c.Chaos.DisconnectAfter,
+		"HTMX_DEMO_MESSAGE_INTERVAL":        &c.Demo.MessageInterval,
+		"HTMX_DEMO_JOIN_INTERVAL":           &c.Demo.JoinInterval,
+		"HTMX_TELEMETRY_INTERVAL":           &c.Telemetry.Interval,
+	}
+	for name, target := range durations {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*target = d
+		}
+	}
+
+	ints := map[string]*int{
+		"HTMX_WS_READ_BUFFER_SIZE":            &c.WebSocket.ReadBufferSize,
+		"HTMX_WS_WRITE_BUFFER_SIZE":           &c.WebSocket.WriteBufferSize,
+		"HTMX_WS_BROADCAST_QUEUE":             &c.WebSocket.BroadcastQueue,
+		"HTMX_WS_OVERLOAD_QUEUE_DEPTH":        &c.WebSocket.Overload.QueueDepth,
+		"HTMX_WS_OVERLOAD_DROP_PERCENT":       &c.WebSocket.Overload.DropPercent,
+		"HTMX_MAX_ROOMS":                      &c.Limits.MaxRooms,
+		"HTMX_MAX_MESSAGES_PER_ROOM":          &c.Limits.MaxMessagesPerRoom,
+		"HTMX_MAX_UPLOAD_SIZE":                &c.Limits.MaxUploadSize,
+		"HTMX_MAX_WS_CLIENTS":                 &c.Limits.MaxWSClients,
+		"HTMX_QUOTA_MESSAGES_PER_DAY":         &c.Quotas.MessagesPerDay,
+		"HTMX_QUOTA_ROOMS_PER_WEEK":           &c.Quotas.RoomsPerWeek,
+		"HTMX_QUOTA_UPLOAD_BYTES_PER_MONTH":   &c.Quotas.UploadBytesPerMonth,
+		"HTMX_RETENTION_MESSAGE_DAYS":         &c.Retention.MessageDays,
+		"HTMX_RETENTION_AUDIT_DAYS":           &c.Retention.AuditDays,
+		"HTMX_JOBS_BACKUP_KEEP":               &c.Jobs.Backup.Keep,
+		"HTMX_JOBS_WEBHOOK_MAX_RETRIES":       &c.Jobs.WebhookRetries.MaxRetries,
+		"HTMX_WEBHOOK_MAX_ATTEMPTS":           &c.Webhooks.MaxAttempts,
+		"HTMX_STORE_MEMORY_BUDGET":            &c.Store.MemoryBudget,
+		"HTMX_COMPRESSION_LEVEL":              &c.Compression.Level,
+		"HTMX_COMPRESSION_CACHE_ENTRIES":      &c.Compression.CacheEntries,
+		"HTMX_MODERATION_MAX_LINKS":           &c.Moderation.MaxLinks,
+		"HTMX_MODERATION_MAX_REPEATS":         &c.Moderation.MaxRepeats,
+		"HTMX_MODERATION_REPORTS_PER_HOUR":    &c.Moderation.ReportsPerHour,
+		"HTMX_MODERATION_MESSAGES_PER_MINUTE": &c.Moderation.MessagesPerMinute,
+		"HTMX_MODERATION_AUTO_BAN_VIOLATIONS": &c.Moderation.AutoBanViolations,
+		"HTMX_CHAOS_ERROR_PERCENT":            &c.Chaos.ErrorPercent,
+		"HTMX_DEMO_USERS":                     &c.Demo.Users,
+		"HTMX_DEMO_ROOMS":                     &c.Demo.Rooms,
+	}
+	for name, target := range ints {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*target = n
+		}
+	}
+
+	bools := map[string]*bool{
+		"HTMX_AUTOCERT":           &c.Server.TLS.Autocert.Enabled,
+		"HTMX_DEV":                &c.Dev,
+		"HTMX_FEDERATION_ENABLED": &c.Federation.Enabled,
+		"HTMX_COMPRESSION":        &c.Compression.Enabled,
+		"HTMX_DEMO":               &c.Demo.Enabled,
+		"HTMX_TELEMETRY":          &c.Telemetry.Enabled,
+	}
+	for name, target := range bools {
+		if value, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*target = b
+		}
+	}
+
+	if value, ok := os.LookupEnv("HTMX_WS_ALLOWED_ORIGINS"); ok {
+		c.WebSocket.AllowedOrigins = splitList(value)
+	}
+	if value, ok := os.LookupEnv("HTMX_EMBED_ALLOWED_ORIGINS"); ok {
+		c.Embed.AllowedOrigins = splitList(value)
+	}
+	if value, ok := os.LookupEnv("HTMX_MODERATION_WORDS"); ok {
+		c.Moderation.Words = splitList(value)
+	}
+	if value, ok := os.LookupEnv("HTMX_AUTOCERT_DOMAINS"); ok {
+		c.Server.TLS.Autocert.Domains = splitList(value)
+	}
+	if value, ok := os.LookupEnv("HTMX_TRUSTED_PROXIES"); ok {
+		c.Server.TrustedProxies = splitList(value)
+	}
+	if value, ok := os.LookupEnv("HTMX_CHAOS_ROUTES"); ok {
+		c.Chaos.Routes = splitList(value)
+	}
+	// The console convention for opting out of tracking, see consoledonottrack.com
+	if value := os.Getenv("DO_NOT_TRACK"); value != "" && value != "0" && value != "false" {
+		c.Telemetry.Enabled = false
+	}
+
+	return nil
+}
+
+// Validate reports every invalid setting in the configuration
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr must not be empty"))
+	}
+	if path, ok := c.Server.SocketPath(); ok {
+		if path == "" {
+			errs = append(errs, errors.New("server.addr unix:// must be followed by a socket path"))
+		}
+		if mode, err := strconv.ParseUint(c.Server.SocketMode, 8, 32); err != nil || mode > 0o777 {
+			errs = append(errs, fmt.Errorf("server.socket_mode %q is not a valid octal permission", c.Server.SocketMode))
+		}
+	}
+
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 ||
+		c.Server.IdleTimeout < 0 || c.Server.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR range", proxy))
+		}
+	}
+
+	tls := c.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		errs = append(errs, errors.New("server.tls.cert_file and server.tls.key_file must be set together"))
+	}
+	if tls.Autocert.Enabled {
+		if tls.CertFile != "" {
+			errs = append(errs, errors.New("server.tls.autocert cannot be combined with certificate files"))
+		}
+		if len(tls.Autocert.Domains) == 0 {
+			errs = append(errs, errors.New("server.tls.autocert.domains must list at least one domain"))
+		}
+		if tls.Autocert.CacheDir == "" {
+			errs = append(errs, errors.New("server.tls.autocert.cache_dir must not be empty"))
+		}
+	}
+
+	if !slices.Contains(storeBackends, c.Store.Backend) {
+		errs = append(errs, fmt.Errorf("store.backend %q is not supported (want one of %s)", c.Store.Backend, strings.Join(storeBackends, ", ")))
+	}
+	if c.Store.MemoryBudget < 0 {
+		errs = append(errs, errors.New("store.memory_budget must not be negative"))
+	}
+	if c.Store.MemoryBudget > 0 && c.Store.ArchiveDir == "" {
+		errs = append(errs, errors.New("store.memory_budget needs store.archive_dir for the evicted messages"))
+	}
+	if c.Store.Backend == "sqlite" {
+		if c.Store.Path == "" {
+			errs = append(errs, errors.New("store.path must not be empty with the sqlite backend"))
+		}
+		if c.Store.MemoryBudget > 0 {
+			errs = append(errs, errors.New("store.memory_budget only applies to the memory backend"))
+		}
+	}
+
+	for _, origin := range c.WebSocket.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("websocket.allowed_origins: %q is not a valid origin", origin))
+		}
+	}
+	for _, origin := range c.Embed.AllowedOrigins {
+		if !validFrameOrigin(origin) {
+			errs = append(errs, fmt.Errorf("embed.allowed_origins: %q is not a valid origin", origin))
+		}
+	}
+	if c.WebSocket.ReadBufferSize <= 0 || c.WebSocket.WriteBufferSize <= 0 {
+		errs = append(errs, errors.New("websocket buffer sizes must be positive"))
+	}
+	if c.WebSocket.FlushInterval < 0 {
+		errs = append(errs, errors.New("websocket.flush_interval must not be negative"))
+	}
+	if c.WebSocket.BroadcastQueue < 0 {
+		errs = append(errs, errors.New("websocket.broadcast_queue must not be negative"))
+	}
+	if c.WebSocket.Overload.Interval <= 0 {
+		errs = append(errs, errors.New("websocket.overload.interval must be positive"))
+	}
+	if c.WebSocket.Overload.QueueDepth < 0 {
+		errs = append(errs, errors.New("websocket.overload.queue_depth must not be negative"))
+	}
+	if c.WebSocket.Overload.DropPercent < 0 || c.WebSocket.Overload.DropPercent > 100 {
+		errs = append(errs, errors.New("websocket.overload.drop_percent must be between 0 and 100"))
+	}
+
+	if c.Compression.Enabled {
+		if c.Compression.Level < 1 || c.Compression.Level > 9 {
+			errs = append(errs, errors.New("compression.level must be between 1 and 9"))
+		}
+		for contentType, size := range c.Compression.MinSizes {
+			if size < 0 {
+				errs = append(errs, fmt.Errorf("compression.min_sizes.%s must not be negative", contentType))
+			}
+		}
+		if c.Compression.CacheEntries < 0 {
+			errs = append(errs, errors.New("compression.cache_entries must not be negative"))
+		}
+	}
+
+	for name, flag := range c.Features.Flags {
+		if flag.Rollout < 0 || flag.Rollout > 100 {
+			errs = append(errs, fmt.Errorf("features.flags.%s.rollout must be between 0 and 100", name))
+		}
+	}
+
+	if c.Errors.DSN != "" {
+		if u, err := url.Parse(c.Errors.DSN); err != nil || u.Scheme == "" || u.Host == "" || u.User == nil || strings.Trim(u.Path, "/") == "" {
+			errs = append(errs, errors.New("error_reporting.dsn must look like https://key@host/project"))
+		}
+	}
+
+	if c.Limits.MaxRooms < 0 || c.Limits.MaxMessagesPerRoom < 0 || c.Limits.MaxUploadSize < 0 || c.Limits.MaxWSClients < 0 {
+		errs = append(errs, errors.New("limits must not be negative"))
+	}
+	if c.Quotas.MessagesPerDay < 0 || c.Quotas.RoomsPerWeek < 0 || c.Quotas.UploadBytesPerMonth < 0 {
+		errs = append(errs, errors.New("quotas must not be negative"))
+	}
+	if c.Retention.MessageDays < 0 || c.Retention.AuditDays < 0 {
+		errs = append(errs, errors.New("retention.message_days and retention.audit_days must not be negative"))
+	}
+	if c.Retention.Interval <= 0 {
+		errs = append(errs, errors.New("retention.interval must be positive"))
+	}
+	errs = append(errs, c.Jobs.validate()...)
+
+	if c.Moderation.MaxLinks < 0 || c.Moderation.MaxRepeats < 0 || c.Moderation.ReportsPerHour < 0 || c.Moderation.MessagesPerMinute < 0 || c.Moderation.AutoBanViolations < 0 {
+		errs = append(errs, errors.New("moderation.max_links, moderation.max_repeats, moderation.reports_per_hour, moderation.messages_per_minute and moderation.auto_ban_violations must not be negative"))
+	}
+	if c.Moderation.AutoBanViolations > 0 && (c.Moderation.AutoBanWindow <= 0 || c.Moderation.AutoBanDuration <= 0) {
+		errs = append(errs, errors.New("moderation.auto_ban_window and moderation.auto_ban_duration must be positive with moderation.auto_ban_violations"))
+	}
+	if c.Moderation.MaxRepeats > 0 && c.Moderation.RepeatWindow <= 0 {
+		errs = append(errs, errors.New("moderation.repeat_window must be positive with moderation.max_repeats"))
+	}
+	for i, word := range c.Moderation.Words {
+		if strings.TrimSpace(word) == "" {
+			errs = append(errs, fmt.Errorf("moderation.words[%d] must not be empty", i))
+		}
+	}
+
+	if c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("webhooks.timeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhooks.max_attempts must be at least 1"))
+	}
+
+	if c.Bots.Timeout <= 0 {
+		errs = append(errs, errors.New("bots.timeout must be positive"))
+	}
+
+	if c.Chaos.Latency < 0 || c.Chaos.Jitter < 0 || c.Chaos.DisconnectAfter < 0 {
+		errs = append(errs, errors.New("chaos.latency, chaos.jitter and chaos.disconnect_after must not be negative"))
+	}
+	if c.Chaos.ErrorPercent < 0 || c.Chaos.ErrorPercent > 100 {
+		errs = append(errs, errors.New("chaos.error_percent must be between 0 and 100"))
+	}
+	for _, route := range c.Chaos.Routes {
+		if !strings.HasPrefix(route, "/") {
+			errs = append(errs, fmt.Errorf("chaos.routes entry %q must start with /", route))
+		}
+	}
+
+	if c.Demo.Enabled {
+		if c.Demo.Users < 1 || c.Demo.Rooms < 1 {
+			errs = append(errs, errors.New("demo.users and demo.rooms must be at least 1"))
+		}
+		if c.Demo.MessageInterval <= 0 || c.Demo.JoinInterval <= 0 {
+			errs = append(errs, errors.New("demo.message_interval and demo.join_interval must be positive"))
+		}
+	}
+
+	if c.Telemetry.Enabled && c.Telemetry.Interval < time.Hour {
+		errs = append(errs, errors.New("telemetry.interval must be at least 1h"))
+	}
+	// Reports travel over HTTPS, except to a collector on the same machine
+	if c.Telemetry.Endpoint != "" {
+		if u, err := url.Parse(c.Telemetry.Endpoint); err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname()))) {
+			errs = append(errs, fmt.Errorf("telemetry.endpoint %q must be an https URL, or http on a loopback address", c.Telemetry.Endpoint))
+		}
+	}
+
+	if !slices.Contains(logging.Levels, strings.ToLower(c.LogLevel)) {
+		errs = append(errs, fmt.Errorf("log_level %q is not supported (want one of %s)", c.LogLevel, strings.Join(logging.Levels, ", ")))
+	}
+
+	if c.Admin.Addr != "" && c.Admin.Addr == c.Server.Addr {
+		errs = append(errs, errors.New("admin.addr must differ from server.addr"))
+	}
+	if c.GRPC.Addr != "" && (c.GRPC.Addr == c.Server.Addr || c.GRPC.Addr == c.Admin.Addr) {
+		errs = append(errs, errors.New("grpc.addr must differ from server.addr and admin.addr"))
+	}
+	if c.GRPC.Addr != "" && c.GRPC.Token == "" {
+		errs = append(errs, errors.New("grpc.token must be set when grpc.addr is"))
+	}
+	if c.IRC.Addr != "" && (c.IRC.Addr == c.Server.Addr || c.IRC.Addr == c.Admin.Addr || c.IRC.Addr == c.GRPC.Addr) {
+		errs = append(errs, errors.New("irc.addr must differ from server.addr, admin.addr and grpc.addr"))
+	}
+	if c.Admin.Username == "" {
+		errs = append(errs, errors.New("admin.username must not be empty"))
+	}
+	if c.Federation.Enabled {
+		errs = append(errs, c.Federation.validate()...)
+	}
+	errs = append(errs, c.Branding.validate()...)
+
+	return errors.Join(errs...)
+}
+
+// validate reports the invalid branding settings; they end up in a
+// stylesheet and in page markup, so anything that could escape a CSS
+// declaration or an attribute is rejected
+func (b *BrandingConfig) validate() []error {
+	var errs []error
+	if strings.TrimSpace(b.Name) == "" {
+		errs = append(errs, errors.New("branding.name must not be empty"))
+	}
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		local := err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(b.LogoURL, "/") && !strings.HasPrefix(b.LogoURL, "//")
+		remote := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+		if !local && !remote {
+			errs = append(errs, fmt.Errorf("branding.logo_url %q must be an http(s) URL or a path starting with /", b.LogoURL))
+		}
+	}
+	colors := map[string]string{
+		"primary_color":   b.PrimaryColor,
+		"secondary_color": b.SecondaryColor,
+		"accent_color":    b.AccentColor,
+	}
+	for _, name := range slices.Sorted(maps.Keys(colors)) {
+		if value := colors[name]; value != "" && !hexColor.MatchString(value) {
+			errs = append(errs, fmt.Errorf("branding.%s %q must be a hex color such as #4f46e5", name, value))
+		}
+	}
+	if b.Font != "" && !fontFamily.MatchString(b.Font) {
+		errs = append(errs, fmt.Errorf("branding.font %q must be a font-family list such as \"Inter, sans-serif\"", b.Font))
+	}
+	return errs
+}
+
+// hexColor matches #rgb and #rrggbb colors, and fontFamily the font names,
+// spaces, quotes, hyphens and commas of a font-family list
+var (
+	hexColor   = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	fontFamily = regexp.MustCompile(`^[\w\s,'"-]+$`)
+)
+
+// validate reports the invalid federation settings
+func (f *FederationConfig) validate() []error {
+	var errs []error
+	if f.Name == "" {
+		errs = append(errs, errors.New("federation.name must not be empty"))
+	}
+	names := make(map[string]bool)
+	for i, peer := range f.Peers {
+		switch {
+		case peer.Name == "":
+			errs = append(errs, fmt.Errorf("federation.peers[%d].name must not be empty", i))
+		case peer.Name == f.Name:
+			errs = append(errs, fmt.Errorf("federation.peers[%d].name must differ from federation.name", i))
+		case names[peer.Name]:
+			errs = append(errs, fmt.Errorf("federation.peers[%d].name %q is used twice", i, peer.Name))
+		}
+		names[peer.Name] = true
+
+		// Events travel over HTTPS, except to peers on the same machine
+		u, err := url.Parse(peer.URL)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname()))) {
+			errs = append(errs, fmt.Errorf("federation.peers[%d].url must be an https URL", i))
+		}
+		if peer.Secret == "" {
+			errs = append(errs, fmt.Errorf("federation.peers[%d].secret must not be empty", i))
+		}
+		if len(peer.Rooms) == 0 {
+			errs = append(errs, fmt.Errorf("federation.peers[%d].rooms must list at least one room", i))
+		}
+	}
+	return errs
+}
+
+// validate reports the invalid schedules and settings of the jobs
+func (j *JobsConfig) validate() []error {
+	var errs []error
+	schedules := map[string]string{
+		"jobs.backup.schedule":          j.Backup.Schedule,
+		"jobs.analytics":                j.Analytics,
+		"jobs.webhook_retries.schedule": j.WebhookRetries.Schedule,
+	}
+	for _, name := range slices.Sorted(maps.Keys(schedules)) {
+		if spec := schedules[name]; spec != "" {
+			if _, err := jobs.Parse(spec); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	if j.Backup.Keep < 0 {
+		errs = append(errs, errors.New("jobs.backup.keep must not be negative"))
+	}
+	if j.WebhookRetries.MaxRetries < 0 {
+		errs = append(errs, errors.New("jobs.webhook_retries.max_retries must not be negative"))
+	}
+	return errs
+}
+
+// isLoopback reports whether host names this machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validFrameOrigin reports whether origin is "*" or a bare scheme and host,
+// which can be put into a frame-ancestors directive as is
+func validFrameOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Scheme != "" && u.Host != "" && origin == u.Scheme+"://"+u.Host && !strings.ContainsAny(origin, " ;,'")
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
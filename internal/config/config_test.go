@@ -0,0 +1,40 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	if proxies := Default().Server.TrustedProxies; len(proxies) != 0 {
+		t.Errorf("trusted proxies by default = %v, want none", proxies)
+	}
+
+	t.Setenv("HTMX_TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8,,::1")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"127.0.0.1", "10.0.0.0/8", "::1"}; !slices.Equal(cfg.Server.TrustedProxies, want) {
+		t.Errorf("trusted proxies from the environment = %v, want %v", cfg.Server.TrustedProxies, want)
+	}
+
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), `server.trusted_proxies: "proxy.internal"`) {
+		t.Errorf("Validate with a host name = %v, want an error naming it", err)
+	}
+}
+
+func TestGRPCToken(t *testing.T) {
+	cfg := Default()
+	cfg.GRPC.Addr = ":9090"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "grpc.token") {
+		t.Errorf("Validate with grpc.addr and no token = %v, want an error naming grpc.token", err)
+	}
+	cfg.GRPC.Token = "secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate with a token = %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package dev
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCapturedBody caps the request and response bodies kept in a fixture
+const maxCapturedBody = 1 << 20
+
+// Entry is one line of a traffic fixture: a request with its response, or
+// an event the hub broadcast
+type Entry struct {
+	// Kind is "http" or "event"
+	Kind     string            `json:"kind"`
+	Time     time.Time         `json:"time"`
+	Request  *CapturedRequest  `json:"request,omitempty"`
+	Response *CapturedResponse `json:"response,omitempty"`
+	Event    json.RawMessage   `json:"event,omitempty"`
+}
+
+// CapturedRequest is a request as the browser sent it
+type CapturedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// CapturedResponse is the response the handlers gave, uncompressed
+type CapturedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// capturedHeaders are the response headers kept, those the pages act on
+var capturedHeaders = []string{"Content-Type", "Location"}
+
+// Recorder writes the traffic of a dev server to a fixture file, one JSON
+// entry per line, for a Replayer to feed back through the handlers
+type Recorder struct {
+	file  *os.File
+	out   *bufio.Writer
+	mutex sync.Mutex
+}
+
+// NewRecorder creates a fixture file in dir named after the current time
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s/traffic-%s.jsonl", strings.TrimRight(dir, "/"), time.Now().Format("20060102-150405"))
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file, out: bufio.NewWriter(file)}, nil
+}
+
+// Path returns the name of the fixture file
+func (r *Recorder) Path() string {
+	return r.file.Name()
+}
+
+// Middleware records every request with its response, other than static
+// files, WebSocket upgrades and the probes. Requests are passed on without
+// Accept-Encoding so the responses are recorded uncompressed
+func (r *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !recorded(c.Request) {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxCapturedBody))
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		c.Request.Header.Del("Accept-Encoding")
+		req := &CapturedRequest{
+			Method: c.Request.Method,
+			URL:    c.Request.URL.RequestURI(),
+			Header: c.Request.Header.Clone(),
+			Body:   string(body),
+		}
+
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		res := &CapturedResponse{Status: w.Status(), Header: http.Header{}, Body: w.body.String()}
+		for name, values := range w.Header() {
+			if strings.HasPrefix(name, "Hx-") || containsFold(capturedHeaders, name) {
+				res.Header[name] = values
+			}
+		}
+		r.write(Entry{Kind: "http", Time: time.Now(), Request: req, Response: res})
+	}
+}
+
+// Event records an event broadcast by the hub
+func (r *Recorder) Event(event any) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	r.write(Entry{Kind: "event", Time: time.Now(), Event: data})
+}
+
+// write appends an entry to the fixture, flushed at once so a killed server
+// keeps what it recorded
+func (r *Recorder) write(entry Entry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.out.Write(append(data, '\n'))
+	r.out.Flush()
+}
+
+// Close flushes and closes the fixture file
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.out.Flush()
+	return r.file.Close()
+}
+
+// ReadFixture reads the entries of a fixture file
+func ReadFixture(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 4*maxCapturedBody)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// recorded reports whether a request is kept in the fixture
+func recorded(req *http.Request) bool {
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+	for _, prefix := range []string{"/static/", "/__dev/", "/__components", "/icons/", "/metrics", "/healthz", "/livez", "/readyz"} {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether names holds name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureWriter is a response writer keeping a copy of the body
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < maxCapturedBody {
+		w.body.Write(data[:min(len(data), maxCapturedBody-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
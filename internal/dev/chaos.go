@@ -0,0 +1,108 @@
+package dev
+
+import (
+	"bufio"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/config"
+	"htmx/internal/i18n"
+	"htmx/internal/middleware"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Chaos injects the faults of cfg into the requests of its routes: it delays
+// them, fails some with a 503, rendered as the error boundary for htmx
+// requests, and cuts WebSocket connections after a while. Static files, the
+// dev reload socket and the component gallery are left alone
+func Chaos(cfg config.ChaosConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/__dev/") || strings.HasPrefix(path, "/__components") || !chaosRoute(cfg.Routes, path) {
+			c.Next()
+			return
+		}
+
+		if delay := cfg.Latency + randDuration(cfg.Jitter); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		if cfg.ErrorPercent > 0 && rand.N(100) < cfg.ErrorPercent {
+			slog.Debug("chaos: failing request", "method", c.Request.Method, "path", path)
+			if c.GetHeader("HX-Request") == "true" {
+				middleware.RenderBoundary(c, http.StatusServiceUnavailable, i18n.FromContext(c).T("errors.unexpected"))
+				c.Abort()
+				return
+			}
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+
+		if cfg.DisconnectAfter > 0 && c.GetHeader("Upgrade") != "" {
+			c.Writer = &chaosWriter{ResponseWriter: c.Writer, after: cfg.DisconnectAfter/2 + randDuration(cfg.DisconnectAfter)}
+		}
+		c.Next()
+	}
+}
+
+// chaosRoute reports whether path is below one of routes, with * matching
+// any one segment; no routes match every path
+func chaosRoute(routes []string, path string) bool {
+	if len(routes) == 0 {
+		return true
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, route := range routes {
+		pattern := strings.Split(strings.Trim(route, "/"), "/")
+		if pattern[0] == "" {
+			return true
+		}
+		if len(pattern) > len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range pattern {
+			if part != "*" && part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// randDuration returns a random duration below max, zero if max is not positive
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// chaosWriter cuts the connection it hijacks for a WebSocket after a while
+type chaosWriter struct {
+	gin.ResponseWriter
+	after time.Duration
+}
+
+func (w *chaosWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err == nil {
+		time.AfterFunc(w.after, func() {
+			slog.Debug("chaos: cutting WebSocket connection", "remote", conn.RemoteAddr())
+			conn.Close()
+		})
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,76 @@
+package dev
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+)
+
+// Proxy forwards requests, WebSocket upgrades included, to the server the
+// dev command currently runs, which changes as it rebuilds the server
+type Proxy struct {
+	target atomic.Pointer[url.URL]
+	proxy  *httputil.ReverseProxy
+}
+
+// NewProxy creates a proxy with no server to forward to yet
+func NewProxy() *Proxy {
+	p := &Proxy{}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(p.target.Load())
+			r.SetXForwarded()
+			// Keep the browser's host, which the WebSocket origin check
+			// and absolute URLs compare against
+			r.Out.Host = r.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			unavailable(w)
+		},
+	}
+	return p
+}
+
+// SetTarget sets the server requests are forwarded to, nil while none runs
+func (p *Proxy) SetTarget(target *url.URL) {
+	p.target.Store(target)
+}
+
+// ServeHTTP forwards the request, answering 503 while no server runs
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.target.Load() == nil {
+		unavailable(w)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// unavailable tells the browser the server is restarting; the reload
+// channel refreshes the page once it is back
+func unavailable(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "The server is rebuilding, the page reloads when it is back.", http.StatusServiceUnavailable)
+}
+
+// RelayReloads passes the reload messages of the server at target, sent when
+// its templates or static files change, on to the browsers of reloader. It
+// returns when the connection ends, such as when the server stops
+func RelayReloads(target *url.URL, reloader *Reloader) error {
+	u := *target
+	u.Scheme = "ws"
+	u.Path = "/__dev/reload"
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return nil
+		}
+		reloader.Reload()
+	}
+}
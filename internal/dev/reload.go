@@ -0,0 +1,62 @@
+package dev
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"log"
+	"sync"
+)
+
+// Reloader tells connected browsers to refresh over a dedicated WebSocket channel
+type Reloader struct {
+	clients  map[*websocket.Conn]bool
+	mutex    sync.Mutex
+	upgrader websocket.Upgrader
+}
+
+// NewReloader creates a reloader with no connected browsers
+func NewReloader() *Reloader {
+	return &Reloader{
+		clients: make(map[*websocket.Conn]bool),
+	}
+}
+
+// Handler accepts a browser connection on the reload channel
+func (r *Reloader) Handler(c *gin.Context) {
+	conn, err := r.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Dev reload upgrade error: %v", err)
+		return
+	}
+
+	r.mutex.Lock()
+	r.clients[conn] = true
+	r.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			r.mutex.Lock()
+			delete(r.clients, conn)
+			r.mutex.Unlock()
+			conn.Close()
+		}()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Reload asks every connected browser to refresh the page
+func (r *Reloader) Reload() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for conn := range r.clients {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("reload")); err != nil {
+			conn.Close()
+			delete(r.clients, conn)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package dev
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uuidPattern matches the IDs the handlers generate, which differ between
+// the recording and the replay
+var uuidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// timePatterns match the times rendered by the handlers, in JSON and in
+// the layouts of the templates
+var timePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2})?`),
+	regexp.MustCompile(`[A-Z][a-z]{2} \d{2}, \d{4} \d{2}:\d{2}:\d{2}`),
+	regexp.MustCompile(`[A-Z][a-z]{2} \d{2} \d{2}:\d{2}`),
+}
+
+// Mismatch is a replayed response or event differing from the recorded one
+type Mismatch struct {
+	// Entry is the line of the entry in the fixture
+	Entry int
+	// What names the request, such as "POST /api/rooms", or the event
+	What   string
+	Reason string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("line %d, %s: %s", m.Entry, m.What, m.Reason)
+}
+
+// Replayer feeds the requests of a fixture back through the handlers and
+// compares their responses, and the events the hub broadcasts meanwhile,
+// with the recorded ones. The IDs generated during the replay are mapped to
+// the recorded ones in the order they appear, and times are ignored
+type Replayer struct {
+	handler http.Handler
+	// ids maps recorded IDs to those generated in the replay
+	ids    map[string]string
+	events []json.RawMessage
+	mutex  sync.Mutex
+}
+
+// NewReplayer creates a replayer sending the requests to handler, which
+// should start from the same data as the recorded server did
+func NewReplayer(handler http.Handler) *Replayer {
+	return &Replayer{handler: handler, ids: make(map[string]string)}
+}
+
+// Event collects an event broadcast by the hub during the replay
+func (r *Replayer) Event(event any) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	r.mutex.Lock()
+	r.events = append(r.events, data)
+	r.mutex.Unlock()
+}
+
+// Run replays the requests of entries in order, waits settle for the last
+// events to be broadcast and returns every difference found
+func (r *Replayer) Run(entries []Entry, settle time.Duration) []Mismatch {
+	var mismatches []Mismatch
+	var recordedEvents []int
+	for i, entry := range entries {
+		switch entry.Kind {
+		case "http":
+			if entry.Request != nil && entry.Response != nil {
+				mismatches = append(mismatches, r.replay(i+1, entry)...)
+			}
+		case "event":
+			recordedEvents = append(recordedEvents, i)
+		}
+	}
+	time.Sleep(settle)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for n, i := range recordedEvents {
+		what := fmt.Sprintf("event %d", n+1)
+		if n >= len(r.events) {
+			mismatches = append(mismatches, Mismatch{i + 1, what, "not broadcast in the replay"})
+			continue
+		}
+		if reason := r.compare(string(entries[i].Event), string(r.events[n])); reason != "" {
+			mismatches = append(mismatches, Mismatch{i + 1, what, reason})
+		}
+	}
+	if extra := len(r.events) - len(recordedEvents); extra > 0 {
+		mismatches = append(mismatches, Mismatch{len(entries), "events", fmt.Sprintf("%d more broadcast in the replay than recorded", extra)})
+	}
+	return mismatches
+}
+
+// replay sends one recorded request and compares the response
+func (r *Replayer) replay(line int, entry Entry) []Mismatch {
+	recorded := entry.Response
+	req := httptest.NewRequest(entry.Request.Method, r.mapIDs(entry.Request.URL), strings.NewReader(r.mapIDs(entry.Request.Body)))
+	for name, values := range entry.Request.Header {
+		for _, value := range values {
+			req.Header.Add(name, r.mapIDs(value))
+		}
+	}
+	w := httptest.NewRecorder()
+	r.handler.ServeHTTP(w, req)
+
+	// Learn the IDs generated for this response before comparing it
+	r.learn(capturedText(recorded.Header, recorded.Body), capturedText(w.Header(), w.Body.String()))
+
+	what := entry.Request.Method + " " + entry.Request.URL
+	var mismatches []Mismatch
+	if w.Code != recorded.Status {
+		mismatches = append(mismatches, Mismatch{line, what, fmt.Sprintf("status %d, recorded %d", w.Code, recorded.Status)})
+	}
+	for name, values := range recorded.Header {
+		if reason := r.compare(strings.Join(values, ", "), strings.Join(w.Header().Values(name), ", ")); reason != "" {
+			mismatches = append(mismatches, Mismatch{line, what, "header " + name + ": " + reason})
+		}
+	}
+	if reason := r.compare(recorded.Body, w.Body.String()); reason != "" {
+		mismatches = append(mismatches, Mismatch{line, what, "body: " + reason})
+	}
+	return mismatches
+}
+
+// mapIDs replaces the recorded IDs in s by those generated in the replay
+func (r *Replayer) mapIDs(s string) string {
+	return uuidPattern.ReplaceAllStringFunc(s, func(id string) string {
+		if mapped, ok := r.ids[id]; ok {
+			return mapped
+		}
+		return id
+	})
+}
+
+// learn maps the IDs first seen in a recorded response to those at the same
+// place among the IDs of the replayed one
+func (r *Replayer) learn(recorded, replayed string) {
+	recordedIDs, replayedIDs := uniqueIDs(recorded), uniqueIDs(replayed)
+	for i, id := range recordedIDs {
+		if i >= len(replayedIDs) {
+			break
+		}
+		if _, known := r.ids[id]; !known && !slices.Contains(recordedIDs, replayedIDs[i]) {
+			r.ids[id] = replayedIDs[i]
+		}
+	}
+}
+
+// compare returns how replayed differs from recorded once IDs are mapped
+// and times ignored, or "" when they match
+func (r *Replayer) compare(recorded, replayed string) string {
+	want, got := normalizeTimes(r.mapIDs(recorded)), normalizeTimes(replayed)
+	if want == got {
+		return ""
+	}
+	i := 0
+	for i < len(want) && i < len(got) && want[i] == got[i] {
+		i++
+	}
+	return fmt.Sprintf("differs at byte %d: recorded %q, replayed %q", i, excerpt(want, i), excerpt(got, i))
+}
+
+// capturedText joins the headers and body of a response for learning IDs
+func capturedText(header http.Header, body string) string {
+	var b strings.Builder
+	for _, name := range capturedHeaders {
+		b.WriteString(strings.Join(header.Values(name), " "))
+	}
+	for name, values := range header {
+		if strings.HasPrefix(name, "Hx-") {
+			b.WriteString(strings.Join(values, " "))
+		}
+	}
+	b.WriteString(body)
+	return b.String()
+}
+
+// uniqueIDs returns the IDs in s in the order they first appear
+func uniqueIDs(s string) []string {
+	var ids []string
+	for _, id := range uuidPattern.FindAllString(s, -1) {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// normalizeTimes replaces the times in s by a placeholder
+func normalizeTimes(s string) string {
+	for _, pattern := range timePatterns {
+		s = pattern.ReplaceAllString(s, "<time>")
+	}
+	return s
+}
+
+// excerpt returns the text of s around i
+func excerpt(s string, i int) string {
+	start, end := max(i-20, 0), min(i+40, len(s))
+	return s[start:end]
+}
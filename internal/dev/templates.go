@@ -0,0 +1,46 @@
+package dev
+
+import (
+	"github.com/gin-gonic/gin/render"
+	"html/template"
+	"sync/atomic"
+)
+
+// Templates is a Gin HTML renderer whose template set can be swapped while serving
+type Templates struct {
+	load    func() (*template.Template, error)
+	current atomic.Pointer[template.Template]
+}
+
+// NewTemplates creates a renderer from the given loader, loading it once
+func NewTemplates(load func() (*template.Template, error)) (*Templates, error) {
+	t := &Templates{load: load}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload parses the templates again, keeping the previous set if parsing fails
+func (t *Templates) Reload() error {
+	templ, err := t.load()
+	if err != nil {
+		return err
+	}
+	t.current.Store(templ)
+	return nil
+}
+
+// Instance returns a render for the named template of the current set
+func (t *Templates) Instance(name string, data any) render.Render {
+	return render.HTML{
+		Template: t.current.Load(),
+		Name:     name,
+		Data:     data,
+	}
+}
+
+// Template returns the current template set
+func (t *Templates) Template() *template.Template {
+	return t.current.Load()
+}
@@ -0,0 +1,89 @@
+package dev
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Watcher polls directory trees and reports when any file in them changes
+type Watcher struct {
+	dirs     []string
+	interval time.Duration
+	state    map[string]fileState
+}
+
+// fileState is what the watcher compares between polls
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewWatcher creates a watcher for the given directories
+func NewWatcher(interval time.Duration, dirs ...string) *Watcher {
+	w := &Watcher{dirs: dirs, interval: interval}
+	w.state = w.scan()
+	return w
+}
+
+// Watch calls onChange with the changed paths after every poll that found
+// changes, until the context is cancelled
+func (w *Watcher) Watch(ctx context.Context, onChange func(paths []string)) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			state := w.scan()
+			if changed := diff(w.state, state); len(changed) > 0 {
+				onChange(changed)
+			}
+			w.state = state
+		}
+	}
+}
+
+// scan records the size and modification time of every file under the
+// directories, skipping hidden directories and installed npm packages
+func (w *Watcher) scan() map[string]fileState {
+	state := make(map[string]fileState)
+	for _, dir := range w.dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != dir && (d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				state[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+			}
+			return nil
+		})
+	}
+	return state
+}
+
+// diff returns the paths added, removed or modified between two scans
+func diff(before, after map[string]fileState) []string {
+	var changed []string
+	for path, state := range after {
+		if prev, ok := before[path]; !ok || prev != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,209 @@
+// Package emoji holds the emoji offered by the emoji picker, grouped in
+// categories and searchable by their English names and keywords
+package emoji
+
+import (
+	"strings"
+)
+
+// Emoji is a pickable emoji
+type Emoji struct {
+	Char string `json:"emoji"`
+	Name string `json:"name"`
+	// Category is the ID of the category the emoji is listed in
+	Category string `json:"category"`
+	// Keywords are more words the emoji is found by
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+// Category is a group of emoji in the picker, titled by the message
+// "emoji.category.<ID>"
+type Category struct {
+	ID    string
+	Emoji []Emoji
+}
+
+// e builds a category from entries written "<emoji> <name>,<keywords>",
+// with the keywords separated by spaces
+func e(category string, entries ...string) Category {
+	c := Category{ID: category}
+	for _, entry := range entries {
+		char, rest, _ := strings.Cut(entry, " ")
+		name, keywords, _ := strings.Cut(rest, ",")
+		c.Emoji = append(c.Emoji, Emoji{Char: char, Name: name, Category: category, Keywords: strings.Fields(keywords)})
+	}
+	return c
+}
+
+// categories are the emoji of the picker, in the order they are shown
+var categories = []Category{
+	e("smileys",
+		"😀 grinning face,smile happy",
+		"😃 grinning face with big eyes,smile happy",
+		"😄 grinning face with smiling eyes,smile happy laugh",
+		"😁 beaming face,grin",
+		"😆 grinning squinting face,laugh",
+		"😅 grinning face with sweat,relief",
+		"😂 face with tears of joy,laugh lol",
+		"🙂 slightly smiling face,smile",
+		"😉 winking face,wink",
+		"😊 smiling face with smiling eyes,blush",
+		"😍 smiling face with heart-eyes,love",
+		"😘 face blowing a kiss,love kiss",
+		"😎 smiling face with sunglasses,cool",
+		"🤔 thinking face,hmm think",
+		"😐 neutral face,meh",
+		"🙄 face with rolling eyes,eyeroll",
+		"😴 sleeping face,tired zzz",
+		"😮 face with open mouth,wow surprise",
+		"😢 crying face,sad tear",
+		"😭 loudly crying face,sad sob",
+		"😡 pouting face,angry mad",
+		"🤯 exploding head,mind blown",
+		"🥳 partying face,party celebrate",
+		"🤗 smiling face with open hands,hug",
+	),
+	e("people",
+		"👍 thumbs up,yes like ok +1",
+		"👎 thumbs down,no dislike -1",
+		"👏 clapping hands,applause bravo",
+		"🙌 raising hands,hooray celebrate",
+		"🙏 folded hands,please thanks pray",
+		"👋 waving hand,hello hi bye",
+		"🤝 handshake,deal agree",
+		"✌️ victory hand,peace",
+		"🤞 crossed fingers,luck hope",
+		"👌 ok hand,perfect",
+		"💪 flexed biceps,strong",
+		"👀 eyes,look see",
+		"🫡 saluting face,salute respect",
+		"🤷 person shrugging,shrug dunno",
+		"🤦 person facepalming,facepalm",
+	),
+	e("nature",
+		"🐶 dog face,puppy pet",
+		"🐱 cat face,kitten pet",
+		"🦊 fox,animal",
+		"🐻 bear,animal",
+		"🐼 panda,animal",
+		"🐸 frog,animal",
+		"🐙 octopus,animal",
+		"🦄 unicorn,magic",
+		"🐝 honeybee,bee",
+		"🌱 seedling,plant grow",
+		"🌸 cherry blossom,flower spring",
+		"🌻 sunflower,flower",
+		"🌈 rainbow,weather",
+		"☀️ sun,weather sunny",
+		"🌧️ cloud with rain,weather rainy",
+		"❄️ snowflake,weather cold winter",
+		"🔥 fire,hot lit",
+	),
+	e("food",
+		"🍎 red apple,fruit",
+		"🍌 banana,fruit",
+		"🍓 strawberry,fruit",
+		"🥑 avocado,fruit",
+		"🍕 pizza,food",
+		"🍔 hamburger,burger food",
+		"🌮 taco,food",
+		"🍣 sushi,food",
+		"🍩 doughnut,donut sweet",
+		"🍪 cookie,sweet",
+		"🎂 birthday cake,cake birthday",
+		"☕ hot beverage,coffee tea",
+		"🍺 beer mug,beer cheers",
+		"🍷 wine glass,wine",
+	),
+	e("activities",
+		"🎉 party popper,party tada celebrate",
+		"🎊 confetti ball,party celebrate",
+		"🎁 wrapped gift,present birthday",
+		"🏆 trophy,win award",
+		"🥇 first place medal,gold win",
+		"⚽ soccer ball,football sport",
+		"🏀 basketball,sport",
+		"🎮 video game,game controller",
+		"🎲 game die,dice game",
+		"🎵 musical note,music",
+		"🎨 artist palette,art paint",
+		"🚀 rocket,launch ship",
+	),
+	e("objects",
+		"💻 laptop,computer",
+		"📱 mobile phone,phone",
+		"⌨️ keyboard,computer",
+		"💡 light bulb,idea",
+		"📌 pushpin,pin",
+		"📎 paperclip,attachment",
+		"📝 memo,note write",
+		"📅 calendar,date",
+		"🔒 locked,lock security",
+		"🔑 key,password",
+		"🔧 wrench,tool fix",
+		"🐛 bug,insect",
+		"📦 package,box ship",
+		"⏰ alarm clock,time",
+	),
+	e("symbols",
+		"❤️ red heart,love",
+		"💔 broken heart,sad",
+		"💯 hundred points,100 perfect",
+		"✅ check mark button,done yes",
+		"❌ cross mark,no wrong",
+		"⚠️ warning,caution",
+		"❓ question mark,question",
+		"❗ exclamation mark,important",
+		"⭐ star,favorite",
+		"✨ sparkles,shiny new",
+		"➕ plus,add",
+		"🆗 ok button,ok",
+	),
+}
+
+// Categories returns the categories of the picker, in order
+func Categories() []Category {
+	return categories
+}
+
+// Lookup returns the emoji of a character
+func Lookup(char string) (Emoji, bool) {
+	for _, category := range categories {
+		for _, emoji := range category.Emoji {
+			if emoji.Char == char {
+				return emoji, true
+			}
+		}
+	}
+	return Emoji{}, false
+}
+
+// Search returns at most limit emoji whose name or a keyword contains
+// every word of the query, in any case, in category order
+func Search(query string, limit int) []Emoji {
+	words := strings.Fields(strings.ToLower(query))
+	found := []Emoji{}
+	for _, category := range categories {
+		for _, emoji := range category.Emoji {
+			if len(found) == limit {
+				return found
+			}
+			if emoji.matches(words) {
+				found = append(found, emoji)
+			}
+		}
+	}
+	return found
+}
+
+// matches reports whether the name or a keyword of the emoji contains
+// each of the words
+func (em Emoji) matches(words []string) bool {
+	text := em.Name + " " + strings.Join(em.Keywords, " ")
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package errorreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"htmx/internal/version"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Event is the subset of the Sentry event payload the application reports
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   []Exception       `json:"exception,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	User        *User             `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// Exception describes a recovered panic
+type Exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+}
+
+// Stacktrace lists the frames of a panic, oldest first
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Frame is a single stack frame
+type Frame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+// Request describes the HTTP request that failed
+type Request struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// User identifies who made the failing request
+type User struct {
+	Username  string `json:"username,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// Reporter sends events to a Sentry-compatible endpoint in the background.
+// A nil Reporter discards every event, so callers need not check whether
+// reporting is configured
+type Reporter struct {
+	endpoint    string
+	auth        string
+	environment string
+	events      chan *Event
+	client      *http.Client
+}
+
+// New creates a reporter for the DSN, returning nil when the DSN is empty
+func New(dsn, environment string) (*Reporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+
+	endpoint, key, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reporter{
+		endpoint:    endpoint,
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=htmx/%s, sentry_key=%s", version.Version, key),
+		environment: environment,
+		events:      make(chan *Event, 100),
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+	go r.run()
+	return r, nil
+}
+
+// ParseDSN splits a DSN of the form https://key@host/project into the store
+// endpoint and the public key
+func ParseDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid DSN: %w", err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.Scheme == "" || u.Host == "" || u.User == nil || project == "" {
+		return "", "", fmt.Errorf("invalid DSN %q: want scheme://key@host/project", dsn)
+	}
+
+	endpoint = fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project)
+	return endpoint, u.User.Username(), nil
+}
+
+// Report queues an event, dropping it if the queue is full
+func (r *Reporter) Report(event *Event) {
+	if r == nil {
+		return
+	}
+
+	event.EventID = newEventID()
+	event.Timestamp = time.Now().UTC()
+	event.Platform = "go"
+	event.Release = version.Version
+	event.Environment = r.environment
+	if event.Level == "" {
+		event.Level = "error"
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		log.Printf("Error report queue full, dropping event: %s", event.Message)
+	}
+}
+
+// run delivers queued events one at a time
+func (r *Reporter) run() {
+	for event := range r.events {
+		if err := r.send(event); err != nil {
+			log.Printf("Error report delivery failed: %v", err)
+		}
+	}
+}
+
+// send posts a single event to the store endpoint
+func (r *Reporter) send(event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// CaptureStack returns the frames of the calling goroutine, oldest first,
+// skipping the given number of callers
+func CaptureStack(skip int) *Stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{Function: frame.Function, Filename: frame.File, Lineno: frame.Line})
+		if !more {
+			break
+		}
+	}
+
+	// Sentry expects the most recent call last
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return &Stacktrace{Frames: stack}
+}
+
+// newEventID returns a random 32 character hex ID
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,102 @@
+package features
+
+import (
+	"hash/fnv"
+	"htmx/internal/config"
+	"sort"
+	"sync"
+)
+
+// Flag is the runtime state of a named feature flag
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Enabled turns the flag on for everyone
+	Enabled bool `json:"enabled"`
+	// Rollout turns the flag on for this percentage of visitors
+	Rollout int `json:"rollout"`
+}
+
+// Set holds the feature flags defined in config, which can be changed at runtime
+type Set struct {
+	flags map[string]*Flag
+	mutex sync.RWMutex
+}
+
+// NewSet creates a flag set from the configured definitions
+func NewSet(defs map[string]config.FlagConfig) *Set {
+	s := &Set{
+		flags: make(map[string]*Flag, len(defs)),
+	}
+	for name, def := range defs {
+		s.flags[name] = &Flag{
+			Name:        name,
+			Description: def.Description,
+			Enabled:     def.Enabled,
+			Rollout:     def.Rollout,
+		}
+	}
+	return s
+}
+
+// GetFlags returns all flags sorted by name
+func (s *Set) GetFlags() []Flag {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	flags := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		flags = append(flags, *flag)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+// GetFlag returns a flag by name
+func (s *Set) GetFlag(name string) (Flag, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	flag, exists := s.flags[name]
+	if !exists {
+		return Flag{}, false
+	}
+	return *flag, true
+}
+
+// UpdateFlag changes a flag at runtime, returning false if it is not defined
+func (s *Set) UpdateFlag(name string, enabled bool, rollout int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	flag, exists := s.flags[name]
+	if !exists {
+		return false
+	}
+
+	flag.Enabled = enabled
+	flag.Rollout = rollout
+	return true
+}
+
+// Evaluate returns the state of every flag for the given visitor. Rollouts are
+// deterministic, so a visitor stays in or out of a cohort across requests
+func (s *Set) Evaluate(visitorID string) map[string]bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	states := make(map[string]bool, len(s.flags))
+	for name, flag := range s.flags {
+		states[name] = flag.Enabled || (flag.Rollout > 0 && bucket(name, visitorID) < flag.Rollout)
+	}
+	return states
+}
+
+// bucket maps a visitor to a stable value in [0, 100) for the named flag
+func bucket(name, visitorID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + visitorID))
+	return int(h.Sum32() % 100)
+}
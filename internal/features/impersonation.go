@@ -0,0 +1,48 @@
+package features
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// ImpersonationCookie carries the signed impersonation of an admin
+	// viewing the site as a visitor
+	ImpersonationCookie = "impersonate"
+
+	// impersonationPrefix sets the payloads of impersonations apart from
+	// those of overrides, which are signed with the same secret
+	impersonationPrefix = "impersonate:"
+)
+
+// Impersonation is an admin viewing the site as a visitor: requests carry
+// the visitor's ID, and so get its flags and preferences
+type Impersonation struct {
+	VisitorID string `json:"visitor_id"`
+	// Name is the name the visitor last posted under, when known
+	Name      string    `json:"name,omitempty"`
+	Admin     string    `json:"admin"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignImpersonation encodes an impersonation into a signed cookie value
+func SignImpersonation(impersonation Impersonation, secret []byte) string {
+	payload, _ := json.Marshal(impersonation)
+	return sign(append([]byte(impersonationPrefix), payload...), secret)
+}
+
+// VerifyImpersonation decodes a value produced by SignImpersonation,
+// rejecting it if the signature does not match or it expired
+func VerifyImpersonation(value string, secret []byte, now time.Time) (Impersonation, bool) {
+	var impersonation Impersonation
+	payload, ok := verify(value, secret)
+	if !ok {
+		return impersonation, false
+	}
+	payload, ok = bytes.CutPrefix(payload, []byte(impersonationPrefix))
+	if !ok || json.Unmarshal(payload, &impersonation) != nil || impersonation.VisitorID == "" || !now.Before(impersonation.ExpiresAt) {
+		return Impersonation{}, false
+	}
+	return impersonation, true
+}
@@ -0,0 +1,90 @@
+package features
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// VisitorCookie identifies a browser for percentage rollouts
+	VisitorCookie = "visitor_id"
+
+	// flagsKey is the context key holding the evaluated flags
+	flagsKey = "featureFlags"
+	// visitorKey is the context key holding the visitor ID of the request
+	visitorKey = "visitorID"
+	// impersonationKey is the context key holding the impersonation of the
+	// request, if any
+	impersonationKey = "impersonation"
+)
+
+// Middleware evaluates the flags of the set for each request, applying any
+// overrides carried in a cookie or header signed with secret. A request
+// carrying a signed impersonation is handled as its visitor's, without the
+// overrides of the admin's browser, until it expires by the time now tells
+func Middleware(set *Set, secret []byte, secure bool, now func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		visitorID, err := c.Cookie(VisitorCookie)
+		if err != nil || visitorID == "" {
+			visitorID = uuid.New().String()
+			c.SetCookie(VisitorCookie, visitorID, 365*24*60*60, "/", "", secure, true)
+		}
+
+		value, _ := c.Cookie(ImpersonationCookie)
+		impersonation, impersonating := VerifyImpersonation(value, secret, now())
+		if impersonating {
+			visitorID = impersonation.VisitorID
+			c.Set(impersonationKey, impersonation)
+		}
+		c.Set(visitorKey, visitorID)
+
+		flags := set.Evaluate(visitorID)
+
+		value = c.GetHeader(OverridesHeader)
+		if value == "" {
+			value, _ = c.Cookie(OverridesCookie)
+		}
+		if overrides, ok := VerifyOverrides(value, secret); ok && !impersonating {
+			for name, enabled := range overrides {
+				// Only known flags can be overridden
+				if _, known := flags[name]; known {
+					flags[name] = enabled
+				}
+			}
+		}
+
+		c.Set(flagsKey, flags)
+		c.Next()
+	}
+}
+
+// FromContext returns the feature flags evaluated for the current request,
+// suitable for passing to templates
+func FromContext(c *gin.Context) map[string]bool {
+	if flags, ok := c.Get(flagsKey); ok {
+		return flags.(map[string]bool)
+	}
+	return map[string]bool{}
+}
+
+// VisitorID returns the ID of the browser of the current request, or of the
+// visitor an admin impersonates
+func VisitorID(c *gin.Context) string {
+	return c.GetString(visitorKey)
+}
+
+// ImpersonationFrom returns the impersonation of the current request, and
+// false when it is not impersonated
+func ImpersonationFrom(c *gin.Context) (Impersonation, bool) {
+	impersonation, ok := c.Get(impersonationKey)
+	if !ok {
+		return Impersonation{}, false
+	}
+	return impersonation.(Impersonation), true
+}
+
+// Enabled reports whether the named feature is enabled for the current request
+func Enabled(c *gin.Context, name string) bool {
+	return FromContext(c)[name]
+}
@@ -0,0 +1,85 @@
+package features
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"strings"
+)
+
+const (
+	// OverridesCookie is the cookie carrying signed flag overrides
+	OverridesCookie = "feature_flags"
+	// OverridesHeader is the header carrying signed flag overrides
+	OverridesHeader = "X-Feature-Flags"
+)
+
+// SignOverrides encodes flag overrides into a signed value usable as cookie or header
+func SignOverrides(overrides map[string]bool, secret []byte) string {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		state := "off"
+		if overrides[name] {
+			state = "on"
+		}
+		pairs = append(pairs, name+"="+state)
+	}
+
+	return sign([]byte(strings.Join(pairs, ",")), secret)
+}
+
+// VerifyOverrides decodes a value produced by SignOverrides, rejecting it if the signature does not match
+func VerifyOverrides(value string, secret []byte) (map[string]bool, bool) {
+	payload, ok := verify(value, secret)
+	if !ok {
+		return nil, false
+	}
+
+	overrides := make(map[string]bool)
+	for _, pair := range strings.Split(string(payload), ",") {
+		name, state, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		overrides[name] = state == "on"
+	}
+	return overrides, true
+}
+
+// sign encodes a payload with its signature
+func sign(payload, secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature(payload, secret))
+}
+
+// verify decodes a value produced by sign, rejecting it if the signature
+// does not match
+func verify(value string, secret []byte) ([]byte, bool) {
+	encoded, sig, found := strings.Cut(value, ".")
+	if !found {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signature(payload, secret)) {
+		return nil, false
+	}
+	return payload, true
+}
+
+// signature computes the HMAC of the payload
+func signature(payload, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
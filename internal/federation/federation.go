@@ -0,0 +1,304 @@
+// Package federation relays the messages of shared rooms between instances.
+//
+// Each instance lists its peers with a shared secret and the names of the
+// rooms it shares with them. New messages in those rooms are POSTed to the
+// peers as signed events, which peers relay on to their own peers. Events
+// carry the instances they have passed through, so they never loop back, and
+// each instance ignores events it has already seen.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"htmx/internal/clock"
+	"htmx/internal/config"
+	"htmx/internal/webhooks"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request headers sent with every event
+const (
+	PeerHeader      = "X-Federation-Peer"
+	TimestampHeader = "X-Federation-Timestamp"
+	SignatureHeader = "X-Federation-Signature"
+)
+
+// Path is where peers receive events
+const Path = "/federation/events"
+
+const (
+	// maxSkew bounds the age of an accepted event, limiting replays
+	maxSkew = 5 * time.Minute
+	// seenFor is how long event IDs are remembered for deduplication
+	seenFor = time.Hour
+	// maxAttempts is how often a delivery is tried before it is dropped
+	maxAttempts = 5
+	// queueSize bounds the deliveries waiting to be sent
+	queueSize = 256
+)
+
+// Errors returned by Verify and Accept
+var (
+	ErrUnknownPeer  = errors.New("unknown peer")
+	ErrBadSignature = errors.New("invalid signature")
+	ErrNotShared    = errors.New("room is not shared with this peer")
+	ErrDuplicate    = errors.New("event already seen")
+)
+
+// Event is a message relayed between instances
+type Event struct {
+	// ID is the message ID at its origin; with Origin it identifies the event
+	ID     string `json:"id"`
+	Origin string `json:"origin"`
+	// Path lists the instances the event has passed through, origin first
+	Path      []string  `json:"path"`
+	Room      string    `json:"room"`
+	Username  string    `json:"username"`
+	Message   string    `json:"message"`
+	Bot       bool      `json:"bot,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// key identifies the event across instances
+func (e *Event) key() string {
+	return e.Origin + "/" + e.ID
+}
+
+// delivery is a pending POST of an event to a peer
+type delivery struct {
+	peer     config.PeerConfig
+	body     []byte
+	attempts int
+}
+
+// Relay sends events to peers and checks the events they send
+type Relay struct {
+	name   string
+	peers  []config.PeerConfig
+	client *http.Client
+	queue  chan *delivery
+	seen   map[string]time.Time
+	clock  clock.Clock
+	mutex  sync.Mutex
+}
+
+// New creates a relay for the configured peers
+func New(cfg config.FederationConfig) *Relay {
+	return &Relay{
+		name:   cfg.Name,
+		peers:  cfg.Peers,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *delivery, queueSize),
+		seen:   make(map[string]time.Time),
+		clock:  clock.Real,
+	}
+}
+
+// SetClock replaces the clock timing the retries, the signatures and how
+// long events are remembered. Call it at startup, before the relay runs
+func (r *Relay) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Name returns the name of this instance
+func (r *Relay) Name() string {
+	return r.name
+}
+
+// Run delivers queued events until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d := <-r.queue:
+				r.deliver(ctx, d)
+			}
+		}
+	}()
+}
+
+// Publish sends a local message to the peers that share its room
+func (r *Relay) Publish(event Event) {
+	event.Origin = r.name
+	event.Path = nil
+	r.markSeen(event.key())
+	r.Forward(event)
+}
+
+// Forward sends an event on to the peers that share its room and have not
+// seen it yet, adding this instance to its path
+func (r *Relay) Forward(event Event) {
+	event.Path = append(slices.Clone(event.Path), r.name)
+
+	var body []byte
+	for _, peer := range r.peers {
+		if !shares(peer, event.Room) || peer.Name == event.Origin || slices.Contains(event.Path, peer.Name) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(event); err != nil {
+				slog.Error("encoding federation event", "error", err)
+				return
+			}
+		}
+		r.enqueue(&delivery{peer: peer, body: body})
+	}
+}
+
+// Verify checks the peer and signature of a received request body
+func (r *Relay) Verify(req *http.Request, body []byte) (config.PeerConfig, error) {
+	name := req.Header.Get(PeerHeader)
+	i := slices.IndexFunc(r.peers, func(peer config.PeerConfig) bool { return peer.Name == name })
+	if i < 0 {
+		return config.PeerConfig{}, ErrUnknownPeer
+	}
+	peer := r.peers[i]
+
+	timestamp := req.Header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || r.clock.Now().Sub(time.Unix(unix, 0)).Abs() > maxSkew {
+		return peer, ErrBadSignature
+	}
+
+	signature, _ := strings.CutPrefix(req.Header.Get(SignatureHeader), "sha256=")
+	if !hmac.Equal([]byte(signature), []byte(sign(peer.Secret, timestamp, body))) {
+		return peer, ErrBadSignature
+	}
+	return peer, nil
+}
+
+// Accept checks that an event from a peer may be posted here, and marks it seen
+func (r *Relay) Accept(peer config.PeerConfig, event Event) error {
+	if !shares(peer, event.Room) {
+		return ErrNotShared
+	}
+	if event.Origin == r.name || slices.Contains(event.Path, r.name) {
+		return ErrDuplicate
+	}
+	if !r.markSeen(event.key()) {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// Forget unmarks an accepted event that could not be posted, so the peer
+// delivering it again is not refused as a duplicate
+func (r *Relay) Forget(event Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.seen, event.key())
+}
+
+// markSeen records an event, reporting false if it had been seen already
+func (r *Relay) markSeen(key string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.clock.Now()
+	if seenAt, ok := r.seen[key]; ok && now.Sub(seenAt) < seenFor {
+		return false
+	}
+	r.seen[key] = now
+
+	// Forget old events once in a while rather than on every call
+	if len(r.seen)%1024 == 0 {
+		for k, seenAt := range r.seen {
+			if now.Sub(seenAt) >= seenFor {
+				delete(r.seen, k)
+			}
+		}
+	}
+	return true
+}
+
+// enqueue queues a delivery without blocking, dropping it when the queue is full
+func (r *Relay) enqueue(d *delivery) {
+	select {
+	case r.queue <- d:
+	default:
+		slog.Warn("federation queue full, dropped event", "peer", d.peer.Name)
+	}
+}
+
+// deliver posts an event once, retrying with exponential backoff on failure
+func (r *Relay) deliver(ctx context.Context, d *delivery) {
+	d.attempts++
+	err := r.post(ctx, d)
+	if err == nil {
+		slog.Debug("federation event delivered", "peer", d.peer.Name, "attempts", d.attempts)
+		return
+	}
+
+	if d.attempts >= maxAttempts {
+		slog.Warn("federation delivery failed, dropped event", "peer", d.peer.Name, "attempts", d.attempts, "error", err)
+		return
+	}
+
+	delay := time.Second << (d.attempts - 1)
+	slog.Debug("federation delivery failed, retrying", "peer", d.peer.Name, "in", delay, "error", err)
+	timer := r.clock.NewTimer(delay)
+	go func() {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C():
+			r.enqueue(d)
+		}
+	}()
+}
+
+// post sends the signed event to the peer
+func (r *Relay) post(ctx context.Context, d *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(d.peer.URL, "/")+Path, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(r.clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "htmx-chat-federation")
+	req.Header.Set(PeerHeader, r.name)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+sign(d.peer.Secret, timestamp, d.body))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// A duplicate is as good as a delivery
+	if resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// sign returns the signature of a body sent at timestamp
+func sign(secret, timestamp string, body []byte) string {
+	return webhooks.Sign(secret, append([]byte(timestamp+"."), body...))
+}
+
+// shares reports whether a room is shared with the peer
+func shares(peer config.PeerConfig, room string) bool {
+	return slices.ContainsFunc(peer.Rooms, func(name string) bool {
+		return strings.EqualFold(name, room)
+	})
+}
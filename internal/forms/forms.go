@@ -0,0 +1,187 @@
+// Package forms validates form submissions on the server and shows the
+// errors next to their fields.
+//
+// Every validated field has an error slot with the ID
+// "<form>-<field>-error", rendered empty along with the form by
+// {{ template "partials/field-error.html" (fieldError "form" "field") }}.
+// Bind maps the binding errors of a submission to its fields, and Render
+// answers 422 with out-of-band swaps filling the slots of the invalid
+// fields and emptying the others. The form itself is not swapped, so the
+// values typed in stay as they were. Clear empties the slots once a
+// submission succeeds.
+//
+// Fields tagged sanitize:"message", "name" or "query" are normalized by the
+// sanitize package before they are validated, and the "message",
+// "room_name" and "username" validation tags cap them at its lengths.
+package forms
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"htmx/internal/i18n"
+	"htmx/internal/sanitize"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterAlias("message", "max="+strconv.Itoa(sanitize.MaxMessage))
+		v.RegisterAlias("room_name", "max="+strconv.Itoa(sanitize.MaxRoomName))
+		v.RegisterAlias("username", "max="+strconv.Itoa(sanitize.MaxUsername))
+	}
+}
+
+// Errors maps the form names of invalid fields to their messages
+type Errors map[string]string
+
+// FieldError is the data of partials/field-error.html
+type FieldError struct {
+	ID      string
+	Message string
+	// OOB marks slots swapped out of band by Render and Clear
+	OOB bool
+}
+
+// SlotID returns the ID of the error slot of a field
+func SlotID(form, field string) string {
+	return form + "-" + field + "-error"
+}
+
+// Slot returns the empty error slot of a field, for rendering a form
+func Slot(form, field string) FieldError {
+	return FieldError{ID: SlotID(form, field)}
+}
+
+// ID returns the ID of the submitted form, which htmx sends as HX-Trigger,
+// or fallback for requests without one; pages showing the same form twice
+// give each copy its own ID
+func ID(c *gin.Context, fallback string) string {
+	if id := c.GetHeader("HX-Trigger"); id != "" {
+		return id
+	}
+	return fallback
+}
+
+// messages are the validation tags with a message of their own; the others
+// use "validation.invalid"
+var messages = map[string]bool{"required": true, "min": true, "max": true, "url": true, "email": true, "oneof": true}
+
+// Bind binds the request into input, a pointer to a struct, as
+// c.ShouldBind does. Failed validations are returned as Errors, with
+// messages from the locale naming each field by the translation of its
+// label tag; other errors, such as bodies over the upload limit, are
+// returned as they are.
+func Bind(c *gin.Context, input any) (Errors, error) {
+	err := bindSanitized(input, c.ShouldBind)
+	if err == nil {
+		return nil, nil
+	}
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return nil, err
+	}
+
+	locale := i18n.FromContext(c)
+	fields := make(Errors, len(invalid))
+	for _, failed := range invalid {
+		name, label := tags(input, failed.StructField())
+		if _, seen := fields[name]; seen {
+			continue
+		}
+		key := "validation.invalid"
+		if messages[failed.ActualTag()] {
+			key = "validation." + failed.ActualTag()
+		}
+		fields[name] = locale.T(key, "field", locale.T(label), "param", failed.Param())
+	}
+	return fields, nil
+}
+
+// BindJSON binds a JSON body into input as c.ShouldBindJSON does, with its
+// fields sanitized before they are validated as Bind does
+func BindJSON(c *gin.Context, input any) error {
+	return bindSanitized(input, c.ShouldBindJSON)
+}
+
+// bindSanitized binds the request with bind, sanitizes the bound fields and
+// only then validates them, so input that is blank once normalized fails
+// "required"
+func bindSanitized(input any, bind func(any) error) error {
+	if err := bind(input); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			return err
+		}
+	}
+	sanitize.Struct(input)
+	return binding.Validator.ValidateStruct(input)
+}
+
+// Render answers 422 with the errors of a submission, leaving the form in
+// place and swapping every error slot of its fields out of band
+func Render(c *gin.Context, form string, input any, errs Errors) {
+	c.Header("HX-Reswap", "none")
+	c.HTML(http.StatusUnprocessableEntity, "partials/form-errors.html", gin.H{
+		"form":   form,
+		"fields": slots(form, input, errs),
+	})
+}
+
+// Clear appends out-of-band swaps emptying the error slots of a form to a
+// successful response
+func Clear(c *gin.Context, form string, input any) {
+	c.HTML(c.Writer.Status(), "partials/form-errors.html", gin.H{
+		"form":   form,
+		"fields": slots(form, input, nil),
+	})
+}
+
+// slots returns the error slots of the fields of input
+func slots(form string, input any, errs Errors) []FieldError {
+	var fields []FieldError
+	for _, name := range names(input) {
+		fields = append(fields, FieldError{ID: SlotID(form, name), Message: errs[name], OOB: true})
+	}
+	return fields
+}
+
+// names returns the form names of the fields of input
+func names(input any) []string {
+	t := reflect.Indirect(reflect.ValueOf(input)).Type()
+	var names []string
+	for i := range t.NumField() {
+		if name := formName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// tags returns the form name and label of a field of input; fields without
+// a label are named by their form name
+func tags(input any, field string) (name, label string) {
+	t := reflect.Indirect(reflect.ValueOf(input)).Type()
+	f, ok := t.FieldByName(field)
+	if !ok {
+		return field, field
+	}
+	name = formName(f)
+	if label = f.Tag.Get("label"); label == "" {
+		label = name
+	}
+	return name, label
+}
+
+// formName returns the name of a field in the form, without tag options
+func formName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/logging"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminAudit renders the audit log page
+func (h *Handler) AdminAudit(c *gin.Context) {
+	filter := models.AuditFilter{
+		Actor:  strings.TrimSpace(c.Query("actor")),
+		Action: c.Query("action"),
+	}
+	status := http.StatusOK
+	from, okFrom := auditDate(c, "from")
+	to, okTo := auditDate(c, "to")
+	if !okFrom || !okTo {
+		status = http.StatusBadRequest
+	}
+	filter.From = from
+	if !to.IsZero() {
+		// The to date is included
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	entries := h.AuditStore.Query(filter)
+	matched := len(entries)
+	if len(entries) > auditPageSize {
+		entries = entries[:auditPageSize]
+	}
+	data := gin.H{
+		"title":       "Audit Log",
+		"entries":     entries,
+		"matched":     matched,
+		"actor":       filter.Actor,
+		"action":      filter.Action,
+		"from":        c.Query("from"),
+		"to":          c.Query("to"),
+		"actionTypes": auditActionTypes(h.AuditStore.Actions()),
+		"Page":        "audit",
+	}
+
+	if c.GetHeader("HX-Target") == "audit-results" {
+		c.HTML(status, "partials/admin-audit-results.html", data)
+		return
+	}
+	if partial(c) {
+		c.HTML(status, "partials/admin-audit.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
+
+// auditDate reads a date of the audit log filter, in UTC; an empty or
+// invalid one is zero, and an invalid one is reported in a toast
+func auditDate(c *gin.Context, param string) (time.Time, bool) {
+	value := c.Query(param)
+	if value == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		toasts.Add(c, toasts.Error, "The "+param+" date must be like 2006-01-02")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// auditPageSize is how many of the matching entries the audit log shows
+const auditPageSize = 200
+
+// auditActionType is a type of action on the audit log filter, such as
+// room, with its actions
+type auditActionType struct {
+	Type    string
+	Actions []string
+}
+
+// auditActionTypes groups sorted action names by the type before their
+// first dot; names without one, the routes of unnamed actions, are each
+// their own type
+func auditActionTypes(actions []string) []auditActionType {
+	var types []auditActionType
+	for _, action := range actions {
+		kind, _, ok := strings.Cut(action, ".")
+		if !ok {
+			types = append(types, auditActionType{Actions: []string{action}})
+			continue
+		}
+		if n := len(types); n > 0 && types[n-1].Type == kind {
+			types[n-1].Actions = append(types[n-1].Actions, action)
+			continue
+		}
+		types = append(types, auditActionType{Type: kind, Actions: []string{action}})
+	}
+	return types
+}
+
+// flagRow describes a feature flag on the admin flags page
+type flagRow struct {
+	features.Flag
+	Browser    bool
+	Overridden bool
+}
+
+// AdminFlags renders the feature flags page
+func (h *Handler) AdminFlags(c *gin.Context) {
+	h.renderAdminFlags(c, h.flagOverrides(c))
+}
+
+// UpdateFlag changes a feature flag for everyone at runtime
+func (h *Handler) UpdateFlag(c *gin.Context) {
+	var input struct {
+		Enabled bool `form:"enabled"`
+		Rollout int  `form:"rollout" binding:"min=0,max=100"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	before, _ := h.Features.GetFlag(c.Param("name"))
+	if !h.Features.UpdateFlag(c.Param("name"), input.Enabled, input.Rollout) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	after, _ := h.Features.GetFlag(c.Param("name"))
+	middleware.SetAuditChange(c, before, after)
+	toasts.Add(c, toasts.Success, "Flag "+c.Param("name")+" updated")
+
+	h.renderAdminFlags(c, h.flagOverrides(c))
+}
+
+// OverrideFlag sets or clears a feature flag override for the current browser
+func (h *Handler) OverrideFlag(c *gin.Context) {
+	var input struct {
+		Name  string `form:"name" binding:"required"`
+		State string `form:"state" binding:"required,oneof=on off default"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if _, known := h.Features.GetFlag(input.Name); !known {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	overrides := h.flagOverrides(c)
+	middleware.SetAuditChange(c, flagOverride(input.Name, overrides), gin.H{"name": input.Name, "state": input.State})
+	if input.State == "default" {
+		delete(overrides, input.Name)
+		toasts.Add(c, toasts.Success, "Override of "+input.Name+" cleared")
+	} else {
+		overrides[input.Name] = input.State == "on"
+		toasts.Add(c, toasts.Success, "Flag "+input.Name+" turned "+input.State+" for this browser")
+	}
+
+	c.SetCookie(features.OverridesCookie, features.SignOverrides(overrides, []byte(h.Config.Features.Secret)), 0, "/", "", h.Config.Server.TLS.Enabled(), true)
+	h.renderAdminFlags(c, overrides)
+}
+
+// flagOverride describes the override of a flag for the audit log
+func flagOverride(name string, overrides map[string]bool) gin.H {
+	state := "default"
+	if enabled, ok := overrides[name]; ok {
+		state = map[bool]string{true: "on", false: "off"}[enabled]
+	}
+	return gin.H{"name": name, "state": state}
+}
+
+// flagOverrides returns the verified flag overrides of the current browser
+func (h *Handler) flagOverrides(c *gin.Context) map[string]bool {
+	cookie, _ := c.Cookie(features.OverridesCookie)
+	overrides, ok := features.VerifyOverrides(cookie, []byte(h.Config.Features.Secret))
+	if !ok {
+		return make(map[string]bool)
+	}
+	return overrides
+}
+
+// renderAdminFlags renders the flags page for the given overrides
+func (h *Handler) renderAdminFlags(c *gin.Context, overrides map[string]bool) {
+	visitorID, _ := c.Cookie(features.VisitorCookie)
+	states := h.Features.Evaluate(visitorID)
+
+	flags := h.Features.GetFlags()
+	rows := make([]flagRow, 0, len(flags))
+	for _, flag := range flags {
+		row := flagRow{Flag: flag, Browser: states[flag.Name]}
+		if enabled, ok := overrides[flag.Name]; ok {
+			row.Browser = enabled
+			row.Overridden = true
+		}
+		rows = append(rows, row)
+	}
+
+	data := gin.H{
+		"title": "Feature Flags",
+		"flags": rows,
+		"Page":  "flags",
+	}
+
+	if partial(c) {
+		c.HTML(http.StatusOK, "partials/admin-flags.html", data)
+		return
+	}
+
+	renderLayout(c, http.StatusOK, "layouts/admin.html", data)
+}
+
+// AdminLogLevel renders the log level page
+func (h *Handler) AdminLogLevel(c *gin.Context) {
+	h.renderAdminLogLevel(c, http.StatusOK, "")
+}
+
+// SetLogLevel changes the level of the application log at runtime
+func (h *Handler) SetLogLevel(c *gin.Context) {
+	var input struct {
+		Level string `form:"level" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminLogLevel(c, http.StatusBadRequest, "Choose a log level")
+		return
+	}
+	before := logging.Level()
+	if err := logging.SetLevel(input.Level); err != nil {
+		h.renderAdminLogLevel(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.SetAuditChange(c, gin.H{"level": before}, gin.H{"level": logging.Level()})
+	slog.Info("log level changed", "level", logging.Level(), "by", c.GetString(gin.AuthUserKey))
+	toasts.Add(c, toasts.Success, "Log level set to "+logging.Level())
+	h.renderAdminLogLevel(c, http.StatusOK, "")
+}
+
+// renderAdminLogLevel renders the log level page with an optional error
+func (h *Handler) renderAdminLogLevel(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	data := gin.H{
+		"title":  "Log Level",
+		"level":  logging.Level(),
+		"levels": logging.Levels,
+		"error":  errMsg,
+		"Page":   "log-level",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-log-level.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
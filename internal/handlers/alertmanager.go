@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// alertmanagerPayload is the body of an Alertmanager webhook notification (version 4)
+type alertmanagerPayload struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []alertmanagerAlert `json:"alerts" binding:"required"`
+}
+
+// alertmanagerAlert is one alert of a notification
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// severityMarkers stand in for colors in the plain-text messages
+var severityMarkers = map[string]string{
+	"critical": "🔴",
+	"error":    "🔴",
+	"warning":  "🟠",
+	"info":     "🔵",
+}
+
+// AlertmanagerWebhook posts the firing and resolved alerts of an Alertmanager
+// notification into the configured room, or the one named by ?room=
+func (h *Handler) AlertmanagerWebhook(c *gin.Context) {
+	cfg := h.Config.Integrations.Alertmanager
+	if cfg.Token != "" {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="Alertmanager"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+	}
+	middleware.SetAuditActor(c, "alertmanager")
+
+	var payload alertmanagerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		status, message := h.bindError(c, err, "invalid Alertmanager payload")
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	room, err := h.alertRoom(c.DefaultQuery("room", cfg.Room))
+	if errors.Is(err, errNotSaved) {
+		storeFailedJSON(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := cfg.Username
+	if username == "" {
+		username = "Alertmanager"
+	}
+
+	// Firing alerts first, then resolved ones, one message each
+	var posted []*models.Chat
+	for _, status := range []string{"firing", "resolved"} {
+		text := formatAlerts(payload, status)
+		if text == "" {
+			continue
+		}
+		if h.roomFull(room.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "room has reached its message limit"})
+			return
+		}
+
+		chat := &models.Chat{
+			ID:        uuid.New().String(),
+			RoomID:    room.ID,
+			Username:  username,
+			Message:   text,
+			Bot:       true,
+			CreatedAt: h.clock.Now(),
+		}
+		if err := h.addChat(chat); err != nil {
+			storeFailedJSON(c, err)
+			return
+		}
+		posted = append(posted, chat)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": room.ID, "messages": len(posted)})
+}
+
+// alertRoom finds the room alerts go to by ID or name, creating a named room that does not exist yet
+func (h *Handler) alertRoom(ref string) (*models.Room, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("no room configured for alerts")
+	}
+	if room, exists := h.RoomStore.GetRoom(ref); exists {
+		return room, nil
+	}
+	return h.namedRoom(ref)
+}
+
+// formatAlerts renders the alerts of a notification with the given status as
+// one message, or "" when there are none
+func formatAlerts(payload alertmanagerPayload, status string) string {
+	var alerts []alertmanagerAlert
+	for _, alert := range payload.Alerts {
+		if alert.Status == status {
+			alerts = append(alerts, alert)
+		}
+	}
+	if len(alerts) == 0 {
+		return ""
+	}
+
+	// What the alerts share is shown once, above the alerts
+	common := alerts[0].Labels
+	annotations := alerts[0].Annotations
+	if len(alerts) > 1 {
+		common = payload.CommonLabels
+		annotations = payload.CommonAnnotations
+	}
+
+	marker := "✅"
+	if status == "firing" {
+		marker = severityMarker(common["severity"])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s:%d] %s", marker, strings.ToUpper(status), len(alerts), common["alertname"])
+	if summary := annotations["summary"]; summary != "" {
+		b.WriteString(" - " + summary)
+	}
+	if labels := formatLabels(common, nil); labels != "" {
+		b.WriteString("\n" + labels)
+	}
+	if description := annotations["description"]; description != "" {
+		b.WriteString("\n" + description)
+	}
+	if runbook := annotations["runbook_url"]; runbook != "" {
+		b.WriteString("\nRunbook: " + runbook)
+	}
+
+	indent := ""
+	if len(alerts) > 1 {
+		indent = "  "
+	}
+	for _, alert := range alerts {
+		if len(alerts) > 1 {
+			b.WriteString("\n• ")
+			if status == "firing" && common["severity"] == "" {
+				b.WriteString(severityMarker(alert.Labels["severity"]) + " ")
+			}
+			b.WriteString(formatLabels(alert.Labels, common))
+			for _, key := range []string{"summary", "description"} {
+				if text := alert.Annotations[key]; text != "" && text != annotations[key] {
+					b.WriteString(" - " + text)
+				}
+			}
+			if runbook := alert.Annotations["runbook_url"]; runbook != "" && runbook != annotations["runbook_url"] {
+				b.WriteString("\n  Runbook: " + runbook)
+			}
+		}
+		if status == "resolved" && !alert.StartsAt.IsZero() && alert.EndsAt.After(alert.StartsAt) {
+			fmt.Fprintf(&b, "\n%sLasted %s", indent, alert.EndsAt.Sub(alert.StartsAt).Round(time.Second))
+		}
+		if alert.GeneratorURL != "" {
+			b.WriteString("\n" + indent + "Source: " + alert.GeneratorURL)
+		}
+	}
+	return b.String()
+}
+
+// formatLabels lists labels as sorted key=value pairs, leaving out alertname
+// and those equal in shared
+func formatLabels(labels, shared map[string]string) string {
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if value, ok := shared[key]; key == "alertname" || (ok && value == labels[key]) {
+			continue
+		}
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// severityMarker returns the marker of a severity label
+func severityMarker(severity string) string {
+	if marker, ok := severityMarkers[strings.ToLower(severity)]; ok {
+		return marker
+	}
+	return "⚪"
+}
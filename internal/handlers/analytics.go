@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/analytics"
+	"htmx/internal/charts"
+	"htmx/internal/toasts"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// analyticsRooms is how many of the busiest rooms the analytics page charts
+const analyticsRooms = 10
+
+// AdminAnalytics renders the charts of the activity over a range, and the
+// form of the analytics exports
+func (h *Handler) AdminAnalytics(c *gin.Context) {
+	status := http.StatusOK
+	r, err := analytics.ParseRange(c.Query("from"), c.Query("to"), c.Query("interval"), h.clock.Now())
+	if err != nil {
+		toasts.Add(c, toasts.Error, err.Error())
+		status = http.StatusBadRequest
+		r, _ = analytics.ParseRange("", "", "", h.clock.Now())
+	}
+
+	data, rolledUpAt, ok := h.rolledUpAnalytics(r)
+	if ok {
+		data["rolledUpAt"] = rolledUpAt
+	} else {
+		data = h.analyticsCharts(r)
+	}
+	data["title"] = "Analytics"
+	data["from"] = r.From.Format(time.DateOnly)
+	data["to"] = r.To.AddDate(0, 0, -1).Format(time.DateOnly)
+	data["interval"] = r.Interval
+	data["intervals"] = analytics.Intervals
+	data["Page"] = "analytics"
+
+	if c.GetHeader("HX-Target") == "analytics-charts" {
+		c.HTML(status, "partials/admin-analytics-charts.html", data)
+		return
+	}
+	if partial(c) {
+		c.HTML(status, "partials/admin-analytics.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
+
+// analyticsCharts lays out the charts of the messages, active users and
+// peak connections per interval, and ranks the busiest rooms
+func (h *Handler) analyticsCharts(r analytics.Range) gin.H {
+	chats := h.ChatStore.GetChats()
+	volume := analytics.MessageVolume(chats, r)
+	users := analytics.ActiveUsers(chats, r)
+	peaks := h.Connections.PeakConnections(r)
+
+	labels := make([]string, len(volume))
+	people, bots := make([]int, len(volume)), make([]int, len(volume))
+	returning, newUsers := make([]int, len(users)), make([]int, len(users))
+	connections := make([]int, len(peaks))
+	for i, row := range volume {
+		labels[i] = chartLabel(row.Start, r.Interval)
+		people[i], bots[i] = row.Messages-row.Bot, row.Bot
+	}
+	for i, row := range users {
+		returning[i], newUsers[i] = row.Active-row.New, row.New
+	}
+	for i, row := range peaks {
+		connections[i] = row.Connections
+	}
+
+	rooms := analytics.RoomActivity(h.RoomStore.GetRooms(), chats, r)
+	if len(rooms) > analyticsRooms {
+		rooms = rooms[:analyticsRooms]
+	}
+	busiest := 0
+	if len(rooms) > 0 {
+		busiest = rooms[0].Messages
+	}
+
+	return gin.H{
+		"messagesChart":    charts.Stacked("Messages", labels, charts.Series{Name: "by people", Values: people}, charts.Series{Name: "by bots", Values: bots}),
+		"usersChart":       charts.Stacked("Active users", labels, charts.Series{Name: "returning", Values: returning}, charts.Series{Name: "new", Values: newUsers}),
+		"connectionsChart": charts.Stacked("Peak connections", labels, charts.Series{Name: "connections", Values: connections}),
+		"roomActivity":     rooms,
+		"busiest":          busiest,
+	}
+}
+
+// chartLabel formats the start of a bucket for the time axis of a chart
+func chartLabel(start time.Time, interval string) string {
+	if interval == "hour" {
+		return start.Format("Jan 02 15:04")
+	}
+	return start.Format("Jan 02")
+}
+
+// ExportMessageVolume streams the number of messages per interval as CSV
+func (h *Handler) ExportMessageVolume(c *gin.Context) {
+	r, ok := h.analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	w := csvExport(c, "messages", r)
+	w.Write([]string{"start", "messages", "bot_messages"})
+	for _, row := range analytics.MessageVolume(h.ChatStore.GetChats(), r) {
+		w.Write([]string{row.Start.Format(time.RFC3339), strconv.Itoa(row.Messages), strconv.Itoa(row.Bot)})
+	}
+	w.Flush()
+}
+
+// ExportActiveUsers streams the number of distinct authors per interval as CSV
+func (h *Handler) ExportActiveUsers(c *gin.Context) {
+	r, ok := h.analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	w := csvExport(c, "users", r)
+	w.Write([]string{"start", "active_users", "new_users"})
+	for _, row := range analytics.ActiveUsers(h.ChatStore.GetChats(), r) {
+		w.Write([]string{row.Start.Format(time.RFC3339), strconv.Itoa(row.Active), strconv.Itoa(row.New)})
+	}
+	w.Flush()
+}
+
+// ExportPeakConnections streams the highest number of concurrent
+// connections per interval as CSV
+func (h *Handler) ExportPeakConnections(c *gin.Context) {
+	r, ok := h.analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	w := csvExport(c, "connections", r)
+	w.Write([]string{"start", "peak_connections"})
+	for _, row := range h.Connections.PeakConnections(r) {
+		w.Write([]string{row.Start.Format(time.RFC3339), strconv.Itoa(row.Connections)})
+	}
+	w.Flush()
+}
+
+// ExportRoomActivity streams a summary of every room over the range as CSV
+func (h *Handler) ExportRoomActivity(c *gin.Context) {
+	r, ok := h.analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	w := csvExport(c, "rooms", r)
+	w.Write([]string{"room_id", "room", "messages", "active_users", "first_message", "last_message"})
+	for _, row := range analytics.RoomActivity(h.RoomStore.GetRooms(), h.ChatStore.GetChats(), r) {
+		w.Write([]string{
+			row.Room.ID,
+			row.Room.Name,
+			strconv.Itoa(row.Messages),
+			strconv.Itoa(row.ActiveUsers),
+			csvTime(row.FirstMessage),
+			csvTime(row.LastMessage),
+		})
+	}
+	w.Flush()
+}
+
+// analyticsRange reads the from, to and interval query parameters, answering
+// 400 when they are invalid
+func (h *Handler) analyticsRange(c *gin.Context) (analytics.Range, bool) {
+	r, err := analytics.ParseRange(c.Query("from"), c.Query("to"), c.Query("interval"), h.clock.Now())
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return r, false
+	}
+	return r, true
+}
+
+// csvExport sets the headers of a CSV download and returns a writer for its rows
+func csvExport(c *gin.Context, name string, r analytics.Range) *csv.Writer {
+	filename := name + "-" + r.From.Format(time.DateOnly) + "-" + r.To.AddDate(0, 0, -1).Format(time.DateOnly) + ".csv"
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+	return csv.NewWriter(c.Writer)
+}
+
+// csvTime formats a time for a CSV cell, leaving zero times empty
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/features"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// announcementInterval is how often the announcements due are cross-posted
+const announcementInterval = 15 * time.Second
+
+// announcementTimeLayout is the format of the datetime-local inputs of the
+// composer, in the server's time zone as formatTime shows times
+const announcementTimeLayout = "2006-01-02T15:04"
+
+// StartAnnouncements cross-posts the scheduled announcements into their
+// rooms as their windows start, until ctx is done
+func (h *Handler) StartAnnouncements(ctx context.Context) {
+	go func() {
+		for {
+			timer := h.clock.NewTimer(announcementInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+				h.postAnnouncements()
+			}
+		}
+	}()
+}
+
+// postAnnouncements cross-posts the announcements whose window started
+func (h *Handler) postAnnouncements() {
+	for _, a := range h.Announcements.TakeDue(h.clock.Now()) {
+		for _, roomID := range a.Rooms {
+			h.postBotMessage(roomID, h.Config.Branding.Name, a.Message)
+		}
+		slog.Info("announcement cross-posted", "announcement", a.ID, "rooms", len(a.Rooms))
+	}
+}
+
+// GetAnnouncements renders the banners shown to the visitor now
+func (h *Handler) GetAnnouncements(c *gin.Context) {
+	visitorID := features.VisitorID(c)
+	render(c, http.StatusOK, "partials/announcements.html", gin.H{
+		"announcements": h.Announcements.Showing(visitorID, h.clock.Now()),
+	})
+}
+
+// DismissAnnouncement hides a banner from the visitor for good, answering
+// with nothing in its place
+func (h *Handler) DismissAnnouncement(c *gin.Context) {
+	visitorID := features.VisitorID(c)
+	if visitorID == "" {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if !h.Announcements.Dismiss(c.Param("id"), visitorID) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// AdminAnnouncements renders the scheduled announcements with the composer
+func (h *Handler) AdminAnnouncements(c *gin.Context) {
+	h.renderAdminAnnouncements(c, http.StatusOK, "")
+}
+
+// CreateAnnouncement schedules a banner for a time window, cross-posted into
+// the rooms picked once it starts
+func (h *Handler) CreateAnnouncement(c *gin.Context) {
+	var input struct {
+		Message  string   `form:"message" binding:"required"`
+		Level    string   `form:"level"`
+		StartsAt string   `form:"starts_at"`
+		EndsAt   string   `form:"ends_at" binding:"required"`
+		Rooms    []string `form:"rooms"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminAnnouncements(c, http.StatusBadRequest, "A message and an end time are required")
+		return
+	}
+	if input.Level == "" {
+		input.Level = "info"
+	}
+	if !slices.Contains(models.AnnouncementLevels, input.Level) {
+		h.renderAdminAnnouncements(c, http.StatusBadRequest, "Unknown level")
+		return
+	}
+	now := h.clock.Now()
+	startsAt := now
+	if input.StartsAt != "" {
+		t, err := time.ParseInLocation(announcementTimeLayout, input.StartsAt, time.Local)
+		if err != nil {
+			h.renderAdminAnnouncements(c, http.StatusBadRequest, "Invalid start time")
+			return
+		}
+		startsAt = t
+	}
+	endsAt, err := time.ParseInLocation(announcementTimeLayout, input.EndsAt, time.Local)
+	if err != nil {
+		h.renderAdminAnnouncements(c, http.StatusBadRequest, "Invalid end time")
+		return
+	}
+	if !endsAt.After(startsAt) || !endsAt.After(now) {
+		h.renderAdminAnnouncements(c, http.StatusBadRequest, "The announcement must end after it starts, in the future")
+		return
+	}
+	for _, roomID := range input.Rooms {
+		if _, exists := h.RoomStore.GetRoom(roomID); !exists {
+			h.renderAdminAnnouncements(c, http.StatusBadRequest, "Unknown room")
+			return
+		}
+	}
+
+	a := &models.Announcement{
+		ID:        uuid.New().String(),
+		Message:   input.Message,
+		Level:     input.Level,
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+		Rooms:     input.Rooms,
+		By:        c.GetString(gin.AuthUserKey),
+		CreatedAt: now,
+	}
+	h.Announcements.AddAnnouncement(a)
+	h.postAnnouncements()
+	middleware.SetAuditChange(c, nil, a)
+	toasts.Add(c, toasts.Success, "Announcement scheduled")
+
+	h.renderAdminAnnouncements(c, http.StatusOK, "")
+}
+
+// DeleteAnnouncement removes an announcement, taking its banner down
+func (h *Handler) DeleteAnnouncement(c *gin.Context) {
+	a, exists := h.Announcements.DeleteAnnouncement(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "Announcement not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, a, nil)
+	toasts.Add(c, toasts.Success, "Announcement deleted")
+
+	h.renderAdminAnnouncements(c, http.StatusOK, "")
+}
+
+// renderAdminAnnouncements renders the announcements page with an optional
+// form error
+func (h *Handler) renderAdminAnnouncements(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	rooms := h.RoomStore.GetRooms()
+	roomNames := make(map[string]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+	now := h.clock.Now()
+
+	data := gin.H{
+		"title":         "Announcements",
+		"announcements": h.Announcements.GetAnnouncements(),
+		"levels":        models.AnnouncementLevels,
+		"rooms":         rooms,
+		"roomNames":     roomNames,
+		"now":           now,
+		"defaultStart":  now.Format(announcementTimeLayout),
+		"defaultEnd":    now.Add(24 * time.Hour).Format(announcementTimeLayout),
+		"error":         errMsg,
+		"Page":          "announcements",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-announcements.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
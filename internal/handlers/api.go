@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/forms"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// apiVersions lists the versions of the JSON API, oldest first. Each is
+// mounted under /api/<version>; breaking changes go into a new version
+var apiVersions = []string{"v1"}
+
+// unversionedAPIVersion serves unversioned JSON requests that do not ask for a
+// version. It stays at the version the unversioned routes were written
+// against, rather than following the latest, so old clients keep working
+const unversionedAPIVersion = "v1"
+
+// apiVersionHeader names the version of a response, and requests a version
+// from the unversioned routes
+const apiVersionHeader = "API-Version"
+
+// versionedHandlers maps API versions to their handler of a route
+type versionedHandlers map[string]gin.HandlerFunc
+
+// withVersion marks the responses of a versioned route with its version
+func withVersion(version string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(apiVersionHeader, version)
+		handler(c)
+	}
+}
+
+// negotiateVersion serves an unversioned JSON request with the handler of
+// the version named in its API-Version header, answering 406 when there is
+// none. The response is marked deprecated and links to the versioned route
+func negotiateVersion(c *gin.Context, handlers versionedHandlers) {
+	version := unversionedAPIVersion
+	if requested := c.GetHeader(apiVersionHeader); requested != "" {
+		version = "v" + strings.TrimPrefix(strings.ToLower(requested), "v")
+	}
+
+	handler, ok := handlers[version]
+	if !ok {
+		supported := make([]string, 0, len(handlers))
+		for _, v := range apiVersions {
+			if handlers[v] != nil {
+				supported = append(supported, v)
+			}
+		}
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "unsupported API version", "supported": supported})
+		return
+	}
+
+	successor := "/api/" + version + strings.TrimPrefix(c.Request.URL.Path, "/api")
+	c.Header(apiVersionHeader, version)
+	c.Header("Deprecation", "true")
+	c.Writer.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+	handler(c)
+}
+
+// unversioned returns the deprecated aliases of the versioned routes listed
+// in unversionedPaths, each negotiating between the versions of its path
+func unversioned(routes []apiRoute) []apiRoute {
+	var aliases []apiRoute
+	byPath := make(map[string]versionedHandlers)
+	for _, route := range routes {
+		version, path := splitVersion(route.Path)
+		key := route.Method + " " + path
+		if !unversionedPaths[key] {
+			continue
+		}
+		if byPath[key] == nil {
+			byPath[key] = make(versionedHandlers)
+
+			alias := route
+			alias.Path = path
+			alias.Summary = fmt.Sprintf("Deprecated alias of %s %s", route.Method, route.Path)
+			alias.Deprecated = true
+			handlers := byPath[key]
+			alias.handler = func(c *gin.Context) { negotiateVersion(c, handlers) }
+			aliases = append(aliases, alias)
+		}
+		byPath[key][version] = route.handler
+	}
+	return aliases
+}
+
+// splitVersion splits "/api/v1/rooms" into "v1" and "/api/rooms"
+func splitVersion(path string) (string, string) {
+	rest, _ := strings.CutPrefix(path, "/api/")
+	version, rest, _ := strings.Cut(rest, "/")
+	if !slices.Contains(apiVersions, version) {
+		return "", path
+	}
+	return version, "/api/" + rest
+}
+
+// roomInput is the body of a room created through the JSON API
+type roomInput struct {
+	Name string `json:"name" sanitize:"name" binding:"required,room_name"`
+}
+
+// chatInput is the body of a message posted through the JSON API
+type chatInput struct {
+	Username string `json:"username" sanitize:"name" binding:"required,username"`
+	Message  string `json:"message" sanitize:"message" binding:"required,message"`
+}
+
+// GetRoomV1 writes a room as JSON
+func (h *Handler) GetRoomV1(c *gin.Context) {
+	room, exists := h.RoomStore.GetRoom(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		return
+	}
+	c.JSON(http.StatusOK, room)
+}
+
+// CreateRoomV1 creates a room from a JSON body
+func (h *Handler) CreateRoomV1(c *gin.Context) {
+	var input roomInput
+	if err := forms.BindJSON(c, &input); err != nil {
+		status, message := h.bindError(c, err, fmt.Sprintf("name is required, at most %d characters", sanitize.MaxRoomName))
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	if h.roomsFull() {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("the limit of %d rooms has been reached", h.Config.Limits.MaxRooms)})
+		return
+	}
+	if quota := h.overQuota(quotaUser(c), h.quotaUse(models.QuotaRooms, 1)); quota != "" {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": h.quotaErrorJSON(quota)})
+		return
+	}
+
+	room := &models.Room{
+		ID:        uuid.New().String(),
+		Name:      input.Name,
+		CreatedAt: h.clock.Now(),
+	}
+	if err := h.addRoom(room); err != nil {
+		storeFailedJSON(c, err)
+		return
+	}
+	middleware.SetAuditChange(c, nil, room)
+
+	c.JSON(http.StatusCreated, room)
+}
+
+// CreateChatV1 posts a message from a JSON body
+func (h *Handler) CreateChatV1(c *gin.Context) {
+	roomID := c.Param("id")
+	if _, exists := h.RoomStore.GetRoom(roomID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		return
+	}
+
+	var input chatInput
+	if err := forms.BindJSON(c, &input); err != nil {
+		status, message := h.bindError(c, err, fmt.Sprintf("username and message are required, at most %d and %d characters", sanitize.MaxUsername, sanitize.MaxMessage))
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	if h.roomFull(roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "room has reached its message limit"})
+		return
+	}
+	if h.BanStore.IsBanned(input.Username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this name is banned from posting"})
+		return
+	}
+	if h.overLimit(c.ClientIP(), h.postLimiter, "messages_per_minute") {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many messages, slow down"})
+		return
+	}
+	if quota := h.overPostQuota(quotaUser(c), input.Message); quota != "" {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": h.quotaErrorJSON(quota)})
+		return
+	}
+	middleware.SetAuditActor(c, input.Username)
+
+	chat := &models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Username:  input.Username,
+		Message:   input.Message,
+		CreatedAt: h.clock.Now(),
+	}
+	if h.blocked(chat) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this message contains blocked words"})
+		return
+	}
+	if h.holdFlagged(chat, "") {
+		c.JSON(http.StatusAccepted, chat)
+		return
+	}
+	if err := h.addChat(chat); err != nil {
+		storeFailedJSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, chat)
+}
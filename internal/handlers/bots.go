@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// botMessage is the body of a message posted by a bot through the API
+type botMessage struct {
+	RoomID string `json:"room_id" binding:"required"`
+	Text   string `json:"text" binding:"required"`
+}
+
+// PostBotMessage posts a message as the bot identified by the bearer API key
+func (h *Handler) PostBotMessage(c *gin.Context) {
+	key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	bot, exists := h.BotStore.GetBotByKey(key)
+	if !ok || !exists {
+		c.Header("WWW-Authenticate", `Bearer realm="Bots"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return
+	}
+	middleware.SetAuditActor(c, "bot:"+bot.Name)
+
+	var input botMessage
+	if err := c.ShouldBindJSON(&input); err != nil {
+		status, message := h.bindError(c, err, "room_id and text are required")
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	if _, exists := h.RoomStore.GetRoom(input.RoomID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		return
+	}
+	if !bot.Subscribed(input.RoomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "bot is not subscribed to this room"})
+		return
+	}
+	if h.roomFull(input.RoomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "room has reached its message limit"})
+		return
+	}
+
+	chat := &models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    input.RoomID,
+		Username:  bot.Name,
+		Message:   input.Text,
+		Bot:       true,
+		CreatedAt: h.clock.Now(),
+	}
+	if err := h.addChat(chat); err != nil {
+		storeFailedJSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, chat)
+}
+
+// postBotMessage posts a bot's reply into a room, dropping it if the room is
+// gone or full
+func (h *Handler) postBotMessage(roomID, username, text string) {
+	if _, exists := h.RoomStore.GetRoom(roomID); !exists {
+		return
+	}
+	if h.roomFull(roomID) {
+		slog.Warn("dropping bot reply, room is full", "bot", username, "room", roomID)
+		return
+	}
+
+	err := h.addChat(&models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Username:  username,
+		Message:   text,
+		Bot:       true,
+		CreatedAt: h.clock.Now(),
+	})
+	if err != nil {
+		slog.Error("saving bot reply failed", "bot", username, "room", roomID, "error", err)
+	}
+}
+
+// AdminBots renders the bots page
+func (h *Handler) AdminBots(c *gin.Context) {
+	h.renderAdminBots(c, http.StatusOK, "")
+}
+
+// CreateBot registers a new bot and shows its API key
+func (h *Handler) CreateBot(c *gin.Context) {
+	var input struct {
+		Name        string   `form:"name" binding:"required"`
+		CallbackURL string   `form:"callback_url"`
+		Rooms       []string `form:"rooms"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminBots(c, http.StatusBadRequest, "A bot name is required")
+		return
+	}
+	if input.CallbackURL != "" {
+		if u, err := url.Parse(input.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			h.renderAdminBots(c, http.StatusBadRequest, "The callback URL must be an absolute http or https URL")
+			return
+		}
+	}
+	for _, roomID := range input.Rooms {
+		if _, exists := h.RoomStore.GetRoom(roomID); !exists {
+			h.renderAdminBots(c, http.StatusBadRequest, "Unknown room")
+			return
+		}
+	}
+
+	bot := &models.Bot{
+		ID:          uuid.New().String(),
+		Name:        input.Name,
+		APIKey:      randomToken(32),
+		Rooms:       input.Rooms,
+		CallbackURL: input.CallbackURL,
+		CreatedAt:   h.clock.Now(),
+	}
+	h.BotStore.AddBot(bot)
+	middleware.SetAuditChange(c, nil, bot)
+	toasts.Add(c, toasts.Success, "Bot "+input.Name+" created")
+
+	h.renderAdminBots(c, http.StatusOK, "")
+}
+
+// DeleteBot removes a bot, revoking its API key
+func (h *Handler) DeleteBot(c *gin.Context) {
+	bot, _ := h.BotStore.GetBot(c.Param("id"))
+	if !h.BotStore.DeleteBot(c.Param("id")) {
+		toasts.Add(c, toasts.Error, "Bot not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, bot, nil)
+	toasts.Add(c, toasts.Success, "Bot deleted")
+
+	h.renderAdminBots(c, http.StatusOK, "")
+}
+
+// renderAdminBots renders the bots page with an optional form error
+func (h *Handler) renderAdminBots(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	rooms := h.RoomStore.GetRooms()
+	roomNames := make(map[string]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+
+	data := gin.H{
+		"title":     "Bots",
+		"bots":      h.BotStore.GetBots(),
+		"rooms":     rooms,
+		"roomNames": roomNames,
+		"error":     errMsg,
+		"Page":      "bots",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-bots.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/branding"
+	"net/http"
+)
+
+// BrandingCSS serves the CSS variables generated from the branding
+// configuration, which the layouts load after the theme stylesheet
+func (h *Handler) BrandingCSS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "text/css; charset=utf-8", branding.CSS(h.Config.Branding))
+}
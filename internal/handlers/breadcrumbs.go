@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"htmx/internal/models"
+	"net/http"
+)
+
+// breadcrumb is a step of the breadcrumbs of the navbar, from the home page
+// to the current page
+type breadcrumb struct {
+	Label   string
+	URL     string
+	Current bool
+}
+
+// breadcrumbs returns the steps from the home page to the current page, the
+// last of steps
+func breadcrumbs(c *gin.Context, steps ...breadcrumb) []breadcrumb {
+	crumbs := append([]breadcrumb{{Label: i18n.FromContext(c).T("nav.home"), URL: "/"}}, steps...)
+	crumbs[len(crumbs)-1].Current = true
+	return crumbs
+}
+
+// roomBreadcrumbs returns the breadcrumbs of the page of a room
+func roomBreadcrumbs(c *gin.Context, room *models.Room) []breadcrumb {
+	return breadcrumbs(c, breadcrumb{Label: room.Name, URL: "/rooms/" + room.ID})
+}
+
+// navigated starts the response of a partial navigation: it pushes the URL
+// of the current page into the history, with the sidebar search, retitles
+// the page and swaps the breadcrumbs out of band, so the page shows the
+// context it would have if loaded from that URL. It sets a header, so it
+// runs before the page is rendered
+func navigated(c *gin.Context, title string, crumbs []breadcrumb) {
+	c.Header("HX-Push-URL", pushURL(c, crumbs[len(crumbs)-1].URL))
+	render(c, http.StatusOK, "partials/breadcrumbs.html", gin.H{"title": title, "breadcrumbs": crumbs, "oob": true})
+}
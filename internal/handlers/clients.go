@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/middleware"
+	"htmx/internal/toasts"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// connectedClient is a connection to the hub on the admin clients page,
+// with the name of its visitor and of the room it shows
+type connectedClient struct {
+	hubConnection
+	Name     string
+	RoomName string
+}
+
+// AdminClients renders the page of the connections to the hub
+func (h *Handler) AdminClients(c *gin.Context) {
+	data := gin.H{
+		"title": "Connections",
+		"Page":  "clients",
+	}
+	for key, value := range h.connectedClients() {
+		data[key] = value
+	}
+
+	if partial(c) {
+		c.HTML(http.StatusOK, "partials/admin-clients.html", data)
+		return
+	}
+
+	renderLayout(c, http.StatusOK, "layouts/admin.html", data)
+}
+
+// ClientsList renders the list of the connections to the hub, which the
+// page refreshes when the hub says the clients changed
+func (h *Handler) ClientsList(c *gin.Context) {
+	c.HTML(http.StatusOK, "partials/admin-clients-list.html", h.connectedClients())
+}
+
+// DisconnectClient closes a connection to the hub; the page does not
+// reconnect on its own
+func (h *Handler) DisconnectClient(c *gin.Context) {
+	id := c.Param("id")
+	clients := h.connectedClients()["clients"].([]connectedClient)
+	i := slices.IndexFunc(clients, func(client connectedClient) bool {
+		return client.ID == id
+	})
+	found, ok := false, true
+	if i >= 0 {
+		found, ok = h.Hub.Disconnect(id, time.Second)
+	}
+	switch {
+	case !ok:
+		toasts.Add(c, toasts.Error, "The hub is not responding")
+		c.Status(http.StatusServiceUnavailable)
+		return
+	case !found:
+		// Gone meanwhile: the refreshed list shows it
+		toasts.Add(c, toasts.Error, "The client is no longer connected")
+		c.HTML(http.StatusOK, "partials/admin-clients-list.html", h.connectedClients())
+		return
+	}
+	client := clients[i]
+	middleware.SetAuditChange(c, gin.H{"visitor_id": client.VisitorID, "name": client.Name, "ip": client.IP, "room_id": client.RoomID}, nil)
+	toasts.Add(c, toasts.Success, "Client disconnected")
+
+	c.HTML(http.StatusOK, "partials/admin-clients-list.html", h.connectedClients())
+}
+
+// connectedClients gathers the connections to the hub, oldest first
+func (h *Handler) connectedClients() gin.H {
+	connections, ok := h.Hub.Clients(time.Second)
+	clients := make([]connectedClient, 0, len(connections))
+	for _, connection := range connections {
+		client := connectedClient{hubConnection: connection}
+		if !connection.Moderator {
+			client.Name = h.NotificationStore.Name(connection.VisitorID)
+		}
+		if room, exists := h.RoomStore.GetRoom(connection.RoomID); exists {
+			client.RoomName = room.Name
+		}
+		clients = append(clients, client)
+	}
+	slices.SortFunc(clients, func(a, b connectedClient) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return gin.H{"clients": clients, "hubResponding": ok}
+}
@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"htmx/internal/clock"
+	"htmx/internal/config"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startAt starts the app on a fake clock showing a fixed time
+func startAt(t *testing.T, configure func(cfg *config.Config)) (*testutil.App, *clock.Fake) {
+	clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	app := testutil.StartApp(t, testutil.Hooks{
+		Configure: configure,
+		Setup: func(app *testutil.App) {
+			app.Handler.SetClock(clk)
+		},
+	})
+	return app, clk
+}
+
+func TestPostLimitRefills(t *testing.T) {
+	app, clk := startAt(t, func(cfg *config.Config) {
+		cfg.Moderation.MessagesPerMinute = 1
+	})
+	room := app.Stores.SeedRoom("General")
+	post := func(message string) int {
+		res, _ := app.HXPost("/api/rooms/"+room.ID+"/chats", url.Values{"username": {"alice"}, "message": {message}})
+		return res.StatusCode
+	}
+
+	if status := post("first"); status != http.StatusOK {
+		t.Fatalf("first message: status %d", status)
+	}
+	clk.Advance(59 * time.Second)
+	if status := post("too soon"); status != http.StatusForbidden {
+		t.Errorf("second message within the minute: status %d, want 403", status)
+	}
+	clk.Advance(2 * time.Second)
+	if status := post("a minute later"); status != http.StatusOK {
+		t.Errorf("message once the minute passed: status %d, want 200", status)
+	}
+}
+
+func TestImpersonationExpires(t *testing.T) {
+	app, clk := startAt(t, nil)
+	req := app.AsAdmin(app.NewRequest(http.MethodPost, "/admin/impersonate", strings.NewReader(url.Values{"visitor_id": {"visitor-1"}}.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res, body := app.Do(req); res.StatusCode != http.StatusOK {
+		t.Fatalf("starting the impersonation: status %d: %s", res.StatusCode, body)
+	}
+	createRoom := func(name string) int {
+		res, _ := app.HXPost("/api/rooms", url.Values{"name": {name}})
+		return res.StatusCode
+	}
+
+	// Viewing as a visitor is read-only, for an hour
+	clk.Advance(59 * time.Minute)
+	if status := createRoom("Lobby"); status != http.StatusForbidden {
+		t.Errorf("creating a room while impersonating: status %d, want 403", status)
+	}
+	clk.Advance(time.Minute)
+	if status := createRoom("Lobby"); status != http.StatusOK {
+		t.Errorf("creating a room once the impersonation expired: status %d, want 200", status)
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/models"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of JSON collections
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// listQuery is the pagination, sorting and field selection of a JSON collection request
+type listQuery struct {
+	Limit  int
+	Offset int
+	Sort   string
+	Desc   bool
+	// Fields lists the JSON fields to return; all of them when empty
+	Fields []string
+}
+
+// sortKeys maps the sort names of a collection to comparisons of its items
+type sortKeys[T any] map[string]func(a, b T) int
+
+// wantsJSON reports whether the client asked for JSON rather than an HTML partial
+func wantsJSON(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// parseListQuery reads the limit, offset, sort and fields query parameters.
+// sort is a key of sorts, prefixed with "-" for descending order
+func parseListQuery[T any](c *gin.Context, sorts sortKeys[T], defaultSort string, fields []string) (listQuery, error) {
+	q := listQuery{Limit: defaultPageSize, Sort: defaultSort}
+
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = n
+	}
+	if s := c.Query("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("offset must be a non-negative integer")
+		}
+		q.Offset = n
+	}
+
+	if s := c.Query("sort"); s != "" {
+		q.Sort, q.Desc = strings.CutPrefix(s, "-")
+	}
+	if _, ok := sorts[q.Sort]; !ok {
+		return q, fmt.Errorf("sort must be one of %s, optionally prefixed with -", strings.Join(slices.Sorted(maps.Keys(sorts)), ", "))
+	}
+
+	if s := c.Query("fields"); s != "" {
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(fields, field) {
+				return q, fmt.Errorf("fields must be a comma-separated list of %s", strings.Join(fields, ", "))
+			}
+			q.Fields = append(q.Fields, field)
+		}
+	}
+	return q, nil
+}
+
+// listPage sorts the items, writes the page selected by q as a JSON array and
+// links the neighbouring pages with RFC 5988 Link headers
+func listPage[T any](c *gin.Context, items []T, q listQuery, sorts sortKeys[T]) {
+	compare := sorts[q.Sort]
+	slices.SortStableFunc(items, func(a, b T) int {
+		if q.Desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+
+	total := len(items)
+	page := items[min(q.Offset, total):min(q.Offset+q.Limit, total)]
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if links := pageLinks(c, q, total); len(links) > 0 {
+		c.Writer.Header().Add("Link", strings.Join(links, ", "))
+	}
+
+	if len(q.Fields) == 0 {
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
+	selected := make([]map[string]any, len(page))
+	for i, item := range page {
+		selected[i] = selectFields(item, q.Fields)
+	}
+	c.JSON(http.StatusOK, selected)
+}
+
+// pageLinks returns the first, prev, next and last links of a page
+func pageLinks(c *gin.Context, q listQuery, total int) []string {
+	link := func(offset int, rel string) string {
+		query := c.Request.URL.Query()
+		query.Set("limit", strconv.Itoa(q.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return fmt.Sprintf(`<%s%s?%s>; rel="%s"`, baseURL(c), c.Request.URL.Path, query.Encode(), rel)
+	}
+
+	last := 0
+	if total > 0 {
+		last = (total - 1) / q.Limit * q.Limit
+	}
+
+	var links []string
+	if q.Offset > 0 {
+		links = append(links, link(0, "first"), link(max(q.Offset-q.Limit, 0), "prev"))
+	}
+	if q.Offset+q.Limit < total {
+		links = append(links, link(q.Offset+q.Limit, "next"), link(last, "last"))
+	}
+	return links
+}
+
+// selectFields returns the named fields of the JSON encoding of v
+func selectFields(v any, fields []string) map[string]any {
+	var all map[string]json.RawMessage
+	data, _ := json.Marshal(v)
+	json.Unmarshal(data, &all)
+
+	selected := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected
+}
+
+// Sort keys and fields of the JSON room and chat collections
+var (
+	roomSorts = sortKeys[*models.Room]{
+		"created_at": func(a, b *models.Room) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		"name": func(a, b *models.Room) int {
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		},
+	}
+	roomFields = []string{"id", "name", "created_at"}
+
+	chatSorts = sortKeys[*models.Chat]{
+		"created_at": func(a, b *models.Chat) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		"username": func(a, b *models.Chat) int {
+			return strings.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+		},
+	}
+	chatFields = []string{"id", "room_id", "username", "message", "bot", "origin", "created_at"}
+)
+
+// ListRoomsV1 writes a page of rooms as JSON, keeping those whose name contains q
+func (h *Handler) ListRoomsV1(c *gin.Context) {
+	q, err := parseListQuery(c, roomSorts, "created_at", roomFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	search := strings.ToLower(c.Query("q"))
+	rooms := slices.DeleteFunc(slices.Clone(h.RoomStore.GetRooms()), func(room *models.Room) bool {
+		return !strings.Contains(strings.ToLower(room.Name), search)
+	})
+	listPage(c, rooms, q, roomSorts)
+}
+
+// ListChatsV1 writes a page of the messages of a room as JSON, filtered by
+// username, q (message text), bot, and since and until (RFC 3339 times)
+func (h *Handler) ListChatsV1(c *gin.Context) {
+	roomID := c.Param("id")
+	if _, exists := h.RoomStore.GetRoom(roomID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		return
+	}
+
+	q, err := parseListQuery(c, chatSorts, "created_at", chatFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := parseChatFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only the matching chats are copied out of the store
+	chats := []*models.Chat{}
+	h.ChatStore.ForEachChatInRoom(roomID, func(chat *models.Chat) bool {
+		if filter(chat) {
+			chats = append(chats, chat)
+		}
+		return true
+	})
+	listPage(c, chats, q, chatSorts)
+}
+
+// parseChatFilter reads the filters of the chat collection into a predicate
+func parseChatFilter(c *gin.Context) (func(*models.Chat) bool, error) {
+	username := c.Query("username")
+	search := strings.ToLower(c.Query("q"))
+
+	var since, until time.Time
+	var err error
+	if s := c.Query("since"); s != "" {
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, fmt.Errorf("since must be an RFC 3339 time")
+		}
+	}
+	if s := c.Query("until"); s != "" {
+		if until, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, fmt.Errorf("until must be an RFC 3339 time")
+		}
+	}
+
+	var bot *bool
+	if s := c.Query("bot"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("bot must be true or false")
+		}
+		bot = &b
+	}
+
+	return func(chat *models.Chat) bool {
+		switch {
+		case username != "" && !strings.EqualFold(chat.Username, username):
+			return false
+		case !strings.Contains(strings.ToLower(chat.Message), search):
+			return false
+		case !since.IsZero() && chat.CreatedAt.Before(since):
+			return false
+		case !until.IsZero() && !chat.CreatedAt.Before(until):
+			return false
+		case bot != nil && chat.Bot != *bot:
+			return false
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"htmx/internal/toasts"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dashboardRows is how many rooms and newcomers the dashboard lists
+	dashboardRows = 10
+	// requestWindow is the span the request and error rates of the
+	// dashboard are measured over
+	requestWindow = 5 * time.Minute
+)
+
+// requestSample is the request counts at one refresh of the dashboard
+type requestSample struct {
+	at                         time.Time
+	total, clientErrs, srvErrs float64
+}
+
+// requestRates keeps the request counts of recent dashboard refreshes, so
+// the rates cover the last few minutes rather than the whole uptime
+type requestRates struct {
+	samples []requestSample
+	mutex   sync.Mutex
+}
+
+// sample records the current counts and returns the oldest kept one within
+// the window, or false for the first refresh
+func (r *requestRates) sample(now requestSample) (requestSample, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cutoff := now.at.Add(-requestWindow)
+	i := 0
+	for i < len(r.samples) && r.samples[i].at.Before(cutoff) {
+		i++
+	}
+	r.samples = append(r.samples[i:], now)
+	if len(r.samples) < 2 {
+		return requestSample{}, false
+	}
+	return r.samples[0], true
+}
+
+// roomActivity is a room on the dashboard with its message counts
+type roomActivity struct {
+	*models.Room
+	Messages   int
+	LastHour   int
+	Percentage float64
+}
+
+// newcomer is a name on the dashboard with its first message
+type newcomer struct {
+	Username string
+	RoomName string
+	First    time.Time
+	Banned   bool
+}
+
+// AdminDashboard renders the dashboard of live stats and quick actions
+func (h *Handler) AdminDashboard(c *gin.Context) {
+	data := gin.H{
+		"title": "Dashboard",
+		"rooms": h.RoomStore.GetRooms(),
+		"Page":  "dashboard",
+	}
+	for key, value := range h.dashboardStats() {
+		data[key] = value
+	}
+	for key, value := range h.dashboardRooms() {
+		data[key] = value
+	}
+	for key, value := range h.dashboardPeople() {
+		data[key] = value
+	}
+	for key, value := range h.dashboardJobs() {
+		data[key] = value
+	}
+
+	if partial(c) {
+		c.HTML(http.StatusOK, "partials/admin-dashboard.html", data)
+		return
+	}
+
+	renderLayout(c, http.StatusOK, "layouts/admin.html", data)
+}
+
+// DashboardStats renders the stats cards of the dashboard
+func (h *Handler) DashboardStats(c *gin.Context) {
+	c.HTML(http.StatusOK, "partials/admin-dashboard-stats.html", h.dashboardStats())
+}
+
+// DashboardRooms renders the busiest rooms of the dashboard
+func (h *Handler) DashboardRooms(c *gin.Context) {
+	h.renderDashboardRooms(c, http.StatusOK)
+}
+
+// DashboardPeople renders the newcomers and bans of the dashboard
+func (h *Handler) DashboardPeople(c *gin.Context) {
+	h.renderDashboardPeople(c, http.StatusOK)
+}
+
+// dashboardStats gathers the connected clients and any overload of the hub,
+// the stored rooms and messages, and the request and error rates
+func (h *Handler) dashboardStats() gin.H {
+	now := h.clock.Now()
+	rooms, messages, lastHour := 0, 0, 0
+	h.RoomStore.ForEachRoom(func(room *models.Room) bool {
+		rooms++
+		messages += h.ChatStore.CountByRoom(room.ID)
+		lastHour += h.ChatStore.CountSince(room.ID, now.Add(-time.Hour))
+		return true
+	})
+
+	current := requestSample{at: now}
+	current.total, current.clientErrs, current.srvErrs = metrics.RequestCounts()
+	data := gin.H{
+		"clients":   h.Hub.ClientCount(),
+		"roomCount": rooms,
+		"messages":  messages,
+		"lastHour":  lastHour,
+		"requests":  current.total,
+		"overload":  h.overload.Load(),
+	}
+	if oldest, ok := h.requestRates.sample(current); ok {
+		requests := current.total - oldest.total
+		data["window"] = now.Sub(oldest.at).Round(time.Second)
+		data["requestRate"] = requests / now.Sub(oldest.at).Minutes()
+		if requests > 0 {
+			data["clientErrorRate"] = 100 * (current.clientErrs - oldest.clientErrs) / requests
+			data["serverErrorRate"] = 100 * (current.srvErrs - oldest.srvErrs) / requests
+		}
+	}
+	return data
+}
+
+// dashboardRooms ranks the rooms by their messages of the last hour, then
+// by all their messages
+func (h *Handler) dashboardRooms() gin.H {
+	since := h.clock.Now().Add(-time.Hour)
+	var rooms []roomActivity
+	total := 0
+	h.RoomStore.ForEachRoom(func(room *models.Room) bool {
+		activity := roomActivity{
+			Room:     room,
+			Messages: h.ChatStore.CountByRoom(room.ID),
+			LastHour: h.ChatStore.CountSince(room.ID, since),
+		}
+		total += activity.LastHour
+		rooms = append(rooms, activity)
+		return true
+	})
+	slices.SortStableFunc(rooms, func(a, b roomActivity) int {
+		return cmp.Or(cmp.Compare(b.LastHour, a.LastHour), cmp.Compare(b.Messages, a.Messages))
+	})
+	if len(rooms) > dashboardRows {
+		rooms = rooms[:dashboardRows]
+	}
+	for i := range rooms {
+		if total > 0 {
+			rooms[i].Percentage = 100 * float64(rooms[i].LastHour) / float64(total)
+		}
+	}
+	return gin.H{"busiestRooms": rooms}
+}
+
+// dashboardPeople finds the names whose first message is the most recent,
+// as there are no accounts to sign up for, and lists the bans
+func (h *Handler) dashboardPeople() gin.H {
+	first := make(map[string]*newcomer)
+	h.RoomStore.ForEachRoom(func(room *models.Room) bool {
+		h.ChatStore.ForEachChatInRoom(room.ID, func(chat *models.Chat) bool {
+			if chat.Bot {
+				return true
+			}
+			key := strings.ToLower(chat.Username)
+			if seen, ok := first[key]; !ok || chat.CreatedAt.Before(seen.First) {
+				first[key] = &newcomer{Username: chat.Username, RoomName: room.Name, First: chat.CreatedAt}
+			}
+			return true
+		})
+		return true
+	})
+
+	newcomers := make([]*newcomer, 0, len(first))
+	for _, person := range first {
+		person.Banned = h.BanStore.IsBanned(person.Username)
+		newcomers = append(newcomers, person)
+	}
+	slices.SortFunc(newcomers, func(a, b *newcomer) int {
+		return b.First.Compare(a.First)
+	})
+	if len(newcomers) > dashboardRows {
+		newcomers = newcomers[:dashboardRows]
+	}
+	return gin.H{
+		"newcomers": newcomers,
+		"bans":      h.BanStore.GetBans(),
+	}
+}
+
+// renderDashboardRooms renders the busiest rooms with the given status
+func (h *Handler) renderDashboardRooms(c *gin.Context, status int) {
+	c.HTML(status, "partials/admin-dashboard-rooms.html", h.dashboardRooms())
+}
+
+// renderDashboardPeople renders the newcomers and bans with the given status
+func (h *Handler) renderDashboardPeople(c *gin.Context, status int) {
+	c.HTML(status, "partials/admin-dashboard-people.html", h.dashboardPeople())
+}
+
+// BanUser keeps a name from posting messages
+func (h *Handler) BanUser(c *gin.Context) {
+	var input struct {
+		Username string `form:"username" binding:"required"`
+		Reason   string `form:"reason"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil || sanitize.Name(input.Username) == "" {
+		toasts.Add(c, toasts.Error, "A name is required")
+		h.renderDashboardPeople(c, http.StatusBadRequest)
+		return
+	}
+
+	ban := &models.Ban{
+		Username:  sanitize.Name(input.Username),
+		Reason:    input.Reason,
+		By:        c.GetString(gin.AuthUserKey),
+		CreatedAt: h.clock.Now(),
+	}
+	if before, exists := h.BanStore.GetBan(ban.Username); exists {
+		middleware.SetAuditChange(c, before, ban)
+	} else {
+		middleware.SetAuditChange(c, nil, ban)
+	}
+	h.BanStore.AddBan(ban)
+	toasts.Add(c, toasts.Success, input.Username+" is banned from posting")
+
+	h.renderDashboardPeople(c, http.StatusOK)
+}
+
+// UnbanUser lets a banned name post again. The name is in the query, as
+// htmx sends the fields of DELETE requests
+func (h *Handler) UnbanUser(c *gin.Context) {
+	username := c.Query("username")
+	ban, _ := h.BanStore.GetBan(username)
+	if !h.BanStore.RemoveBan(username) {
+		toasts.Add(c, toasts.Error, "This name is not banned")
+		h.renderDashboardPeople(c, http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, ban, nil)
+	toasts.Add(c, toasts.Success, username+" may post again")
+
+	h.renderDashboardPeople(c, http.StatusOK)
+}
+
+// DeleteRoomAdmin removes a room and its messages
+func (h *Handler) DeleteRoomAdmin(c *gin.Context) {
+	room, exists := h.RoomStore.GetRoom(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "Room not found")
+		h.renderDashboardRooms(c, http.StatusNotFound)
+		return
+	}
+	messages := h.ChatStore.CountByRoom(room.ID)
+	deleted, err := h.deleteRoom(room.ID)
+	if err != nil {
+		_ = c.Error(err)
+		toasts.Add(c, toasts.Error, "Room "+room.Name+" could not be deleted: "+err.Error())
+		h.renderDashboardRooms(c, http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		toasts.Add(c, toasts.Error, "Room not found")
+		h.renderDashboardRooms(c, http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, gin.H{"room": room, "messages": messages}, nil)
+	toasts.Add(c, toasts.Success, "Room "+room.Name+" deleted")
+
+	h.renderDashboardRooms(c, http.StatusOK)
+}
+
+// Announce posts a message from the instance into one room or every room,
+// skipping the full ones
+func (h *Handler) Announce(c *gin.Context) {
+	var input struct {
+		Message string `form:"message" binding:"required"`
+		RoomID  string `form:"room_id"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		toasts.Add(c, toasts.Error, "A message is required")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var rooms []string
+	if input.RoomID != "" {
+		if _, exists := h.RoomStore.GetRoom(input.RoomID); !exists {
+			toasts.Add(c, toasts.Error, "Unknown room")
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		rooms = append(rooms, input.RoomID)
+	} else {
+		h.RoomStore.ForEachRoom(func(room *models.Room) bool {
+			rooms = append(rooms, room.ID)
+			return true
+		})
+	}
+
+	var posted []string
+	for _, roomID := range rooms {
+		if h.roomFull(roomID) {
+			continue
+		}
+		h.postBotMessage(roomID, h.Config.Branding.Name, input.Message)
+		posted = append(posted, roomID)
+	}
+	middleware.SetAuditChange(c, nil, gin.H{"message": input.Message, "rooms": posted})
+	if len(posted) == 0 {
+		toasts.Add(c, toasts.Error, "No room could take the announcement")
+	} else {
+		toasts.Add(c, toasts.Success, fmt.Sprintf("Announced in %d of %d rooms", len(posted), len(rooms)))
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"expvar"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/metrics"
+	"htmx/internal/models"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+)
+
+// publishOnce and registerOnce guard the expvar and metrics registrations,
+// which panic when repeated
+var publishOnce, registerOnce sync.Once
+
+// registerMetrics exports the hub and store sizes as Prometheus gauges
+func (h *Handler) registerMetrics() {
+	registerOnce.Do(func() {
+		metrics.RegisterGauge("htmx_ws_clients", "Connected WebSocket clients.", func() float64 {
+			return float64(h.Hub.ClientCount())
+		})
+		metrics.RegisterGauge("htmx_rooms", "Rooms in the store.", func() float64 {
+			return float64(h.RoomStore.Count())
+		})
+		metrics.RegisterGauge("htmx_messages", "Chat messages in the store.", func() float64 {
+			return float64(h.ChatStore.Count())
+		})
+		// The memory budget only applies to the in-memory store
+		if chats, ok := h.ChatStore.(*models.ChatStore); ok {
+			metrics.RegisterGauge("htmx_messages_bytes", "Estimated memory used by the chat messages in the store.", func() float64 {
+				return float64(chats.Size())
+			})
+			metrics.RegisterCounter("htmx_messages_evicted_total", "Chat messages moved to the archive to keep within the memory budget.", func() float64 {
+				evicted, _ := chats.Evicted()
+				return float64(evicted)
+			})
+			metrics.RegisterCounter("htmx_messages_evicted_bytes_total", "Estimated memory freed by moving chat messages to the archive.", func() float64 {
+				_, bytes := chats.Evicted()
+				return float64(bytes)
+			})
+		}
+		metrics.RegisterGauge("htmx_render_cache_entries", "Partials in the render cache.", func() float64 {
+			return float64(h.RenderCache.Len())
+		})
+	})
+}
+
+// setupDebugRoutes mounts pprof and expvar on the given (admin-protected) group
+func (h *Handler) setupDebugRoutes(group *gin.RouterGroup) {
+	publishOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() any {
+			return runtime.NumGoroutine()
+		}))
+		expvar.Publish("hub_clients", expvar.Func(func() any {
+			return h.Hub.ClientCount()
+		}))
+		expvar.Publish("rooms", expvar.Func(func() any {
+			return h.RoomStore.Count()
+		}))
+	})
+
+	group.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	group.GET("/debug/pprof/", gin.WrapF(pprof.Index))
+	group.GET("/debug/pprof/:name", h.Profile)
+	group.POST("/debug/pprof/symbol", gin.WrapF(pprof.Symbol))
+}
+
+// Profile serves a named pprof profile
+func (h *Handler) Profile(c *gin.Context) {
+	switch name := c.Param("name"); name {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
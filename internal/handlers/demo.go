@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"htmx/internal/models"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// demoNames are the simulated people of demo mode, numbered once they run out
+var demoNames = []string{
+	"Ada", "Grace", "Linus", "Margaret", "Ken", "Barbara", "Dennis", "Radia",
+	"Alan", "Frances", "Guido", "Hedy", "Rob", "Katherine", "Niklaus", "Edsger",
+}
+
+// demoGreetings are posted by a simulated person joining a room
+var demoGreetings = []string{
+	"Hi everyone!",
+	"Hello, what did I miss?",
+	"Hey all 👋",
+	"Morning! Or evening, wherever you are.",
+}
+
+// demoLines are the messages simulated people chat with; {name} is replaced
+// by another of them, so mentions show up too
+var demoLines = []string{
+	"Has anyone tried the new release yet?",
+	"I'm still getting used to the keyboard shortcuts, press ? to see them.",
+	"@{name} did you get my message earlier?",
+	"Coffee break ☕",
+	"That's a great point.",
+	"Does anyone know a good book on distributed systems?",
+	"Just deployed on a Friday. Wish me luck.",
+	"@{name} agreed, let's pick this up tomorrow.",
+	"The dark theme looks really nice.",
+	"Lunch anyone?",
+	"I think the tests are flaky again 🙃",
+	"Back in five.",
+	"Thanks @{name}, that fixed it!",
+	"Who's joining the demo later?",
+}
+
+// StartDemo creates the rooms of demo mode when there are too few and
+// starts the simulated people chatting in them, until ctx is done
+func (h *Handler) StartDemo(ctx context.Context) {
+	cfg := h.Config.Demo
+	for i := h.RoomStore.Count(); i < cfg.Rooms; i++ {
+		if h.roomsFull() {
+			break
+		}
+		err := h.addRoom(&models.Room{
+			ID:        uuid.New().String(),
+			Name:      fmt.Sprintf("Demo room %d", i+1),
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			slog.Error("creating demo room failed", "error", err)
+			break
+		}
+	}
+
+	names := make([]string, cfg.Users)
+	for i := range names {
+		names[i] = demoNames[i%len(demoNames)]
+		if i >= len(demoNames) {
+			names[i] += fmt.Sprint(i/len(demoNames) + 1)
+		}
+	}
+	for _, name := range names {
+		go h.demoUser(ctx, name, names)
+	}
+	slog.Info("demo mode started", "users", cfg.Users, "rooms", cfg.Rooms, "message_interval", cfg.MessageInterval)
+}
+
+// demoUser simulates a person joining a room, chatting in it and moving to
+// another one now and then, until ctx is done
+func (h *Handler) demoUser(ctx context.Context, name string, names []string) {
+	cfg := h.Config.Demo
+	var roomID string
+	leave := time.Now()
+	for {
+		// Vary the waits by up to half the interval either way, so the
+		// people do not post in lockstep
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.MessageInterval/2 + rand.N(cfg.MessageInterval)):
+		}
+
+		if _, exists := h.RoomStore.GetRoom(roomID); !exists || time.Now().After(leave) {
+			rooms := h.RoomStore.GetRooms()
+			if len(rooms) == 0 {
+				continue
+			}
+			roomID = rooms[rand.N(len(rooms))].ID
+			leave = time.Now().Add(cfg.JoinInterval/2 + rand.N(cfg.JoinInterval))
+			h.postDemoMessage(roomID, name, demoGreetings[rand.N(len(demoGreetings))])
+			continue
+		}
+
+		line := strings.ReplaceAll(demoLines[rand.N(len(demoLines))], "{name}", demoOther(name, names))
+		h.postDemoMessage(roomID, name, line)
+	}
+}
+
+// demoOther picks a simulated person other than name to mention
+func demoOther(name string, names []string) string {
+	if len(names) < 2 {
+		return "everyone"
+	}
+	for {
+		if other := names[rand.N(len(names))]; other != name {
+			return other
+		}
+	}
+}
+
+// postDemoMessage posts a message of a simulated person, unless the room
+// is full
+func (h *Handler) postDemoMessage(roomID, username, message string) {
+	if h.roomFull(roomID) {
+		return
+	}
+	err := h.addChat(&models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Username:  username,
+		Message:   message,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		slog.Error("posting demo message failed", "user", username, "room", roomID, "error", err)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers_test
+
+import (
+	"htmx/internal/config"
+	"htmx/internal/features"
+	"htmx/internal/models"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// browser is a person using the app through a client that keeps cookies
+type browser struct {
+	t      *testing.T
+	app    *testutil.App
+	client *http.Client
+}
+
+// open loads the home page, which gives the browser its visitor cookie,
+// and returns its visitor ID
+func (b *browser) open() string {
+	b.t.Helper()
+	res, err := b.client.Get(b.app.URL + "/")
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	res.Body.Close()
+	for _, cookie := range b.client.Jar.Cookies(res.Request.URL) {
+		if cookie.Name == features.VisitorCookie {
+			return cookie.Value
+		}
+	}
+	b.t.Fatal("no visitor cookie set")
+	return ""
+}
+
+// post sends a message to a room as the chat form does
+func (b *browser) post(roomID, username, message string) {
+	b.t.Helper()
+	res, err := b.client.PostForm(b.app.URL+"/api/rooms/"+roomID+"/chats", url.Values{"username": {username}, "message": {message}})
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b.t.Fatalf("posting to %s: status %d", roomID, res.StatusCode)
+	}
+}
+
+// dial connects the browser's page to the hub with its cookies
+func (b *browser) dial() *testutil.WSClient {
+	b.t.Helper()
+	u, _ := url.Parse(b.app.URL)
+	header := http.Header{}
+	for _, cookie := range b.client.Jar.Cookies(u) {
+		header.Add("Cookie", cookie.String())
+	}
+	return b.app.DialWS("/ws", header)
+}
+
+func TestEndToEndMention(t *testing.T) {
+	var room *models.Room
+	app := testutil.StartApp(t, testutil.Hooks{
+		Configure: func(cfg *config.Config) {
+			cfg.Moderation.MessagesPerMinute = 0
+		},
+		Setup: func(app *testutil.App) {
+			room = app.Stores.SeedRoom("General")
+		},
+	})
+	alice := &browser{t: t, app: app, client: app.Client()}
+	bob := &browser{t: t, app: app, client: app.NewClient()}
+	aliceID, bobID := alice.open(), bob.open()
+	if aliceID == bobID {
+		t.Fatalf("both browsers are visitor %q", aliceID)
+	}
+
+	alice.post(room.ID, "alice", "Hi")
+	page := alice.dial()
+	app.WaitClients(1)
+	bob.post(room.ID, "bob", "Hello @alice")
+
+	chat := page.Expect("new-chat")
+	page.Expect("notifications")
+	// The app's client is alice's browser
+	res, body := app.HXGet("/api/rooms/" + room.ID + "/chats")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("messages: status %d", res.StatusCode)
+	}
+	testutil.AssertOrder(t, body, "Hi", "Hello @alice")
+	testutil.AssertAttr(t, body, "id", "chat-"+chat.ChatID)
+	if n := app.Handler.NotificationStore.Count(aliceID); n != 1 {
+		t.Errorf("alice has %d unread mentions, want 1", n)
+	}
+	if n := app.Handler.NotificationStore.Count(bobID); n != 0 {
+		t.Errorf("bob has %d unread mentions, want none", n)
+	}
+}
+
+func TestEndToEndRetention(t *testing.T) {
+	var room *models.Room
+	var old *models.Chat
+	app := testutil.StartApp(t, testutil.Hooks{
+		Configure: func(cfg *config.Config) {
+			cfg.Retention.MessageDays = 30
+		},
+		Setup: func(app *testutil.App) {
+			room = app.Stores.SeedRoom("General")
+			old = &models.Chat{ID: "old", RoomID: room.ID, Username: "alice", Message: "from last year", CreatedAt: time.Now().AddDate(-1, 0, 0)}
+			if err := app.Stores.Chats.AddChat(old); err != nil {
+				t.Fatal(err)
+			}
+			app.Stores.SeedChat(room.ID, "bob", "from today")
+		},
+		Stopped: func(app *testutil.App) {
+			if _, exists := app.Handler.ChatStore.GetChat(old.ID); exists {
+				t.Error("message past the retention kept")
+			}
+		},
+	})
+
+	// The purge runs hourly, or at once from the dashboard
+	res, body := app.Do(app.AsAdmin(app.NewRequest(http.MethodPost, "/admin/jobs/retention/run", nil)))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("running the purge: status %d: %s", res.StatusCode, body)
+	}
+	for deadline := time.Now().Add(testutil.DefaultTimeout); app.Handler.ChatStore.CountByRoom(room.ID) != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("room has %d messages after the purge, want 1", app.Handler.ChatStore.CountByRoom(room.ID))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
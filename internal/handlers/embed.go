@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// widgetScript inserts an iframe with the embeddable room view where the
+// script tag is. %s is the JSON-encoded URL of the view
+const widgetScript = `(function () {
+  var script = document.currentScript;
+  var src = %s;
+  var theme = script && script.dataset.theme;
+  if (theme) {
+    src += "?theme=" + encodeURIComponent(theme);
+  }
+  var frame = document.createElement("iframe");
+  frame.src = src;
+  frame.title = "Chat room";
+  frame.loading = "lazy";
+  frame.style.border = "0";
+  frame.style.width = (script && script.dataset.width) || "100%%";
+  frame.style.height = (script && script.dataset.height) || "480px";
+  if (script && script.parentNode) {
+    script.parentNode.insertBefore(frame, script);
+  } else {
+    document.body.appendChild(frame);
+  }
+})();
+`
+
+// EmbedRoom renders the compact, frameable view of a room
+func (h *Handler) EmbedRoom(c *gin.Context) {
+	room, exists := h.RoomStore.GetRoom(c.Param("id"))
+	if !exists {
+		c.String(http.StatusNotFound, "Room not found")
+		return
+	}
+
+	c.Header("Content-Security-Policy", h.frameAncestors())
+	renderLayout(c, http.StatusOK, "layouts/embed.html", gin.H{
+		"title": room.Name,
+		"room":  room,
+		"theme": c.Query("theme"),
+		"Page":  "embed",
+	})
+}
+
+// EmbedWidget serves the script that embeds a room into another website
+func (h *Handler) EmbedWidget(c *gin.Context) {
+	room, exists := h.RoomStore.GetRoom(c.Param("id"))
+	if !exists {
+		c.String(http.StatusNotFound, "// Room not found")
+		return
+	}
+
+	src, err := json.Marshal(baseURL(c) + "/embed/rooms/" + url.PathEscape(room.ID))
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "text/javascript; charset=utf-8", fmt.Appendf(nil, widgetScript, src))
+}
+
+// frameAncestors returns the policy limiting which sites may frame the
+// embeddable view to the configured origins
+func (h *Handler) frameAncestors() string {
+	origins := h.Config.Embed.AllowedOrigins
+	for _, origin := range origins {
+		if origin == "*" {
+			return "frame-ancestors *"
+		}
+	}
+	return strings.TrimSpace("frame-ancestors 'self' " + strings.Join(origins, " "))
+}
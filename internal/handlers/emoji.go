@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/emoji"
+	"htmx/internal/features"
+	"htmx/internal/sanitize"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxEmojiResults caps the emoji returned by a search
+const maxEmojiResults = 48
+
+// pickerTarget matches the IDs of the fields a picker can insert into
+var pickerTarget = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// emojiSection is a titled group of emoji in the picker
+type emojiSection struct {
+	// Title is the message key of the section heading
+	Title string
+	Emoji []emoji.Emoji
+}
+
+// emojiPicker reads the query of a picker: the ID of the field the picked
+// emoji is inserted into, and the URL it is posted to as "emoji", which
+// records it as recently used by default. Reactions post it to their own URL
+// and leave target empty
+func emojiPicker(c *gin.Context) (gin.H, bool) {
+	target, action := c.Query("target"), c.DefaultQuery("action", "/emoji/recent")
+	if target != "" && !pickerTarget.MatchString(target) {
+		return nil, false
+	}
+	if !strings.HasPrefix(action, "/") || strings.HasPrefix(action, "//") || strings.ContainsAny(action, " \\") {
+		return nil, false
+	}
+
+	id := "emoji-picker"
+	if target != "" {
+		id = target + "-emoji"
+	}
+	vals, _ := json.Marshal(gin.H{"target": target, "action": action})
+	return gin.H{"id": id, "target": target, "action": action, "vals": string(vals)}, true
+}
+
+// EmojiPicker renders the emoji picker, with a search field over its sections
+func (h *Handler) EmojiPicker(c *gin.Context) {
+	data, ok := emojiPicker(c)
+	if !ok {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	data["sections"] = h.emojiSections(c)
+	render(c, http.StatusOK, "partials/emoji-picker.html", data)
+}
+
+// emojiSections returns the sections of a picker before any search: the
+// emoji the browser used last, then every category
+func (h *Handler) emojiSections(c *gin.Context) []emojiSection {
+	visitorID := features.VisitorID(c)
+	var sections []emojiSection
+	var recent []emoji.Emoji
+	for _, char := range h.EmojiStore.Recent(visitorID) {
+		if e, ok := emoji.Lookup(char); ok {
+			recent = append(recent, e)
+		}
+	}
+	if len(recent) > 0 {
+		sections = append(sections, emojiSection{Title: "emoji.recent", Emoji: recent})
+	}
+	for _, category := range emoji.Categories() {
+		sections = append(sections, emojiSection{Title: "emoji.category." + category.ID, Emoji: category.Emoji})
+	}
+	return sections
+}
+
+// SearchEmoji returns the emoji matching the q query as JSON, or as the
+// grid of a picker for htmx, which shows the picker's sections again for
+// an empty query
+func (h *Handler) SearchEmoji(c *gin.Context) {
+	query := sanitize.Query(c.Query("q"))
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, emoji.Search(query, maxEmojiResults))
+		return
+	}
+
+	data, ok := emojiPicker(c)
+	if !ok {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	data["search"] = query
+	if query == "" {
+		data["sections"] = h.emojiSections(c)
+	} else if found := emoji.Search(query, maxEmojiResults); len(found) > 0 {
+		data["sections"] = []emojiSection{{Title: "emoji.results", Emoji: found}}
+	}
+	render(c, http.StatusOK, "partials/emoji-grid.html", data)
+}
+
+// UseEmoji records an emoji picked into a field as recently used
+func (h *Handler) UseEmoji(c *gin.Context) {
+	visitorID := features.VisitorID(c)
+	char := c.PostForm("emoji")
+	if _, ok := emoji.Lookup(char); !ok || visitorID == "" {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	h.EmojiStore.Use(visitorID, char)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/i18n"
+	"net/http"
+)
+
+// NotFound renders the 404 page for unmatched routes
+func (h *Handler) NotFound(c *gin.Context) {
+	h.renderErrorPage(c, http.StatusNotFound, "errors.not_found", "errors.not_found_message")
+}
+
+// MethodNotAllowed renders the 405 page for routes matched with the wrong method
+func (h *Handler) MethodNotAllowed(c *gin.Context) {
+	h.renderErrorPage(c, http.StatusMethodNotAllowed, "errors.method_not_allowed", "errors.method_not_allowed_message")
+}
+
+// renderErrorPage renders the error partial for HTMX requests and the full
+// page otherwise, translating the heading and message keys
+func (h *Handler) renderErrorPage(c *gin.Context, status int, heading, message string) {
+	locale := i18n.FromContext(c)
+	heading, message = locale.T(heading), locale.T(message)
+	data := gin.H{
+		"title":   heading,
+		"rooms":   h.RoomStore.GetRooms(), // For sidebar
+		"status":  status,
+		"heading": heading,
+		"message": message,
+		"flags":   features.FromContext(c),
+		"Page":    "error",
+		"search":  pageSearch(c),
+	}
+
+	if partial(c) {
+		render(c, status, "partials/error-page.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/base.html", data)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// exportReadme is the first file of a compliance export, describing the
+// others
+const exportReadme = `This archive holds the data this server keeps about one browser, identified
+by the visitor ID of its cookie, as there are no accounts.
+
+profile.json   the name last posted under, feature flags, keyboard shortcuts,
+               recent emoji, dismissed announcements, quota usage and any ban
+messages.json  the messages in the rooms posted under that name
+mentions.json  the unread messages mentioning the browser
+reports.json   the messages the browser reported, while awaiting review
+sessions.json  the open WebSocket connections of the browser
+
+Nothing is uploaded to this server besides the messages themselves.
+`
+
+// exportProfile is profile.json of a compliance export
+type exportProfile struct {
+	VisitorID              string                 `json:"visitor_id"`
+	Name                   string                 `json:"name,omitempty"`
+	ExportedAt             time.Time              `json:"exported_at"`
+	Flags                  map[string]bool        `json:"feature_flags"`
+	Shortcuts              models.Keymap          `json:"shortcuts"`
+	RecentEmoji            []string               `json:"recent_emoji"`
+	DismissedAnnouncements []*models.Announcement `json:"dismissed_announcements"`
+	Quotas                 []exportQuota          `json:"quotas"`
+	Ban                    *models.Ban            `json:"ban,omitempty"`
+}
+
+// exportQuota is the usage of a quota in its current period
+type exportQuota struct {
+	Quota string `json:"quota"`
+	Used  int64  `json:"used"`
+	// Limit is 0 for a quota without a limit
+	Limit       int64     `json:"limit"`
+	PeriodStart time.Time `json:"period_start"`
+	Resets      time.Time `json:"resets"`
+}
+
+// exportChat is a message of a compliance export, with the name of its room
+type exportChat struct {
+	*models.Chat
+	Room string `json:"room"`
+}
+
+// exportReport is a report of a compliance export
+type exportReport struct {
+	MessageID string `json:"message_id"`
+	RoomID    string `json:"room_id"`
+	*models.Report
+}
+
+// ExportVisitor downloads a zip of everything kept about a visitor, for a
+// data-access request. Exports are recorded in the audit log
+func (h *Handler) ExportVisitor(c *gin.Context) {
+	visitorID := strings.TrimSpace(c.Query("visitor_id"))
+	if visitorID == "" || len(visitorID) > 64 {
+		c.String(http.StatusBadRequest, "A visitor ID is required")
+		return
+	}
+	name := h.NotificationStore.Name(visitorID)
+	middleware.AuditView(c, "visitor.export")
+	middleware.SetAuditChange(c, nil, gin.H{"visitor_id": visitorID, "name": name})
+
+	now := h.clock.Now()
+	profile := exportProfile{
+		VisitorID:              visitorID,
+		Name:                   name,
+		ExportedAt:             now,
+		Flags:                  h.Features.Evaluate(visitorID),
+		Shortcuts:              h.ShortcutStore.GetKeymap(visitorID),
+		RecentEmoji:            append([]string{}, h.EmojiStore.Recent(visitorID)...),
+		DismissedAnnouncements: append([]*models.Announcement{}, h.Announcements.Dismissed(visitorID)...),
+	}
+	for _, quota := range quotas {
+		period, next := quotaPeriod(quota, now)
+		profile.Quotas = append(profile.Quotas, exportQuota{
+			Quota:       quota,
+			Used:        h.Quotas.Used(visitorID, quota, period),
+			Limit:       h.quotaLimit(quota),
+			PeriodStart: period,
+			Resets:      next,
+		})
+	}
+	if name != "" {
+		if ban, banned := h.BanStore.GetBan(name); banned {
+			profile.Ban = ban
+		}
+	}
+	sessions, _ := h.Hub.Sessions(visitorID, time.Second)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="visitor-export-`+now.Format(time.DateOnly)+`.zip"`)
+	c.Status(http.StatusOK)
+
+	w := zip.NewWriter(c.Writer)
+	err := exportText(w, "README.txt", exportReadme, now)
+	for _, file := range []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"messages.json", h.exportChats(name)},
+		{"mentions.json", h.NotificationStore.Unread(visitorID)},
+		{"reports.json", h.exportReports(visitorID)},
+		{"sessions.json", sessions},
+	} {
+		if err != nil {
+			break
+		}
+		err = exportJSON(w, file.name, file.data, now)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		slog.Warn("compliance export failed", "visitor", visitorID, "error", err)
+	}
+}
+
+// exportChats returns the messages posted under a name, oldest first; the
+// names are compared ignoring case, as bans compare them
+func (h *Handler) exportChats(name string) []exportChat {
+	chats := []exportChat{}
+	if name == "" {
+		return chats
+	}
+	roomNames := make(map[string]string)
+	h.RoomStore.ForEachRoom(func(room *models.Room) bool {
+		roomNames[room.ID] = room.Name
+		return true
+	})
+	for _, chat := range h.ChatStore.GetChats() {
+		if !chat.Bot && chat.Origin == "" && strings.EqualFold(chat.Username, name) {
+			chats = append(chats, exportChat{Chat: chat, Room: roomNames[chat.RoomID]})
+		}
+	}
+	slices.SortFunc(chats, func(a, b exportChat) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return chats
+}
+
+// exportReports returns the reports a visitor made of the messages in the
+// moderation queue
+func (h *Handler) exportReports(visitorID string) []exportReport {
+	reports := []exportReport{}
+	for _, item := range h.ModerationQueue.List() {
+		for _, report := range item.Reports {
+			if report.VisitorID == visitorID {
+				reports = append(reports, exportReport{MessageID: item.Chat.ID, RoomID: item.Chat.RoomID, Report: report})
+			}
+		}
+	}
+	return reports
+}
+
+// exportText adds a text file to a zip
+func exportText(w *zip.Writer, name, text string, modified time.Time) error {
+	f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, text)
+	return err
+}
+
+// exportJSON adds a JSON file of data to a zip, indented to be read as is
+func exportJSON(w *zip.Writer, name string, data any, modified time.Time) error {
+	f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
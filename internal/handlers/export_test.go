@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"htmx/internal/features"
+	"htmx/internal/testutil"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// exportSessions returns the sessions.json of the data export of a visitor
+func exportSessions(t *testing.T, srv *testutil.Server, visitorID string) []map[string]any {
+	t.Helper()
+	res, body := srv.Do(srv.AsAdmin(srv.NewRequest(http.MethodGet, "/admin/export?visitor_id="+visitorID, nil)))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("export status = %d: %s", res.StatusCode, body)
+	}
+	archive, err := zip.NewReader(bytes.NewReader([]byte(body)), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := archive.Open("sessions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sessions []map[string]any
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		t.Fatalf("sessions.json: %v", err)
+	}
+	return sessions
+}
+
+func TestExportSessionsSkipImpersonation(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	const visitorID = "visitor-1"
+
+	visitor := http.Header{}
+	visitor.Set("Cookie", features.VisitorCookie+"="+visitorID)
+	visitor.Set("User-Agent", "visitor-browser")
+	srv.DialWS("/ws", visitor)
+
+	// An admin viewing the site as the visitor connects under its ID
+	impersonation := features.SignImpersonation(features.Impersonation{
+		VisitorID: visitorID,
+		Admin:     testutil.AdminUsername,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, []byte(srv.Config.Features.Secret))
+	admin := http.Header{}
+	admin.Set("Cookie", features.VisitorCookie+"=admin-browser; "+features.ImpersonationCookie+"="+impersonation)
+	admin.Set("User-Agent", "admin-browser")
+	srv.DialWS("/ws", admin)
+
+	srv.WaitClients(2)
+
+	sessions := exportSessions(t, srv, visitorID)
+	if len(sessions) != 1 || sessions[0]["user_agent"] != "visitor-browser" {
+		t.Errorf("sessions = %v, want the visitor's browser only", sessions)
+	}
+}
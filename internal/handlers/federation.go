@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/federation"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// FederationEvents receives a message relayed by a peer instance, posts it
+// into the shared room and relays it on to the other peers sharing the room
+func (h *Handler) FederationEvents(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		status, message := h.bindError(c, err, "unreadable body")
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	peer, err := h.Federation.Verify(c.Request, body)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.SetAuditActor(c, "peer:"+peer.Name)
+
+	var event federation.Event
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Origin == "" || event.Room == "" || sanitize.Name(event.Username) == "" || sanitize.Message(event.Message) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event"})
+		return
+	}
+
+	switch err := h.Federation.Accept(peer, event); {
+	case errors.Is(err, federation.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := h.namedRoom(event.Room)
+	if errors.Is(err, errNotSaved) {
+		h.Federation.Forget(event)
+		storeFailedJSON(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if h.roomFull(room.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "room has reached its message limit"})
+		return
+	}
+
+	err = h.addChat(&models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    room.ID,
+		Username:  event.Username,
+		Message:   event.Message,
+		Bot:       event.Bot,
+		Origin:    event.Origin,
+		CreatedAt: h.clock.Now(),
+	})
+	if err != nil {
+		h.Federation.Forget(event)
+		storeFailedJSON(c, err)
+		return
+	}
+	h.Federation.Forward(event)
+
+	c.Status(http.StatusNoContent)
+}
+
+// publishFederated relays a local message to the peers sharing its room
+func (h *Handler) publishFederated(chat *models.Chat) {
+	room, exists := h.RoomStore.GetRoom(chat.RoomID)
+	if !exists {
+		slog.Warn("not federating message of unknown room", "room", chat.RoomID)
+		return
+	}
+
+	h.Federation.Publish(federation.Event{
+		ID:        chat.ID,
+		Room:      room.Name,
+		Username:  chat.Username,
+		Message:   chat.Message,
+		Bot:       chat.Bot,
+		CreatedAt: chat.CreatedAt,
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/components"
+	"htmx/internal/models"
+	"net"
+	"net/http"
+	"time"
+)
+
+// feedEntries is the number of latest messages included in a room feed
+const feedEntries = 50
+
+// The room header links to the feed
+func init() {
+	components.Register(components.RoomHeader, components.Component{Name: "feed", Template: "partials/room-feed-link.html", Order: 20})
+}
+
+// atomFeed is an Atom 1.0 feed document
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomLink is an Atom link element
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// atomEntry is a single message in a room feed
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Link    atomLink   `xml:"link"`
+	Content atomText   `xml:"content"`
+}
+
+// atomAuthor is the author of an entry
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// atomText is a text construct
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// RoomFeed serves the latest messages of a room as an Atom feed
+func (h *Handler) RoomFeed(c *gin.Context) {
+	room, exists := h.RoomStore.GetRoom(c.Param("id"))
+	if !exists {
+		c.String(http.StatusNotFound, "Room not found")
+		return
+	}
+
+	total := h.ChatStore.CountByRoom(room.ID)
+	chats, _ := h.ChatStore.GetChatsByRoomPage(room.ID, total-feedEntries, feedEntries)
+
+	roomURL := baseURL(c) + "/rooms/" + room.ID
+	tag := feedTag(c.Request.Host, room)
+	feed := atomFeed{
+		ID:      tag,
+		Title:   room.Name,
+		Updated: feedTime(room.CreatedAt),
+		Links: []atomLink{
+			{Href: roomURL, Rel: "alternate", Type: "text/html"},
+			{Href: roomURL + "/feed.atom", Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: make([]atomEntry, 0, len(chats)),
+	}
+
+	// Newest first, as feed readers expect
+	for i := len(chats) - 1; i >= 0; i-- {
+		feed.Entries = append(feed.Entries, feedEntry(chats[i], roomURL, tag))
+	}
+	if len(chats) > 0 {
+		feed.Updated = feedTime(chats[len(chats)-1].CreatedAt)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to render feed")
+		return
+	}
+	c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// feedEntry converts a chat message to a feed entry
+func feedEntry(chat *models.Chat, roomURL, tag string) atomEntry {
+	return atomEntry{
+		ID:      tag + "/chats/" + chat.ID,
+		Title:   chat.Username + ": " + truncate(chat.Message, 80),
+		Updated: feedTime(chat.CreatedAt),
+		Author:  atomAuthor{Name: chat.Username},
+		Link:    atomLink{Href: roomURL + "#chat-" + chat.ID, Rel: "alternate"},
+		Content: atomText{Type: "text", Body: chat.Message},
+	}
+}
+
+// feedTag returns the tag URI (RFC 4151) identifying a room's feed, which
+// stays the same for as long as the room is served from the same host
+func feedTag(host string, room *models.Room) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return fmt.Sprintf("tag:%s,%s:rooms/%s", host, room.CreatedAt.UTC().Format(time.DateOnly), room.ID)
+}
+
+// feedTime formats a timestamp as an Atom date
+func feedTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// baseURL returns the scheme and host the request was made to
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
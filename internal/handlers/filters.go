@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"net/http"
+)
+
+// AdminFilters renders the filter rules, the words and expressions the
+// moderation filters flag or block
+func (h *Handler) AdminFilters(c *gin.Context) {
+	h.renderAdminFilters(c, http.StatusOK, "")
+}
+
+// CreateFilterRule adds a filter rule, applied from the next message posted
+func (h *Handler) CreateFilterRule(c *gin.Context) {
+	var input struct {
+		Pattern string `form:"pattern" binding:"required"`
+		Regex   bool   `form:"regex"`
+		Action  string `form:"action" binding:"required,oneof=flag block"`
+		RoomID  string `form:"room_id"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminFilters(c, http.StatusBadRequest, "A pattern and an action are required")
+		return
+	}
+	if input.RoomID != "" {
+		if _, exists := h.RoomStore.GetRoom(input.RoomID); !exists {
+			h.renderAdminFilters(c, http.StatusBadRequest, "Unknown room")
+			return
+		}
+	}
+
+	rule := &models.FilterRule{
+		ID:        uuid.New().String(),
+		Pattern:   input.Pattern,
+		Regex:     input.Regex,
+		Action:    input.Action,
+		RoomID:    input.RoomID,
+		By:        c.GetString(gin.AuthUserKey),
+		CreatedAt: h.clock.Now(),
+	}
+	if err := rule.Compile(); err != nil {
+		h.renderAdminFilters(c, http.StatusBadRequest, "Cannot add the rule: "+err.Error())
+		return
+	}
+	h.FilterRules.AddRule(rule)
+	middleware.SetAuditChange(c, nil, rule)
+	toasts.Add(c, toasts.Success, "Rule "+rule.Pattern+" added")
+
+	h.renderAdminFilters(c, http.StatusOK, "")
+}
+
+// DeleteFilterRule removes a filter rule
+func (h *Handler) DeleteFilterRule(c *gin.Context) {
+	rule, exists := h.FilterRules.DeleteRule(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "Rule not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, rule, nil)
+	toasts.Add(c, toasts.Success, "Rule "+rule.Pattern+" deleted")
+
+	h.renderAdminFilters(c, http.StatusOK, "")
+}
+
+// renderAdminFilters renders the filters page with an optional form error
+func (h *Handler) renderAdminFilters(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	rooms := h.RoomStore.GetRooms()
+	roomNames := make(map[string]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+
+	data := gin.H{
+		"title":     "Filters",
+		"rules":     h.FilterRules.GetRules(),
+		"words":     h.Config.Moderation.Words,
+		"rooms":     rooms,
+		"roomNames": roomNames,
+		"error":     errMsg,
+		"Page":      "filters",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-filters.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"cmp"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/i18n"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// galleryComponent is a partial shown in the dev component gallery, with
+// the sample data variants it is rendered with
+type galleryComponent struct {
+	// Name is the URL segment of the component
+	Name     string
+	Title    string
+	Template string
+	Variants []galleryVariant
+}
+
+// galleryVariant renders a component with one set of sample data
+type galleryVariant struct {
+	Name  string
+	Title string
+	// Template overrides the template of the component, for the variants
+	// of a family of partials
+	Template string
+	// data returns the template data, without the locale render adds
+	data func(h *Handler, c *gin.Context) gin.H
+}
+
+// galleryChats are the sample messages of the gallery, one of each kind
+func galleryChats() []*models.Chat {
+	now := time.Now()
+	return []*models.Chat{
+		{ID: "gallery-1", RoomID: "gallery", Username: "Ada", Message: "Hello everyone!", CreatedAt: now.Add(-20 * time.Minute)},
+		{ID: "gallery-2", RoomID: "gallery", Username: "Grace", Message: "A longer message that wraps over several lines, to check the spacing of the card and the position of the time next to it.\nIt keeps its line breaks too.", CreatedAt: now.Add(-15 * time.Minute)},
+		{ID: "gallery-3", RoomID: "gallery", Username: "Deploy bot", Message: "Build #1234 passed", Bot: true, CreatedAt: now.Add(-10 * time.Minute)},
+		{ID: "gallery-4", RoomID: "gallery", Username: "Linus", Message: "Hi from another instance", Origin: "chat.example.org", CreatedAt: now.Add(-5 * time.Minute)},
+		{ID: "gallery-5", RoomID: "gallery", Username: "Margaret", Message: "Posted before the server stored a time"},
+	}
+}
+
+// galleryRooms are the sample rooms of the gallery
+func galleryRooms() []*models.Room {
+	now := time.Now()
+	return []*models.Room{
+		{ID: "gallery-general", Name: "General", CreatedAt: now.Add(-24 * time.Hour)},
+		{ID: "gallery-technology", Name: "Technology", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "gallery-a-room-with-a-rather-long-name", Name: "A room with a rather long name that may not fit the sidebar"},
+	}
+}
+
+// galleryComponents lists the partials of the gallery, in the order shown
+var galleryComponents = []galleryComponent{
+	{
+		Name: "messages-list", Title: "Messages list", Template: "partials/component-messages-list.html",
+		Variants: []galleryVariant{
+			{"messages", "Messages", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"chats": galleryChats(), "roomID": "gallery", "flags": features.FromContext(c)}
+			}},
+			{"empty", "Empty room", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"chats": []*models.Chat{}, "roomID": "gallery", "flags": features.FromContext(c)}
+			}},
+		},
+	},
+	{
+		Name: "rooms-list", Title: "Rooms list", Template: "partials/component-rooms-list.html",
+		Variants: []galleryVariant{
+			{"rooms", "Rooms", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"rooms": galleryRooms(), "counts": map[string]int{"gallery-general": 42, "gallery-technology": 1}}
+			}},
+			{"empty", "No rooms", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"rooms": []*models.Room{}}
+			}},
+			{"no-match", "No search match", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"rooms": []*models.Room{}, "search": "kubernetes"}
+			}},
+		},
+	},
+	{
+		Name: "pending-message", Title: "Pending message", Template: "partials/chat-pending.html",
+		Variants: []galleryVariant{
+			{"sending", "Sending", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"username": "Ada", "message": "On its way"}
+			}},
+			{"held", "Held for review", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"username": "Ada", "message": "Check out http://example.com", "held": true}
+			}},
+			{"failed", "Failed", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"username": "Ada", "message": "This one did not make it", "failed": true}
+			}},
+		},
+	},
+	{
+		Name: "toasts", Title: "Toasts", Template: "partials/gallery-toast.html",
+		Variants: []galleryVariant{
+			{"success", "Success", "", galleryToast(toasts.Success, "toasts.room_created", "name", "General")},
+			{"info", "Info", "", galleryToast(toasts.Info, "offline.request_failed")},
+			{"error", "Error", "", galleryToast(toasts.Error, "errors.unexpected")},
+		},
+	},
+	{
+		Name: "error-boundary", Title: "Error boundary", Template: "partials/error-boundary.html",
+		Variants: []galleryVariant{
+			{"retry", "Retrying the request", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{
+					"message":   i18n.FromContext(c).T("errors.unexpected"),
+					"requestID": "3f2a9c1e-0b7d-4e8a-9f61-5c2d8e4b7a90",
+					"retry":     gin.H{"Method": "get", "URL": c.Request.URL.Path, "Target": "#gallery-error-boundary-retry", "Swap": "innerHTML"},
+				}
+			}},
+			{"reload", "Reloading the page", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{
+					"message":   i18n.FromContext(c).T("errors.unexpected"),
+					"requestID": "3f2a9c1e-0b7d-4e8a-9f61-5c2d8e4b7a90",
+					"retry":     gin.H{"Method": "get", "URL": c.Request.URL.Path},
+				}
+			}},
+			{"no-request-id", "Without a request ID", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"message": i18n.FromContext(c).T("errors.chat_gone")}
+			}},
+		},
+	},
+	{
+		Name: "form-errors", Title: "Form errors", Template: "partials/error-chat-form.html",
+		Variants: []galleryVariant{
+			{"rooms-limit", "Room limit, room form", "partials/error-room-form.html", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"error": i18n.FromContext(c).N("errors.rooms_limit", 100)}
+			}},
+			{"banned", "Banned name", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"error": i18n.FromContext(c).T("errors.banned")}
+			}},
+			{"limit", "Room message limit", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"error": i18n.FromContext(c).N("errors.messages_limit", 1000)}
+			}},
+			{"rate", "Posting too fast", "", func(h *Handler, c *gin.Context) gin.H {
+				return gin.H{"error": i18n.FromContext(c).T("errors.post_limit")}
+			}},
+		},
+	},
+	{
+		Name: "error-page", Title: "Error page", Template: "partials/error-page.html",
+		Variants: []galleryVariant{
+			{"not-found", "Not found", "", galleryErrorPage(http.StatusNotFound, "errors.not_found", "errors.not_found_message")},
+			{"method-not-allowed", "Method not allowed", "", galleryErrorPage(http.StatusMethodNotAllowed, "errors.method_not_allowed", "errors.method_not_allowed_message")},
+		},
+	},
+	{
+		Name: "skeletons", Title: "Loading skeletons", Template: "partials/skeleton-room-page.html",
+		Variants: []galleryVariant{
+			{"room-page", "Room page", "", galleryEmpty},
+			{"messages", "Messages", "partials/skeleton-messages.html", galleryEmpty},
+			{"rooms-list", "Rooms list", "partials/skeleton-rooms-list.html", galleryEmpty},
+		},
+	},
+}
+
+// galleryEmpty is the data of the partials that need none
+func galleryEmpty(h *Handler, c *gin.Context) gin.H {
+	return gin.H{}
+}
+
+// galleryToast queues a toast with the translated message, shown out of
+// band as handlers' toasts are
+func galleryToast(level, key string, args ...any) func(h *Handler, c *gin.Context) gin.H {
+	return func(h *Handler, c *gin.Context) gin.H {
+		toasts.Add(c, level, i18n.FromContext(c).T(key, args...))
+		return gin.H{"url": c.Request.URL.Path}
+	}
+}
+
+// galleryErrorPage renders the error page partial with a status
+func galleryErrorPage(status int, heading, message string) func(h *Handler, c *gin.Context) gin.H {
+	return func(h *Handler, c *gin.Context) gin.H {
+		locale := i18n.FromContext(c)
+		return gin.H{"status": status, "heading": locale.T(heading), "message": locale.T(message)}
+	}
+}
+
+// setupGallery serves the component gallery of dev mode: every partial of
+// galleryComponents rendered in isolation with each of its variants
+func (h *Handler) setupGallery(router *gin.Engine) {
+	router.GET("/__components", h.Gallery)
+	router.GET("/__components/:component", h.Gallery)
+	router.GET("/__components/:component/:variant", h.GalleryVariant)
+}
+
+// Gallery renders the gallery page, with every component or the one named
+func (h *Handler) Gallery(c *gin.Context) {
+	shown := galleryComponents
+	if name := c.Param("component"); name != "" {
+		i := slices.IndexFunc(galleryComponents, func(component galleryComponent) bool {
+			return component.Name == name
+		})
+		if i < 0 {
+			h.NotFound(c)
+			return
+		}
+		shown = galleryComponents[i : i+1]
+	}
+
+	data := gin.H{
+		"title":      "Components",
+		"components": galleryComponents,
+		"shown":      shown,
+		"current":    c.Param("component"),
+	}
+	if theme := c.Query("theme"); slices.Contains(themes, theme) {
+		data["theme"] = theme
+	}
+	renderLayout(c, http.StatusOK, "layouts/gallery.html", data)
+}
+
+// GalleryVariant renders one variant of a component, as the gallery page
+// loads them
+func (h *Handler) GalleryVariant(c *gin.Context) {
+	for _, component := range galleryComponents {
+		if component.Name != c.Param("component") {
+			continue
+		}
+		for _, variant := range component.Variants {
+			if variant.Name == c.Param("variant") {
+				render(c, http.StatusOK, cmp.Or(variant.Template, component.Template), variant.data(h, c))
+				return
+			}
+		}
+	}
+	h.NotFound(c)
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"htmx/internal/models"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+// graphqlRequest is a GraphQL operation sent over HTTP
+type graphqlRequest struct {
+	Query         string         `json:"query" form:"query"`
+	OperationName string         `json:"operationName" form:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// newSchema parses the GraphQL schema with resolvers over the handler's stores and hub
+func (h *Handler) newSchema() *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &rootResolver{h: h},
+		graphql.MaxDepth(10),
+	)
+}
+
+// GraphQL executes queries sent as JSON POST or GET parameters. Requests that
+// accept text/event-stream are answered as Server-Sent Events, which is how
+// subscriptions are delivered
+func (h *Handler) GraphQL(c *gin.Context) {
+	var req graphqlRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if vars := c.Query("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": "variables must be a JSON object"}}})
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		status, message := h.bindError(c, err, "the body must be a JSON GraphQL request")
+		c.JSON(status, gin.H{"errors": []gin.H{{"message": message}}})
+		return
+	}
+	if req.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": "query is required"}}})
+		return
+	}
+
+	if !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		c.JSON(http.StatusOK, h.Schema.Exec(c.Request.Context(), req.Query, req.OperationName, req.Variables))
+		return
+	}
+
+	responses, err := h.Schema.Subscribe(c.Request.Context(), req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": err.Error()}}})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		response, ok := <-responses
+		if !ok {
+			c.SSEvent("complete", "")
+			return false
+		}
+		data, _ := json.Marshal(response)
+		c.SSEvent("next", string(data))
+		return true
+	})
+}
+
+// rootResolver resolves the Query and Subscription fields
+type rootResolver struct {
+	h *Handler
+}
+
+func (r *rootResolver) Rooms() []*roomResolver {
+	rooms := r.h.RoomStore.GetRooms()
+	resolvers := make([]*roomResolver, len(rooms))
+	for i, room := range rooms {
+		resolvers[i] = &roomResolver{r.h, room}
+	}
+	return resolvers
+}
+
+func (r *rootResolver) Room(args struct{ ID graphql.ID }) *roomResolver {
+	room, exists := r.h.RoomStore.GetRoom(string(args.ID))
+	if !exists {
+		return nil
+	}
+	return &roomResolver{r.h, room}
+}
+
+func (r *rootResolver) Chats(args struct {
+	RoomID graphql.ID
+	Last   int32
+}) []*chatResolver {
+	return r.h.chatResolvers(r.h.lastChats(string(args.RoomID), args.Last))
+}
+
+func (r *rootResolver) Users() []*userResolver {
+	return r.h.userResolvers("")
+}
+
+func (r *rootResolver) User(args struct{ Name string }) *userResolver {
+	users := r.h.userResolvers(args.Name)
+	if len(users) == 0 {
+		return nil
+	}
+	return users[0]
+}
+
+func (r *rootResolver) Search(args struct {
+	Text   string
+	RoomID *graphql.ID
+	Limit  int32
+}) []*chatResolver {
+	text := strings.ToLower(args.Text)
+	chats := r.h.ChatStore.GetChats()
+	slices.SortFunc(chats, func(a, b *models.Chat) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	var matches []*models.Chat
+	for _, chat := range chats {
+		if len(matches) >= int(args.Limit) {
+			break
+		}
+		if args.RoomID != nil && chat.RoomID != string(*args.RoomID) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(chat.Message), text) {
+			matches = append(matches, chat)
+		}
+	}
+	return r.h.chatResolvers(matches)
+}
+
+func (r *rootResolver) MessageAdded(ctx context.Context, args struct{ RoomID *graphql.ID }) <-chan *chatResolver {
+	out := make(chan *chatResolver)
+	subscribeHub(ctx, r.h, func(event HubEvent) *chatResolver {
+		if event.Type != models.EventChatCreated || (args.RoomID != nil && event.Chat.RoomID != string(*args.RoomID)) {
+			return nil
+		}
+		return &chatResolver{r.h, event.Chat}
+	}, out)
+	return out
+}
+
+func (r *rootResolver) RoomAdded(ctx context.Context) <-chan *roomResolver {
+	out := make(chan *roomResolver)
+	subscribeHub(ctx, r.h, func(event HubEvent) *roomResolver {
+		if event.Type != models.EventRoomCreated {
+			return nil
+		}
+		return &roomResolver{r.h, event.Room}
+	}, out)
+	return out
+}
+
+// subscribeHub forwards the hub events selected by pick to out until ctx is done
+func subscribeHub[T any](ctx context.Context, h *Handler, pick func(HubEvent) *T, out chan<- *T) {
+	events, cancel := h.Hub.Subscribe()
+	go func() {
+		defer close(out)
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				if v := pick(event); v != nil {
+					select {
+					case out <- v:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// roomResolver resolves the fields of a Room
+type roomResolver struct {
+	h    *Handler
+	room *models.Room
+}
+
+func (r *roomResolver) ID() graphql.ID          { return graphql.ID(r.room.ID) }
+func (r *roomResolver) Name() string            { return r.room.Name }
+func (r *roomResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.room.CreatedAt} }
+func (r *roomResolver) MessageCount() int32     { return int32(r.h.ChatStore.CountByRoom(r.room.ID)) }
+func (r *roomResolver) Chats(args struct{ Last int32 }) []*chatResolver {
+	return r.h.chatResolvers(r.h.lastChats(r.room.ID, args.Last))
+}
+
+// chatResolver resolves the fields of a Chat
+type chatResolver struct {
+	h    *Handler
+	chat *models.Chat
+}
+
+func (r *chatResolver) ID() graphql.ID          { return graphql.ID(r.chat.ID) }
+func (r *chatResolver) Username() string        { return r.chat.Username }
+func (r *chatResolver) Message() string         { return r.chat.Message }
+func (r *chatResolver) Bot() bool               { return r.chat.Bot }
+func (r *chatResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.chat.CreatedAt} }
+func (r *chatResolver) Room() *roomResolver {
+	room, exists := r.h.RoomStore.GetRoom(r.chat.RoomID)
+	if !exists {
+		return nil
+	}
+	return &roomResolver{r.h, room}
+}
+
+// userResolver resolves the fields of a User, derived from the messages they posted
+type userResolver struct {
+	h            *Handler
+	name         string
+	messageCount int32
+	lastSeen     graphql.Time
+	roomIDs      []string
+}
+
+func (r *userResolver) Name() string           { return r.name }
+func (r *userResolver) MessageCount() int32    { return r.messageCount }
+func (r *userResolver) LastSeen() graphql.Time { return r.lastSeen }
+func (r *userResolver) Rooms() []*roomResolver {
+	var rooms []*roomResolver
+	for _, id := range r.roomIDs {
+		if room, exists := r.h.RoomStore.GetRoom(id); exists {
+			rooms = append(rooms, &roomResolver{r.h, room})
+		}
+	}
+	return rooms
+}
+
+// chatResolvers wraps chats in resolvers
+func (h *Handler) chatResolvers(chats []*models.Chat) []*chatResolver {
+	resolvers := make([]*chatResolver, len(chats))
+	for i, chat := range chats {
+		resolvers[i] = &chatResolver{h, chat}
+	}
+	return resolvers
+}
+
+// userResolvers derives the users from the chat history, limited to one name
+// when name is set, sorted by name
+func (h *Handler) userResolvers(name string) []*userResolver {
+	byName := make(map[string]*userResolver)
+	for _, chat := range h.ChatStore.GetChats() {
+		if chat.Bot || (name != "" && chat.Username != name) {
+			continue
+		}
+		user, ok := byName[chat.Username]
+		if !ok {
+			user = &userResolver{h: h, name: chat.Username}
+			byName[chat.Username] = user
+		}
+		user.messageCount++
+		if chat.CreatedAt.After(user.lastSeen.Time) {
+			user.lastSeen = graphql.Time{Time: chat.CreatedAt}
+		}
+		if !slices.Contains(user.roomIDs, chat.RoomID) {
+			user.roomIDs = append(user.roomIDs, chat.RoomID)
+		}
+	}
+
+	users := make([]*userResolver, 0, len(byName))
+	for _, user := range byName {
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b *userResolver) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return users
+}
+
+// lastChats returns at most the last n chats of a room, or all of them
+// when n is negative, oldest first
+func (h *Handler) lastChats(roomID string, n int32) []*models.Chat {
+	if n < 0 {
+		return h.ChatStore.GetChatsByRoom(roomID)
+	}
+	chats, _ := h.ChatStore.GetChatsByRoomPage(roomID, h.ChatStore.CountByRoom(roomID)-int(n), int(n))
+	return chats
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"htmx/internal/chatpb"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// chatService implements the gRPC Chat service over the same stores and hub as the web UI
+type chatService struct {
+	chatpb.UnimplementedChatServer
+	h *Handler
+}
+
+// NewGRPCServer creates the gRPC server with the Chat, health and reflection
+// services, requiring the configured token of every call
+func (h *Handler) NewGRPCServer() *grpc.Server {
+	token := h.Config.GRPC.Token
+	unary := []grpc.UnaryServerInterceptor{h.auditGRPC, func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkToken(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}}
+	opts := []grpc.ServerOption{
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkToken(stream.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	}
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...))
+	server := grpc.NewServer(opts...)
+	chatpb.RegisterChatServer(server, &chatService{h: h})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server
+}
+
+// grpcHeldHeader is the response header of a CreateChat call whose message
+// the moderation filters held for review
+const grpcHeldHeader = "x-held-for-review"
+
+// grpcAuditActions maps the mutating methods to the actions of the audit log
+var grpcAuditActions = map[string]string{
+	chatpb.Chat_CreateRoom_FullMethodName: "room.create",
+	chatpb.Chat_UpdateRoom_FullMethodName: "room.update",
+	chatpb.Chat_DeleteRoom_FullMethodName: "room.delete",
+	chatpb.Chat_CreateChat_FullMethodName: "chat.create",
+	chatpb.Chat_DeleteChat_FullMethodName: "chat.delete",
+}
+
+// grpcAuditKey is the context key of the change a gRPC call records
+type grpcAuditKey struct{}
+
+// grpcAuditChange is the state before and after a gRPC call, as set by
+// its method
+type grpcAuditChange struct {
+	before, after any
+}
+
+// auditGRPC records the mutating calls into the audit store, as the audit
+// middleware does for HTTP requests. Answered before the token is checked,
+// rejected calls are recorded too
+func (h *Handler) auditGRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	action, ok := grpcAuditActions[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	change := &grpcAuditChange{}
+	resp, err := handler(context.WithValue(ctx, grpcAuditKey{}, change), req)
+
+	entry := &models.AuditEntry{
+		ID:        uuid.New().String(),
+		Actor:     "grpc",
+		Action:    action,
+		Method:    "GRPC",
+		Path:      info.FullMethod,
+		Status:    grpcHTTPStatus(status.Code(err)),
+		CreatedAt: h.clock.Now(),
+	}
+	entry.IP = grpcPeerIP(ctx)
+	if err == nil {
+		entry.SetChange(change.before, change.after)
+	}
+	h.AuditStore.AddEntry(entry)
+	return resp, err
+}
+
+// grpcHTTPStatus returns the HTTP status matching a gRPC code, so the audit
+// log reads alike for both
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// setGRPCAuditChange records what a gRPC call changed; nil leaves a side out
+func setGRPCAuditChange(ctx context.Context, before, after any) {
+	if change, ok := ctx.Value(grpcAuditKey{}).(*grpcAuditChange); ok {
+		change.before, change.after = before, after
+	}
+}
+
+// grpcPeerIP returns the IP address of the client of a call, empty when it
+// has none, such as over a Unix socket
+func grpcPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	ip, _, _ := net.SplitHostPort(p.Addr.String())
+	return ip
+}
+
+// checkToken verifies the bearer token in the request metadata; an empty
+// token, which the configuration refuses, lets no call through
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if token == "" {
+		md = nil
+	}
+	for _, value := range md.Get("authorization") {
+		if got, ok := strings.CutPrefix(value, "Bearer "); ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+func (s *chatService) ListRooms(ctx context.Context, req *chatpb.ListRoomsRequest) (*chatpb.ListRoomsResponse, error) {
+	rooms := s.h.RoomStore.GetRooms()
+	resp := &chatpb.ListRoomsResponse{Rooms: make([]*chatpb.Room, len(rooms))}
+	for i, room := range rooms {
+		resp.Rooms[i] = roomProto(room)
+	}
+	return resp, nil
+}
+
+func (s *chatService) GetRoom(ctx context.Context, req *chatpb.GetRoomRequest) (*chatpb.Room, error) {
+	room, exists := s.h.RoomStore.GetRoom(req.GetId())
+	if !exists {
+		return nil, status.Error(codes.NotFound, "room not found")
+	}
+	return roomProto(room), nil
+}
+
+func (s *chatService) CreateRoom(ctx context.Context, req *chatpb.CreateRoomRequest) (*chatpb.Room, error) {
+	name := sanitize.Name(req.GetName())
+	if !sanitize.Fits(name, sanitize.MaxRoomName) {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required, at most %d characters", sanitize.MaxRoomName)
+	}
+	if s.h.roomsFull() {
+		return nil, status.Errorf(codes.ResourceExhausted, "the limit of %d rooms has been reached", s.h.Config.Limits.MaxRooms)
+	}
+
+	room := &models.Room{
+		ID:        uuid.New().String(),
+		Name:      name,
+		CreatedAt: s.h.clock.Now(),
+	}
+	if err := s.h.addRoom(room); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	setGRPCAuditChange(ctx, nil, room)
+	return roomProto(room), nil
+}
+
+func (s *chatService) UpdateRoom(ctx context.Context, req *chatpb.UpdateRoomRequest) (*chatpb.Room, error) {
+	name := sanitize.Name(req.GetName())
+	if !sanitize.Fits(name, sanitize.MaxRoomName) {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required, at most %d characters", sanitize.MaxRoomName)
+	}
+	room, exists := s.h.RoomStore.GetRoom(req.GetId())
+	if !exists {
+		return nil, status.Error(codes.NotFound, "room not found")
+	}
+
+	updated := *room
+	updated.Name = name
+	if ok, err := s.h.RoomStore.UpdateRoom(&updated); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	} else if !ok {
+		return nil, status.Error(codes.NotFound, "room not found")
+	}
+	setGRPCAuditChange(ctx, room, &updated)
+	return roomProto(&updated), nil
+}
+
+func (s *chatService) DeleteRoom(ctx context.Context, req *chatpb.DeleteRoomRequest) (*chatpb.DeleteRoomResponse, error) {
+	room, _ := s.h.RoomStore.GetRoom(req.GetId())
+	messages := s.h.ChatStore.CountByRoom(req.GetId())
+	if deleted, err := s.h.deleteRoom(req.GetId()); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	} else if !deleted {
+		return nil, status.Error(codes.NotFound, "room not found")
+	}
+	setGRPCAuditChange(ctx, gin.H{"room": room, "messages": messages}, nil)
+	return &chatpb.DeleteRoomResponse{}, nil
+}
+
+func (s *chatService) ListChats(ctx context.Context, req *chatpb.ListChatsRequest) (*chatpb.ListChatsResponse, error) {
+	if _, exists := s.h.RoomStore.GetRoom(req.GetRoomId()); !exists {
+		return nil, status.Error(codes.NotFound, "room not found")
+	}
+
+	chats := s.h.ChatStore.GetChatsByRoom(req.GetRoomId())
+	resp := &chatpb.ListChatsResponse{Chats: make([]*chatpb.ChatMessage, len(chats))}
+	for i, chat := range chats {
+		resp.Chats[i] = chatProto(chat)
+	}
+	return resp, nil
+}
+
+func (s *chatService) GetChat(ctx context.Context, req *chatpb.GetChatRequest) (*chatpb.ChatMessage, error) {
+	chat, exists := s.h.ChatStore.GetChat(req.GetId())
+	if !exists {
+		return nil, status.Error(codes.NotFound, "message not found")
+	}
+	return chatProto(chat), nil
+}
+
+func (s *chatService) CreateChat(ctx context.Context, req *chatpb.CreateChatRequest) (*chatpb.ChatMessage, error) {
+	username, message := sanitize.Name(req.GetUsername()), sanitize.Message(req.GetMessage())
+	if !sanitize.Fits(username, sanitize.MaxUsername) || !sanitize.Fits(message, sanitize.MaxMessage) {
+		return nil, status.Errorf(codes.InvalidArgument, "username and message are required, at most %d and %d characters", sanitize.MaxUsername, sanitize.MaxMessage)
+	}
+	if _, exists := s.h.RoomStore.GetRoom(req.GetRoomId()); !exists {
+		return nil, status.Error(codes.NotFound, "room not found")
+	}
+	if s.h.roomFull(req.GetRoomId()) {
+		return nil, status.Errorf(codes.ResourceExhausted, "the room has reached the limit of %d messages", s.h.Config.Limits.MaxMessagesPerRoom)
+	}
+	// Calls go through the limits and filters of the JSON API, counted
+	// against the address of the client
+	ip := grpcPeerIP(ctx)
+	if s.h.BanStore.IsBanned(username) || s.h.ipBanned(ip) {
+		return nil, status.Error(codes.PermissionDenied, "this name is banned from posting")
+	}
+	if s.h.overLimit(ip, s.h.postLimiter, "messages_per_minute") {
+		return nil, status.Error(codes.ResourceExhausted, "too many messages, slow down")
+	}
+	if quota := s.h.overPostQuota(ipQuotaUser(ip), message); quota != "" {
+		return nil, status.Error(codes.ResourceExhausted, s.h.quotaErrorJSON(quota))
+	}
+
+	chat := &models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    req.GetRoomId(),
+		Username:  username,
+		Message:   message,
+		Bot:       req.GetBot(),
+		CreatedAt: s.h.clock.Now(),
+	}
+	if s.h.blocked(chat) {
+		return nil, status.Error(codes.PermissionDenied, "this message contains blocked words")
+	}
+	// A held message is returned as the JSON API does, with a header
+	// telling it awaits review
+	if s.h.holdFlagged(chat, "") {
+		grpc.SetHeader(ctx, metadata.Pairs(grpcHeldHeader, "true"))
+		return chatProto(chat), nil
+	}
+	if err := s.h.addChat(chat); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return chatProto(chat), nil
+}
+
+func (s *chatService) DeleteChat(ctx context.Context, req *chatpb.DeleteChatRequest) (*chatpb.DeleteChatResponse, error) {
+	chat, _ := s.h.ChatStore.GetChat(req.GetId())
+	if deleted, err := s.h.ChatStore.DeleteChat(req.GetId()); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	} else if !deleted {
+		return nil, status.Error(codes.NotFound, "message not found")
+	}
+	setGRPCAuditChange(ctx, chat, nil)
+	return &chatpb.DeleteChatResponse{}, nil
+}
+
+func (s *chatService) Subscribe(req *chatpb.SubscribeRequest, stream grpc.ServerStreamingServer[chatpb.Event]) error {
+	events, cancel := s.h.Hub.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			var msg *chatpb.Event
+			switch event.Type {
+			case models.EventRoomCreated:
+				msg = &chatpb.Event{Event: &chatpb.Event_RoomCreated{RoomCreated: roomProto(event.Room)}}
+			case models.EventChatCreated:
+				if req.GetRoomId() != "" && event.Chat.RoomID != req.GetRoomId() {
+					continue
+				}
+				msg = &chatpb.Event{Event: &chatpb.Event_ChatCreated{ChatCreated: chatProto(event.Chat)}}
+			default:
+				continue
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// roomProto converts a room to its protobuf message
+func roomProto(room *models.Room) *chatpb.Room {
+	return &chatpb.Room{
+		Id:        room.ID,
+		Name:      room.Name,
+		CreatedAt: timestamppb.New(room.CreatedAt),
+	}
+}
+
+// chatProto converts a chat to its protobuf message
+func chatProto(chat *models.Chat) *chatpb.ChatMessage {
+	return &chatpb.ChatMessage{
+		Id:        chat.ID,
+		RoomId:    chat.RoomID,
+		Username:  chat.Username,
+		Message:   chat.Message,
+		Bot:       chat.Bot,
+		CreatedAt: timestamppb.New(chat.CreatedAt),
+	}
+}
@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"htmx/internal/chatpb"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"htmx/internal/testutil"
+	"net"
+	"testing"
+)
+
+const grpcToken = "grpc-token"
+
+// dialGRPC serves the gRPC service of srv on a loopback port and returns a
+// client of it, both closed when the test ends
+func dialGRPC(t *testing.T, srv *testutil.Server) chatpb.ChatClient {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := srv.Handler.NewGRPCServer()
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return chatpb.NewChatClient(conn)
+}
+
+// authorized returns a context sending the token
+func authorized(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// grpcServer starts a test server whose gRPC service takes grpcToken
+func grpcServer(t *testing.T, configure func(cfg *config.Config)) *testutil.Server {
+	return testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.GRPC.Token = grpcToken
+		if configure != nil {
+			configure(cfg)
+		}
+	})
+}
+
+func TestGRPCToken(t *testing.T) {
+	srv := grpcServer(t, nil)
+	client := dialGRPC(t, srv)
+	room := srv.Stores.SeedRoom("General")
+
+	for _, ctx := range []context.Context{context.Background(), authorized("wrong"), authorized("")} {
+		_, err := client.DeleteRoom(ctx, &chatpb.DeleteRoomRequest{Id: room.ID})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("DeleteRoom without the token: %v, want Unauthenticated", err)
+		}
+	}
+	if _, exists := srv.Handler.RoomStore.GetRoom(room.ID); !exists {
+		t.Fatal("room deleted without the token")
+	}
+	if _, err := client.DeleteRoom(authorized(grpcToken), &chatpb.DeleteRoomRequest{Id: room.ID}); err != nil {
+		t.Errorf("DeleteRoom with the token: %v", err)
+	}
+}
+
+func TestGRPCNoTokenConfigured(t *testing.T) {
+	// A server built without validating its configuration still lets no
+	// call through
+	srv := grpcServer(t, func(cfg *config.Config) { cfg.GRPC.Token = "" })
+	client := dialGRPC(t, srv)
+	if _, err := client.ListRooms(authorized(""), &chatpb.ListRoomsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListRooms with no token configured: %v, want Unauthenticated", err)
+	}
+}
+
+func TestGRPCCreateChatChecks(t *testing.T) {
+	srv := grpcServer(t, func(cfg *config.Config) {
+		cfg.Moderation.MessagesPerMinute = 2
+		cfg.Moderation.MaxLinks = 1
+	})
+	client := dialGRPC(t, srv)
+	room := srv.Stores.SeedRoom("General")
+	ctx := authorized(grpcToken)
+	create := func(message string, opts ...grpc.CallOption) (*chatpb.ChatMessage, error) {
+		return client.CreateChat(ctx, &chatpb.CreateChatRequest{RoomId: room.ID, Username: "service", Message: message}, opts...)
+	}
+
+	// A flagged message is held, not posted
+	var header metadata.MD
+	chat, err := create("https://a.example https://b.example", grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-held-for-review"); len(got) != 1 || got[0] != "true" {
+		t.Errorf("held header = %v", got)
+	}
+	if _, exists := srv.Handler.ChatStore.GetChat(chat.GetId()); exists || srv.Handler.ModerationQueue.Count() != 1 {
+		t.Error("flagged message posted rather than held")
+	}
+
+	// The second message reaches the limit of the client's address
+	if _, err := create("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := create("again"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("CreateChat over the limit: %v, want ResourceExhausted", err)
+	}
+
+	ban, err := models.NewIPBan("ban", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Handler.IPBans.AddBan(ban)
+	if _, err := create("banned"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CreateChat from a banned address: %v, want PermissionDenied", err)
+	}
+	if n := srv.Handler.ChatStore.CountByRoom(room.ID); n != 1 {
+		t.Errorf("room has %d messages, want 1", n)
+	}
+}
@@ -1,137 +1,1039 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	"htmx/internal/analytics"
+	"htmx/internal/assets"
+	"htmx/internal/bots"
+	"htmx/internal/bufpool"
+	"htmx/internal/clock"
+	"htmx/internal/components"
+	"htmx/internal/config"
+	"htmx/internal/features"
+	"htmx/internal/federation"
+	"htmx/internal/forms"
+	"htmx/internal/i18n"
+	"htmx/internal/jobs"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
 	"htmx/internal/models"
+	"htmx/internal/moderation"
+	"htmx/internal/ratelimit"
+	"htmx/internal/rendercache"
+	"htmx/internal/sanitize"
+	"htmx/internal/toasts"
+	"htmx/internal/webhooks"
 	"log"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// WebSocket Hub for broadcasting updates
+// HubEvent announces a new room or message, or a message held for review
+type HubEvent struct {
+	// Type is models.EventRoomCreated, models.EventChatCreated or
+	// models.EventChatFlagged
+	Type string
+	Room *models.Room
+	Chat *models.Chat
+	// Flagged is the held message of a models.EventChatFlagged event, sent
+	// to moderators only
+	Flagged *models.FlaggedChat
+	// ClientID is the composer's ID of a message sent optimistically
+	ClientID string
+	// Notify lists the visitors a message mentions, whose pages are told to
+	// update their notification badge
+	Notify []string
+}
+
+// hubTypes maps event types to the type of the message sent to WebSocket clients
+var hubTypes = map[string]string{
+	models.EventRoomCreated: "new-room",
+	models.EventChatCreated: "new-chat",
+	models.EventChatFlagged: "flagged",
+}
+
+// hubNotifications is the type of the message sent to the clients of the
+// visitors a message mentions, besides its new-chat message
+const hubNotifications = "notifications"
+
+// hubClients is the type of the message telling moderators that clients
+// connected, disconnected or opened another room
+const hubClients = "clients"
+
+// hubClientsMessage is the message of type hubClients, the same for all
+var hubClientsMessage = []byte(`{"type":"` + hubClients + `"}`)
+
+// hubViewing is the type of the message pages send to the hub with the
+// room they show, empty for none
+const hubViewing = "viewing"
+
+// hubMessage is the JSON pushed to WebSocket clients for a hub event; pages
+// update the lists it concerns and read the announcement out to screen readers
+type hubMessage struct {
+	// Type is "new-room", "new-chat", "notifications", "flagged" or, for
+	// moderators, "clients"
+	Type   string `json:"type"`
+	RoomID string `json:"room_id"`
+	// Announcement describes the update in the locale of the client
+	Announcement string `json:"announcement"`
+	// ChatID is the new message of a new-chat message, which pages fetch
+	// and append to the messages list
+	ChatID string `json:"chat_id,omitempty"`
+	// ClientID acknowledges an optimistically sent message to its sender
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// encodeHubEvent writes the message pushed for an event to clients in the locale
+func encodeHubEvent(buf *bytes.Buffer, event HubEvent, locale *i18n.Locale) {
+	message := hubMessage{Type: hubTypes[event.Type], ClientID: event.ClientID}
+	switch {
+	case event.Room != nil:
+		message.RoomID = event.Room.ID
+		message.Announcement = locale.T("announce.new_room", "name", event.Room.Name)
+	case event.Chat != nil:
+		message.RoomID = event.Chat.RoomID
+		message.ChatID = event.Chat.ID
+		message.Announcement = locale.T("announce.new_chat", "username", event.Chat.Username, "message", event.Chat.Message)
+	case event.Flagged != nil:
+		message.RoomID = event.Flagged.Chat.RoomID
+		key := "announce.reported"
+		if event.Flagged.Held {
+			key = "announce.flagged"
+		}
+		message.Announcement = locale.T(key, "username", event.Flagged.Chat.Username)
+	}
+	json.NewEncoder(buf).Encode(message)
+}
+
+// encodeHubEvents writes the message pushed for events to clients in the
+// locale: that of the event, or a JSON array of them for a batch
+func encodeHubEvents(buf *bytes.Buffer, events []HubEvent, locale *i18n.Locale) {
+	if len(events) == 1 {
+		encodeHubEvent(buf, events[0], locale)
+		return
+	}
+	buf.WriteByte('[')
+	for i, event := range events {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodeHubEvent(buf, event, locale)
+	}
+	buf.WriteByte(']')
+}
+
+// encodeNotification writes the message telling a client in the locale that
+// a message mentions its visitor
+func encodeNotification(buf *bytes.Buffer, chat *models.Chat, locale *i18n.Locale) {
+	json.NewEncoder(buf).Encode(hubMessage{
+		Type:         hubNotifications,
+		RoomID:       chat.RoomID,
+		Announcement: locale.T("announce.mention", "username", chat.Username),
+	})
+}
+
+// hubClient is a browser connected to the hub
+type hubClient struct {
+	// id identifies the connection on the admin clients page
+	id   string
+	conn *websocket.Conn
+	// locale is the language updates are announced in
+	locale *i18n.Locale
+	// visitorID identifies the browser for its notifications
+	visitorID string
+	// ip, userAgent and connectedAt describe the connection in the
+	// compliance export of the visitor
+	ip          string
+	userAgent   string
+	connectedAt time.Time
+	// moderator is set for the admin pages, which are told of the messages
+	// held for review rather than of the rooms and messages
+	moderator bool
+	// impersonated is set for the page of an admin viewing the site as the
+	// visitor, which is not one of the visitor's sessions
+	impersonated bool
+	// roomID is the room the page shows, as it last told the hub
+	roomID string
+	// pushed counts the messages written to the client
+	pushed int
+}
+
+// hubConnection is a connection to the hub, as the admin clients page
+// lists it
+type hubConnection struct {
+	ID        string
+	VisitorID string
+	Moderator bool
+	RoomID    string
+	Pushed    int
+	hubSession
+}
+
+// viewingRequest tells the hub loop the room a client shows
+type viewingRequest struct {
+	conn   *websocket.Conn
+	roomID string
+}
+
+// disconnectRequest asks the hub loop to close a connection, by ID
+type disconnectRequest struct {
+	id    string
+	reply chan bool
+}
+
+// hubSession is an open connection of a visitor to the hub
+type hubSession struct {
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Locale      string    `json:"locale"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// sessionsRequest asks the hub loop for the open connections of a visitor
+type sessionsRequest struct {
+	visitorID string
+	reply     chan []hubSession
+}
+
+// WebSocket Hub for broadcasting updates to browsers and in-process subscribers
 type Hub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan []byte
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
+	clients     map[*websocket.Conn]hubClient
+	subscribers map[chan HubEvent]bool
+	broadcast   chan HubEvent
+	register    chan hubClient
+	unregister  chan *websocket.Conn
+	subscribe   chan chan HubEvent
+	unsubscribe chan chan HubEvent
+	ping        chan chan struct{}
+	closeAll    chan chan struct{}
+	sessions    chan sessionsRequest
+	list        chan chan []hubConnection
+	viewing     chan viewingRequest
+	disconnect  chan disconnectRequest
+	running     atomic.Bool
+	count       atomic.Int64
+	upgrader    websocket.Upgrader
+	// flushInterval is how long new messages wait to be written along with
+	// the other new messages of their room; zero writes each at once
+	flushInterval time.Duration
+	// pending holds the new messages waiting for the flush by room, and
+	// pendingRooms the rooms in the order their first message came
+	pending      map[string][]HubEvent
+	pendingRooms []string
+	// messages holds the encoded message of each locale while a send writes
+	// it, kept between sends so a broadcast does not allocate a map
+	messages map[*i18n.Locale]*bytes.Buffer
+	// connections collects the client counts for the analytics
+	connections *analytics.Connections
+	// peakDepth, writes and drops measure the pressure on the hub since the
+	// overload monitor last took them: the deepest the broadcast queue got,
+	// the writes to clients and subscribers and those that failed or were
+	// skipped
+	peakDepth atomic.Int64
+	writes    atomic.Int64
+	drops     atomic.Int64
 }
 
-var hub = &Hub{
-	clients:    make(map[*websocket.Conn]bool),
-	broadcast:  make(chan []byte),
-	register:   make(chan *websocket.Conn),
-	unregister: make(chan *websocket.Conn),
+// NewHub creates a hub whose connections are upgraded according to the
+// WebSocket config, and whose client counts are collected into connections
+func NewHub(cfg config.WebSocketConfig, connections *analytics.Connections) *Hub {
+	return &Hub{
+		clients:     make(map[*websocket.Conn]hubClient),
+		subscribers: make(map[chan HubEvent]bool),
+		broadcast:   make(chan HubEvent, cfg.BroadcastQueue),
+		register:    make(chan hubClient),
+		unregister:  make(chan *websocket.Conn),
+		subscribe:   make(chan chan HubEvent),
+		unsubscribe: make(chan chan HubEvent),
+		ping:        make(chan chan struct{}),
+		closeAll:    make(chan chan struct{}),
+		sessions:    make(chan sessionsRequest),
+		list:        make(chan chan []hubConnection),
+		viewing:     make(chan viewingRequest),
+		disconnect:  make(chan disconnectRequest),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  cfg.ReadBufferSize,
+			WriteBufferSize: cfg.WriteBufferSize,
+			CheckOrigin:     checkOrigin(cfg.AllowedOrigins),
+		},
+		flushInterval: cfg.FlushInterval,
+		pending:       make(map[string][]HubEvent),
+		messages:      make(map[*i18n.Locale]*bytes.Buffer),
+		connections:   connections,
+	}
 }
 
 func (h *Hub) run() {
+	h.running.Store(true)
+	defer h.running.Store(false)
+
+	// flush fires once the first of the pending messages waited the flush
+	// interval; it is nil while none are pending
+	var flush <-chan time.Time
 	for {
 		select {
-		case conn := <-h.register:
-			h.clients[conn] = true
+		case reply := <-h.ping:
+			close(reply)
+		case req := <-h.sessions:
+			sessions := []hubSession{}
+			for _, client := range h.clients {
+				if !client.moderator && !client.impersonated && client.visitorID == req.visitorID {
+					sessions = append(sessions, hubSession{IP: client.ip, UserAgent: client.userAgent, Locale: client.locale.Tag, ConnectedAt: client.connectedAt})
+				}
+			}
+			req.reply <- sessions
+		case reply := <-h.list:
+			connections := make([]hubConnection, 0, len(h.clients))
+			for _, client := range h.clients {
+				connections = append(connections, hubConnection{
+					ID:         client.id,
+					VisitorID:  client.visitorID,
+					Moderator:  client.moderator,
+					RoomID:     client.roomID,
+					Pushed:     client.pushed,
+					hubSession: hubSession{IP: client.ip, UserAgent: client.userAgent, Locale: client.locale.Tag, ConnectedAt: client.connectedAt},
+				})
+			}
+			reply <- connections
+		case req := <-h.viewing:
+			if client, ok := h.clients[req.conn]; ok && client.roomID != req.roomID {
+				client.roomID = req.roomID
+				h.clients[req.conn] = client
+				h.tellModerators()
+			}
+		case req := <-h.disconnect:
+			found := false
+			for conn, client := range h.clients {
+				if client.id != req.id {
+					continue
+				}
+				// Pages do not reconnect after a policy violation
+				message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "disconnected by an admin")
+				conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+				conn.Close()
+				delete(h.clients, conn)
+				found = true
+				slog.Info("hub client disconnected by an admin", "remote", conn.RemoteAddr().String(), "visitor", client.visitorID)
+			}
+			if found {
+				h.counted()
+				h.tellModerators()
+			}
+			req.reply <- found
+		case reply := <-h.closeAll:
+			h.flush()
+			flush = nil
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server restarting")
+			for conn := range h.clients {
+				conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+				conn.Close()
+				delete(h.clients, conn)
+			}
+			h.counted()
+			close(reply)
+		case client := <-h.register:
+			h.clients[client.conn] = client
+			h.counted()
+			h.tellModerators()
+			slog.Debug("hub client registered", "remote", client.conn.RemoteAddr().String(), "locale", client.locale.Tag, "clients", len(h.clients))
 		case conn := <-h.unregister:
 			if _, ok := h.clients[conn]; ok {
 				delete(h.clients, conn)
 				conn.Close()
+				slog.Debug("hub client unregistered", "remote", conn.RemoteAddr().String(), "clients", len(h.clients))
+				h.tellModerators()
 			}
-		case message := <-h.broadcast:
-			for conn := range h.clients {
-				err := conn.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					conn.Close()
-					delete(h.clients, conn)
+			h.counted()
+		case sub := <-h.subscribe:
+			h.subscribers[sub] = true
+		case sub := <-h.unsubscribe:
+			delete(h.subscribers, sub)
+			close(sub)
+		case event := <-h.broadcast:
+			// The hub loop alone raises the peak, so it cannot race itself
+			if depth := int64(len(h.broadcast)) + 1; depth > h.peakDepth.Load() {
+				h.peakDepth.Store(depth)
+			}
+
+			// Subscribers that fall behind miss events rather than stalling the hub
+			h.writes.Add(int64(len(h.subscribers)))
+			for sub := range h.subscribers {
+				select {
+				case sub <- event:
+				default:
+					h.drops.Add(1)
+					metrics.HubDrops.WithLabelValues("subscriber").Inc()
+					slog.Debug("hub subscriber too slow, dropped event", "event", event.Type)
 				}
 			}
+
+			// New messages wait for the flush, so a burst of messages in a
+			// room costs each client one write. Other events are written at
+			// once, after the pending messages to keep the order
+			if event.Chat != nil && h.flushInterval > 0 {
+				if len(h.pendingRooms) == 0 {
+					flush = time.After(h.flushInterval)
+				}
+				h.queue(event)
+			} else {
+				h.flush()
+				flush = nil
+				h.send([]HubEvent{event})
+			}
+		case <-flush:
+			flush = nil
+			h.flush()
+		}
+	}
+}
+
+// queue adds a new message to those waiting for the flush
+func (h *Hub) queue(event HubEvent) {
+	roomID := event.Chat.RoomID
+	if len(h.pending[roomID]) == 0 {
+		h.pendingRooms = append(h.pendingRooms, roomID)
+	}
+	h.pending[roomID] = append(h.pending[roomID], event)
+}
+
+// flush writes the pending messages, in one message per room
+func (h *Hub) flush() {
+	for _, roomID := range h.pendingRooms {
+		h.send(h.pending[roomID])
+		delete(h.pending, roomID)
+	}
+	h.pendingRooms = h.pendingRooms[:0]
+}
+
+// send writes events to the clients they concern as one message, dropping
+// the clients that fail. Clients sharing a locale share the encoded message,
+// in a pooled buffer: writes copy it into the write buffer of the
+// connection, framing it there without allocating, before returning
+func (h *Hub) send(events []HubEvent) {
+	messages := h.messages
+	// Held messages come alone, as they do not wait for the flush
+	flagged := events[0].Type == models.EventChatFlagged
+	metrics.BroadcastFanout.Observe(float64(len(h.clients)))
+	metrics.BroadcastBatchSize.Observe(float64(len(events)))
+	slog.Debug("hub broadcast", "event", events[0].Type, "events", len(events), "clients", len(h.clients), "subscribers", len(h.subscribers))
+	for conn, client := range h.clients {
+		if client.moderator != flagged {
+			continue
+		}
+		message, ok := messages[client.locale]
+		if !ok {
+			message = bufpool.Get()
+			encodeHubEvents(message, events, client.locale)
+			messages[client.locale] = message
+		}
+		h.writes.Add(1)
+		err := conn.WriteMessage(websocket.TextMessage, message.Bytes())
+		pushed := 1
+		for _, event := range events {
+			if err == nil && event.Chat != nil && slices.Contains(event.Notify, client.visitorID) {
+				notification := bufpool.Get()
+				encodeNotification(notification, event.Chat, client.locale)
+				err = conn.WriteMessage(websocket.TextMessage, notification.Bytes())
+				bufpool.Put(notification)
+				pushed++
+			}
+		}
+		if err == nil {
+			client.pushed += pushed
+			h.clients[conn] = client
+		} else {
+			h.drops.Add(1)
+			metrics.HubDrops.WithLabelValues("client").Inc()
+			slog.Debug("hub dropped client after failed write", "remote", conn.RemoteAddr().String(), "error", err)
+			conn.Close()
+			delete(h.clients, conn)
 		}
 	}
+	for _, message := range messages {
+		bufpool.Put(message)
+	}
+	clear(messages)
+	h.counted()
 }
 
-// WebSocket Upgrader
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for simplicity; restrict in production
-	},
+// tellModerators tells the admin pages that the clients changed, so the
+// clients page refreshes; pages that fail are dropped by their read loop
+func (h *Hub) tellModerators() {
+	for conn, client := range h.clients {
+		if client.moderator {
+			conn.WriteMessage(websocket.TextMessage, hubClientsMessage)
+		}
+	}
+}
+
+// counted updates the client count after clients came or went, recording
+// changes for the analytics
+func (h *Hub) counted() {
+	count := len(h.clients)
+	if h.count.Swap(int64(count)) != int64(count) {
+		h.connections.Observe(count)
+	}
+}
+
+// Subscribe returns a channel receiving every event broadcast by the hub, and a
+// function that ends the subscription and closes the channel
+func (h *Hub) Subscribe() (<-chan HubEvent, func()) {
+	sub := make(chan HubEvent, 16)
+	h.subscribe <- sub
+	return sub, func() {
+		h.unsubscribe <- sub
+	}
+}
+
+// TakePressure returns the deepest the broadcast queue got, the writes to
+// clients and subscribers and those dropped since the last call
+func (h *Hub) TakePressure() (depth int, writes, drops int64) {
+	return int(h.peakDepth.Swap(0)), h.writes.Swap(0), h.drops.Swap(0)
+}
+
+// Running reports whether the hub loop has been started
+func (h *Hub) Running() bool {
+	return h.running.Load()
+}
+
+// ClientCount returns the number of connected WebSocket clients
+func (h *Hub) ClientCount() int {
+	return int(h.count.Load())
+}
+
+// Ping reports whether the hub loop answers within the timeout
+func (h *Hub) Ping(timeout time.Duration) bool {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-time.After(timeout):
+		return false
+	}
+	<-reply
+	return true
+}
+
+// Sessions returns the open connections of a visitor, without those of
+// admins viewing the site as the visitor, waiting at most timeout for the
+// hub to respond
+func (h *Hub) Sessions(visitorID string, timeout time.Duration) ([]hubSession, bool) {
+	req := sessionsRequest{visitorID: visitorID, reply: make(chan []hubSession, 1)}
+	select {
+	case h.sessions <- req:
+	case <-time.After(timeout):
+		return nil, false
+	}
+	return <-req.reply, true
+}
+
+// Clients returns the connections to the hub, waiting at most timeout for
+// the hub to respond
+func (h *Hub) Clients(timeout time.Duration) ([]hubConnection, bool) {
+	reply := make(chan []hubConnection, 1)
+	select {
+	case h.list <- reply:
+	case <-time.After(timeout):
+		return nil, false
+	}
+	return <-reply, true
+}
+
+// Disconnect closes a connection to the hub, reporting false when there is
+// none with the ID; it waits at most timeout for the hub to respond
+func (h *Hub) Disconnect(id string, timeout time.Duration) (found, ok bool) {
+	req := disconnectRequest{id: id, reply: make(chan bool, 1)}
+	select {
+	case h.disconnect <- req:
+	case <-time.After(timeout):
+		return false, false
+	}
+	return <-req.reply, true
+}
+
+// CloseAll tells every connected client the server is going away so they
+// reconnect, waiting at most timeout for the hub to respond
+func (h *Hub) CloseAll(timeout time.Duration) bool {
+	reply := make(chan struct{})
+	select {
+	case h.closeAll <- reply:
+	case <-time.After(timeout):
+		return false
+	}
+	<-reply
+	return true
+}
+
+// checkOrigin builds the upgrader origin check for the allowed origins
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	if len(allowed) == 0 {
+		return nil // Same-origin only
+	}
+	if slices.Contains(allowed, "*") {
+		return func(r *http.Request) bool {
+			return true
+		}
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || slices.Contains(allowed, origin)
+	}
 }
 
 // WS Handler
 func (h *Handler) WS(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	h.connectHub(c, false)
+}
+
+// ModeratorWS connects an admin page to the hub, which tells it of the
+// messages held for review
+func (h *Handler) ModeratorWS(c *gin.Context) {
+	h.connectHub(c, true)
+}
+
+// connectHub upgrades the request to a WebSocket and registers it with the
+// hub, as a moderator or a visitor
+func (h *Handler) connectHub(c *gin.Context, moderator bool) {
+	conn, err := h.Hub.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
-	hub.register <- conn
+
+	// Close with "try again later" so the client stops reconnecting
+	if h.hubFull() {
+		message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many clients")
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+	_, impersonated := features.ImpersonationFrom(c)
+	h.Hub.register <- hubClient{
+		id:           uuid.New().String(),
+		conn:         conn,
+		locale:       i18n.FromContext(c),
+		visitorID:    features.VisitorID(c),
+		ip:           c.ClientIP(),
+		userAgent:    c.Request.UserAgent(),
+		connectedAt:  time.Now(),
+		moderator:    moderator,
+		impersonated: impersonated,
+	}
 
 	go func() {
 		defer func() {
-			hub.unregister <- conn
+			h.Hub.unregister <- conn
 		}()
+		// Pages only send the room they show; anything else is ignored
 		for {
-			_, _, err := conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
 				return
 			}
+			var message struct {
+				Type   string `json:"type"`
+				RoomID string `json:"room_id"`
+			}
+			if json.Unmarshal(data, &message) == nil && message.Type == hubViewing && len(message.RoomID) <= 64 {
+				h.Hub.viewing <- viewingRequest{conn: conn, roomID: message.RoomID}
+			}
 		}
 	}()
 }
 
 // Handler holds the dependencies for all handlers
 type Handler struct {
-	RoomStore *models.RoomStore
-	ChatStore *models.ChatStore
+	Config     *config.Config
+	Features   *features.Set
+	Hub        *Hub
+	RoomStore  models.RoomRepository
+	ChatStore  models.ChatRepository
+	AuditStore *models.AuditStore
+	AdminStore *models.AdminStore
+	// Webhooks delivers events to the webhooks in WebhookStore
+	Webhooks     *webhooks.Dispatcher
+	WebhookStore *models.WebhookStore
+	// Bots delivers messages to in-process bots and the bots in BotStore
+	Bots     *bots.Dispatcher
+	BotStore *models.BotStore
+	// ShortcutStore holds the keyboard shortcuts customized per visitor
+	ShortcutStore *models.ShortcutStore
+	// NotificationStore holds the unread mentions of visitors
+	NotificationStore *models.NotificationStore
+	// EmojiStore holds the emoji each visitor picked last
+	EmojiStore *models.EmojiStore
+	// BanStore holds the names banned from posting
+	BanStore *models.BanStore
+	// Moderation screens the messages people post, and ModerationQueue
+	// holds those it flags or people report until a moderator reviews them
+	Moderation      *moderation.Pipeline
+	ModerationQueue *models.ModerationQueue
+	// FilterRules holds the words and expressions the moderation filters
+	// flag or block, managed from the admin pages
+	FilterRules *models.FilterRuleStore
+	// IPBans holds the networks banned from posting and connecting
+	IPBans *models.IPBanStore
+	// Announcements holds the banners scheduled across the site
+	Announcements *models.AnnouncementStore
+	// Quotas tracks the usage of the quotas of each user
+	Quotas *models.QuotaStore
+	// SettingsStore holds what admins change at runtime, such as the retention
+	SettingsStore *models.SettingsStore
+	// Jobs runs the background jobs, such as the purge of old data
+	Jobs *jobs.Runner
+	// Connections collects the concurrent WebSocket connections over time,
+	// for the analytics
+	Connections *analytics.Connections
+	// Schema serves GraphQL queries over the stores and hub
+	Schema *graphql.Schema
+	// Federation relays shared rooms to peer instances; nil when disabled
+	Federation *federation.Relay
+	// RenderCache keeps the hot partials rendered, until the stores change
+	// what they show
+	RenderCache *rendercache.Cache
+	// Assets fingerprints the static files; nil in dev mode, where they are
+	// served from disk as they change
+	Assets *assets.Manifest
+	// Database reports the schema version of the database of the backend,
+	// for the readiness check; nil for the memory backend
+	Database models.SchemaVersioner
+
+	// router renders the partials kept in the render cache
+	router *gin.Engine
+	// compress holds the compression middleware, shared by the listeners so
+	// they share its cache; it is empty with compression off
+	compress []gin.HandlerFunc
+	// requestRates measures the request and error rates of the dashboard
+	requestRates requestRates
+	// reportLimiter caps the messages each client reports per hour, and
+	// postLimiter those it posts per minute
+	reportLimiter *ratelimit.Limiter
+	postLimiter   *ratelimit.Limiter
+	// violations counts the refusals of the limiters above per client, to
+	// ban those refused too often
+	violations *ratelimit.Limiter
+	// analyticsRollup holds the charts of the analytics job
+	analyticsRollup atomic.Pointer[analyticsRollup]
+	// overload is set while the hub is overloaded
+	overload atomic.Pointer[hubOverload]
+	// clock tells the time of messages, schedules, retention and limits
+	clock clock.Clock
+	// telemetryID tells the telemetry reports of this process apart, random
+	// so it says nothing of the instance
+	telemetryID string
 }
 
 // NewHandler creates a new handler with the given dependencies
-func NewHandler(roomStore *models.RoomStore, chatStore *models.ChatStore) *Handler {
-	return &Handler{
-		RoomStore: roomStore,
-		ChatStore: chatStore,
+func NewHandler(cfg *config.Config, roomStore models.RoomRepository, chatStore models.ChatRepository, auditStore *models.AuditStore, adminStore *models.AdminStore, webhookStore *models.WebhookStore, botStore *models.BotStore, shortcutStore *models.ShortcutStore, notificationStore *models.NotificationStore, emojiStore *models.EmojiStore, banStore *models.BanStore, moderationQueue *models.ModerationQueue, filterRules *models.FilterRuleStore, ipBans *models.IPBanStore, announcements *models.AnnouncementStore, quotas *models.QuotaStore, settings *models.SettingsStore) *Handler {
+	connections := analytics.NewConnections()
+	h := &Handler{
+		Config:            cfg,
+		Features:          features.NewSet(cfg.Features.Flags),
+		Hub:               NewHub(cfg.WebSocket, connections),
+		Connections:       connections,
+		RoomStore:         roomStore,
+		ChatStore:         chatStore,
+		AuditStore:        auditStore,
+		AdminStore:        adminStore,
+		Webhooks:          webhooks.NewDispatcher(webhookStore, cfg.Webhooks),
+		WebhookStore:      webhookStore,
+		BotStore:          botStore,
+		ShortcutStore:     shortcutStore,
+		NotificationStore: notificationStore,
+		EmojiStore:        emojiStore,
+		BanStore:          banStore,
+		Moderation:        moderation.New(cfg.Moderation, filterRules),
+		ModerationQueue:   moderationQueue,
+		FilterRules:       filterRules,
+		IPBans:            ipBans,
+		Announcements:     announcements,
+		Quotas:            quotas,
+		SettingsStore:     settings,
+		RenderCache:       rendercache.New(renderCacheEntries),
+		reportLimiter:     ratelimit.New(cfg.Moderation.ReportsPerHour, time.Hour),
+		postLimiter:       ratelimit.New(cfg.Moderation.MessagesPerMinute, time.Minute),
+		violations:        ratelimit.New(cfg.Moderation.AutoBanViolations, cfg.Moderation.AutoBanWindow),
+		clock:             clock.Real,
+		telemetryID:       uuid.New().String(),
+	}
+	roomStore.Observe(h.invalidateRoom)
+	chatStore.Observe(h.invalidateRoom)
+	h.Bots = bots.NewDispatcher(botStore, cfg.Bots.Timeout, h.postBotMessage)
+	h.Schema = h.newSchema()
+	h.Jobs = h.newJobs()
+	if cfg.Federation.Enabled {
+		h.Federation = federation.New(cfg.Federation)
+	}
+	if cfg.Compression.Enabled {
+		h.compress = []gin.HandlerFunc{middleware.Compress(cfg.Compression.Level, cfg.Compression.MinSizes, cfg.Compression.CacheEntries)}
+	}
+	return h
+}
+
+// SetClock replaces the clock of the handler and of what it runs: the
+// stores telling time themselves, the rate limits, impersonation expiry,
+// the overload monitor, webhook and federation retries, the background jobs
+// and the announcement schedule, so tests can move time forward. Call it
+// before the handler serves and its background work starts
+func (h *Handler) SetClock(c clock.Clock) {
+	h.clock = c
+	if chats, ok := h.ChatStore.(*models.ChatStore); ok {
+		chats.SetClock(c)
 	}
+	h.IPBans.SetClock(c)
+	h.reportLimiter.SetClock(c)
+	h.postLimiter.SetClock(c)
+	h.violations.SetClock(c)
+	h.Webhooks.SetClock(c)
+	if h.Federation != nil {
+		h.Federation.SetClock(c)
+	}
+	h.Jobs.SetClock(c)
+}
+
+// now tells the time by the clock of the handler, for the middleware, which
+// is set up before a test may replace the clock
+func (h *Handler) now() time.Time {
+	return h.clock.Now()
 }
 
 // StartHub starts the WebSocket hub
-func StartHub() {
-	go hub.run()
+func (h *Handler) StartHub() {
+	go h.Hub.run()
+}
+
+// StartWebhooks starts delivering webhook and federation events until ctx is done
+func (h *Handler) StartWebhooks(ctx context.Context) {
+	h.Webhooks.Run(ctx)
+	if h.Federation != nil {
+		h.Federation.Run(ctx)
+	}
 }
 
 // SetupRoutes configures all the routes for our application
 func (h *Handler) SetupRoutes(router *gin.Engine) {
-	// Serve static files
-	router.Static("/static", "./static")
+	h.router = router
+	h.setupStatic(router)
+	h.setupMiddleware(router)
 
 	// HTML routes
 	router.GET("/", h.Home)
 	router.GET("/rooms/:id", h.RoomDetail)
+	router.GET("/rooms/:id/feed.atom", h.RoomFeed)
+	router.GET("/rooms/:id/transcript", h.RoomTranscript)
+	router.GET("/embed/rooms/:id", h.EmbedRoom)
+	router.GET("/embed/rooms/:id/widget.js", h.EmbedWidget)
+	h.setupThemeRoutes(router)
+	router.POST("/lang", h.SetLanguage)
+	router.GET("/settings", h.Settings)
+	router.GET("/settings/usage", h.GetUsage)
+	router.GET("/shortcuts", h.GetShortcuts)
+	router.POST("/shortcuts", h.SaveShortcuts)
+	router.POST("/shortcuts/reset", h.ResetShortcuts)
+	router.GET("/notifications", h.GetNotifications)
+	router.GET("/notifications/badge", h.GetNotificationBadge)
+	router.GET("/emoji/picker", h.EmojiPicker)
+	router.POST("/emoji/recent", h.UseEmoji)
+	router.POST("/layout", h.SetLayout)
+	router.GET("/drawer/open", h.OpenDrawer)
+	router.GET("/drawer/close", h.CloseDrawer)
+	router.GET("/announcements", h.GetAnnouncements)
+	router.POST("/announcements/:id/dismiss", h.DismissAnnouncement)
+	router.POST("/impersonate/stop", h.StopImpersonation)
+
+	// API routes for HTMX, documented at /api/docs
+	blockIPs := middleware.BlockIPs(h.IPBans)
+	for _, route := range h.apiRoutes() {
+		if ipGuarded[route.Method+" "+route.Path] {
+			router.Handle(route.Method, route.Path, blockIPs, route.handler)
+			continue
+		}
+		router.Handle(route.Method, route.Path, route.handler)
+	}
+	router.GET("/graphql", h.GraphQL)
+	router.POST("/graphql", h.GraphQL)
+	router.GET("/api/openapi.json", h.OpenAPI)
+	router.GET("/api/docs", h.APIDocs)
+	router.GET("/ws", blockIPs, h.WS)
+	if h.Federation != nil {
+		router.POST(federation.Path, h.FederationEvents)
+	}
 
-	// API routes for HTMX
-	router.GET("/api/rooms", h.GetRooms)
-	router.POST("/api/rooms", h.CreateRoom)
-	router.GET("/api/rooms/:id/chats", h.GetChats)
-	router.POST("/api/rooms/:id/chats", h.CreateChat)
-	router.GET("/api/rooms/:id/chat-content", h.GetChatContent) // New for full chat partial
-	router.GET("/ws", h.WS)
+	// Ops and admin routes, unless they have their own listener
+	if h.Config.Admin.Addr == "" {
+		h.setupOpsRoutes(router)
+	}
+
+	// Component gallery of dev mode
+	if h.Config.Dev {
+		h.setupGallery(router)
+	}
+
+	h.setupErrorPages(router)
+}
+
+// SetupAdminRoutes configures the routes of the separate admin listener
+func (h *Handler) SetupAdminRoutes(router *gin.Engine) {
+	h.setupStatic(router)
+	h.setupMiddleware(router)
+	h.setupThemeRoutes(router)
+	h.setupOpsRoutes(router)
+	h.setupErrorPages(router)
+}
 
-	// Start hub in a goroutine
-	go hub.run()
+// setupThemeRoutes stores the theme preference, on every listener serving pages
+func (h *Handler) setupThemeRoutes(router *gin.Engine) {
+	router.POST("/theme", h.SetTheme)
+	router.POST("/theme/toggle", h.ToggleTheme)
+}
+
+// setupStatic serves static files, from disk in dev mode so changes show up
+// without a rebuild, otherwise from the embedded copies under their
+// fingerprinted URLs, and the branding stylesheet. They are compressed but
+// skip the rest of the middleware
+func (h *Handler) setupStatic(router *gin.Engine) {
+	static := router.Group("/", h.compress...)
+	static.GET("/branding.css", h.BrandingCSS)
+	static.GET("/manifest.webmanifest", h.Manifest)
+	static.GET("/icons/:name", h.AppIcon)
+	static.GET("/sw.js", h.ServiceWorker)
+	static.GET("/offline", h.Offline)
+	if h.Config.Dev {
+		static.Static("/static", "./static")
+	} else {
+		static.GET(assets.Prefix+"*filepath", gin.WrapH(h.Assets))
+		static.HEAD(assets.Prefix+"*filepath", gin.WrapH(h.Assets))
+	}
+}
+
+// setupMiddleware installs the middleware shared by every listener, plus the health probes
+func (h *Handler) setupMiddleware(router *gin.Engine) {
+	// Metrics
+	router.Use(metrics.Middleware())
+	h.registerMetrics()
+
+	// Health probes
+	router.GET("/healthz", h.Healthz)
+	router.GET("/livez", h.Livez)
+	router.GET("/readyz", h.Readyz)
+
+	// Cap request bodies
+	router.Use(middleware.LimitBody(h.Config.Limits.MaxUploadSize))
+
+	// Compress responses, measured compressed by the metrics above
+	router.Use(h.compress...)
+
+	// Record mutating requests, pick the locale, deliver toasts, evaluate
+	// feature flags and keep admins viewing as a visitor read-only
+	router.Use(middleware.Audit(h.AuditStore, h.now))
+	router.Use(i18n.Middleware())
+	router.Use(toasts.Middleware())
+	router.Use(features.Middleware(h.Features, []byte(h.Config.Features.Secret), h.Config.Server.TLS.Enabled(), h.now))
+	router.Use(h.guardImpersonation)
+	router.Use(h.signalOverload)
+}
+
+// setupOpsRoutes configures the metrics endpoint and the admin pages
+func (h *Handler) setupOpsRoutes(router *gin.Engine) {
+	router.GET("/metrics", metrics.Handler())
+
+	admin := router.Group("/admin", middleware.AdminAuth(h.Config.Admin.Username, h.Config.Admin.Password, h.AdminStore))
+	admin.GET("", h.AdminDashboard)
+	admin.GET("/dashboard/stats", h.DashboardStats)
+	admin.GET("/dashboard/rooms", h.DashboardRooms)
+	admin.GET("/dashboard/people", h.DashboardPeople)
+	admin.GET("/dashboard/jobs", h.DashboardJobs)
+	admin.POST("/jobs/:name/run", h.RunJob)
+	admin.POST("/bans", h.BanUser)
+	admin.DELETE("/bans", h.UnbanUser)
+	admin.DELETE("/rooms/:id", h.DeleteRoomAdmin)
+	admin.POST("/announce", h.Announce)
+	admin.GET("/announcements", h.AdminAnnouncements)
+	admin.POST("/announcements", h.CreateAnnouncement)
+	admin.DELETE("/announcements/:id", h.DeleteAnnouncement)
+	admin.GET("/moderation", h.AdminModeration)
+	admin.GET("/moderation/badge", h.ModerationBadge)
+	admin.POST("/moderation/:id/approve", h.ApproveFlagged)
+	admin.POST("/moderation/:id/ban", h.BanFlagged)
+	admin.DELETE("/moderation/:id", h.DeleteFlagged)
+	admin.GET("/ws", h.ModeratorWS)
+	admin.GET("/ip-bans", h.AdminIPBans)
+	admin.POST("/ip-bans", h.CreateIPBan)
+	admin.DELETE("/ip-bans/:id", h.DeleteIPBan)
+	admin.GET("/filters", h.AdminFilters)
+	admin.POST("/filters", h.CreateFilterRule)
+	admin.DELETE("/filters/:id", h.DeleteFilterRule)
+	admin.GET("/audit", h.AdminAudit)
+	admin.GET("/analytics", h.AdminAnalytics)
+	admin.GET("/analytics/messages.csv", h.ExportMessageVolume)
+	admin.GET("/analytics/users.csv", h.ExportActiveUsers)
+	admin.GET("/analytics/rooms.csv", h.ExportRoomActivity)
+	admin.GET("/analytics/connections.csv", h.ExportPeakConnections)
+	admin.GET("/flags", h.AdminFlags)
+	admin.POST("/flags", h.OverrideFlag)
+	admin.POST("/flags/:name", h.UpdateFlag)
+	admin.GET("/clients", h.AdminClients)
+	admin.GET("/clients/list", h.ClientsList)
+	admin.POST("/clients/:id/disconnect", h.DisconnectClient)
+	admin.GET("/impersonate", h.AdminImpersonate)
+	admin.POST("/impersonate", h.StartImpersonation)
+	admin.GET("/export", h.ExportVisitor)
+	admin.GET("/settings", h.AdminSettings)
+	admin.POST("/settings", h.UpdateSettings)
+	admin.GET("/telemetry", h.TelemetryReport)
+	admin.GET("/log-level", h.AdminLogLevel)
+	admin.POST("/log-level", h.SetLogLevel)
+	admin.GET("/webhooks", h.AdminWebhooks)
+	admin.POST("/webhooks", h.CreateWebhook)
+	admin.DELETE("/webhooks/:id", h.DeleteWebhook)
+	admin.GET("/bots", h.AdminBots)
+	admin.POST("/bots", h.CreateBot)
+	admin.DELETE("/bots/:id", h.DeleteBot)
+	admin.POST("/webhooks/incoming", h.CreateIncomingWebhook)
+	admin.POST("/webhooks/incoming/:token/template", h.UpdateIncomingWebhookTemplate)
+	admin.DELETE("/webhooks/incoming/:token", h.DeleteIncomingWebhook)
+	admin.POST("/webhooks/dead-letters/:id/retry", h.RetryDelivery)
+	admin.DELETE("/webhooks/dead-letters/:id", h.DiscardDelivery)
+	h.setupDebugRoutes(admin)
+}
+
+// setupErrorPages renders the custom 404 and 405 pages
+func (h *Handler) setupErrorPages(router *gin.Engine) {
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(h.NotFound)
+	router.NoMethod(h.MethodNotAllowed)
 }
 
 // Home renders the home page
 func (h *Handler) Home(c *gin.Context) {
 	data := gin.H{
-		"title": "Chat Rooms",
-		"rooms": h.RoomStore.GetRooms(),
-		"Page":  "home",
+		"title":         h.Config.Branding.Name,
+		"rooms":         h.RoomStore.GetRooms(),
+		"flags":         features.FromContext(c),
+		"Page":          "home",
+		"notifications": h.notificationCount(c),
+		"breadcrumbs":   breadcrumbs(c),
+		"search":        pageSearch(c),
 	}
 
-	if c.Request.Header.Get("HX-Request") == "true" {
-		c.HTML(http.StatusOK, "partials/home-page.html", data)
+	if partial(c) {
+		navigated(c, h.Config.Branding.Name, breadcrumbs(c))
+		render(c, http.StatusOK, "partials/home-page.html", data)
 		return
 	}
 
-	c.HTML(http.StatusOK, "layouts/base.html", data)
+	renderLayout(c, http.StatusOK, "layouts/base.html", data)
 }
 
 // RoomDetail renders the room detail page
@@ -144,37 +1046,84 @@ func (h *Handler) RoomDetail(c *gin.Context) {
 	}
 
 	data := gin.H{
-		"title": room.Name,
-		"rooms": h.RoomStore.GetRooms(), // For sidebar
-		"room":  room,
-		"chats": h.ChatStore.GetChatsByRoom(roomID),
-		"Page":  "room",
+		"title":         room.Name,
+		"rooms":         h.RoomStore.GetRooms(), // For sidebar
+		"room":          room,
+		"flags":         features.FromContext(c),
+		"Page":          "room",
+		"notifications": h.notificationCount(c),
+		"breadcrumbs":   roomBreadcrumbs(c, room),
+		"search":        pageSearch(c),
 	}
 
-	if c.Request.Header.Get("HX-Request") == "true" {
-		c.HTML(http.StatusOK, "partials/room-page.html", data)
+	if partial(c) {
+		navigated(c, room.Name, roomBreadcrumbs(c, room))
+		render(c, http.StatusOK, "partials/room-page.html", data)
 		return
 	}
 
-	c.HTML(http.StatusOK, "layouts/base.html", data)
+	renderLayout(c, http.StatusOK, "layouts/base.html", data)
 }
 
-// GetRooms returns the rooms list partial for HTMX
+// GetRooms returns the rooms list partial for HTMX; JSON requests are
+// answered as by /api/v1/rooms
 func (h *Handler) GetRooms(c *gin.Context) {
-	c.HTML(http.StatusOK, "partials/component-rooms-list.html", gin.H{
-		"rooms": h.RoomStore.GetRooms(),
+	if wantsJSON(c) {
+		negotiateVersion(c, versionedHandlers{"v1": h.ListRoomsV1})
+		return
+	}
+
+	search := sanitize.Query(c.Query("q"))
+	if c.GetHeader("HX-Trigger") == "room-search" {
+		replaceSearch(c, search)
+	}
+	h.renderCached(c, "partials/component-rooms-list.html", []string{search}, []string{cacheTagRooms}, func() gin.H {
+		return h.roomsListData(search)
+	})
+}
+
+// roomsListData returns the data of the rooms list partial, with the rooms
+// whose name contains search, as typed into the sidebar search
+func (h *Handler) roomsListData(search string) gin.H {
+	lower := strings.ToLower(search)
+	rooms := slices.DeleteFunc(slices.Clone(h.RoomStore.GetRooms()), func(room *models.Room) bool {
+		return !strings.Contains(strings.ToLower(room.Name), lower)
 	})
+	counts := make(map[string]int, len(rooms))
+	for _, room := range rooms {
+		counts[room.ID] = h.ChatStore.CountByRoom(room.ID)
+	}
+	return gin.H{"rooms": rooms, "counts": counts, "search": search}
 }
 
 // CreateRoom creates a new room
 func (h *Handler) CreateRoom(c *gin.Context) {
 	var input struct {
-		Name string `form:"name" binding:"required"`
+		Name string `form:"name" label:"home.room_name" sanitize:"name" binding:"required,room_name"`
 	}
 
-	if err := c.ShouldBind(&input); err != nil {
-		c.HTML(http.StatusBadRequest, "partials/error-room-form.html", gin.H{
-			"error": "Room name is required",
+	form := forms.ID(c, "room-form")
+	invalid, err := forms.Bind(c, &input)
+	if err != nil {
+		status, message := h.bindError(c, err, i18n.FromContext(c).T("errors.invalid_form"))
+		renderFormError(c, status, form, "partials/error-room-form.html", gin.H{
+			"error": message,
+		})
+		return
+	}
+	if invalid != nil {
+		forms.Render(c, form, &input, invalid)
+		return
+	}
+	if h.roomsFull() {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-room-form.html", gin.H{
+			"error": i18n.FromContext(c).N("errors.rooms_limit", h.Config.Limits.MaxRooms),
+		})
+		return
+	}
+	if quota := h.overQuota(quotaUser(c), h.quotaUse(models.QuotaRooms, 1)); quota != "" {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-room-form.html", gin.H{
+			"error": h.quotaError(i18n.FromContext(c), quota),
 		})
 		return
 	}
@@ -182,32 +1131,141 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 	room := &models.Room{
 		ID:        uuid.New().String(),
 		Name:      input.Name,
-		CreatedAt: time.Now(),
+		CreatedAt: h.clock.Now(),
+	}
+
+	if err := h.addRoom(room); err != nil {
+		_ = c.Error(err)
+		renderFormError(c, http.StatusInternalServerError, form, "partials/error-room-form.html", gin.H{
+			"error": i18n.FromContext(c).T("errors.unexpected"),
+		})
+		return
+	}
+	middleware.SetAuditChange(c, nil, room)
+	triggerRoomUpdated(c, room, "created")
+	toasts.Add(c, toasts.Success, i18n.FromContext(c).T("toasts.room_created", "name", room.Name))
+
+	render(c, http.StatusOK, "partials/component-rooms-list.html", h.roomsListData(""))
+	forms.Clear(c, form, &input)
+}
+
+// namedRoom returns the oldest room with the name, ignoring case, and creates
+// it when there is none. A room the store fails to save is an errNotSaved
+func (h *Handler) namedRoom(name string) (*models.Room, error) {
+	name = sanitize.Truncate(sanitize.Name(name), sanitize.MaxRoomName)
+	if name == "" {
+		return nil, fmt.Errorf("room name is empty")
 	}
+	var found *models.Room
+	for _, room := range h.RoomStore.GetRooms() {
+		if strings.EqualFold(room.Name, name) && (found == nil || room.CreatedAt.Before(found.CreatedAt)) {
+			found = room
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+
+	if h.roomsFull() {
+		return nil, fmt.Errorf("room %q does not exist and the room limit has been reached", name)
+	}
+	room := &models.Room{
+		ID:        uuid.New().String(),
+		Name:      name,
+		CreatedAt: h.clock.Now(),
+	}
+	if err := h.addRoom(room); err != nil {
+		return nil, fmt.Errorf("%w: %w", errNotSaved, err)
+	}
+	return room, nil
+}
 
-	h.RoomStore.AddRoom(room)
+// errNotSaved wraps the errors of the stores returned along with refusals,
+// so callers answer them as failures of the server
+var errNotSaved = errors.New("not saved")
+
+// addRoom stores a new room and notifies clients and webhooks, unless the
+// store fails to save it
+func (h *Handler) addRoom(room *models.Room) error {
+	room.Name = sanitize.Truncate(sanitize.Name(room.Name), sanitize.MaxRoomName)
+	if err := h.RoomStore.AddRoom(room); err != nil {
+		return err
+	}
+	metrics.RoomsCreated.Inc()
+	h.Webhooks.Dispatch(webhooks.Event{Type: models.EventRoomCreated, RoomID: room.ID, Data: room})
 
 	// Broadcast update
-	hub.broadcast <- []byte("new-room")
+	h.Hub.broadcast <- HubEvent{Type: models.EventRoomCreated, Room: room}
+	return nil
+}
 
-	c.HTML(http.StatusOK, "partials/component-rooms-list.html", gin.H{
-		"rooms": h.RoomStore.GetRooms(),
-	})
-	c.Writer.Write([]byte(`<div id="room-form-error" hx-swap-oob="innerHTML"></div>`))
+// deleteRoom removes a room and its messages, reporting whether it existed.
+// Once the room is gone, messages the store fails to delete are reported
+// with it still removed
+func (h *Handler) deleteRoom(id string) (bool, error) {
+	if deleted, err := h.RoomStore.DeleteRoom(id); !deleted || err != nil {
+		return false, err
+	}
+	err := h.ChatStore.DeleteChatsByRoom(id)
+	h.ModerationQueue.RemoveRoom(id)
+	h.FilterRules.DeleteRoomRules(id)
+	h.Announcements.DeleteRoom(id)
+	return true, err
 }
 
-// GetChats returns the chats list partial for HTMX
+// GetChats returns the chats list partial for HTMX; JSON requests are
+// answered as by /api/v1/rooms/:id/chats
 func (h *Handler) GetChats(c *gin.Context) {
+	if wantsJSON(c) {
+		negotiateVersion(c, versionedHandlers{"v1": h.ListChatsV1})
+		return
+	}
+
 	roomID := c.Param("id")
 	_, exists := h.RoomStore.GetRoom(roomID)
 	if !exists {
+		roomGone(c)
+		return
+	}
+
+	h.renderMessages(c, roomID, nil)
+}
+
+// GetChat returns a message of a room, which the browsers showing the room
+// append to its messages list once the WebSocket announces it
+func (h *Handler) GetChat(c *gin.Context) {
+	chat, exists := h.ChatStore.GetChat(c.Param("chatID"))
+	if !exists || chat.RoomID != c.Param("id") {
 		c.Status(http.StatusNotFound)
 		return
 	}
 
-	c.HTML(http.StatusOK, "partials/component-messages-list.html", gin.H{
-		"chats":  h.ChatStore.GetChatsByRoom(roomID),
-		"roomID": roomID,
+	h.renderMessages(c, chat.RoomID, chat)
+}
+
+// renderMessages renders the messages list of a room, or only one of its
+// messages when chat is set. Both go through the render cache, as every
+// browser in the room fetches them after a new message; the key includes
+// the message footer components enabled for the visitor
+func (h *Handler) renderMessages(c *gin.Context, roomID string, chat *models.Chat) {
+	flags := features.FromContext(c)
+	key := []string{roomID, ""}
+	if chat != nil {
+		key[1] = chat.ID
+	}
+	for _, component := range components.Enabled(components.MessageFooter, flags) {
+		key = append(key, component.Name)
+	}
+	h.renderCached(c, "partials/component-messages-list.html", key, []string{roomTag(roomID)}, func() gin.H {
+		chats := []*models.Chat{chat}
+		if chat == nil {
+			chats = h.ChatStore.GetChatsByRoom(roomID)
+		}
+		return gin.H{
+			"chats":  chats,
+			"roomID": roomID,
+			"flags":  flags,
+		}
 	})
 }
 
@@ -215,42 +1273,149 @@ func (h *Handler) GetChats(c *gin.Context) {
 func (h *Handler) CreateChat(c *gin.Context) {
 	roomID := c.Param("id")
 	_, exists := h.RoomStore.GetRoom(roomID)
+	// Optimistically sent messages are replaced or marked failed by ID
+	pending := newPendingChat(c, roomID)
+	defer pending.failed(c)
 	if !exists {
-		c.Status(http.StatusNotFound)
+		roomGone(c)
 		return
 	}
 
 	var input struct {
-		Username string `form:"username" binding:"required"`
-		Message  string `form:"message" binding:"required"`
+		Username string `form:"username" label:"chat_form.your_name" sanitize:"name" binding:"required,username"`
+		Message  string `form:"message" label:"chat_form.message" sanitize:"message" binding:"required,message"`
 	}
 
-	if err := c.ShouldBind(&input); err != nil {
-		c.HTML(http.StatusBadRequest, "partials/error-chat-form.html", gin.H{
-			"error":  "Username and message are required",
+	form := forms.ID(c, "chat-form")
+	invalid, err := forms.Bind(c, &input)
+	if err != nil {
+		status, message := h.bindError(c, err, i18n.FromContext(c).T("errors.invalid_form"))
+		renderFormError(c, status, form, "partials/error-chat-form.html", gin.H{
+			"error":  message,
 			"roomID": roomID,
 		})
 		return
 	}
+	if invalid != nil {
+		forms.Render(c, form, &input, invalid)
+		return
+	}
+	if h.roomFull(roomID) {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-chat-form.html", gin.H{
+			"error":  i18n.FromContext(c).N("errors.messages_limit", h.Config.Limits.MaxMessagesPerRoom),
+			"roomID": roomID,
+		})
+		return
+	}
+	if h.BanStore.IsBanned(input.Username) {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-chat-form.html", gin.H{
+			"error":  i18n.FromContext(c).T("errors.banned"),
+			"roomID": roomID,
+		})
+		return
+	}
+	// Refused with a 403, as htmx does not swap a 429 into the form
+	if h.overLimit(c.ClientIP(), h.postLimiter, "messages_per_minute") {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-chat-form.html", gin.H{
+			"error":  i18n.FromContext(c).T("errors.post_limit"),
+			"roomID": roomID,
+		})
+		return
+	}
+	if quota := h.overPostQuota(quotaUser(c), input.Message); quota != "" {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-chat-form.html", gin.H{
+			"error":  h.quotaError(i18n.FromContext(c), quota),
+			"roomID": roomID,
+		})
+		return
+	}
+
+	middleware.SetAuditActor(c, input.Username)
+	if visitorID := features.VisitorID(c); visitorID != "" {
+		h.NotificationStore.SetName(visitorID, input.Username)
+	}
 
 	chat := &models.Chat{
 		ID:        uuid.New().String(),
 		RoomID:    roomID,
 		Username:  input.Username,
 		Message:   input.Message,
-		CreatedAt: time.Now(),
+		CreatedAt: h.clock.Now(),
+	}
+
+	if h.blocked(chat) {
+		renderFormError(c, http.StatusForbidden, form, "partials/error-chat-form.html", gin.H{
+			"error":  i18n.FromContext(c).T("errors.message_blocked"),
+			"roomID": roomID,
+		})
+		return
+	}
+	if h.holdFlagged(chat, pending.ClientID) {
+		toasts.Add(c, toasts.Info, i18n.FromContext(c).T("toasts.message_held"))
+		if pending.ClientID != "" {
+			pending.held(c)
+		} else {
+			c.Header("HX-Reswap", "none")
+			c.Status(http.StatusAccepted)
+		}
+		forms.Clear(c, form, &input)
+		return
+	}
+
+	if err := h.addChatAck(chat, pending.ClientID); err != nil {
+		_ = c.Error(err)
+		renderFormError(c, http.StatusInternalServerError, form, "partials/error-chat-form.html", gin.H{
+			"error":  i18n.FromContext(c).T("errors.unexpected"),
+			"roomID": roomID,
+		})
+		return
 	}
+	h.triggerChatCreated(c, chat)
+	toasts.Add(c, toasts.Success, i18n.FromContext(c).T("toasts.message_sent"))
 
-	h.ChatStore.AddChat(chat)
+	// The message is appended to the list, which the other browsers in the
+	// room do as well
+	if pending.ClientID != "" {
+		pending.ack(c, chat)
+	} else {
+		c.Header("HX-Reswap", "beforeend")
+		h.renderMessages(c, roomID, chat)
+	}
+	forms.Clear(c, form, &input)
+}
+
+// addChat stores a new message and notifies clients and webhooks, unless
+// the store fails to save it
+func (h *Handler) addChat(chat *models.Chat) error {
+	return h.addChatAck(chat, "")
+}
+
+// addChatAck adds a message as addChat does, acknowledging the client ID of
+// an optimistically sent message to WebSocket clients
+func (h *Handler) addChatAck(chat *models.Chat, clientID string) error {
+	sanitizeChat(chat)
+	if err := h.ChatStore.AddChat(chat); err != nil {
+		return err
+	}
+	metrics.MessagesCreated.Inc()
+	h.Webhooks.Dispatch(webhooks.Event{Type: models.EventChatCreated, RoomID: chat.RoomID, Data: chat})
+	h.Bots.Notify(chat)
+	if h.Federation != nil && chat.Origin == "" {
+		h.publishFederated(chat)
+	}
 
 	// Broadcast update (could be room-specific, but global for simplicity)
-	hub.broadcast <- []byte("new-chat")
+	notify := h.NotificationStore.Notify(chat)
+	h.Hub.broadcast <- HubEvent{Type: models.EventChatCreated, Chat: chat, ClientID: clientID, Notify: notify}
+	return nil
+}
 
-	c.HTML(http.StatusOK, "partials/component-messages-list.html", gin.H{
-		"chats":  h.ChatStore.GetChatsByRoom(roomID),
-		"roomID": roomID,
-	})
-	c.Writer.Write([]byte(`<div id="chat-form-error" hx-swap-oob="innerHTML"></div>`))
+// sanitizeChat normalizes a message and the name of its author before they
+// are stored, cut to the length limits. People posting through the forms,
+// the APIs and IRC are refused longer input before; integrations are cut
+func sanitizeChat(chat *models.Chat) {
+	chat.Username = sanitize.Truncate(sanitize.Name(chat.Username), sanitize.MaxUsername)
+	chat.Message = sanitize.Truncate(sanitize.Message(chat.Message), sanitize.MaxMessage)
 }
 
 // GetChatContent returns the full chat content partial for HTMX swaps
@@ -258,14 +1423,32 @@ func (h *Handler) GetChatContent(c *gin.Context) {
 	roomID := c.Param("id")
 	room, exists := h.RoomStore.GetRoom(roomID)
 	if !exists {
-		c.Status(http.StatusNotFound)
+		roomGone(c)
 		return
 	}
 
 	data := gin.H{
 		"room":  room,
-		"chats": h.ChatStore.GetChatsByRoom(roomID),
+		"flags": features.FromContext(c),
 	}
 
-	c.HTML(http.StatusOK, "partials/room-page.html", data)
+	navigated(c, room.Name, roomBreadcrumbs(c, room))
+	render(c, http.StatusOK, "partials/room-page.html", data)
+}
+
+// storeFailedJSON answers an API request whose change the store failed to
+// save with a 500, recording err for the error report
+func storeFailedJSON(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "the change could not be saved"})
+}
+
+// roomGone answers a request for a room that does not exist (anymore), with
+// the error boundary for htmx requests since the layouts do not swap a bare 404
+func roomGone(c *gin.Context) {
+	if c.GetHeader("HX-Request") == "true" {
+		middleware.RenderBoundary(c, http.StatusNotFound, i18n.FromContext(c).T("errors.room_gone"))
+		return
+	}
+	c.Status(http.StatusNotFound)
 }
@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"htmx/internal/config"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCreateRoom(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.Stores.SeedRoom("General")
+
+	res, body := srv.HXPost("/api/rooms", url.Values{"name": {"  Lobby \t"}})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", res.StatusCode)
+	}
+	// The list comes back with the new room, its name sanitized
+	testutil.AssertOrder(t, body, "General", "Lobby")
+	testutil.AssertHTMLCount(t, body, "<li>", 2)
+	if n := srv.Handler.RoomStore.Count(); n != 2 {
+		t.Errorf("rooms stored = %d, want 2", n)
+	}
+}
+
+func TestCreateRoomInvalid(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+
+	res, body := srv.HXPost("/api/rooms", url.Values{"name": {"   "}})
+	if res.StatusCode == http.StatusOK {
+		t.Fatalf("status = 200 for an empty name: %s", body)
+	}
+	// The error goes next to the field, out of band
+	testutil.AssertAttr(t, body, "id", "room-form-name-error")
+	testutil.AssertHTML(t, body, "Room Name is required")
+	if n := srv.Handler.RoomStore.Count(); n != 0 {
+		t.Errorf("rooms stored = %d, want 0", n)
+	}
+}
+
+func TestCreateRoomLimit(t *testing.T) {
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.Limits.MaxRooms = 1
+	})
+	srv.Stores.SeedRoom("General")
+
+	res, body := srv.HXPost("/api/rooms", url.Values{"name": {"Lobby"}})
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", res.StatusCode)
+	}
+	testutil.AssertHTML(t, body, "1 room")
+}
+
+func TestMessagesEscaped(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	srv.Stores.SeedChats(room.ID, "mallory", "<script>alert(1)</script>", "second")
+
+	_, body := srv.HXGet("/api/rooms/" + room.ID + "/chats")
+	testutil.AssertNoHTML(t, body, "<script>alert(1)</script>")
+	testutil.AssertHTML(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	testutil.AssertOrder(t, body, "alert(1)", "second")
+	testutil.AssertAttr(t, body, "data-author", "mallory")
+}
+
+func TestAdminAuth(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.Stores.SeedAdmin(t, "root", "hunter2")
+
+	if res, _ := srv.Get("/admin"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status without credentials = %d, want 401", res.StatusCode)
+	}
+	if res, _ := srv.Do(srv.AsAdmin(srv.NewRequest(http.MethodGet, "/admin", nil))); res.StatusCode != http.StatusOK {
+		t.Errorf("status as the configured admin = %d, want 200", res.StatusCode)
+	}
+
+	req := srv.NewRequest(http.MethodGet, "/admin", nil)
+	req.SetBasicAuth("root", "hunter2")
+	if res, _ := srv.Do(req); res.StatusCode != http.StatusOK {
+		t.Errorf("status as a stored admin = %d, want 200", res.StatusCode)
+	}
+	req.SetBasicAuth("root", "wrong")
+	if res, _ := srv.Do(req); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status with a wrong password = %d, want 401", res.StatusCode)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// probeTimeout bounds how long a single health check may take
+const probeTimeout = 2 * time.Second
+
+// checkResult is the outcome of a single health check
+type checkResult struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Healthz reports that the process is up and serving requests
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Livez reports whether the process is healthy enough to keep running, i.e.
+// the hub loop is not stuck
+func (h *Handler) Livez(c *gin.Context) {
+	h.respondChecks(c, map[string]checkResult{
+		"hub": h.checkHub(),
+	})
+}
+
+// Readyz reports whether the process can serve traffic: the store is
+// reachable, the hub is running and migrations are applied
+func (h *Handler) Readyz(c *gin.Context) {
+	h.respondChecks(c, map[string]checkResult{
+		"store":      h.checkStore(),
+		"hub":        h.checkHub(),
+		"migrations": h.checkMigrations(),
+	})
+}
+
+// checkMigrations compares the schema version of the database with the
+// latest this build migrates to, failing when they differ
+func (h *Handler) checkMigrations() checkResult {
+	if h.Database == nil {
+		return checkResult{Status: "ok", Detail: "not required for the memory store"}
+	}
+	version, latest, err := h.Database.SchemaVersion()
+	if err != nil {
+		return checkResult{Status: "fail", Detail: err.Error()}
+	}
+	if version != latest {
+		return checkResult{Status: "fail", Detail: fmt.Sprintf("schema version %d, this build expects %d", version, latest)}
+	}
+	return checkResult{Status: "ok", Detail: fmt.Sprintf("schema version %d", version)}
+}
+
+// checkHub verifies the hub loop is running and responsive
+func (h *Handler) checkHub() checkResult {
+	if !h.Hub.Running() {
+		return checkResult{Status: "fail", Detail: "hub not started"}
+	}
+	if !h.Hub.Ping(probeTimeout) {
+		return checkResult{Status: "fail", Detail: "hub not responding"}
+	}
+	return checkResult{Status: "ok"}
+}
+
+// checkStore verifies every store answers within the probe timeout
+func (h *Handler) checkStore() checkResult {
+	done := make(chan error, 1)
+	go func() {
+		done <- errors.Join(h.RoomStore.Ping(), h.ChatStore.Ping())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return checkResult{Status: "fail", Detail: err.Error()}
+		}
+		return checkResult{Status: "ok"}
+	case <-time.After(probeTimeout):
+		return checkResult{Status: "fail", Detail: "store not responding"}
+	}
+}
+
+// respondChecks writes the check results, failing with 503 if any check failed
+func (h *Handler) respondChecks(c *gin.Context, checks map[string]checkResult) {
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"htmx/internal/testutil"
+	"net/http"
+	"testing"
+)
+
+// schema is a database at a fixed schema version
+type schema struct{ version, latest int }
+
+func (s schema) SchemaVersion() (int, int, error) {
+	return s.version, s.latest, nil
+}
+
+func TestReadyzMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		database *schema
+		status   int
+		check    string
+		detail   string
+	}{
+		{"memory", nil, http.StatusOK, "ok", "not required for the memory store"},
+		{"migrated", &schema{2, 2}, http.StatusOK, "ok", "schema version 2"},
+		{"behind", &schema{1, 2}, http.StatusServiceUnavailable, "fail", "schema version 1, this build expects 2"},
+		{"newer", &schema{3, 2}, http.StatusServiceUnavailable, "fail", "schema version 3, this build expects 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := testutil.NewServer(t, nil)
+			if tt.database != nil {
+				srv.Handler.Database = *tt.database
+			}
+			res, body := srv.Get("/readyz")
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			var ready struct {
+				Checks map[string]struct{ Status, Detail string }
+			}
+			if err := json.Unmarshal([]byte(body), &ready); err != nil {
+				t.Fatal(err)
+			}
+			if got := ready.Checks["migrations"]; got.Status != tt.check || got.Detail != tt.detail {
+				t.Errorf("migrations = %+v, want %s %q", got, tt.check, tt.detail)
+			}
+		})
+	}
+}
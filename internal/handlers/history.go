@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/sanitize"
+	"net/url"
+)
+
+// partial reports whether a request for a page wants only its content, as
+// swapped in by an htmx navigation, rather than the whole page. htmx also
+// sends HX-Request when it restores a history entry missing from its cache,
+// and swaps the response in as the whole page, so those get the layout too.
+// Both headers change the response, which caches are told
+func partial(c *gin.Context) bool {
+	c.Writer.Header().Add("Vary", "HX-Request, HX-History-Restore-Request")
+	return c.GetHeader("HX-Request") == "true" && c.GetHeader("HX-History-Restore-Request") != "true"
+}
+
+// pageSearch returns the sidebar search of a page, given in its "q" query
+// parameter
+func pageSearch(c *gin.Context) string {
+	return sanitize.Query(c.Query("q"))
+}
+
+// currentPage returns the URL of the page an htmx request is sent from
+func currentPage(c *gin.Context) (*url.URL, bool) {
+	current, err := url.Parse(c.GetHeader("HX-Current-URL"))
+	if err != nil || current.Path == "" {
+		return nil, false
+	}
+	return current, true
+}
+
+// withSearch returns the URL of a page showing the sidebar search
+func withSearch(path, search string) string {
+	if search == "" {
+		return path
+	}
+	return path + "?" + url.Values{"q": {search}}.Encode()
+}
+
+// currentSearch returns the sidebar search of the page an htmx request is
+// sent from
+func currentSearch(c *gin.Context) string {
+	if current, ok := currentPage(c); ok {
+		return sanitize.Query(current.Query().Get("q"))
+	}
+	return ""
+}
+
+// pushURL returns the URL pushed into the history when a partial
+// navigation opens the page at path: the sidebar is not swapped, so the
+// search of the current page is kept
+func pushURL(c *gin.Context, path string) string {
+	return withSearch(path, currentSearch(c))
+}
+
+// replaceSearch replaces the URL of the current page with one showing the
+// sidebar search typed into it, so the page shows it again when reloaded.
+// Typing replaces the URL rather than pushing one per keystroke
+func replaceSearch(c *gin.Context, search string) {
+	if current, ok := currentPage(c); ok {
+		c.Header("HX-Replace-Url", withSearch(current.Path, search))
+	}
+}
@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"fmt"
+	"htmx/internal/config"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentPosts posts to several rooms at once while clients read the
+// hub, for the race detector: every message is saved once, in its room, and
+// announced to every client once
+func TestConcurrentPosts(t *testing.T) {
+	const rooms, posters, posts = 4, 8, 10
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.Moderation.MessagesPerMinute = 0
+	})
+	roomIDs := make([]string, rooms)
+	for i := range roomIDs {
+		roomIDs[i] = srv.Stores.SeedRoom(fmt.Sprint("Room ", i)).ID
+	}
+	clients := make([]*testutil.WSClient, 3)
+	for i := range clients {
+		clients[i] = srv.DialWS("/ws", nil)
+	}
+	srv.WaitClients(len(clients))
+
+	var wg sync.WaitGroup
+	for p := range posters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			roomID := roomIDs[p%rooms]
+			for i := range posts {
+				form := url.Values{"username": {fmt.Sprint("user", p)}, "message": {fmt.Sprintf("message %d of %d", i, p)}}
+				res, err := srv.Client().PostForm(srv.URL+"/api/rooms/"+roomID+"/chats", form)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("posting to %s: status %d", roomID, res.StatusCode)
+				}
+			}
+		}()
+	}
+	// Clients read while the posts are saved and broadcast
+	announced := make([]map[string]int, len(clients))
+	var reads sync.WaitGroup
+	for i, client := range clients {
+		announced[i] = make(map[string]int)
+		reads.Add(1)
+		go func() {
+			defer reads.Done()
+			deadline := time.After(5 * time.Second)
+			for received := 0; received < posters*posts; {
+				select {
+				case event, ok := <-client.Events:
+					if !ok {
+						t.Errorf("client %d closed after %d messages", i, received)
+						return
+					}
+					if event.Type == "new-chat" {
+						announced[i][event.ChatID]++
+						received++
+					}
+				case <-deadline:
+					t.Errorf("client %d got %d of %d messages", i, received, posters*posts)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	reads.Wait()
+
+	chats := srv.Handler.ChatStore
+	if n := chats.Count(); n != posters*posts {
+		t.Fatalf("Count = %d, want %d", n, posters*posts)
+	}
+	for _, roomID := range roomIDs {
+		listed := chats.GetChatsByRoom(roomID)
+		if want := posters / rooms * posts; len(listed) != want {
+			t.Errorf("room %s has %d messages, want %d", roomID, len(listed), want)
+		}
+		for _, chat := range listed {
+			if chat.RoomID != roomID {
+				t.Errorf("chat %s of room %s listed in %s", chat.ID, chat.RoomID, roomID)
+			}
+			for i := range clients {
+				if n := announced[i][chat.ID]; n != 1 {
+					t.Errorf("client %d was told of %s %d times", i, chat.ID, n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"htmx/internal/analytics"
+	"htmx/internal/config"
+	"htmx/internal/i18n"
+	"htmx/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// benchHub returns a hub with n clients, split between the en and de
+// locales, whose peers discard what they read without decoding it, so only
+// the allocations of the hub count
+func benchHub(b *testing.B, n int) *Hub {
+	b.Helper()
+	hub := NewHub(config.Default().WebSocket, analytics.NewConnections())
+	conns := make(chan *websocket.Conn)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := hub.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	b.Cleanup(srv.Close)
+
+	en, _ := i18n.Get("en")
+	de, _ := i18n.Get("de")
+	url := "ws" + srv.URL[len("http"):]
+	for i := range n {
+		peer, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { peer.Close() })
+		go io.Copy(io.Discard, peer.NetConn())
+
+		conn := <-conns
+		b.Cleanup(func() { conn.Close() })
+		locale := en
+		if i%2 == 1 {
+			locale = de
+		}
+		hub.clients[conn] = hubClient{id: fmt.Sprint(i), conn: conn, locale: locale, visitorID: fmt.Sprint("visitor-", i)}
+	}
+	hub.counted()
+	return hub
+}
+
+// BenchmarkHubSend measures the broadcast of one new message, whose cost
+// per op is mostly one write per client; the allocations are those of
+// encoding the message once per locale
+func BenchmarkHubSend(b *testing.B) {
+	chat := &models.Chat{ID: "c1", RoomID: "r1", Username: "alice", Message: "Hello, everyone!", CreatedAt: time.Now()}
+	events := []HubEvent{{Type: models.EventChatCreated, Chat: chat}}
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("clients=%d", n), func(b *testing.B) {
+			hub := benchHub(b, n)
+			b.ReportAllocs()
+			for b.Loop() {
+				hub.send(events)
+			}
+			if len(hub.clients) != n {
+				b.Fatalf("%d of %d clients were dropped", n-len(hub.clients), n)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"cmp"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/i18n"
+	"htmx/internal/middleware"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// impersonationDuration is how long an admin views the site as a visitor
+// unless they stop sooner
+const impersonationDuration = time.Hour
+
+// impersonationViews lists the pages, and the partials navigated to, that
+// are recorded in the audit log when an admin views them as a visitor; the
+// partials polled while a page is open are left out
+var impersonationViews = map[string]bool{
+	"GET /":                           true,
+	"GET /rooms/:id":                  true,
+	"GET /api/rooms/:id/chat-content": true,
+	"GET /settings":                   true,
+	"GET /notifications":              true,
+	"GET /shortcuts":                  true,
+	"GET /rooms/:id/transcript":       true,
+	"GET /embed/rooms/:id":            true,
+}
+
+// impersonationAllowed lists the mutating routes an admin may still use
+// while viewing the site as a visitor: stopping, and those only setting the
+// cookies of the admin's own browser
+var impersonationAllowed = map[string]bool{
+	"POST /impersonate/stop": true,
+	"POST /theme":            true,
+	"POST /theme/toggle":     true,
+	"POST /lang":             true,
+	"POST /layout":           true,
+}
+
+// impersonatedVisitor is a visitor an admin may view the site as
+type impersonatedVisitor struct {
+	ID   string
+	Name string
+	// Unread is the number of mentions the visitor has not read yet
+	Unread int
+}
+
+// guardImpersonation keeps an admin viewing the site as a visitor from
+// acting as them: their requests outside the admin pages are recorded under
+// the admin's name, those changing anything are refused, and the pages they
+// view are recorded in the audit log
+func (h *Handler) guardImpersonation(c *gin.Context) {
+	impersonation, ok := features.ImpersonationFrom(c)
+	if !ok || strings.HasPrefix(c.Request.URL.Path, "/admin") {
+		c.Next()
+		return
+	}
+
+	middleware.SetAuditActor(c, impersonation.Admin)
+	route := c.Request.Method + " " + c.FullPath()
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && !impersonationAllowed[route] {
+		name := cmp.Or(impersonation.Name, impersonation.VisitorID)
+		toasts.Add(c, toasts.Error, i18n.FromContext(c).T("errors.impersonating", "name", name))
+		c.Status(http.StatusForbidden)
+		c.Abort()
+		return
+	}
+	if impersonationViews[route] {
+		middleware.AuditView(c, "impersonate.view")
+		middleware.SetAuditChange(c, nil, impersonation)
+	}
+	c.Next()
+}
+
+// AdminImpersonate lists the visitors an admin may view the site as or
+// export the data of: those who posted under a name, as there are no accounts
+func (h *Handler) AdminImpersonate(c *gin.Context) {
+	h.renderAdminImpersonate(c, http.StatusOK, "")
+}
+
+// StartImpersonation lets the admin's browser view the site as a visitor,
+// read-only, until they stop or impersonationDuration passes
+func (h *Handler) StartImpersonation(c *gin.Context) {
+	var input struct {
+		VisitorID string `form:"visitor_id" binding:"required,max=64"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminImpersonate(c, http.StatusBadRequest, "A visitor ID is required")
+		return
+	}
+	visitorID := strings.TrimSpace(input.VisitorID)
+	if visitorID == "" {
+		h.renderAdminImpersonate(c, http.StatusBadRequest, "A visitor ID is required")
+		return
+	}
+
+	impersonation := features.Impersonation{
+		VisitorID: visitorID,
+		Name:      h.NotificationStore.Name(visitorID),
+		Admin:     c.GetString(gin.AuthUserKey),
+		ExpiresAt: h.clock.Now().Add(impersonationDuration),
+	}
+	value := features.SignImpersonation(impersonation, []byte(h.Config.Features.Secret))
+	c.SetCookie(features.ImpersonationCookie, value, int(impersonationDuration.Seconds()), "/", "", h.Config.Server.TLS.Enabled(), true)
+	middleware.SetAuditChange(c, nil, impersonation)
+	slog.Info("impersonation started", "admin", impersonation.Admin, "visitor", visitorID)
+
+	fullRedirect(c, "/")
+}
+
+// StopImpersonation returns the admin's browser to its own view of the site
+func (h *Handler) StopImpersonation(c *gin.Context) {
+	if impersonation, ok := features.ImpersonationFrom(c); ok {
+		middleware.SetAuditActor(c, impersonation.Admin)
+		middleware.SetAuditChange(c, impersonation, nil)
+		slog.Info("impersonation stopped", "admin", impersonation.Admin, "visitor", impersonation.VisitorID)
+	}
+	c.SetCookie(features.ImpersonationCookie, "", -1, "/", "", h.Config.Server.TLS.Enabled(), true)
+
+	fullRedirect(c, "/")
+}
+
+// fullRedirect sends the browser to another page with a full load, as
+// starting or stopping an impersonation changes the whole layout
+func fullRedirect(c *gin.Context, url string) {
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Redirect", url)
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, url)
+}
+
+// renderAdminImpersonate renders the visitors to view the site as with an
+// optional form error
+func (h *Handler) renderAdminImpersonate(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	var visitors []impersonatedVisitor
+	for id, name := range h.NotificationStore.Names() {
+		visitors = append(visitors, impersonatedVisitor{ID: id, Name: name, Unread: h.NotificationStore.Count(id)})
+	}
+	slices.SortFunc(visitors, func(a, b impersonatedVisitor) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.ID, b.ID))
+	})
+
+	data := gin.H{
+		"title":    "Visitors",
+		"visitors": visitors,
+		"error":    errMsg,
+		"Page":     "impersonate",
+	}
+	if impersonation, ok := features.ImpersonationFrom(c); ok {
+		data["impersonation"] = impersonation
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-impersonate.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"net/http"
+	"net/url"
+)
+
+// slackMessage is the subset of a Slack incoming webhook payload that maps onto a chat message
+type slackMessage struct {
+	Text     string `json:"text"`
+	Username string `json:"username"`
+	IconURL  string `json:"icon_url"`
+}
+
+// IncomingWebhook posts a Slack-style payload into the room of the webhook
+// token, or any JSON payload formatted with the webhook's template. Like
+// Slack, it accepts a JSON body or a form with a JSON "payload" field, and
+// answers with a short plain-text status
+func (h *Handler) IncomingWebhook(c *gin.Context) {
+	webhook, exists := h.WebhookStore.GetIncomingWebhook(c.Param("token"))
+	if !exists {
+		c.String(http.StatusForbidden, "invalid_token")
+		return
+	}
+	if _, exists := h.RoomStore.GetRoom(webhook.RoomID); !exists {
+		c.String(http.StatusNotFound, "channel_not_found")
+		return
+	}
+
+	var msg slackMessage
+	if webhook.Template != "" {
+		text, err := renderPayload(c, webhook.Template)
+		if errors.Is(err, errPayloadTemplate) {
+			c.String(http.StatusUnprocessableEntity, "template_error")
+			return
+		}
+		if err != nil {
+			status, _ := h.bindError(c, err, "")
+			c.String(status, "invalid_payload")
+			return
+		}
+		if text == "" {
+			// Templates skip the events they are not interested in this way
+			c.String(http.StatusOK, "ignored")
+			return
+		}
+		msg.Text = text
+	} else if err := bindSlackMessage(c, &msg); err != nil {
+		status, _ := h.bindError(c, err, "")
+		c.String(status, "invalid_payload")
+		return
+	}
+	if sanitize.Message(msg.Text) == "" {
+		c.String(http.StatusBadRequest, "no_text")
+		return
+	}
+	if h.roomFull(webhook.RoomID) {
+		c.String(http.StatusForbidden, "room_full")
+		return
+	}
+
+	username := msg.Username
+	if username == "" {
+		username = webhook.Name
+	}
+	middleware.SetAuditActor(c, "webhook:"+webhook.Name)
+
+	err := h.addChat(&models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    webhook.RoomID,
+		Username:  username,
+		Message:   msg.Text,
+		Bot:       true,
+		AvatarURL: iconURL(msg.IconURL),
+		CreatedAt: h.clock.Now(),
+	})
+	if err != nil {
+		_ = c.Error(err)
+		c.String(http.StatusInternalServerError, "save_failed")
+		return
+	}
+
+	c.String(http.StatusOK, "ok")
+}
+
+// bindSlackMessage reads the message from a JSON body or a form "payload" field
+func bindSlackMessage(c *gin.Context, msg *slackMessage) error {
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		return c.ShouldBindJSON(msg)
+	}
+
+	var form struct {
+		Payload string `form:"payload" binding:"required"`
+	}
+	if err := c.ShouldBind(&form); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(form.Payload), msg)
+}
+
+// iconURL returns the icon_url of a payload if it is an absolute http or
+// https URL, which is all avatars are shown from
+func iconURL(raw string) string {
+	if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return raw
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/ratelimit"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// ipBanDurations are the durations an admin can ban a network for, by the
+// value of the form's select; "" never lifts the ban
+var ipBanDurations = map[string]time.Duration{
+	"1h":   time.Hour,
+	"24h":  24 * time.Hour,
+	"168h": 7 * 24 * time.Hour,
+	"720h": 30 * 24 * time.Hour,
+	"":     0,
+}
+
+// ipGuarded lists the API routes people post through, refused to banned
+// addresses along with the WebSocket upgrade. Bots and webhooks
+// authenticate with their tokens instead
+var ipGuarded = map[string]bool{
+	"POST /api/rooms":                          true,
+	"POST /api/rooms/:id/chats":                true,
+	"POST /api/rooms/:id/chats/:chatID/report": true,
+	"POST /api/v1/rooms":                       true,
+	"POST /api/v1/rooms/:id/chats":             true,
+}
+
+// overLimit records an attempt of the client at the address against a
+// per-client limiter, reporting whether the limit refuses it. Refusals
+// count towards an automatic ban of the address
+func (h *Handler) overLimit(ip string, limiter *ratelimit.Limiter, limit string) bool {
+	if limiter.Allow(ip) {
+		return false
+	}
+	metrics.LimitRejections.WithLabelValues(limit).Inc()
+	if h.violations.Allow(ip) {
+		return true
+	}
+
+	cfg := h.Config.Moderation
+	ban, err := models.NewIPBan(uuid.New().String(), ip)
+	if err != nil {
+		return true
+	}
+	ban.Reason = fmt.Sprintf("Refused by the limits more than %d times within %s", cfg.AutoBanViolations, cfg.AutoBanWindow)
+	ban.CreatedAt = h.clock.Now()
+	ban.ExpiresAt = ban.CreatedAt.Add(cfg.AutoBanDuration)
+	h.IPBans.AddBan(ban)
+	metrics.IPBansAutomatic.Inc()
+	slog.Warn("address banned automatically", "ip", ip, "limit", limit, "until", ban.ExpiresAt)
+	return true
+}
+
+// ipBanned reports whether the address, as IRC clients connect from, is
+// banned
+func (h *Handler) ipBanned(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	_, banned := h.IPBans.Banned(addr)
+	return banned
+}
+
+// AdminIPBans renders the banned networks
+func (h *Handler) AdminIPBans(c *gin.Context) {
+	h.renderAdminIPBans(c, http.StatusOK, "")
+}
+
+// CreateIPBan bans a network or a single address from posting and
+// connecting, for a while or until lifted
+func (h *Handler) CreateIPBan(c *gin.Context) {
+	var input struct {
+		CIDR     string `form:"cidr" binding:"required"`
+		Reason   string `form:"reason"`
+		Duration string `form:"duration"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminIPBans(c, http.StatusBadRequest, "An address or CIDR is required")
+		return
+	}
+	duration, ok := ipBanDurations[input.Duration]
+	if !ok {
+		h.renderAdminIPBans(c, http.StatusBadRequest, "Unknown ban duration")
+		return
+	}
+	ban, err := models.NewIPBan(uuid.New().String(), input.CIDR)
+	if err != nil {
+		h.renderAdminIPBans(c, http.StatusBadRequest, "Cannot ban "+err.Error())
+		return
+	}
+	ban.Reason = input.Reason
+	ban.By = c.GetString(gin.AuthUserKey)
+	ban.CreatedAt = h.clock.Now()
+	if duration > 0 {
+		ban.ExpiresAt = ban.CreatedAt.Add(duration)
+	}
+	h.IPBans.AddBan(ban)
+	middleware.SetAuditChange(c, nil, ban)
+	toasts.Add(c, toasts.Success, ban.CIDR+" is banned")
+
+	h.renderAdminIPBans(c, http.StatusOK, "")
+}
+
+// DeleteIPBan lifts the ban of a network
+func (h *Handler) DeleteIPBan(c *gin.Context) {
+	ban, exists := h.IPBans.RemoveBan(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "Ban not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, ban, nil)
+	toasts.Add(c, toasts.Success, "The ban of "+ban.CIDR+" is lifted")
+
+	h.renderAdminIPBans(c, http.StatusOK, "")
+}
+
+// renderAdminIPBans renders the IP bans page with an optional form error
+func (h *Handler) renderAdminIPBans(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	data := gin.H{
+		"title":    "IP bans",
+		"bans":     h.IPBans.GetBans(),
+		"clientIP": c.ClientIP(),
+		"error":    errMsg,
+		"Page":     "ip-bans",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-ip-bans.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
@@ -0,0 +1,730 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ircServerName prefixes the replies sent by the IRC gateway
+const ircServerName = "htmx-chat"
+
+const (
+	// ircIdleTimeout drops clients that send nothing, not even a PING, for this long
+	ircIdleTimeout = 10 * time.Minute
+	// ircWriteTimeout bounds each line written to a client
+	ircWriteTimeout = 10 * time.Second
+	// ircMaxLine bounds the length of a line read from a client
+	ircMaxLine = 4096
+	// ircNamesLength is the length after which a NAMES reply is split
+	ircNamesLength = 400
+)
+
+// IRCServer exposes rooms as IRC channels, so terminal users can take part
+// with their usual IRC client
+type IRCServer struct {
+	h        *Handler
+	listener net.Listener
+	clients  map[*ircClient]struct{}
+	nicks    map[string]*ircClient
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// ircClient is a connection to the IRC gateway
+type ircClient struct {
+	server *IRCServer
+	conn   net.Conn
+	host   string
+	done   chan struct{}
+	// Registration state, only used by the read loop
+	nick       string
+	user       string
+	password   bool
+	registered bool
+	// channels maps the joined rooms to their channel names, and posted holds
+	// the IDs of messages sent by this client so they are not echoed back
+	channels map[string]string
+	posted   map[string]struct{}
+	mutex    sync.Mutex
+	writeMu  sync.Mutex
+}
+
+// NewIRCServer creates the IRC gateway
+func (h *Handler) NewIRCServer() *IRCServer {
+	return &IRCServer{
+		h:       h,
+		clients: make(map[*ircClient]struct{}),
+		nicks:   make(map[string]*ircClient),
+	}
+}
+
+// Serve accepts IRC connections on ln until Close is called
+func (s *IRCServer) Serve(ln net.Listener) error {
+	s.mutex.Lock()
+	s.listener = ln
+	s.mutex.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and disconnects every client
+func (s *IRCServer) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c := range s.clients {
+		c.send("ERROR :Closing link (server shutting down)")
+		c.conn.Close()
+	}
+}
+
+// serveConn reads commands from a client until it quits or disconnects
+func (s *IRCServer) serveConn(conn net.Conn) {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	c := &ircClient{
+		server:   s,
+		conn:     conn,
+		host:     host,
+		done:     make(chan struct{}),
+		nick:     "*",
+		channels: make(map[string]string),
+		posted:   make(map[string]struct{}),
+	}
+	if s.h.ipBanned(host) {
+		c.send("ERROR :Closing link (your address is banned)")
+		conn.Close()
+		return
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	s.clients[c] = struct{}{}
+	s.mutex.Unlock()
+	slog.Debug("irc client connected", "remote", conn.RemoteAddr().String())
+
+	defer func() {
+		close(c.done)
+		s.part(c, "Connection closed")
+		conn.Close()
+		slog.Debug("irc client disconnected", "remote", conn.RemoteAddr().String(), "nick", c.nick)
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 512), ircMaxLine)
+	for {
+		conn.SetReadDeadline(time.Now().Add(ircIdleTimeout))
+		if !scanner.Scan() {
+			return
+		}
+		command, params := parseIRC(scanner.Text())
+		if command == "" {
+			continue
+		}
+		if !c.handle(command, params) {
+			return
+		}
+	}
+}
+
+// part removes a disconnecting client from its channels and the nick list
+func (s *IRCServer) part(c *ircClient, reason string) {
+	c.mutex.Lock()
+	joined := make(map[string]string, len(c.channels))
+	for roomID, channel := range c.channels {
+		joined[roomID] = channel
+	}
+	c.channels = make(map[string]string)
+	c.mutex.Unlock()
+
+	if c.registered {
+		for roomID := range joined {
+			s.tell(roomID, c, fmt.Sprintf(":%s QUIT :%s", c.prefix(), reason))
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.clients, c)
+	if s.nicks[strings.ToLower(c.nick)] == c {
+		delete(s.nicks, strings.ToLower(c.nick))
+	}
+}
+
+// tell sends a line to every other client in a room's channel
+func (s *IRCServer) tell(roomID string, from *ircClient, line string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.clients {
+		if c != from && c.joined(roomID) {
+			c.send(line)
+		}
+	}
+}
+
+// members returns the nicks of the clients in a room's channel
+func (s *IRCServer) members(roomID string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var nicks []string
+	for c := range s.clients {
+		if c.joined(roomID) {
+			nicks = append(nicks, c.nick)
+		}
+	}
+	return nicks
+}
+
+// findRoom returns the room of a channel name, the oldest one when several
+// room names map to the same channel
+func (s *IRCServer) findRoom(channel string) (*models.Room, bool) {
+	var found *models.Room
+	for _, room := range s.h.RoomStore.GetRooms() {
+		if ircChannel(room) == strings.ToLower(channel) && (found == nil || room.CreatedAt.Before(found.CreatedAt)) {
+			found = room
+		}
+	}
+	return found, found != nil
+}
+
+// handle runs one command, returning false when the connection should close
+func (c *ircClient) handle(command string, params []string) bool {
+	switch command {
+	case "CAP":
+		if len(params) > 0 && strings.ToUpper(params[0]) == "LS" {
+			c.send(fmt.Sprintf(":%s CAP * LS :", ircServerName))
+		}
+		return true
+	case "PASS":
+		if c.registered {
+			c.reply("462", ":You may not reregister")
+		} else if len(params) > 0 {
+			c.password = subtle.ConstantTimeCompare([]byte(params[0]), []byte(c.server.h.Config.IRC.Password)) == 1
+		}
+		return true
+	case "NICK":
+		return c.setNick(params)
+	case "USER":
+		if c.registered {
+			c.reply("462", ":You may not reregister")
+			return true
+		}
+		if len(params) < 4 {
+			c.reply("461", "USER :Not enough parameters")
+			return true
+		}
+		c.user = params[0]
+		return c.register()
+	case "PING":
+		token := ircServerName
+		if len(params) > 0 {
+			token = params[0]
+		}
+		c.send(fmt.Sprintf(":%s PONG %s :%s", ircServerName, ircServerName, token))
+		return true
+	case "PONG":
+		return true
+	case "QUIT":
+		c.send("ERROR :Closing link")
+		return false
+	}
+
+	if !c.registered {
+		c.reply("451", ":You have not registered")
+		return true
+	}
+
+	switch command {
+	case "JOIN":
+		c.join(params)
+	case "PART":
+		c.part(params)
+	case "NAMES":
+		if len(params) == 0 {
+			c.reply("366", "* :End of /NAMES list")
+		}
+		for _, channel := range ircTargets(params) {
+			c.names(channel)
+		}
+	case "LIST":
+		c.list()
+	case "TOPIC":
+		c.topic(params)
+	case "PRIVMSG":
+		c.privmsg(params)
+	case "NOTICE":
+		// Notices must never trigger replies, and there is nowhere to send them
+	case "WHO":
+		target := "*"
+		if len(params) > 0 {
+			target = params[0]
+		}
+		c.reply("315", target+" :End of /WHO list")
+	case "MODE":
+		if len(params) > 0 && strings.HasPrefix(params[0], "#") {
+			c.reply("324", params[0]+" +nt")
+		} else {
+			c.reply("221", "+i")
+		}
+	default:
+		c.reply("421", command+" :Unknown command")
+	}
+	return true
+}
+
+// setNick claims a nick, announcing the change when already registered
+func (c *ircClient) setNick(params []string) bool {
+	if len(params) == 0 {
+		c.reply("431", ":No nickname given")
+		return true
+	}
+	nick := params[0]
+	if !validNick(nick) {
+		c.reply("432", nick+" :Erroneous nickname")
+		return true
+	}
+
+	s := c.server
+	s.mutex.Lock()
+	if owner, taken := s.nicks[strings.ToLower(nick)]; taken && owner != c {
+		s.mutex.Unlock()
+		c.reply("433", nick+" :Nickname is already in use")
+		return true
+	}
+	if s.nicks[strings.ToLower(c.nick)] == c {
+		delete(s.nicks, strings.ToLower(c.nick))
+	}
+	s.nicks[strings.ToLower(nick)] = c
+	line := fmt.Sprintf(":%s NICK :%s", c.prefix(), nick)
+	c.nick = nick // Guarded by the server mutex for members
+	s.mutex.Unlock()
+
+	if !c.registered {
+		return c.register()
+	}
+
+	c.send(line)
+	c.mutex.Lock()
+	rooms := make([]string, 0, len(c.channels))
+	for roomID := range c.channels {
+		rooms = append(rooms, roomID)
+	}
+	c.mutex.Unlock()
+	for _, roomID := range rooms {
+		s.tell(roomID, c, line)
+	}
+	return true
+}
+
+// register completes registration once both NICK and USER have been sent
+func (c *ircClient) register() bool {
+	if c.registered || c.nick == "*" || c.user == "" {
+		return true
+	}
+	if c.server.h.Config.IRC.Password != "" && !c.password {
+		c.reply("464", ":Password incorrect")
+		c.send("ERROR :Closing link (password incorrect)")
+		return false
+	}
+
+	c.registered = true
+	c.reply("001", fmt.Sprintf(":Welcome to %s, %s", ircServerName, c.prefix()))
+	c.reply("002", fmt.Sprintf(":Your host is %s", ircServerName))
+	c.reply("003", ":This server relays the chat rooms; LIST shows them and JOIN enters one")
+	c.reply("004", ircServerName+" htmx-chat i nt")
+	c.reply("005", "CHANTYPES=# NICKLEN=30 CHANNELLEN=64 :are supported by this server")
+	c.reply("422", ":MOTD File is missing")
+	go c.relay()
+	return true
+}
+
+// relay forwards the messages posted in joined rooms from the hub
+func (c *ircClient) relay() {
+	events, cancel := c.server.h.Hub.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case event := <-events:
+			if event.Type != models.EventChatCreated {
+				continue
+			}
+			chat := event.Chat
+
+			c.mutex.Lock()
+			channel, joined := c.channels[chat.RoomID]
+			_, own := c.posted[chat.ID]
+			delete(c.posted, chat.ID)
+			c.mutex.Unlock()
+			if !joined || own {
+				continue
+			}
+
+			prefix := ircNick(chat.Username) + "!web@" + ircServerName
+			if chat.Bot {
+				prefix = ircNick(chat.Username) + "!bot@" + ircServerName
+			}
+			for _, line := range strings.Split(chat.Message, "\n") {
+				if line = strings.TrimRight(line, "\r"); line != "" {
+					c.send(fmt.Sprintf(":%s PRIVMSG %s :%s", prefix, channel, line))
+				}
+			}
+		}
+	}
+}
+
+// join enters the channels of existing rooms
+func (c *ircClient) join(params []string) {
+	if len(params) == 0 {
+		c.reply("461", "JOIN :Not enough parameters")
+		return
+	}
+	if params[0] == "0" {
+		c.mutex.Lock()
+		channels := make([]string, 0, len(c.channels))
+		for _, channel := range c.channels {
+			channels = append(channels, channel)
+		}
+		c.mutex.Unlock()
+		c.part([]string{strings.Join(channels, ",")})
+		return
+	}
+
+	for _, channel := range ircTargets(params[:1]) {
+		room, exists := c.server.findRoom(channel)
+		if !exists {
+			c.reply("403", channel+" :No such channel")
+			continue
+		}
+		channel = ircChannel(room)
+
+		c.mutex.Lock()
+		_, already := c.channels[room.ID]
+		c.channels[room.ID] = channel
+		c.mutex.Unlock()
+		if already {
+			continue
+		}
+
+		line := fmt.Sprintf(":%s JOIN %s", c.prefix(), channel)
+		c.send(line)
+		c.server.tell(room.ID, c, line)
+		c.reply("332", channel+" :"+ircText(room.Name))
+		c.names(channel)
+	}
+}
+
+// part leaves joined channels
+func (c *ircClient) part(params []string) {
+	if len(params) == 0 {
+		c.reply("461", "PART :Not enough parameters")
+		return
+	}
+	reason := ""
+	if len(params) > 1 {
+		reason = " :" + params[1]
+	}
+
+	for _, channel := range ircTargets(params[:1]) {
+		roomID, joined := c.joinedChannel(channel)
+		if !joined {
+			c.reply("442", channel+" :You're not on that channel")
+			continue
+		}
+
+		line := fmt.Sprintf(":%s PART %s%s", c.prefix(), channel, reason)
+		c.send(line)
+		c.server.tell(roomID, c, line)
+		c.mutex.Lock()
+		delete(c.channels, roomID)
+		c.mutex.Unlock()
+	}
+}
+
+// names lists the IRC users in a channel and everyone who has posted in its room
+func (c *ircClient) names(channel string) {
+	room, exists := c.server.findRoom(channel)
+	if !exists {
+		c.reply("366", channel+" :End of /NAMES list")
+		return
+	}
+	channel = ircChannel(room)
+
+	names := c.server.members(room.ID)
+	c.server.h.ChatStore.ForEachChatInRoom(room.ID, func(chat *models.Chat) bool {
+		if nick := ircNick(chat.Username); !slices.ContainsFunc(names, func(name string) bool {
+			return strings.EqualFold(name, nick)
+		}) {
+			names = append(names, nick)
+		}
+		return true
+	})
+
+	var line strings.Builder
+	for _, name := range names {
+		if line.Len() > 0 && line.Len()+len(name) > ircNamesLength {
+			c.reply("353", "= "+channel+" :"+line.String())
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(name)
+	}
+	if line.Len() > 0 {
+		c.reply("353", "= "+channel+" :"+line.String())
+	}
+	c.reply("366", channel+" :End of /NAMES list")
+}
+
+// list shows every room with its message count and name
+func (c *ircClient) list() {
+	rooms := c.server.h.RoomStore.GetRooms()
+
+	c.reply("321", "Channel :Users  Name")
+	for _, room := range rooms {
+		c.reply("322", fmt.Sprintf("%s %d :%s", ircChannel(room), c.server.h.ChatStore.CountByRoom(room.ID), ircText(room.Name)))
+	}
+	c.reply("323", ":End of /LIST")
+}
+
+// topic shows the room name as the channel topic; rooms are renamed elsewhere
+func (c *ircClient) topic(params []string) {
+	if len(params) == 0 {
+		c.reply("461", "TOPIC :Not enough parameters")
+		return
+	}
+	room, exists := c.server.findRoom(params[0])
+	if !exists {
+		c.reply("403", params[0]+" :No such channel")
+		return
+	}
+	if len(params) > 1 {
+		c.reply("482", ircChannel(room)+" :The topic is the room name and cannot be changed over IRC")
+		return
+	}
+	c.reply("332", ircChannel(room)+" :"+ircText(room.Name))
+}
+
+// privmsg posts a message into the room of a joined channel
+func (c *ircClient) privmsg(params []string) {
+	if len(params) == 0 {
+		c.reply("411", ":No recipient given (PRIVMSG)")
+		return
+	}
+	if len(params) < 2 || params[1] == "" {
+		c.reply("412", ":No text to send")
+		return
+	}
+
+	channel, text := params[0], params[1]
+	if !strings.HasPrefix(channel, "#") {
+		c.reply("401", channel+" :Private messages are not supported")
+		return
+	}
+	roomID, joined := c.joinedChannel(channel)
+	if !joined {
+		c.reply("404", channel+" :Cannot send to channel (join it first)")
+		return
+	}
+	if _, exists := c.server.h.RoomStore.GetRoom(roomID); !exists {
+		c.reply("403", channel+" :No such channel")
+		return
+	}
+	if c.server.h.roomFull(roomID) {
+		c.reply("404", channel+" :Cannot send to channel (the room is full)")
+		return
+	}
+	if c.server.h.BanStore.IsBanned(c.nick) || c.server.h.ipBanned(c.host) {
+		c.reply("404", channel+" :Cannot send to channel (you are banned)")
+		return
+	}
+	if c.server.h.overLimit(c.host, c.server.h.postLimiter, "messages_per_minute") {
+		c.reply("404", channel+" :Cannot send to channel (you are posting too fast)")
+		return
+	}
+
+	// CTCP ACTION (/me) carries the text between markers
+	if action, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+		text = "* " + c.nick + " " + strings.TrimSuffix(action, "\x01")
+	} else if strings.HasPrefix(text, "\x01") {
+		return // Other CTCP requests are not chat messages
+	}
+
+	chat := &models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Username:  c.nick,
+		Message:   text,
+		CreatedAt: c.server.h.clock.Now(),
+	}
+	if quota := c.server.h.overPostQuota(ipQuotaUser(c.host), chat.Message); quota != "" {
+		c.reply("404", channel+" :Cannot send to channel ("+c.server.h.quotaErrorJSON(quota)+")")
+		return
+	}
+	if c.server.h.blocked(chat) {
+		c.reply("404", channel+" :Cannot send to channel (your message contains blocked words)")
+		return
+	}
+	c.mutex.Lock()
+	c.posted[chat.ID] = struct{}{}
+	c.mutex.Unlock()
+	if c.server.h.holdFlagged(chat, "") {
+		c.send(fmt.Sprintf(":%s NOTICE %s :Your message awaits review by a moderator", ircServerName, channel))
+		return
+	}
+	if err := c.server.h.addChat(chat); err != nil {
+		slog.Error("saving IRC message failed", "nick", c.nick, "room", chat.RoomID, "error", err)
+		c.mutex.Lock()
+		delete(c.posted, chat.ID)
+		c.mutex.Unlock()
+		c.reply("404", channel+" :Cannot send to channel (the message could not be saved)")
+	}
+}
+
+// joined reports whether the client is in a room's channel
+func (c *ircClient) joined(roomID string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, joined := c.channels[roomID]
+	return joined
+}
+
+// joinedChannel returns the room of a joined channel
+func (c *ircClient) joinedChannel(channel string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for roomID, name := range c.channels {
+		if strings.EqualFold(name, channel) {
+			return roomID, true
+		}
+	}
+	return "", false
+}
+
+// prefix returns the client's nick!user@host
+func (c *ircClient) prefix() string {
+	return c.nick + "!" + c.user + "@" + c.host
+}
+
+// reply sends a numeric reply addressed to the client
+func (c *ircClient) reply(code, text string) {
+	c.send(fmt.Sprintf(":%s %s %s %s", ircServerName, code, c.nick, text))
+}
+
+// send writes a line to the client, closing the connection if it fails
+func (c *ircClient) send(line string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(ircWriteTimeout))
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Debug("irc write failed", "remote", c.conn.RemoteAddr().String(), "error", err)
+		c.conn.Close()
+	}
+}
+
+// parseIRC splits a line into its command and parameters, dropping any prefix
+func parseIRC(line string) (string, []string) {
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	params := strings.Fields(line)
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(params[0]), params[1:]
+}
+
+// ircTargets splits a comma-separated channel list
+func ircTargets(params []string) []string {
+	if len(params) == 0 {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(params[0], ",") {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ircChannel returns the channel name of a room: its lowercased name with
+// spaces and commas replaced by dashes
+func ircChannel(room *models.Room) string {
+	return "#" + strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == ',' {
+			return '-'
+		}
+		return unicode.ToLower(r)
+	}, strings.TrimSpace(room.Name))
+}
+
+// ircNick turns a web username into a valid nick
+func ircNick(username string) string {
+	nick := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("!@:,#", r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(username))
+	if nick == "" {
+		return "anonymous"
+	}
+	return nick
+}
+
+// validNick reports whether a nick sent by a client can be used
+func validNick(nick string) bool {
+	return nick != "" && len(nick) <= 30 && ircNick(nick) == nick && sanitize.Name(nick) == nick && !strings.HasPrefix(nick, "*")
+}
+
+// ircText flattens text for a single IRC line
+func ircText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
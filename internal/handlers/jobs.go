@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/analytics"
+	"htmx/internal/jobs"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/telemetry"
+	"htmx/internal/toasts"
+	"log/slog"
+	"maps"
+	"net/http"
+	"time"
+)
+
+// analyticsRollup is the charts of the analytics page for its default
+// range, as the analytics job last computed them
+type analyticsRollup struct {
+	at     time.Time
+	r      analytics.Range
+	charts gin.H
+}
+
+// newJobs creates the runner of the background jobs with the jobs of the
+// handler registered; the backup job is added by the serve command, which
+// owns the export format
+func (h *Handler) newJobs() *jobs.Runner {
+	runner := jobs.NewRunner(func(name string, d time.Duration, err error) {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		metrics.JobRuns.WithLabelValues(name, result).Inc()
+	})
+
+	// The retention is read from the settings on each run, so changes on
+	// the settings page apply without a restart
+	runner.Add("retention", "@every "+h.Config.Retention.Interval.String(), jobs.Every(h.Config.Retention.Interval), func(ctx context.Context) error {
+		return h.purge(h.clock.Now())
+	})
+	h.addJob(runner, "analytics", h.Config.Jobs.Analytics, func(ctx context.Context) error {
+		h.rollUpAnalytics(h.clock.Now())
+		return nil
+	})
+	h.addJob(runner, "webhook_retries", h.Config.Jobs.WebhookRetries.Schedule, func(ctx context.Context) error {
+		h.retryDeadLetters()
+		return nil
+	})
+	if t := h.Config.Telemetry; t.Enabled && telemetry.Endpoint(t.Endpoint) != "" {
+		runner.Add("telemetry", "@every "+t.Interval.String(), jobs.Every(t.Interval), h.sendTelemetry)
+	}
+	return runner
+}
+
+// addJob registers a job on a configured schedule, unless it is empty
+func (h *Handler) addJob(runner *jobs.Runner, name, spec string, fn jobs.Func) {
+	if spec == "" {
+		return
+	}
+	// The configuration is validated on load
+	schedule, err := jobs.Parse(spec)
+	if err != nil {
+		slog.Error("job not scheduled", "job", name, "error", err)
+		return
+	}
+	runner.Add(name, spec, schedule, fn)
+}
+
+// StartJobs runs the background jobs on their schedules until ctx is done
+func (h *Handler) StartJobs(ctx context.Context) {
+	h.Jobs.Start(ctx)
+}
+
+// rollUpAnalytics computes the charts the analytics page opens on, so it
+// reads them rather than every message
+func (h *Handler) rollUpAnalytics(now time.Time) {
+	r, _ := analytics.ParseRange("", "", "", now)
+	h.analyticsRollup.Store(&analyticsRollup{at: now, r: r, charts: h.analyticsCharts(r)})
+}
+
+// rolledUpAnalytics returns a copy of the charts of the analytics job for a
+// range, and false unless they were computed for that very range
+func (h *Handler) rolledUpAnalytics(r analytics.Range) (gin.H, time.Time, bool) {
+	rollup := h.analyticsRollup.Load()
+	if rollup == nil || rollup.r != r {
+		return nil, time.Time{}, false
+	}
+	return maps.Clone(rollup.charts), rollup.at, true
+}
+
+// retryDeadLetters queues the dead-lettered webhook deliveries again, those
+// retried fewer than jobs.webhook_retries.max_retries times
+func (h *Handler) retryDeadLetters() {
+	retried := 0
+	for _, delivery := range h.WebhookStore.GetDeadLetters() {
+		if delivery.Retries >= h.Config.Jobs.WebhookRetries.MaxRetries {
+			continue
+		}
+		if delivery, exists := h.WebhookStore.TakeDeadLetter(delivery.ID); exists {
+			h.Webhooks.Retry(delivery)
+			retried++
+		}
+	}
+	if retried > 0 {
+		slog.Info("dead-lettered webhook deliveries queued again", "count", retried)
+	}
+}
+
+// DashboardJobs renders the status of the background jobs on the dashboard
+func (h *Handler) DashboardJobs(c *gin.Context) {
+	c.HTML(http.StatusOK, "partials/admin-dashboard-jobs.html", h.dashboardJobs())
+}
+
+// jobStatus is a background job on the dashboard, with the duration of its
+// last run rounded
+type jobStatus struct {
+	jobs.Status
+	Took time.Duration
+}
+
+// dashboardJobs gathers the status of the background jobs
+func (h *Handler) dashboardJobs() gin.H {
+	statuses := h.Jobs.Statuses()
+	rows := make([]jobStatus, len(statuses))
+	for i, status := range statuses {
+		rows[i] = jobStatus{Status: status, Took: status.LastDuration.Round(time.Millisecond)}
+	}
+	return gin.H{"jobs": rows}
+}
+
+// RunJob runs a background job now, off its schedule
+func (h *Handler) RunJob(c *gin.Context) {
+	name := c.Param("name")
+	exists, err := h.Jobs.Trigger(name)
+	switch {
+	case !exists:
+		toasts.Add(c, toasts.Error, "Job not found")
+		c.Status(http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrRunning):
+		toasts.Add(c, toasts.Error, fmt.Sprintf("The %s job is already running", name))
+		c.Status(http.StatusConflict)
+		return
+	}
+	middleware.SetAuditChange(c, nil, gin.H{"job": name})
+	toasts.Add(c, toasts.Info, fmt.Sprintf("The %s job will run in a moment", name))
+
+	c.HTML(http.StatusOK, "partials/admin-dashboard-jobs.html", h.dashboardJobs())
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"net/http"
+)
+
+// render renders a chat page or partial with the locale of the request,
+// which the templates translate their text with
+func render(c *gin.Context, status int, name string, data gin.H) {
+	data["locale"] = i18n.FromContext(c)
+	c.HTML(status, name, data)
+}
+
+// SetLanguage stores the locale picked with the language switcher and
+// reloads the page, since all of its text changes
+func (h *Handler) SetLanguage(c *gin.Context) {
+	locale, ok := i18n.Get(c.PostForm("lang"))
+	if !ok {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	c.SetCookie(i18n.Cookie, locale.Tag, 365*24*60*60, "/", "", h.Config.Server.TLS.Enabled(), true)
+	c.Header("HX-Refresh", "true")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// LayoutCookie holds the page layout picked by the browser
+const LayoutCookie = "layout"
+
+// Page layouts of layouts/base.html: the classic one shows the rooms in a
+// sidebar next to the chat, the responsive one in a drawer over it, for
+// small screens
+const (
+	layoutClassic    = "classic"
+	layoutResponsive = "responsive"
+)
+
+// layouts lists the page layouts a browser can pick
+var layouts = []string{layoutClassic, layoutResponsive}
+
+// layout returns the page layout of the browser: the one it picked, or the
+// responsive one for mobile browsers
+func layout(c *gin.Context) string {
+	if name, err := c.Cookie(LayoutCookie); err == nil && slices.Contains(layouts, name) {
+		return name
+	}
+	if c.GetHeader("Sec-CH-UA-Mobile") == "?1" || strings.Contains(c.GetHeader("User-Agent"), "Mobi") {
+		return layoutResponsive
+	}
+	return layoutClassic
+}
+
+// SetLayout stores the page layout picked by the browser and reloads the
+// page, which is laid out again around the new one
+func (h *Handler) SetLayout(c *gin.Context) {
+	name := c.PostForm("layout")
+	if !slices.Contains(layouts, name) {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	c.SetCookie(LayoutCookie, name, 365*24*60*60, "/", "", h.Config.Server.TLS.Enabled(), true)
+	c.Header("HX-Refresh", "true")
+	c.Status(http.StatusNoContent)
+}
+
+// OpenDrawer returns the rooms drawer of the responsive layout, open with
+// the rooms sidebar, and the navbar toggle swapped out of band to close it
+func (h *Handler) OpenDrawer(c *gin.Context) {
+	renderDrawer(c, true)
+}
+
+// CloseDrawer returns the rooms drawer of the responsive layout, closed,
+// and the navbar toggle swapped out of band to open it
+func (h *Handler) CloseDrawer(c *gin.Context) {
+	renderDrawer(c, false)
+}
+
+// renderDrawer renders the rooms drawer and its toggle in a state, the
+// sidebar with the search of the page
+func renderDrawer(c *gin.Context, open bool) {
+	render(c, http.StatusOK, "partials/rooms-drawer.html", gin.H{"open": open, "search": currentSearch(c), "flags": features.FromContext(c)})
+	render(c, http.StatusOK, "partials/drawer-toggle.html", gin.H{"open": open, "oob": true})
+}
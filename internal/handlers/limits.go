@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"htmx/internal/metrics"
+	"htmx/internal/toasts"
+	"net/http"
+)
+
+// renderFormError swaps an error partial into the "<form>-error" slot of the
+// submitted form instead of the form's usual target; errors of single fields
+// are rendered by forms.Render instead
+func renderFormError(c *gin.Context, status int, form, name string, data gin.H) {
+	if message, ok := data["error"].(string); ok {
+		toasts.Add(c, toasts.Error, message)
+	}
+	c.Header("HX-Retarget", "#"+form+"-error")
+	c.Header("HX-Reswap", "innerHTML")
+	render(c, status, name, data)
+}
+
+// bindError returns the status and message for a failed form bind, reporting
+// bodies over the upload limit separately from invalid input
+func (h *Handler) bindError(c *gin.Context, err error, invalid string) (int, string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		metrics.LimitRejections.WithLabelValues("upload_size").Inc()
+		return http.StatusRequestEntityTooLarge, i18n.FromContext(c).T("errors.too_large", "limit", formatBytes(tooLarge.Limit))
+	}
+	return http.StatusBadRequest, invalid
+}
+
+// roomsFull reports whether the room limit has been reached
+func (h *Handler) roomsFull() bool {
+	max := h.Config.Limits.MaxRooms
+	if max > 0 && h.RoomStore.Count() >= max {
+		metrics.LimitRejections.WithLabelValues("rooms").Inc()
+		return true
+	}
+	return false
+}
+
+// roomFull reports whether the message limit of a room has been reached
+func (h *Handler) roomFull(roomID string) bool {
+	max := h.Config.Limits.MaxMessagesPerRoom
+	if max > 0 && h.ChatStore.CountByRoom(roomID) >= max {
+		metrics.LimitRejections.WithLabelValues("messages_per_room").Inc()
+		return true
+	}
+	return false
+}
+
+// hubFull reports whether the WebSocket client limit has been reached
+func (h *Handler) hubFull() bool {
+	max := h.Config.Limits.MaxWSClients
+	if max > 0 && h.Hub.ClientCount() >= max {
+		metrics.LimitRejections.WithLabelValues("ws_clients").Inc()
+		return true
+	}
+	return false
+}
+
+// formatBytes formats a byte count for error messages
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
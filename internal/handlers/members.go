@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/components"
+	"htmx/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// membersShown caps the people listed in the members section of a room
+const membersShown = 50
+
+// The room page lists the people who posted in the room beside the messages
+func init() {
+	components.Register(components.RoomSection, components.Component{Name: "members", Template: "partials/room-members-section.html", Order: 10})
+}
+
+// roomMember is someone who posted in a room
+type roomMember struct {
+	Username   string
+	AvatarURL  string
+	Messages   int
+	LastPosted time.Time
+}
+
+// RoomMembers renders the people who posted in a room, most recent first.
+// The room page loads it once its section is revealed, and again after new
+// messages while it is shown
+func (h *Handler) RoomMembers(c *gin.Context) {
+	roomID := c.Param("id")
+	if _, exists := h.RoomStore.GetRoom(roomID); !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	h.renderCached(c, "partials/room-members.html", []string{roomID}, []string{roomTag(roomID)}, func() gin.H {
+		members := roomMembers(h.ChatStore.GetChatsByRoom(roomID))
+		return gin.H{
+			"members": members[:min(len(members), membersShown)],
+			"more":    max(len(members)-membersShown, 0),
+		}
+	})
+}
+
+// roomMembers returns the people who posted the chats of a room, oldest
+// first, most recently posting first; names differing only in case are the
+// same person, and bots are left out
+func roomMembers(chats []*models.Chat) []*roomMember {
+	var members []*roomMember
+	byName := make(map[string]*roomMember)
+	for i := len(chats) - 1; i >= 0; i-- {
+		chat := chats[i]
+		if chat.Bot {
+			continue
+		}
+		name := strings.ToLower(chat.Username)
+		if member, exists := byName[name]; exists {
+			member.Messages++
+			continue
+		}
+		member := &roomMember{Username: chat.Username, AvatarURL: chat.AvatarURL, Messages: 1, LastPosted: chat.CreatedAt}
+		byName[name] = member
+		members = append(members, member)
+	}
+	return members
+}
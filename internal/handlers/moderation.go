@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// blocked reports whether a blocking filter rule refuses a message someone
+// posts, which is then neither posted nor held
+func (h *Handler) blocked(chat *models.Chat) bool {
+	reason := h.Moderation.Blocked(chat)
+	if reason == "" {
+		return false
+	}
+	metrics.MessagesBlocked.Inc()
+	slog.Info("message blocked", "room", chat.RoomID, "username", chat.Username, "reason", reason)
+	return true
+}
+
+// holdFlagged runs a message someone posts through the moderation filters.
+// A flagged message is held in the queue and announced to the moderators
+// instead of being posted; holdFlagged reports whether it was
+func (h *Handler) holdFlagged(chat *models.Chat, clientID string) bool {
+	reasons := h.Moderation.Check(chat)
+	if len(reasons) == 0 {
+		return false
+	}
+
+	item := &models.FlaggedChat{
+		ID:        uuid.New().String(),
+		Chat:      chat,
+		Held:      true,
+		Reasons:   reasons,
+		ClientID:  clientID,
+		CreatedAt: h.clock.Now(),
+	}
+	h.ModerationQueue.Add(item)
+	metrics.MessagesFlagged.Inc()
+	slog.Info("message held for review", "room", chat.RoomID, "username", chat.Username, "reasons", reasons)
+	h.Hub.broadcast <- HubEvent{Type: models.EventChatFlagged, Flagged: item}
+	return true
+}
+
+// AdminModeration renders the queue of the messages held for review
+func (h *Handler) AdminModeration(c *gin.Context) {
+	// The queue refreshes itself when the hub reports a new message
+	if c.GetHeader("HX-Target") == "moderation-queue" {
+		h.renderModerationQueue(c, http.StatusOK)
+		return
+	}
+
+	data := h.moderationQueue()
+	data["title"] = "Moderation"
+	data["Page"] = "moderation"
+
+	if partial(c) {
+		c.HTML(http.StatusOK, "partials/admin-moderation.html", data)
+		return
+	}
+
+	renderLayout(c, http.StatusOK, "layouts/admin.html", data)
+}
+
+// ModerationBadge renders the number of messages waiting for review, shown
+// next to the Moderation link of the admin navigation
+func (h *Handler) ModerationBadge(c *gin.Context) {
+	c.HTML(http.StatusOK, "partials/admin-moderation-badge.html", gin.H{
+		"queueCount": h.ModerationQueue.Count(),
+	})
+}
+
+// moderationQueue gathers the held messages with the names of their rooms
+func (h *Handler) moderationQueue() gin.H {
+	roomNames := make(map[string]string)
+	h.RoomStore.ForEachRoom(func(room *models.Room) bool {
+		roomNames[room.ID] = room.Name
+		return true
+	})
+	queue := h.ModerationQueue.List()
+	return gin.H{
+		"queue":      queue,
+		"queueCount": len(queue),
+		"roomNames":  roomNames,
+	}
+}
+
+// renderModerationQueue renders the held messages after a review, with the
+// badge of the navigation swapped out of band
+func (h *Handler) renderModerationQueue(c *gin.Context, status int) {
+	data := h.moderationQueue()
+	data["oob"] = c.Request.Method != http.MethodGet
+	c.HTML(status, "partials/admin-moderation-queue.html", data)
+}
+
+// takeFlagged takes a held message out of the queue for a review, answering
+// with an error when another moderator reviewed it first
+func (h *Handler) takeFlagged(c *gin.Context) (*models.FlaggedChat, bool) {
+	item, exists := h.ModerationQueue.Remove(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "This message was already reviewed")
+		h.renderModerationQueue(c, http.StatusNotFound)
+		return nil, false
+	}
+	return item, true
+}
+
+// ApproveFlagged posts a held message into its room, or dismisses the
+// reports of a posted one, which stays
+func (h *Handler) ApproveFlagged(c *gin.Context) {
+	item, ok := h.takeFlagged(c)
+	if !ok {
+		return
+	}
+	if !item.Held {
+		metrics.MessagesReviewed.WithLabelValues("dismissed").Inc()
+		middleware.SetAuditChange(c, item, nil)
+		toasts.Add(c, toasts.Success, "Reports of the message by "+item.Chat.Username+" dismissed")
+		h.renderModerationQueue(c, http.StatusOK)
+		return
+	}
+	if _, exists := h.RoomStore.GetRoom(item.Chat.RoomID); !exists {
+		toasts.Add(c, toasts.Error, "The room of this message was deleted")
+		h.renderModerationQueue(c, http.StatusNotFound)
+		return
+	}
+	if h.roomFull(item.Chat.RoomID) {
+		h.ModerationQueue.Add(item)
+		toasts.Add(c, toasts.Error, "The room has reached its message limit")
+		h.renderModerationQueue(c, http.StatusForbidden)
+		return
+	}
+
+	if err := h.addChatAck(item.Chat, item.ClientID); err != nil {
+		_ = c.Error(err)
+		h.ModerationQueue.Add(item)
+		toasts.Add(c, toasts.Error, "The message could not be posted: "+err.Error())
+		h.renderModerationQueue(c, http.StatusInternalServerError)
+		return
+	}
+	metrics.MessagesReviewed.WithLabelValues("approved").Inc()
+	middleware.SetAuditChange(c, item, item.Chat)
+	toasts.Add(c, toasts.Success, "Message by "+item.Chat.Username+" posted")
+
+	h.renderModerationQueue(c, http.StatusOK)
+}
+
+// DeleteFlagged discards a held message, or deletes a reported one from its
+// room
+func (h *Handler) DeleteFlagged(c *gin.Context) {
+	item, ok := h.takeFlagged(c)
+	if !ok {
+		return
+	}
+	if !item.Held {
+		if _, err := h.ChatStore.DeleteChat(item.Chat.ID); err != nil {
+			_ = c.Error(err)
+			h.ModerationQueue.Add(item)
+			toasts.Add(c, toasts.Error, "The message could not be deleted: "+err.Error())
+			h.renderModerationQueue(c, http.StatusInternalServerError)
+			return
+		}
+	}
+	metrics.MessagesReviewed.WithLabelValues("deleted").Inc()
+	middleware.SetAuditChange(c, item, nil)
+	toasts.Add(c, toasts.Success, "Message by "+item.Chat.Username+" deleted")
+
+	h.renderModerationQueue(c, http.StatusOK)
+}
+
+// BanFlagged bans the name of a queued message from posting, discarding the
+// message along with the others queued for that name; those reported are
+// deleted from their rooms
+func (h *Handler) BanFlagged(c *gin.Context) {
+	item, ok := h.takeFlagged(c)
+	if !ok {
+		return
+	}
+
+	ban := &models.Ban{
+		Username:  item.Chat.Username,
+		Reason:    flaggedReason(item),
+		By:        c.GetString(gin.AuthUserKey),
+		CreatedAt: h.clock.Now(),
+	}
+	h.BanStore.AddBan(ban)
+	discarded := []*models.FlaggedChat{item}
+	for _, other := range h.ModerationQueue.List() {
+		if strings.EqualFold(other.Chat.Username, ban.Username) {
+			if _, exists := h.ModerationQueue.Remove(other.ID); exists {
+				discarded = append(discarded, other)
+			}
+		}
+	}
+	// Reported messages that fail to be deleted go back in the queue
+	var failed error
+	removed := discarded[:0:0]
+	for _, other := range discarded {
+		if !other.Held {
+			if _, err := h.ChatStore.DeleteChat(other.Chat.ID); err != nil {
+				failed = err
+				h.ModerationQueue.Add(other)
+				continue
+			}
+		}
+		removed = append(removed, other)
+	}
+	metrics.MessagesReviewed.WithLabelValues("banned").Add(float64(len(removed)))
+	middleware.SetAuditChange(c, gin.H{"messages": removed}, ban)
+	if failed != nil {
+		_ = c.Error(failed)
+		toasts.Add(c, toasts.Error, ban.Username+" is banned, but some messages could not be deleted: "+failed.Error())
+		h.renderModerationQueue(c, http.StatusInternalServerError)
+		return
+	}
+	toasts.Add(c, toasts.Success, ban.Username+" is banned from posting")
+
+	h.renderModerationQueue(c, http.StatusOK)
+}
+
+// flaggedReason describes why a message is queued, as the reason of a ban:
+// the reasons of the filters, or the reasons it was reported for
+func flaggedReason(item *models.FlaggedChat) string {
+	if item.Held {
+		return strings.Join(item.Reasons, "; ")
+	}
+	var reasons []string
+	for _, report := range item.Reports {
+		if !slices.Contains(reasons, report.Reason) {
+			reasons = append(reasons, report.Reason)
+		}
+	}
+	return "Reported as " + strings.Join(reasons, ", ")
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"net/http"
+)
+
+// notificationCount returns the unread mentions of the browser, shown in
+// the notification badge of the layout
+func (h *Handler) notificationCount(c *gin.Context) int {
+	visitorID := features.VisitorID(c)
+	return h.NotificationStore.Count(visitorID)
+}
+
+// GetNotifications lists the unread mentions of the browser in the
+// notifications dropdown and marks them read, clearing the badge out of
+// band. An admin viewing the site as the visitor leaves them unread
+func (h *Handler) GetNotifications(c *gin.Context) {
+	visitorID := features.VisitorID(c)
+	rooms := h.RoomStore.GetRooms()
+	roomNames := make(map[string]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+
+	if _, impersonating := features.ImpersonationFrom(c); impersonating {
+		render(c, http.StatusOK, "partials/notifications.html", gin.H{
+			"chats":     h.NotificationStore.Unread(visitorID),
+			"roomNames": roomNames,
+		})
+		return
+	}
+	render(c, http.StatusOK, "partials/notifications.html", gin.H{
+		"chats":     h.NotificationStore.MarkRead(visitorID),
+		"roomNames": roomNames,
+	})
+	render(c, http.StatusOK, "partials/notification-badge.html", gin.H{"notifications": 0, "oob": true})
+}
+
+// GetNotificationBadge returns the notification badge for an out-of-band
+// swap, which pages request when the hub tells them of a new mention
+func (h *Handler) GetNotificationBadge(c *gin.Context) {
+	render(c, http.StatusOK, "partials/notification-badge.html", gin.H{"notifications": h.notificationCount(c), "oob": true})
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/emoji"
+	"htmx/internal/models"
+	"htmx/internal/openapi"
+	"htmx/internal/version"
+	"net/http"
+)
+
+// apiRoute pairs a documented operation with its handler
+type apiRoute struct {
+	openapi.Operation
+	handler gin.HandlerFunc
+}
+
+// Response shapes shared by the routes below
+var (
+	htmlOK       = openapi.Response{Status: http.StatusOK, Description: "Rendered HTML partial", ContentType: "text/html"}
+	roomNotFound = openapi.Response{Status: http.StatusNotFound, Description: "Room not found"}
+	formInvalid  = openapi.Response{Status: http.StatusUnprocessableEntity, Description: "Invalid fields, as out-of-band swaps of their error slots", ContentType: "text/html"}
+	formUnread   = openapi.Response{Status: http.StatusBadRequest, Description: "Unreadable form body, as an HTML error partial", ContentType: "text/html"}
+	limitReached = openapi.Response{Status: http.StatusForbidden, Description: "A resource limit was reached, as an HTML error partial", ContentType: "text/html"}
+	bodyTooLarge = openapi.Response{Status: http.StatusRequestEntityTooLarge, Description: "Request body over the upload limit, as an HTML error partial", ContentType: "text/html"}
+	queryInvalid = openapi.Response{Status: http.StatusBadRequest, Description: "Invalid pagination, sort or filter parameter, for JSON requests"}
+)
+
+// pageQuery lists the query parameters shared by the JSON collections
+var pageQuery = []openapi.Field{
+	{Name: "limit", Description: fmt.Sprintf("Page size, %d by default and at most %d", defaultPageSize, maxPageSize)},
+	{Name: "offset", Description: "Number of items to skip"},
+	{Name: "sort", Description: "Sort key, prefixed with - for descending order"},
+	{Name: "fields", Description: "Comma-separated JSON fields to return"},
+}
+
+// apiRoutes is the registry of /api routes; SetupRoutes mounts them and
+// OpenAPI documents them from the same list. The HTML routes used by the
+// front end are unversioned; the JSON API is versioned under /api/v1
+func (h *Handler) apiRoutes() []apiRoute {
+	v1 := h.apiV1Routes()
+	routes := []apiRoute{
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/rooms", Tag: "rooms",
+			Summary:   "List rooms; JSON requests are answered as by GET /api/v1/rooms, deprecated",
+			Query:     []openapi.Field{{Name: "q", Description: "Only rooms whose name contains this text"}},
+			Responses: []openapi.Response{htmlOK},
+		}, h.GetRooms},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/rooms", Tag: "rooms",
+			Summary: "Create a room and return the updated room list",
+			Form: []openapi.Field{
+				{Name: "name", Description: "Room name", Required: true},
+			},
+			Responses: []openapi.Response{htmlOK, formInvalid, formUnread, limitReached, bodyTooLarge},
+		}, h.CreateRoom},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/rooms/:id/chats", Tag: "chats",
+			Summary:   "List the messages of a room; JSON requests are answered as by GET /api/v1/rooms/:id/chats, deprecated",
+			Responses: []openapi.Response{htmlOK, roomNotFound},
+		}, h.GetChats},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/rooms/:id/chats", Tag: "chats",
+			Summary: "Post a message and return it, appended to the message list, or swapped out of band in place of its pending copy when sent optimistically",
+			Form: []openapi.Field{
+				{Name: "username", Description: "Display name of the sender", Required: true},
+				{Name: "message", Description: "Message text", Required: true},
+				{Name: "client_id", Description: "ID of the pending copy shown by the composer, replaced by the stored message or marked failed out of band"},
+			},
+			Responses: []openapi.Response{
+				htmlOK,
+				{Status: http.StatusAccepted, Description: "Held for review by the moderation filters; the pending copy, when sent optimistically, is marked as such out of band", ContentType: "text/html"},
+				roomNotFound, formInvalid, formUnread, limitReached, bodyTooLarge,
+			},
+		}, h.CreateChat},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/rooms/:id/chats/:chatID", Tag: "chats",
+			Summary: "Render a message of a room, as appended to its message list after a new-chat WebSocket message",
+			Responses: []openapi.Response{
+				htmlOK,
+				{Status: http.StatusNotFound, Description: "No such message in the room"},
+			},
+		}, h.GetChat},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/rooms/:id/chats/:chatID/report", Tag: "chats",
+			Summary: "Report a message to the moderators, who review it in the moderation queue; a browser reports a message once",
+			Form: []openapi.Field{
+				{Name: "reason", Description: "Why the message is reported: spam, harassment, offensive or other", Required: true},
+			},
+			Responses: []openapi.Response{
+				htmlOK,
+				{Status: http.StatusBadRequest, Description: "Unknown reason"},
+				{Status: http.StatusNotFound, Description: "No such message in the room"},
+				{Status: http.StatusTooManyRequests, Description: "The client reported too many messages within the hour"},
+			},
+		}, h.ReportChat},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/rooms/:id/members", Tag: "rooms",
+			Summary:   "Render the people who posted in a room, loaded when the members section of the room page is revealed",
+			Responses: []openapi.Response{htmlOK, roomNotFound},
+		}, h.RoomMembers},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/rooms/:id/chat-content", Tag: "chats",
+			Summary:   "Render the full chat panel of a room",
+			Responses: []openapi.Response{htmlOK, roomNotFound},
+		}, h.GetChatContent},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/emoji/search", Tag: "emoji",
+			Summary: "Search the emoji of the picker by name or keyword, as JSON or as the picker's grid",
+			Query: []openapi.Field{
+				{Name: "q", Description: "Words the name or a keyword of the emoji contains; empty returns the picker's sections for HTML requests"},
+				{Name: "target", Description: "ID of the field picked emoji are inserted into"},
+				{Name: "action", Description: "Local URL picked emoji are posted to, /emoji/recent by default"},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The matching emoji, at most 48", ContentType: "application/json", Body: []emoji.Emoji{}},
+				htmlOK,
+				{Status: http.StatusBadRequest, Description: "Invalid target or action"},
+			},
+		}, h.SearchEmoji},
+	}
+	routes = append(routes, v1...)
+	return append(routes, unversioned(v1)...)
+}
+
+// unversionedPaths lists the JSON routes that were served before /api/v1
+// existed. They stay mounted as deprecated aliases; new routes are versioned only
+var unversionedPaths = map[string]bool{
+	"POST /api/webhooks/:token":           true,
+	"POST /api/bots/messages":             true,
+	"POST /api/integrations/alertmanager": true,
+	"GET /api/version":                    true,
+}
+
+// apiV1Routes is the registry of the v1 JSON API
+func (h *Handler) apiV1Routes() []apiRoute {
+	return []apiRoute{
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/v1/rooms", Tag: "rooms",
+			Summary: "List a page of rooms, sortable by name or created_at, with Link and X-Total-Count headers",
+			Query:   append([]openapi.Field{{Name: "q", Description: "Only rooms whose name contains this text"}}, pageQuery...),
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "A page of rooms", ContentType: "application/json", Body: []models.Room{}},
+				queryInvalid,
+			},
+		}, withVersion("v1", h.ListRoomsV1)},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/v1/rooms", Tag: "rooms",
+			Summary: "Create a room",
+			Body:    roomInput{},
+			Responses: []openapi.Response{
+				{Status: http.StatusCreated, Description: "The created room", ContentType: "application/json", Body: models.Room{}},
+				{Status: http.StatusBadRequest, Description: "Missing name"},
+				{Status: http.StatusForbidden, Description: "The room limit was reached"},
+				{Status: http.StatusTooManyRequests, Description: "The user created as many rooms as their weekly quota allows"},
+			},
+		}, withVersion("v1", h.CreateRoomV1)},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/v1/rooms/:id", Tag: "rooms",
+			Summary: "Get a room",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The room", ContentType: "application/json", Body: models.Room{}},
+				roomNotFound,
+			},
+		}, withVersion("v1", h.GetRoomV1)},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/v1/rooms/:id/chats", Tag: "chats",
+			Summary: "List a page of the messages of a room, sortable by created_at or username, with Link and X-Total-Count headers",
+			Query: append([]openapi.Field{
+				{Name: "username", Description: "Only messages by this user"},
+				{Name: "q", Description: "Only messages containing this text"},
+				{Name: "bot", Description: "true or false to keep only bot or only human messages"},
+				{Name: "since", Description: "Only messages posted at or after this RFC 3339 time"},
+				{Name: "until", Description: "Only messages posted before this RFC 3339 time"},
+			}, pageQuery...),
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "A page of messages", ContentType: "application/json", Body: []models.Chat{}},
+				queryInvalid,
+				roomNotFound,
+			},
+		}, withVersion("v1", h.ListChatsV1)},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/v1/rooms/:id/chats", Tag: "chats",
+			Summary: "Post a message",
+			Body:    chatInput{},
+			Responses: []openapi.Response{
+				{Status: http.StatusCreated, Description: "The posted message", ContentType: "application/json", Body: models.Chat{}},
+				{Status: http.StatusAccepted, Description: "The message, held for review by the moderation filters; it is posted if a moderator approves it", ContentType: "application/json", Body: models.Chat{}},
+				{Status: http.StatusBadRequest, Description: "Missing username or message"},
+				{Status: http.StatusForbidden, Description: "The room reached its message limit, the name or address is banned, or the message contains blocked words"},
+				{Status: http.StatusTooManyRequests, Description: "The client posted too many messages within the minute, or the user reached their daily quota of messages or monthly quota of upload bytes"},
+				roomNotFound,
+			},
+		}, withVersion("v1", h.CreateChatV1)},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/v1/webhooks/:token", Tag: "integrations",
+			Summary: "Post a bot message through an incoming webhook: a Slack-compatible message, or any JSON payload when the webhook has a template",
+			Body:    slackMessage{},
+			Form: []openapi.Field{
+				{Name: "payload", Description: "The JSON message, for form-encoded requests", Required: true},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Posted; the body is \"ok\", or \"ignored\" when the template rendered nothing", ContentType: "text/plain"},
+				{Status: http.StatusBadRequest, Description: "invalid_payload or no_text", ContentType: "text/plain"},
+				{Status: http.StatusForbidden, Description: "invalid_token, or room_full when the room reached its message limit", ContentType: "text/plain"},
+				{Status: http.StatusNotFound, Description: "channel_not_found when the room was deleted", ContentType: "text/plain"},
+				{Status: http.StatusUnprocessableEntity, Description: "template_error when the webhook's template failed on the payload", ContentType: "text/plain"},
+				{Status: http.StatusRequestEntityTooLarge, Description: "invalid_payload when the body is over the upload limit", ContentType: "text/plain"},
+			},
+		}, withVersion("v1", h.IncomingWebhook)},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/v1/bots/messages", Tag: "integrations",
+			Summary: "Post a message as a bot, authenticated with an Authorization: Bearer API key",
+			Body:    botMessage{},
+			Responses: []openapi.Response{
+				{Status: http.StatusCreated, Description: "The posted message", ContentType: "application/json", Body: models.Chat{}},
+				{Status: http.StatusBadRequest, Description: "Missing room_id or text"},
+				{Status: http.StatusUnauthorized, Description: "Missing or unknown API key"},
+				{Status: http.StatusForbidden, Description: "The bot is not subscribed to the room, or the room reached its message limit"},
+				roomNotFound,
+			},
+		}, withVersion("v1", h.PostBotMessage)},
+		{openapi.Operation{
+			Method: http.MethodPost, Path: "/api/v1/integrations/alertmanager", Tag: "integrations",
+			Summary: "Receive Alertmanager webhook notifications and post the firing and resolved alerts into a room",
+			Body:    alertmanagerPayload{},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The room and the number of messages posted", ContentType: "application/json", Body: struct {
+					RoomID   string `json:"room_id"`
+					Messages int    `json:"messages"`
+				}{}},
+				{Status: http.StatusBadRequest, Description: "Not an Alertmanager payload"},
+				{Status: http.StatusUnauthorized, Description: "Missing or wrong bearer token, when one is configured"},
+				{Status: http.StatusForbidden, Description: "The room reached its message limit"},
+				{Status: http.StatusNotFound, Description: "No room configured, or it could not be created"},
+			},
+		}, withVersion("v1", h.AlertmanagerWebhook)},
+		{openapi.Operation{
+			Method: http.MethodGet, Path: "/api/v1/version", Tag: "meta",
+			Summary: "Build info of the running binary",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Build info", ContentType: "application/json", Body: version.Info{}},
+			},
+		}, withVersion("v1", h.Version)},
+	}
+}
+
+// OpenAPI serves the OpenAPI document describing the /api routes
+func (h *Handler) OpenAPI(c *gin.Context) {
+	routes := h.apiRoutes()
+	ops := make([]openapi.Operation, len(routes))
+	for i, route := range routes {
+		ops[i] = route.Operation
+	}
+
+	c.JSON(http.StatusOK, openapi.Document(openapi.Info{
+		Title:       "HTMX Chat API",
+		Version:     version.Get().Version,
+		Description: "The unversioned routes are used by the HTMX front end and return HTML partials meant to be swapped into the page. The JSON API for integrations is versioned under /api/v1.",
+	}, ops))
+}
+
+// APIDocs renders the Swagger UI page for the OpenAPI document
+func (h *Handler) APIDocs(c *gin.Context) {
+	c.HTML(http.StatusOK, "layouts/api-docs.html", gin.H{
+		"title": "API Documentation",
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/models"
+	"net/http"
+	"regexp"
+)
+
+// clientIDPattern matches the IDs composers give optimistically sent messages
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// pendingChat is a message the composer shows before the server has stored
+// it, as partials/chat-pending.html with the ID "pending-<client ID>"
+type pendingChat struct {
+	ClientID string
+	RoomID   string
+	Username string
+	Message  string
+}
+
+// newPendingChat returns the pending message of a chat submission; its
+// ClientID is empty when the composer did not send one, or sent an invalid one
+func newPendingChat(c *gin.Context, roomID string) *pendingChat {
+	p := &pendingChat{RoomID: roomID}
+	if id := c.PostForm("client_id"); clientIDPattern.MatchString(id) {
+		p.ClientID = id
+		p.Username = c.PostForm("username")
+		p.Message = c.PostForm("message")
+	}
+	return p
+}
+
+// ack answers the submission with the stored message, swapped out of band
+// in place of the pending one instead of refreshing the whole list
+func (p *pendingChat) ack(c *gin.Context, chat *models.Chat) {
+	c.Header("HX-Reswap", "none")
+	render(c, http.StatusOK, "partials/component-messages-list.html", gin.H{
+		"chats":  []*models.Chat{chat},
+		"roomID": p.RoomID,
+		"ack":    p.ClientID,
+		"flags":  features.FromContext(c),
+	})
+}
+
+// held answers the submission of a message held for review, marking its
+// pending copy as such; it turns into the message if a moderator approves it
+func (p *pendingChat) held(c *gin.Context) {
+	c.Header("HX-Reswap", "none")
+	render(c, http.StatusAccepted, "partials/chat-pending.html", gin.H{
+		"clientID": p.ClientID,
+		"username": p.Username,
+		"message":  p.Message,
+		"held":     true,
+		"oob":      true,
+	})
+}
+
+// failed appends the pending message, marked failed with a retry button, to
+// error responses; CreateChat defers it so every failure reaches the composer
+func (p *pendingChat) failed(c *gin.Context) {
+	if p.ClientID == "" || c.Writer.Status() < http.StatusBadRequest {
+		return
+	}
+	vals, _ := json.Marshal(map[string]string{
+		"username":  p.Username,
+		"message":   p.Message,
+		"client_id": p.ClientID,
+	})
+	render(c, c.Writer.Status(), "partials/chat-pending.html", gin.H{
+		"clientID": p.ClientID,
+		"username": p.Username,
+		"message":  p.Message,
+		"failed":   true,
+		"oob":      true,
+		"retryURL": "/api/rooms/" + p.RoomID + "/chats",
+		"vals":     string(vals),
+	})
+}
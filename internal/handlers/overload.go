@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"htmx/internal/metrics"
+	"htmx/internal/models"
+	"htmx/internal/webhooks"
+	"log/slog"
+	"time"
+)
+
+const (
+	// overloadMinWrites is the fewest writes within an interval whose drops
+	// are judged, so one closed tab among a few clients is no overload
+	overloadMinWrites = 20
+	// overloadKey is the context key of the overload, for the layouts
+	overloadKey = "hubOverload"
+	// hubOverloadedHeader is sent by the pages showing the overload banner,
+	// so they are told when the hub recovered
+	hubOverloadedHeader = "X-Hub-Overloaded"
+)
+
+// hubOverload is an overload of the hub, as the monitor found it
+type hubOverload struct {
+	Since time.Time
+	// Reason is the threshold crossed: "queue_depth" or "drop_percent"
+	Reason      string
+	QueueDepth  int
+	DropPercent float64
+}
+
+// hubAlert is the data of the hub.overloaded and hub.recovered webhook events
+type hubAlert struct {
+	Reason      string    `json:"reason"`
+	QueueDepth  int       `json:"queue_depth"`
+	DropPercent float64   `json:"drop_percent"`
+	Clients     int       `json:"clients"`
+	Since       time.Time `json:"since"`
+	// Seconds is how long the overload lasted, once recovered
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// StartOverloadMonitor checks the pressure on the hub every
+// websocket.overload.interval until ctx is done
+func (h *Handler) StartOverloadMonitor(ctx context.Context) {
+	go func() {
+		for {
+			timer := h.clock.NewTimer(h.Config.WebSocket.Overload.Interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case now := <-timer.C():
+				h.checkOverload(now)
+			}
+		}
+	}()
+}
+
+// checkOverload judges the pressure on the hub since the last check, and
+// alerts when the hub becomes overloaded or recovers. The hub recovers
+// after an interval within both thresholds
+func (h *Handler) checkOverload(now time.Time) {
+	cfg := h.Config.WebSocket.Overload
+	depth, writes, drops := h.Hub.TakePressure()
+	metrics.HubQueueDepth.Set(float64(depth))
+	var percent float64
+	if writes > 0 {
+		percent = 100 * float64(drops) / float64(writes)
+	}
+
+	reason := ""
+	switch {
+	case cfg.QueueDepth > 0 && depth >= cfg.QueueDepth:
+		reason = "queue_depth"
+	case cfg.DropPercent > 0 && writes >= overloadMinWrites && percent >= float64(cfg.DropPercent):
+		reason = "drop_percent"
+	}
+
+	current := h.overload.Load()
+	alert := hubAlert{Reason: reason, QueueDepth: depth, DropPercent: percent, Clients: h.Hub.ClientCount(), Since: now}
+	switch {
+	case reason != "" && current == nil:
+		h.overload.Store(&hubOverload{Since: now, Reason: reason, QueueDepth: depth, DropPercent: percent})
+		metrics.HubOverloaded.Set(1)
+		slog.Warn("hub overloaded", "reason", reason, "queue_depth", depth, "drop_percent", percent, "writes", writes, "clients", alert.Clients)
+		h.Webhooks.Dispatch(webhooks.Event{Type: models.EventHubOverloaded, Data: alert})
+	case reason == "" && current != nil:
+		h.overload.Store(nil)
+		metrics.HubOverloaded.Set(0)
+		alert.Reason, alert.Since = current.Reason, current.Since
+		alert.Seconds = now.Sub(current.Since).Seconds()
+		slog.Info("hub recovered", "reason", current.Reason, "after", now.Sub(current.Since).Round(time.Second))
+		h.Webhooks.Dispatch(webhooks.Event{Type: models.EventHubRecovered, Data: alert})
+	}
+}
+
+// signalOverload tells htmx requests that the hub is overloaded with the
+// hub:status event, which shows the banner of the layout, and the pages
+// showing it when the hub recovered
+func (h *Handler) signalOverload(c *gin.Context) {
+	overload := h.overload.Load()
+	if overload != nil {
+		c.Set(overloadKey, overload)
+	}
+	if c.GetHeader("HX-Request") != "" && (overload != nil || c.GetHeader(hubOverloadedHeader) != "") {
+		trigger(c, eventHubStatus, gin.H{
+			"overloaded": overload != nil,
+			"message":    i18n.FromContext(c).T("nav.overloaded"),
+		})
+	}
+	c.Next()
+}
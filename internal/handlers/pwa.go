@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/branding"
+	"htmx/static"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// appIcons caches the generated app icons by file name, as the branding
+// they are drawn from does not change while the server runs
+var appIcons sync.Map
+
+// Manifest serves the web app manifest that makes the chat installable
+func (h *Handler) Manifest(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/manifest+json", branding.Manifest(h.Config.Branding))
+}
+
+// AppIcon serves the app icons of the manifest, icon-<size>.png and
+// maskable-<size>.png
+func (h *Handler) AppIcon(c *gin.Context) {
+	name := c.Param("name")
+	kind, rest, _ := strings.Cut(name, "-")
+	size, err := strconv.Atoi(strings.TrimSuffix(rest, ".png"))
+	if (kind != "icon" && kind != "maskable") || !strings.HasSuffix(rest, ".png") || err != nil || !slices.Contains(branding.IconSizes, size) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	icon, ok := appIcons.Load(name)
+	if !ok {
+		icon, _ = appIcons.LoadOrStore(name, branding.Icon(h.Config.Branding, size, kind == "maskable"))
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/png", icon.([]byte))
+}
+
+// ServiceWorker serves static/js/sw.js at the root of the site, the scope
+// a service worker controls being the path it is served from
+func (h *Handler) ServiceWorker(c *gin.Context) {
+	var script []byte
+	var err error
+	if h.Config.Dev {
+		script, err = os.ReadFile("static/js/sw.js")
+	} else {
+		script, err = static.FS.ReadFile("js/sw.js")
+	}
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	// The worker precaches the fingerprinted URLs the pages use
+	if h.Assets != nil {
+		script = h.Assets.Rewrite(script)
+	}
+	// Browsers check for a new worker on every navigation
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "text/javascript; charset=utf-8", script)
+}
+
+// Offline renders the page the service worker shows for pages that cannot
+// be loaded without a connection
+func (h *Handler) Offline(c *gin.Context) {
+	renderLayout(c, http.StatusOK, "layouts/offline.html", gin.H{
+		"title": h.Config.Branding.Name,
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/i18n"
+	"htmx/internal/metrics"
+	"htmx/internal/models"
+	"net/http"
+	"time"
+)
+
+// quotas lists the quotas in the order the settings page shows them
+var quotas = []string{models.QuotaMessages, models.QuotaRooms, models.QuotaUploadBytes}
+
+// quotaUsage is a user's usage of a quota, as the settings page shows it
+type quotaUsage struct {
+	Quota string
+	Used  string
+	// Limit is "" for a quota without a limit
+	Limit   string
+	Percent int64
+	Resets  time.Time
+}
+
+// quotaUser returns who the quotas of a request count against: the browser,
+// by its visitor ID, or else the client IP, as there are no accounts
+func quotaUser(c *gin.Context) string {
+	if visitorID := features.VisitorID(c); visitorID != "" {
+		return visitorID
+	}
+	return ipQuotaUser(c.ClientIP())
+}
+
+// ipQuotaUser returns who the quotas of a client without a visitor ID count
+// against, such as an IRC client
+func ipQuotaUser(ip string) string {
+	return "ip:" + ip
+}
+
+// quotaPeriod returns when the current period of a quota started and when
+// the next starts, in the server's time zone: the day of the messages, the
+// week from Monday of the rooms and the month of the upload bytes
+func quotaPeriod(quota string, now time.Time) (time.Time, time.Time) {
+	now = now.Local()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch quota {
+	case models.QuotaRooms:
+		week := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return week, week.AddDate(0, 0, 7)
+	case models.QuotaUploadBytes:
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		return month, month.AddDate(0, 1, 0)
+	}
+	return day, day.AddDate(0, 0, 1)
+}
+
+// quotaLimit returns the configured limit of a quota, 0 for none
+func (h *Handler) quotaLimit(quota string) int64 {
+	switch quota {
+	case models.QuotaMessages:
+		return int64(h.Config.Quotas.MessagesPerDay)
+	case models.QuotaRooms:
+		return int64(h.Config.Quotas.RoomsPerWeek)
+	case models.QuotaUploadBytes:
+		return int64(h.Config.Quotas.UploadBytesPerMonth)
+	}
+	return 0
+}
+
+// quotaUse returns a use of an amount of a quota in its current period
+func (h *Handler) quotaUse(quota string, amount int64) models.QuotaUse {
+	period, _ := quotaPeriod(quota, h.clock.Now())
+	return models.QuotaUse{Quota: quota, Period: period, Amount: amount, Limit: h.quotaLimit(quota)}
+}
+
+// overQuota records the uses of a user's quotas, returning the quota one of
+// them would go over, with none recorded, or "" when they are within them
+func (h *Handler) overQuota(user string, uses ...models.QuotaUse) string {
+	quota := h.Quotas.Use(user, uses...)
+	if quota != "" {
+		metrics.LimitRejections.WithLabelValues("quota_" + quota).Inc()
+	}
+	return quota
+}
+
+// overPostQuota records a message a user posts against their quotas of
+// messages and upload bytes, returning the quota it would go over
+func (h *Handler) overPostQuota(user, message string) string {
+	return h.overQuota(user, h.quotaUse(models.QuotaMessages, 1), h.quotaUse(models.QuotaUploadBytes, int64(len(message))))
+}
+
+// quotaError returns the message refusing what would go over a quota
+func (h *Handler) quotaError(locale *i18n.Locale, quota string) string {
+	limit := h.quotaLimit(quota)
+	if quota == models.QuotaUploadBytes {
+		return locale.T("errors.quota_upload_bytes", "limit", formatBytes(limit))
+	}
+	return locale.N("errors.quota_"+quota, int(limit))
+}
+
+// quotaErrorJSON returns the error of the JSON API, also replied by IRC,
+// refusing what would go over a quota
+func (h *Handler) quotaErrorJSON(quota string) string {
+	limit := h.quotaLimit(quota)
+	switch quota {
+	case models.QuotaRooms:
+		return fmt.Sprintf("the quota of %d rooms per week has been reached", limit)
+	case models.QuotaUploadBytes:
+		return fmt.Sprintf("the quota of %s of messages per month has been reached", formatBytes(limit))
+	}
+	return fmt.Sprintf("the quota of %d messages per day has been reached", limit)
+}
+
+// quotaUsages returns the usage of each quota of the user of a request
+func (h *Handler) quotaUsages(c *gin.Context) []quotaUsage {
+	user := quotaUser(c)
+	now := h.clock.Now()
+	usages := make([]quotaUsage, 0, len(quotas))
+	for _, quota := range quotas {
+		period, next := quotaPeriod(quota, now)
+		used, limit := h.Quotas.Used(user, quota, period), h.quotaLimit(quota)
+		usage := quotaUsage{Quota: quota, Used: formatAmount(quota, used), Resets: next}
+		if limit > 0 {
+			usage.Limit = formatAmount(quota, limit)
+			usage.Percent = min(100, used*100/limit)
+		}
+		usages = append(usages, usage)
+	}
+	return usages
+}
+
+// formatAmount formats an amount of a quota, the upload bytes in the largest
+// unit they reach, rounded unless they are whole
+func formatAmount(quota string, n int64) string {
+	if quota != models.QuotaUploadBytes {
+		return fmt.Sprint(n)
+	}
+	switch {
+	case n%(1<<10) == 0:
+		return formatBytes(n)
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// Settings renders the settings page of the browser, with its usage of the
+// quotas
+func (h *Handler) Settings(c *gin.Context) {
+	title := i18n.FromContext(c).T("settings.title")
+	crumbs := breadcrumbs(c, breadcrumb{Label: title, URL: "/settings"})
+	data := gin.H{
+		"title":         title,
+		"rooms":         h.RoomStore.GetRooms(), // For sidebar
+		"usage":         h.quotaUsages(c),
+		"flags":         features.FromContext(c),
+		"Page":          "settings",
+		"notifications": h.notificationCount(c),
+		"breadcrumbs":   crumbs,
+		"search":        pageSearch(c),
+	}
+
+	if partial(c) {
+		navigated(c, title, crumbs)
+		render(c, http.StatusOK, "partials/settings-page.html", data)
+		return
+	}
+
+	renderLayout(c, http.StatusOK, "layouts/base.html", data)
+}
+
+// GetUsage renders the usage of the quotas, which the settings page
+// refreshes while open, as the browser may post from other tabs
+func (h *Handler) GetUsage(c *gin.Context) {
+	render(c, http.StatusOK, "partials/quota-usage.html", gin.H{"usage": h.quotaUsages(c)})
+}
@@ -0,0 +1,122 @@
+package handlers_test
+
+import (
+	"html"
+	"htmx/internal/models"
+	"htmx/internal/sanitize"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// markup counts the characters that delimit tags and attribute values,
+// which text rendered into a page must never add
+func markup(s string) int {
+	return strings.Count(s, "<") + strings.Count(s, ">") + strings.Count(s, `"`) + strings.Count(s, "'")
+}
+
+func FuzzRenderChat(f *testing.F) {
+	f.Add("alice", "hello")
+	f.Add(`"><script>alert(1)</script>`, `<img src=x onerror="alert(1)">`)
+	f.Add("' onmouseover='alert(1)", `<a href="javascript:alert(1)">link</a>`)
+	f.Add("</p><p>", "</article><script>alert(1)</script>")
+	f.Add("\u202eevil", "{{ .locale }}\r\n<!--")
+
+	srv := testutil.NewServer(f, nil)
+	render := func(t testing.TB, username, message string) string {
+		t.Helper()
+		chat := &models.Chat{ID: "c1", RoomID: "r1", Username: username, Message: message, CreatedAt: time.Now()}
+		page, err := srv.Execute("partials/component-messages-list.html", map[string]any{"chats": []*models.Chat{chat}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+	want := markup(render(f, "alice", "hello"))
+
+	f.Fuzz(func(t *testing.T, username, message string) {
+		username = sanitize.Name(username)
+		message = sanitize.Message(message)
+		if username == "" || message == "" {
+			t.Skip("rejected by the form")
+		}
+		page := render(t, username, message)
+		if got := markup(page); got != want {
+			t.Fatalf("username %q and message %q changed the markup:\n%s", username, message, page)
+		}
+		// The message is shown as it was typed
+		_, text, _ := strings.Cut(page, "data-message>")
+		text, _, _ = strings.Cut(text, "</p>")
+		if got := html.UnescapeString(text); got != message {
+			t.Errorf("message %q renders as %q", message, got)
+		}
+	})
+}
+
+func FuzzRenderRoom(f *testing.F) {
+	f.Add("General")
+	f.Add(`"><script>alert(1)</script>`)
+	f.Add("javascript:alert(1)")
+	f.Add("</a><a href=//evil.example>")
+
+	srv := testutil.NewServer(f, nil)
+	render := func(t testing.TB, name string) string {
+		t.Helper()
+		room := &models.Room{ID: "r1", Name: name, CreatedAt: time.Now()}
+		page, err := srv.Execute("partials/component-rooms-list.html", map[string]any{
+			"rooms":  []*models.Room{room},
+			"counts": map[string]int{room.ID: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+	want := markup(render(f, "General"))
+
+	f.Fuzz(func(t *testing.T, name string) {
+		name = sanitize.Name(name)
+		if name == "" {
+			t.Skip("rejected by the form")
+		}
+		if page := render(t, name); markup(page) != want {
+			t.Fatalf("room name %q changed the markup:\n%s", name, page)
+		}
+	})
+}
+
+func BenchmarkRenderMessages(b *testing.B) {
+	srv := testutil.NewServer(b, nil)
+	room := srv.Stores.SeedRoom("General")
+	for i := range 50 {
+		srv.Stores.SeedChat(room.ID, "alice", strings.Repeat("message ", i%10+1))
+	}
+	router := srv.Server.Config.Handler
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms/"+room.ID+"/chats", nil)
+	req.Header.Set("HX-Request", "true")
+
+	// A miss renders the list into a pooled buffer, a hit copies it from
+	// the render cache
+	for _, cached := range []bool{false, true} {
+		name := "miss"
+		if cached {
+			name = "hit"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if !cached {
+					srv.Handler.RenderCache.Invalidate("room:" + room.ID)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status = %d", w.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/bufpool"
+	"htmx/internal/i18n"
+	"htmx/internal/metrics"
+	"net/http"
+	"strings"
+)
+
+// renderCacheEntries caps the partials kept by the render cache
+const renderCacheEntries = 1024
+
+// cacheTagRooms tags the cached partials that show every room, such as the
+// rooms list with its message counts
+const cacheTagRooms = "rooms"
+
+// roomTag tags the cached partials that show a room or its messages
+func roomTag(roomID string) string {
+	return "room:" + roomID
+}
+
+// invalidateRoom drops the cached partials showing a room, once the room or
+// its messages changed. The stores call it on every change
+func (h *Handler) invalidateRoom(roomID string) {
+	h.RenderCache.Invalidate(cacheTagRooms, roomTag(roomID))
+}
+
+// renderCached renders a partial like render, copied from the render cache
+// when it was rendered before with the same key in the same locale and
+// nothing tagged changed since. data is only called on a miss, so the
+// stores are not read for cached partials. Dev mode renders every time, as
+// the templates reload
+func (h *Handler) renderCached(c *gin.Context, name string, key []string, tags []string, data func() gin.H) {
+	if h.Config.Dev {
+		render(c, http.StatusOK, name, data())
+		return
+	}
+
+	locale := i18n.FromContext(c)
+	cacheKey := strings.Join(append([]string{name, locale.Tag}, key...), "\x00")
+	if body, ok := h.RenderCache.Get(cacheKey); ok {
+		metrics.RenderCacheLookups.WithLabelValues(name, "hit").Inc()
+		c.Data(http.StatusOK, "text/html; charset=utf-8", body)
+		return
+	}
+	metrics.RenderCacheLookups.WithLabelValues(name, "miss").Inc()
+
+	generation := h.RenderCache.Generation()
+	d := data()
+	d["locale"] = locale
+	buf := &renderBuffer{Buffer: bufpool.Get(), header: http.Header{}}
+	defer bufpool.Put(buf.Buffer)
+	if err := h.router.HTMLRender.Instance(name, d).Render(buf); err != nil {
+		_ = c.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// The cache keeps a copy sized to the render, the buffer goes back to
+	// the pool
+	body := bytes.Clone(buf.Bytes())
+	h.RenderCache.Set(cacheKey, body, generation, tags...)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", body)
+}
+
+// renderBuffer is a response writer that keeps a render in memory, in a
+// pooled buffer
+type renderBuffer struct {
+	*bytes.Buffer
+	header http.Header
+}
+
+// Header returns the headers set by the render, which are dropped
+func (b *renderBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader ignores the status, which renders do not set
+func (b *renderBuffer) WriteHeader(int) {}
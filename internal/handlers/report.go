@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/components"
+	"htmx/internal/features"
+	"htmx/internal/i18n"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+func init() {
+	components.Register(components.MessageFooter, components.Component{Name: "report", Template: "partials/chat-report.html", Order: 90})
+}
+
+// ReportChat records a visitor's report of a message, queueing the message
+// for review along with its earlier reports. Each client may report
+// moderation.reports_per_hour messages an hour
+func (h *Handler) ReportChat(c *gin.Context) {
+	locale := i18n.FromContext(c)
+	chat, exists := h.ChatStore.GetChat(c.Param("chatID"))
+	if !exists || chat.RoomID != c.Param("id") {
+		toasts.Add(c, toasts.Error, locale.T("errors.chat_gone"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+	reason := c.PostForm("reason")
+	if !slices.Contains(models.ReportReasons, reason) {
+		toasts.Add(c, toasts.Error, locale.T("errors.invalid_form"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if h.overLimit(c.ClientIP(), h.reportLimiter, "reports") {
+		toasts.Add(c, toasts.Error, locale.T("errors.report_limit"))
+		c.Status(http.StatusTooManyRequests)
+		return
+	}
+
+	visitorID := features.VisitorID(c)
+	report := &models.Report{
+		Reason:    reason,
+		Reporter:  h.NotificationStore.Name(visitorID),
+		VisitorID: visitorID,
+		CreatedAt: h.clock.Now(),
+	}
+	if report.Reporter != "" {
+		middleware.SetAuditActor(c, report.Reporter)
+	}
+	if item, added := h.ModerationQueue.AddReport(chat, report); added {
+		metrics.MessagesReported.WithLabelValues(reason).Inc()
+		slog.Info("message reported", "room", chat.RoomID, "chat", chat.ID, "reason", reason)
+		middleware.SetAuditChange(c, nil, report)
+		h.Hub.broadcast <- HubEvent{Type: models.EventChatFlagged, Flagged: item}
+	}
+
+	toasts.Add(c, toasts.Success, locale.T("toasts.message_reported"))
+	render(c, http.StatusOK, "partials/chat-reported.html", gin.H{})
+}
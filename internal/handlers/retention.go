@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/metrics"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// purge deletes the messages and audit entries older than their retention,
+// returning the error of a store that fails to delete the messages
+func (h *Handler) purge(now time.Time) error {
+	settings := h.SettingsStore.Get()
+	var err error
+	if days := settings.MessageRetentionDays; days > 0 {
+		var n int
+		if n, err = h.ChatStore.DeleteChatsBefore(now.AddDate(0, 0, -days)); n > 0 {
+			metrics.RetentionPurged.WithLabelValues("messages").Add(float64(n))
+			slog.Info("purged old messages", "count", n, "days", days)
+		}
+	}
+	if days := settings.AuditRetentionDays; days > 0 {
+		if n := h.AuditStore.DeleteEntriesBefore(now.AddDate(0, 0, -days)); n > 0 {
+			metrics.RetentionPurged.WithLabelValues("audit").Add(float64(n))
+			slog.Info("purged old audit entries", "count", n, "days", days)
+		}
+	}
+	return err
+}
+
+// AdminSettings renders the settings changed at runtime
+func (h *Handler) AdminSettings(c *gin.Context) {
+	h.renderAdminSettings(c, http.StatusOK, "")
+}
+
+// UpdateSettings changes the settings, purging the data past the new
+// retention at once
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	var input struct {
+		MessageRetentionDays *int `form:"message_retention_days" binding:"required,min=0"`
+		AuditRetentionDays   *int `form:"audit_retention_days" binding:"required,min=0"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminSettings(c, http.StatusBadRequest, "Retention must be a number of days, 0 or more")
+		return
+	}
+
+	settings := models.Settings{
+		MessageRetentionDays: *input.MessageRetentionDays,
+		AuditRetentionDays:   *input.AuditRetentionDays,
+		UpdatedBy:            c.GetString(gin.AuthUserKey),
+		UpdatedAt:            h.clock.Now(),
+	}
+	before := h.SettingsStore.Set(settings)
+	middleware.SetAuditChange(c, before, settings)
+	slog.Info("settings changed", "message_retention_days", settings.MessageRetentionDays, "audit_retention_days", settings.AuditRetentionDays, "by", settings.UpdatedBy)
+	if err := h.purge(settings.UpdatedAt); err != nil {
+		_ = c.Error(err)
+		h.renderAdminSettings(c, http.StatusInternalServerError, "Settings saved, but the old messages could not be purged: "+err.Error())
+		return
+	}
+	toasts.Add(c, toasts.Success, "Settings saved")
+
+	h.renderAdminSettings(c, http.StatusOK, "")
+}
+
+// renderAdminSettings renders the settings page with an optional form error
+func (h *Handler) renderAdminSettings(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	data := gin.H{
+		"title":    "Settings",
+		"settings": h.SettingsStore.Get(),
+		"interval": h.Config.Retention.Interval,
+		"error":    errMsg,
+		"Page":     "settings",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-settings.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
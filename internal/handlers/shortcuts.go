@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/forms"
+	"htmx/internal/i18n"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// keyPattern matches the keys of a binding, see models.Keymap
+var keyPattern = regexp.MustCompile(`^(ctrl\+)?(alt\+)?(shift\+)?(meta\+)?([a-z0-9]|[[:punct:]]|f[1-9]|f1[0-2]|arrow(up|down|left|right)|enter|escape|space|tab|home|end|pageup|pagedown|backspace|delete)$`)
+
+// keymap returns the keyboard shortcuts of the browser, which are kept by
+// the visitor ID of the feature flag rollouts
+func (h *Handler) keymap(c *gin.Context) models.Keymap {
+	visitorID := features.VisitorID(c)
+	return h.ShortcutStore.GetKeymap(visitorID)
+}
+
+// GetShortcuts returns the keyboard shortcuts of the browser as JSON for
+// static/js/shortcuts.js, and as the help overlay for htmx
+func (h *Handler) GetShortcuts(c *gin.Context) {
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, h.keymap(c))
+		return
+	}
+	h.renderShortcuts(c, h.keymap(c))
+}
+
+// SaveShortcuts stores the keyboard shortcuts edited in the help overlay
+func (h *Handler) SaveShortcuts(c *gin.Context) {
+	visitorID := features.VisitorID(c)
+	if visitorID == "" {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		SearchRooms string `form:"search_rooms" label:"shortcuts.search_rooms" binding:"required"`
+		NextUnread  string `form:"next_unread" label:"shortcuts.next_unread" binding:"required"`
+		EditLast    string `form:"edit_last" label:"shortcuts.edit_last" binding:"required"`
+		Help        string `form:"help" label:"shortcuts.help" binding:"required"`
+	}
+
+	form := forms.ID(c, "shortcuts-form")
+	invalid, err := forms.Bind(c, &input)
+	if err != nil {
+		status, message := h.bindError(c, err, i18n.FromContext(c).T("errors.invalid_form"))
+		toasts.Add(c, toasts.Error, message)
+		c.Status(status)
+		return
+	}
+	if invalid == nil {
+		invalid = forms.Errors{}
+	}
+
+	keymap := models.Keymap{
+		models.ShortcutSearchRooms: input.SearchRooms,
+		models.ShortcutNextUnread:  input.NextUnread,
+		models.ShortcutEditLast:    input.EditLast,
+		models.ShortcutHelp:        input.Help,
+	}
+	locale := i18n.FromContext(c)
+	boundTo := make(map[string]string, len(keymap))
+	for _, action := range models.ShortcutActions {
+		key := strings.ToLower(strings.TrimSpace(keymap[action]))
+		keymap[action] = key
+		if _, failed := invalid[action]; failed {
+			continue
+		}
+		if !keyPattern.MatchString(key) {
+			invalid[action] = locale.T("shortcuts.invalid_key")
+		} else if other, taken := boundTo[key]; taken {
+			invalid[action] = locale.T("shortcuts.duplicate", "action", locale.T("shortcuts."+other))
+		} else {
+			boundTo[key] = action
+		}
+	}
+	if len(invalid) > 0 {
+		forms.Render(c, form, &input, invalid)
+		return
+	}
+
+	h.ShortcutStore.SetKeymap(visitorID, keymap)
+	trigger(c, eventShortcutsChanged, keymap)
+	toasts.Add(c, toasts.Success, locale.T("toasts.shortcuts_saved"))
+	h.renderShortcuts(c, keymap)
+}
+
+// ResetShortcuts restores the default keyboard shortcuts of the browser
+func (h *Handler) ResetShortcuts(c *gin.Context) {
+	visitorID := features.VisitorID(c)
+	h.ShortcutStore.ResetKeymap(visitorID)
+
+	keymap := models.DefaultKeymap()
+	trigger(c, eventShortcutsChanged, keymap)
+	toasts.Add(c, toasts.Info, i18n.FromContext(c).T("toasts.shortcuts_reset"))
+	h.renderShortcuts(c, keymap)
+}
+
+// renderShortcuts renders the help overlay listing the bindings of keymap
+func (h *Handler) renderShortcuts(c *gin.Context, keymap models.Keymap) {
+	render(c, http.StatusOK, "partials/shortcuts-help.html", gin.H{
+		"actions": models.ShortcutActions,
+		"keymap":  keymap,
+	})
+}
@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"htmx/internal/testutil"
+	"net/http"
+	"testing"
+)
+
+// TestSnapshots compares the pages and partials of a room with two messages,
+// of an empty room and of missing ones with their golden files in
+// testdata/snapshots; run go test ./internal/handlers -run TestSnapshots
+// -update to accept a change of the markup
+func TestSnapshots(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	srv.Stores.SeedChats(room.ID, "alice", "Hello, everyone!", "Is anyone <here>?")
+	empty := srv.Stores.SeedRoom("Quiet")
+
+	tests := []struct {
+		name   string
+		path   string
+		htmx   bool
+		status int
+	}{
+		{"pages/home", "/", false, http.StatusOK},
+		{"pages/room", "/rooms/" + room.ID, false, http.StatusOK},
+		{"pages/not-found", "/no-such-page", false, http.StatusNotFound},
+		{"partials/rooms-list", "/api/rooms", true, http.StatusOK},
+		{"partials/messages-list", "/api/rooms/" + room.ID + "/chats", true, http.StatusOK},
+		{"partials/messages-empty", "/api/rooms/" + empty.ID + "/chats", true, http.StatusOK},
+		{"partials/chat-content", "/api/rooms/" + room.ID + "/chat-content", true, http.StatusOK},
+		{"partials/room-gone", "/api/rooms/missing/chats", true, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			get := srv.Get
+			if tt.htmx {
+				get = srv.HXGet
+			}
+			res, body := get(tt.path)
+			if res.StatusCode != tt.status {
+				t.Fatalf("GET %s: status %d, want %d", tt.path, res.StatusCode, tt.status)
+			}
+			testutil.AssertSnapshot(t, tt.name, body)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package handlers_test
+
+import (
+	"errors"
+	"htmx/internal/models"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingChats is a chat store whose writes fail, as a database gone away
+type failingChats struct {
+	models.ChatRepository
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (failingChats) AddChat(*models.Chat) error {
+	return errDiskFull
+}
+
+func TestCreateChatStoreFailure(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	ws := srv.DialWS("/ws", nil)
+	ws.View(room.ID)
+
+	chats := srv.Handler.ChatStore
+	srv.Handler.ChatStore = failingChats{chats}
+	form := url.Values{"username": {"alice"}, "message": {"lost"}}
+	res, body := srv.HXPost("/api/rooms/"+room.ID+"/chats", form)
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", res.StatusCode)
+	}
+	testutil.AssertHTML(t, body, "Something went wrong on our side")
+	// Nobody is told of a message that was not saved
+	ws.ExpectNone("new-chat", 200*time.Millisecond)
+	if n := chats.Count(); n != 0 {
+		t.Errorf("Count after a failed write = %d, want 0", n)
+	}
+
+	// Once the store saves again, so does the form
+	srv.Handler.ChatStore = chats
+	form.Set("message", "saved")
+	if res, _ := srv.HXPost("/api/rooms/"+room.ID+"/chats", form); res.StatusCode != http.StatusOK {
+		t.Fatalf("status once the store recovered = %d, want 200", res.StatusCode)
+	}
+	ws.Expect("new-chat")
+}
+
+func TestCreateChatV1StoreFailure(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	srv.Handler.ChatStore = failingChats{srv.Handler.ChatStore}
+
+	req := srv.NewRequest(http.MethodPost, "/api/v1/rooms/"+room.ID+"/chats", strings.NewReader(`{"username":"alice","message":"lost"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, body := srv.Do(req)
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500: %s", res.StatusCode, body)
+	}
+	testutil.AssertHTML(t, body, `"error":"the change could not be saved"`)
+}
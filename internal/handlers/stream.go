@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// streamFlushInterval is how long a streamed render writes before what it
+// wrote so far is flushed to the browser
+const streamFlushInterval = 50 * time.Millisecond
+
+// flushingWriter is a response writer that flushes what a render wrote at
+// least every streamFlushInterval. Responses without a length are sent in
+// chunks, so the browser paints the start of a long page, and loads its
+// styles, while the rest renders
+type flushingWriter struct {
+	gin.ResponseWriter
+	flushed time.Time
+}
+
+// Write writes to the response, flushing it when the interval passed
+func (w *flushingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if time.Since(w.flushed) >= streamFlushInterval {
+		w.Flush()
+	}
+	return n, err
+}
+
+// WriteString writes to the response as Write does
+func (w *flushingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what was written so far to the browser
+func (w *flushingWriter) Flush() {
+	w.ResponseWriter.Flush()
+	w.flushed = time.Now()
+}
+
+// stream renders a template like render, flushing the response as the
+// template writes it. The status and headers are sent with the first
+// flush, so a template failing halfway leaves the page cut short rather
+// than turning it into an error page. Data can also flush the response
+// itself through c.Writer, such as between the sections of a page
+func stream(c *gin.Context, status int, name string, data gin.H) {
+	w := &flushingWriter{ResponseWriter: c.Writer, flushed: time.Now()}
+	c.Writer = w
+	defer func() {
+		c.Writer = w.ResponseWriter
+	}()
+	render(c, status, name, data)
+}
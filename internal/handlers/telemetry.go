@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/telemetry"
+	"htmx/internal/version"
+	"net/http"
+)
+
+// telemetryReport gathers the anonymous usage statistics sent next
+func (h *Handler) telemetryReport() telemetry.Report {
+	info := version.Get()
+	return telemetry.Report{
+		Instance:    h.telemetryID,
+		Version:     info.Version,
+		GoVersion:   info.GoVersion,
+		Platform:    info.Platform,
+		Store:       h.Config.Store.Backend,
+		Rooms:       telemetry.Round(h.RoomStore.Count()),
+		Messages:    telemetry.Round(h.ChatStore.Count()),
+		Connections: telemetry.Round(h.Hub.ClientCount()),
+		Features:    h.telemetryFeatures(),
+	}
+}
+
+// telemetryFeatures lists the optional features turned on, by name only,
+// never with their settings
+func (h *Handler) telemetryFeatures() []string {
+	cfg := h.Config
+	optional := []struct {
+		name string
+		on   bool
+	}{
+		{"tls", cfg.Server.TLS.Enabled()},
+		{"autocert", cfg.Server.TLS.Autocert.Enabled},
+		{"admin_listener", cfg.Admin.Addr != ""},
+		{"grpc", cfg.GRPC.Addr != ""},
+		{"irc", cfg.IRC.Addr != ""},
+		{"federation", cfg.Federation.Enabled},
+		{"compression", cfg.Compression.Enabled},
+		{"error_reporting", cfg.Errors.DSN != ""},
+		{"memory_budget", cfg.Store.MemoryBudget > 0},
+		{"retention", cfg.Retention.MessageDays > 0 || cfg.Retention.AuditDays > 0},
+		{"backups", cfg.Jobs.Backup.Dir != "" && cfg.Jobs.Backup.Schedule != ""},
+		{"alertmanager", cfg.Integrations.Alertmanager.Room != ""},
+		{"embed", len(cfg.Embed.AllowedOrigins) > 0},
+		{"webhooks", len(h.WebhookStore.GetWebhooks()) > 0},
+		{"bots", len(h.BotStore.GetBots()) > 0},
+		{"demo", cfg.Demo.Enabled},
+	}
+	features := []string{}
+	for _, feature := range optional {
+		if feature.on {
+			features = append(features, feature.name)
+		}
+	}
+	return features
+}
+
+// sendTelemetry sends the usage statistics, the job of telemetry.interval
+func (h *Handler) sendTelemetry(ctx context.Context) error {
+	return telemetry.Send(ctx, telemetry.Endpoint(h.Config.Telemetry.Endpoint), h.telemetryReport())
+}
+
+// TelemetryReport shows the report telemetry sends next, exactly as sent,
+// and where it goes
+func (h *Handler) TelemetryReport(c *gin.Context) {
+	cfg := h.Config.Telemetry
+	endpoint := telemetry.Endpoint(cfg.Endpoint)
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"enabled":  cfg.Enabled && endpoint != "",
+		"endpoint": endpoint,
+		"interval": cfg.Interval.String(),
+		"report":   h.telemetryReport(),
+	})
+}
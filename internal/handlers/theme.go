@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/features"
+	"htmx/internal/i18n"
+	"net/http"
+	"slices"
+)
+
+// ThemeCookie holds the DaisyUI theme picked by the browser
+const ThemeCookie = "theme"
+
+// defaultTheme is used until a browser picks a theme
+const defaultTheme = "dark"
+
+// themes lists the themes offered by the layouts; darkThemes are the ones
+// the dark mode toggle switches away from
+var (
+	themes     = []string{"light", "dark", "cupcake", "emerald", "corporate", "synthwave", "cyberpunk"}
+	darkThemes = []string{"dark", "synthwave"}
+)
+
+// theme returns the theme picked by the browser
+func theme(c *gin.Context) string {
+	if name, err := c.Cookie(ThemeCookie); err == nil && slices.Contains(themes, name) {
+		return name
+	}
+	return defaultTheme
+}
+
+// renderLayout renders a full page, applying the browser's theme on the
+// server so the page does not flash in the wrong one, in the browser's layout
+func renderLayout(c *gin.Context, status int, name string, data gin.H) {
+	if _, ok := data["theme"]; !ok {
+		data["theme"] = theme(c)
+	}
+	data["themes"] = themes
+	data["locales"] = i18n.Locales()
+	data["layout"] = layout(c)
+	if impersonation, ok := features.ImpersonationFrom(c); ok {
+		data["impersonation"] = impersonation
+	}
+	if overload, ok := c.Get(overloadKey); ok {
+		data["overload"] = overload
+	}
+	stream(c, status, name, data)
+}
+
+// SetTheme stores the theme picked by the browser
+func (h *Handler) SetTheme(c *gin.Context) {
+	name := c.PostForm("theme")
+	if !slices.Contains(themes, name) {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	h.applyTheme(c, name)
+}
+
+// ToggleTheme switches between the light and dark themes
+func (h *Handler) ToggleTheme(c *gin.Context) {
+	if slices.Contains(darkThemes, theme(c)) {
+		h.applyTheme(c, "light")
+	} else {
+		h.applyTheme(c, "dark")
+	}
+}
+
+// applyTheme stores a theme in the cookie and tells the page to switch to it
+func (h *Handler) applyTheme(c *gin.Context, name string) {
+	c.SetCookie(ThemeCookie, name, 365*24*60*60, "/", "", h.Config.Server.TLS.Enabled(), true)
+	trigger(c, eventThemeChanged, gin.H{"theme": name})
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/components"
+	"htmx/internal/models"
+	"iter"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// transcriptPageSize is the number of messages on a page of a transcript,
+// and transcriptBatch the number read from the store at once while the page
+// streams
+const (
+	transcriptPageSize = 1000
+	transcriptBatch    = 100
+)
+
+// The room header links to the transcript
+func init() {
+	components.Register(components.RoomHeader, components.Component{Name: "transcript", Template: "partials/room-transcript-link.html", Order: 10})
+}
+
+// transcriptDay is the messages of a transcript page posted on one day, in UTC
+type transcriptDay struct {
+	Date  time.Time
+	Chats []*models.Chat
+}
+
+// RoomTranscript renders a read-only, printable page of the conversation
+// of a room, oldest first and split by day, for archiving
+func (h *Handler) RoomTranscript(c *gin.Context) {
+	room, exists := h.RoomStore.GetRoom(c.Param("id"))
+	if !exists {
+		h.NotFound(c)
+		return
+	}
+
+	total := h.ChatStore.CountByRoom(room.ID)
+	pages := max(1, (total+transcriptPageSize-1)/transcriptPageSize)
+	page := 1
+	if s := c.Query("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > pages {
+			h.NotFound(c)
+			return
+		}
+		page = n
+	}
+
+	data := gin.H{
+		"title": room.Name,
+		"room":  room,
+		"days":  h.transcriptDays(c, room.ID, (page-1)*transcriptPageSize, transcriptPageSize),
+		"page":  page,
+		"pages": pages,
+		"total": total,
+		// Transcripts are meant for paper, whatever the browser's theme
+		"theme": "light",
+	}
+	// Pages without a previous or next page leave it out
+	if page > 1 {
+		data["previous"] = page - 1
+	}
+	if page < pages {
+		data["next"] = page + 1
+	}
+	renderLayout(c, http.StatusOK, "layouts/transcript.html", data)
+}
+
+// transcriptDays returns the days of the limit messages of a room starting
+// at offset, as the transcript ranges over them. The messages are read from
+// the store in batches as the page renders, and the response is flushed
+// before each day, so the browser shows the days rendered so far
+func (h *Handler) transcriptDays(c *gin.Context, roomID string, offset, limit int) iter.Seq[transcriptDay] {
+	return func(yield func(transcriptDay) bool) {
+		var day transcriptDay
+		for read := 0; read < limit; {
+			chats, _ := h.ChatStore.GetChatsByRoomPage(roomID, offset+read, min(transcriptBatch, limit-read))
+			if len(chats) == 0 {
+				break
+			}
+			read += len(chats)
+
+			for _, chat := range chats {
+				date := chat.CreatedAt.UTC().Truncate(24 * time.Hour)
+				if day.Chats != nil && !day.Date.Equal(date) {
+					c.Writer.Flush()
+					if !yield(day) {
+						return
+					}
+					day = transcriptDay{}
+				}
+				day.Date = date
+				day.Chats = append(day.Chats, chat)
+			}
+		}
+		if day.Chats != nil {
+			c.Writer.Flush()
+			yield(day)
+		}
+	}
+}
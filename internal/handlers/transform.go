@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// errPayloadTemplate marks a template that failed on the payload it was given
+var errPayloadTemplate = errors.New("template failed")
+
+// payloadFuncs are the functions available to incoming webhook templates,
+// besides header, which reads a request header
+var payloadFuncs = template.FuncMap{
+	"default": func(fallback, value any) any {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"join": func(sep string, items []any) string {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"truncate": func(n int, s string) string { return truncate(s, n) },
+}
+
+// parsePayloadTemplate parses an incoming webhook template, reading headers
+// with header when it is executed
+func parsePayloadTemplate(text string, header func(string) string) (*template.Template, error) {
+	return template.New("payload").
+		Funcs(payloadFuncs).
+		Funcs(template.FuncMap{"header": header}).
+		Parse(text)
+}
+
+// renderPayload formats the JSON payload of the request with an incoming
+// webhook template. Like Slack, the payload can also be sent as a form
+// "payload" field, which GitHub does when asked for form-encoded deliveries
+func renderPayload(c *gin.Context, text string) (string, error) {
+	tmpl, err := parsePayloadTemplate(text, c.GetHeader)
+	if err != nil {
+		return "", err
+	}
+
+	var body []byte
+	if c.ContentType() == "application/x-www-form-urlencoded" {
+		var form struct {
+			Payload string `form:"payload" binding:"required"`
+		}
+		if err := c.ShouldBind(&form); err != nil {
+			return "", err
+		}
+		body = []byte(form.Payload)
+	} else if body, err = io.ReadAll(c.Request.Body); err != nil {
+		return "", err
+	}
+
+	// Keep numbers such as IDs exact rather than printing them as floats
+	var payload any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, payload); err != nil {
+		return "", fmt.Errorf("%w: %v", errPayloadTemplate, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
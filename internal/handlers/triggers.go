@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"htmx/internal/models"
+)
+
+// Client events set through the HX-Trigger response header. htmx fires them
+// on the element that made the request, so they bubble up to document.body,
+// where page code hooks them with hx-trigger="chat:created from:body" or
+// htmx.on("badge:update", ...). The toasts package sends toast:show, and
+// static/js/events.js handles the toast, badge, theme and hub events
+const (
+	// eventChatCreated carries the ID and room ID of a posted message
+	eventChatCreated = "chat:created"
+	// eventRoomUpdated carries the ID and name of a room, and the action:
+	// "created" for now
+	eventRoomUpdated = "room:updated"
+	// eventBadgeUpdate carries the key of the badges to update, their count
+	// and a translated label for it
+	eventBadgeUpdate = "badge:update"
+	// eventThemeChanged carries the theme the page should switch to
+	eventThemeChanged = "theme:changed"
+	// eventShortcutsChanged carries the keymap of the browser's keyboard
+	// shortcuts, as GET /shortcuts returns it
+	eventShortcutsChanged = "shortcuts:changed"
+	// eventHubStatus carries whether the hub is overloaded and a translated
+	// message saying so, for the banner of the layout
+	eventHubStatus = "hub:status"
+)
+
+// triggersKey is the context key of the events set on the current response
+const triggersKey = "hxTriggers"
+
+// trigger adds a client event and its detail to the HX-Trigger header. Like
+// any header, it must be set before the response body is written
+func trigger(c *gin.Context, event string, detail any) {
+	events, _ := c.Get(triggersKey)
+	byName, ok := events.(map[string]any)
+	if !ok {
+		byName = make(map[string]any)
+		c.Set(triggersKey, byName)
+	}
+	byName[event] = detail
+
+	header, err := json.Marshal(byName)
+	if err != nil {
+		return
+	}
+	c.Header("HX-Trigger", string(header))
+}
+
+// triggerChatCreated announces a message posted by this request, updating the
+// message count badge of its room
+func (h *Handler) triggerChatCreated(c *gin.Context, chat *models.Chat) {
+	count := h.ChatStore.CountByRoom(chat.RoomID)
+	trigger(c, eventChatCreated, gin.H{"id": chat.ID, "room_id": chat.RoomID})
+	trigger(c, eventBadgeUpdate, gin.H{
+		"key":   roomBadge(chat.RoomID),
+		"count": count,
+		"label": i18n.FromContext(c).N("rooms.messages", count),
+	})
+}
+
+// triggerRoomUpdated announces a room changed by this request
+func triggerRoomUpdated(c *gin.Context, room *models.Room, action string) {
+	trigger(c, eventRoomUpdated, gin.H{"id": room.ID, "name": room.Name, "action": action})
+}
+
+// roomBadge is the badge key of the message count of a room
+func roomBadge(roomID string) string {
+	return "room-" + roomID + "-messages"
+}
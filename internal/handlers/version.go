@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/version"
+	"net/http"
+)
+
+// Version returns the build info of the running binary
+func (h *Handler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// AdminWebhooks renders the webhooks page
+func (h *Handler) AdminWebhooks(c *gin.Context) {
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// CreateWebhook registers a new outgoing webhook
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var input struct {
+		URL    string   `form:"url" binding:"required"`
+		Events []string `form:"events" binding:"required"`
+		RoomID string   `form:"room_id"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "A URL and at least one event are required")
+		return
+	}
+	if u, err := url.Parse(input.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "The URL must be an absolute http or https URL")
+		return
+	}
+	for _, event := range input.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			h.renderAdminWebhooks(c, http.StatusBadRequest, "Unknown event "+event)
+			return
+		}
+	}
+	if _, exists := h.RoomStore.GetRoom(input.RoomID); input.RoomID != "" && !exists {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "Unknown room")
+		return
+	}
+
+	secret := randomToken(32)
+
+	webhook := &models.Webhook{
+		ID:        uuid.New().String(),
+		URL:       input.URL,
+		Events:    input.Events,
+		RoomID:    input.RoomID,
+		Secret:    secret,
+		CreatedAt: h.clock.Now(),
+	}
+	h.WebhookStore.AddWebhook(webhook)
+	middleware.SetAuditChange(c, nil, webhook)
+	toasts.Add(c, toasts.Success, "Webhook created")
+
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// DeleteWebhook removes an outgoing webhook
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	webhook, _ := h.WebhookStore.GetWebhook(c.Param("id"))
+	if !h.WebhookStore.DeleteWebhook(c.Param("id")) {
+		toasts.Add(c, toasts.Error, "Webhook not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, webhook, nil)
+	toasts.Add(c, toasts.Success, "Webhook deleted")
+
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// RetryDelivery queues a dead-lettered delivery again
+func (h *Handler) RetryDelivery(c *gin.Context) {
+	delivery, exists := h.WebhookStore.TakeDeadLetter(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "Delivery not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	middleware.SetAuditChange(c, deadLetter(delivery), nil)
+	h.Webhooks.Retry(delivery)
+	toasts.Add(c, toasts.Info, "Delivery queued for retry")
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// DiscardDelivery drops a dead-lettered delivery
+func (h *Handler) DiscardDelivery(c *gin.Context) {
+	delivery, exists := h.WebhookStore.TakeDeadLetter(c.Param("id"))
+	if !exists {
+		toasts.Add(c, toasts.Error, "Delivery not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, deadLetter(delivery), nil)
+	toasts.Add(c, toasts.Success, "Delivery discarded")
+
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// deadLetter describes a dead-lettered delivery for the audit log, leaving
+// out its payload
+func deadLetter(delivery *models.Delivery) gin.H {
+	return gin.H{
+		"id":         delivery.ID,
+		"webhook_id": delivery.WebhookID,
+		"event":      delivery.Event,
+		"attempts":   delivery.Attempts,
+		"retries":    delivery.Retries,
+		"last_error": delivery.LastError,
+	}
+}
+
+// CreateIncomingWebhook creates a secret URL that posts into a room
+func (h *Handler) CreateIncomingWebhook(c *gin.Context) {
+	var input struct {
+		RoomID   string `form:"room_id" binding:"required"`
+		Name     string `form:"name"`
+		Template string `form:"template"`
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "Choose a room for the incoming webhook")
+		return
+	}
+	if _, exists := h.RoomStore.GetRoom(input.RoomID); !exists {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "Unknown room")
+		return
+	}
+	if input.Name == "" {
+		input.Name = "Webhook"
+	}
+	if err := checkPayloadTemplate(input.Template); err != nil {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "The template does not parse: "+err.Error())
+		return
+	}
+
+	webhook := &models.IncomingWebhook{
+		Token:     randomToken(24),
+		RoomID:    input.RoomID,
+		Name:      input.Name,
+		Template:  strings.TrimSpace(input.Template),
+		CreatedAt: h.clock.Now(),
+	}
+	h.WebhookStore.AddIncomingWebhook(webhook)
+	middleware.SetAuditChange(c, nil, webhook)
+	toasts.Add(c, toasts.Success, "Incoming webhook created")
+
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// UpdateIncomingWebhookTemplate changes or clears the template of an incoming webhook
+func (h *Handler) UpdateIncomingWebhookTemplate(c *gin.Context) {
+	webhook, exists := h.WebhookStore.GetIncomingWebhook(c.Param("token"))
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	text := c.PostForm("template")
+	if err := checkPayloadTemplate(text); err != nil {
+		h.renderAdminWebhooks(c, http.StatusBadRequest, "The template does not parse: "+err.Error())
+		return
+	}
+
+	updated := *webhook
+	updated.Template = strings.TrimSpace(text)
+	h.WebhookStore.UpdateIncomingWebhook(&updated)
+	middleware.SetAuditChange(c, webhook, &updated)
+	if updated.Template == "" {
+		toasts.Add(c, toasts.Success, "Template of "+updated.Name+" cleared")
+	} else {
+		toasts.Add(c, toasts.Success, "Template of "+updated.Name+" saved")
+	}
+
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// checkPayloadTemplate parses a template entered by an admin; empty means none
+func checkPayloadTemplate(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	_, err := parsePayloadTemplate(text, func(string) string { return "" })
+	return err
+}
+
+// DeleteIncomingWebhook revokes an incoming webhook URL
+func (h *Handler) DeleteIncomingWebhook(c *gin.Context) {
+	webhook, _ := h.WebhookStore.GetIncomingWebhook(c.Param("token"))
+	if !h.WebhookStore.DeleteIncomingWebhook(c.Param("token")) {
+		toasts.Add(c, toasts.Error, "Incoming webhook not found")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	middleware.SetAuditChange(c, webhook, nil)
+	toasts.Add(c, toasts.Success, "Incoming webhook revoked")
+
+	h.renderAdminWebhooks(c, http.StatusOK, "")
+}
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// renderAdminWebhooks renders the webhooks page with an optional form error
+func (h *Handler) renderAdminWebhooks(c *gin.Context, status int, errMsg string) {
+	if errMsg != "" {
+		toasts.Add(c, toasts.Error, errMsg)
+	}
+	rooms := h.RoomStore.GetRooms()
+	roomNames := make(map[string]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+
+	data := gin.H{
+		"title":       "Webhooks",
+		"webhooks":    h.WebhookStore.GetWebhooks(),
+		"incoming":    h.WebhookStore.GetIncomingWebhooks(),
+		"baseURL":     baseURL(c),
+		"deadLetters": h.WebhookStore.GetDeadLetters(),
+		"events":      models.WebhookEvents,
+		"rooms":       rooms,
+		"roomNames":   roomNames,
+		"error":       errMsg,
+		"Page":        "webhooks",
+	}
+
+	if partial(c) {
+		c.HTML(status, "partials/admin-webhooks.html", data)
+		return
+	}
+
+	renderLayout(c, status, "layouts/admin.html", data)
+}
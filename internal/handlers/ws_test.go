@@ -0,0 +1,192 @@
+package handlers_test
+
+import (
+	"htmx/internal/config"
+	"htmx/internal/features"
+	"htmx/internal/testutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quiet is how long the tests wait to be sure an update is not sent
+const quiet = 200 * time.Millisecond
+
+// visitorHeader returns the handshake header of a visitor's browser
+func visitorHeader(visitorID, language string) http.Header {
+	header := http.Header{}
+	header.Set("Cookie", features.VisitorCookie+"="+visitorID)
+	if language != "" {
+		header.Set("Accept-Language", language)
+	}
+	return header
+}
+
+// post sends a message to a room as the visitor, as the chat form does
+func post(t *testing.T, srv *testutil.Server, roomID, visitorID, username, message string) *http.Response {
+	t.Helper()
+	form := url.Values{"username": {username}, "message": {message}}
+	req := srv.NewRequest(http.MethodPost, "/api/rooms/"+roomID+"/chats", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("Cookie", features.VisitorCookie+"="+visitorID)
+	res, body := srv.Do(req)
+	if res.StatusCode >= 400 {
+		t.Fatalf("posting to %s: status %d: %s", roomID, res.StatusCode, body)
+	}
+	return res
+}
+
+func TestNewChatBroadcast(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	viewer := srv.DialWS("/ws", nil)
+	viewer.View(room.ID)
+	elsewhere := srv.DialWS("/ws", nil)
+	srv.WaitClients(2)
+
+	post(t, srv, room.ID, "visitor-1", "alice", "Hello, everyone!")
+
+	chats := srv.Handler.ChatStore.GetChatsByRoom(room.ID)
+	if len(chats) != 1 {
+		t.Fatalf("room has %d messages, want 1", len(chats))
+	}
+	// Every page is told, whatever room it shows, to update its lists
+	for _, client := range []*testutil.WSClient{viewer, elsewhere} {
+		event := client.Expect("new-chat")
+		if event.RoomID != room.ID || event.ChatID != chats[0].ID {
+			t.Errorf("new-chat for room %q chat %q, want %q %q", event.RoomID, event.ChatID, room.ID, chats[0].ID)
+		}
+		if want := "New message from alice: Hello, everyone!"; event.Announcement != want {
+			t.Errorf("announcement = %q, want %q", event.Announcement, want)
+		}
+	}
+}
+
+func TestNewChatBroadcastLocale(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	en := srv.DialWS("/ws", visitorHeader("visitor-en", "en"))
+	de := srv.DialWS("/ws", visitorHeader("visitor-de", "de"))
+	srv.WaitClients(2)
+
+	post(t, srv, room.ID, "visitor-1", "alice", "Hallo")
+
+	if got := en.Expect("new-chat").Announcement; got != "New message from alice: Hallo" {
+		t.Errorf("en announcement = %q", got)
+	}
+	if got := de.Expect("new-chat").Announcement; got != "Neue Nachricht von alice: Hallo" {
+		t.Errorf("de announcement = %q", got)
+	}
+}
+
+func TestNewRoomBroadcast(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	client := srv.DialWS("/ws", nil)
+	srv.WaitClients(1)
+
+	srv.HXPost("/api/rooms", url.Values{"name": {"Lobby"}})
+
+	event := client.Expect("new-room")
+	rooms := srv.Handler.RoomStore.GetRooms()
+	if len(rooms) != 1 || event.RoomID != rooms[0].ID {
+		t.Errorf("new-room for %q, rooms stored %v", event.RoomID, rooms)
+	}
+	client.ExpectNone("new-chat", quiet)
+}
+
+func TestFlaggedToModerators(t *testing.T) {
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.Moderation.MaxLinks = 1
+	})
+	room := srv.Stores.SeedRoom("General")
+	visitor := srv.DialWS("/ws", nil)
+	moderator := srv.DialAdminWS()
+	srv.WaitClients(2)
+
+	res := post(t, srv, room.ID, "visitor-1", "spammer", "https://a.example https://b.example")
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202 for a held message", res.StatusCode)
+	}
+
+	event := moderator.Expect("flagged")
+	if event.RoomID != room.ID || !strings.Contains(event.Announcement, "spammer") {
+		t.Errorf("flagged = %s", event.Raw)
+	}
+	// Visitors do not hear of a held message until it is approved
+	visitor.ExpectNone("flagged", quiet)
+	if n := srv.Handler.ChatStore.CountByRoom(room.ID); n != 0 {
+		t.Errorf("room has %d messages, want none while held", n)
+	}
+}
+
+func TestModeratorsNotToldOfChats(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	moderator := srv.DialAdminWS()
+	srv.WaitClients(1)
+
+	post(t, srv, room.ID, "visitor-1", "alice", "Hello")
+	moderator.ExpectNone("new-chat", quiet)
+}
+
+func TestClientsTellsModerators(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	moderator := srv.DialAdminWS()
+	// The admin page hears of its own connection first
+	moderator.Expect("clients")
+
+	visitor := srv.DialWS("/ws", nil)
+	moderator.Expect("clients")
+	visitor.View(room.ID)
+	moderator.Expect("clients")
+	// Telling the same room again changes nothing
+	visitor.View(room.ID)
+	moderator.ExpectNone("clients", quiet)
+
+	visitor.Close()
+	moderator.Expect("clients")
+	for deadline := time.Now().Add(testutil.DefaultTimeout); srv.Handler.Hub.ClientCount() != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients after the visitor left, want 1", srv.Handler.Hub.ClientCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMentionNotifications(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	room := srv.Stores.SeedRoom("General")
+	// A visitor can be mentioned by the name it last posted under
+	post(t, srv, room.ID, "visitor-alice", "alice", "Hi")
+	alice := srv.DialWS("/ws", visitorHeader("visitor-alice", ""))
+	bob := srv.DialWS("/ws", visitorHeader("visitor-bob", ""))
+	srv.WaitClients(2)
+
+	post(t, srv, room.ID, "visitor-bob", "bob", "Welcome back, @alice")
+
+	alice.Expect("new-chat")
+	event := alice.Expect("notifications")
+	if event.RoomID != room.ID || event.Announcement != "bob mentioned you" {
+		t.Errorf("notifications = %s", event.Raw)
+	}
+	bob.Expect("new-chat")
+	bob.ExpectNone("notifications", quiet)
+	if n := srv.Handler.NotificationStore.Count("visitor-alice"); n != 1 {
+		t.Errorf("alice has %d unread mentions, want 1", n)
+	}
+}
+
+func TestCloseAllClosesClients(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	visitor := srv.DialWS("/ws", visitorHeader("visitor-1", ""))
+	srv.WaitClients(1)
+
+	if !srv.Handler.Hub.CloseAll(time.Second) {
+		t.Fatal("hub did not answer")
+	}
+	visitor.ExpectClosed()
+}
@@ -0,0 +1,285 @@
+// Package i18n translates the chat pages.
+//
+// Every locale is a JSON catalog in locales/, embedded into the binary.
+// Middleware picks the locale of each request from the language switcher
+// cookie or the Accept-Language header, and handlers hand it to templates,
+// which look messages up with {{ .locale.T "key" }} and, for counts,
+// {{ .locale.N "key" count }}. Messages missing from a catalog fall back to
+// the default locale, then to the key itself.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale used when the browser asks for none we support
+const Default = "en"
+
+// Cookie holds the locale picked with the language switcher
+const Cookie = "lang"
+
+// localeKey is the context key of the locale of the current request
+const localeKey = "locale"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// Locale is a catalog of messages in one language
+type Locale struct {
+	// Tag is the language tag, such as "en", used in the cookie and the
+	// lang attribute of pages
+	Tag string
+	// Name is the name of the language in that language, for the switcher
+	Name string
+
+	messages map[string]message
+	plural   func(n int) string
+}
+
+// message holds the plural forms of a message, keyed by CLDR plural
+// category; messages without plural forms only have "other"
+type message map[string]string
+
+// UnmarshalJSON reads a message from a string or an object of plural forms
+func (m *message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = message{"other": text}
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return err
+	}
+	if _, ok := forms["other"]; !ok {
+		return fmt.Errorf("plural forms %v lack \"other\"", forms)
+	}
+	*m = forms
+	return nil
+}
+
+// pluralRules pick the CLDR plural category of a count per language; the
+// languages not listed use the English rule
+var pluralRules = map[string]func(n int) string{
+	"fr": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+}
+
+// englishPlural is the plural rule of English, German and Spanish
+func englishPlural(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// locales holds the embedded catalogs by tag
+var locales = mustLoad()
+
+// mustLoad parses the embedded catalogs; they ship with the binary, so a
+// broken one is a build mistake
+func mustLoad() map[string]*Locale {
+	names, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*Locale, len(names))
+	for _, entry := range names {
+		data, err := files.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		var catalog struct {
+			Name     string             `json:"name"`
+			Messages map[string]message `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: parsing %s: %v", entry.Name(), err))
+		}
+
+		tag := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		plural, ok := pluralRules[tag]
+		if !ok {
+			plural = englishPlural
+		}
+		loaded[tag] = &Locale{Tag: tag, Name: catalog.Name, messages: catalog.Messages, plural: plural}
+	}
+	if _, ok := loaded[Default]; !ok {
+		panic("i18n: missing catalog of the default locale " + Default)
+	}
+	return loaded
+}
+
+// Locales returns the supported locales, sorted by tag
+func Locales() []*Locale {
+	sorted := make([]*Locale, 0, len(locales))
+	for _, locale := range locales {
+		sorted = append(sorted, locale)
+	}
+	slices.SortFunc(sorted, func(a, b *Locale) int { return strings.Compare(a.Tag, b.Tag) })
+	return sorted
+}
+
+// Get returns the locale with the tag, if supported
+func Get(tag string) (*Locale, bool) {
+	locale, ok := locales[tag]
+	return locale, ok
+}
+
+// T returns the message for key, replacing each {name} placeholder with the
+// value following "name" in pairs
+func (l *Locale) T(key string, pairs ...any) string {
+	return l.format(l.lookup(key, 0, false), pairs)
+}
+
+// N returns the plural form of the message for key that fits count,
+// replacing {count} and the placeholders in pairs as T does
+func (l *Locale) N(key string, count int, pairs ...any) string {
+	return l.format(l.lookup(key, count, true), append([]any{"count", count}, pairs...))
+}
+
+// lookup returns the form of a message for count, falling back to the
+// default locale and then to the key
+func (l *Locale) lookup(key string, count int, plural bool) string {
+	for _, locale := range []*Locale{l, locales[Default]} {
+		forms, ok := locale.messages[key]
+		if !ok {
+			continue
+		}
+		if plural {
+			if form, ok := forms[locale.plural(count)]; ok {
+				return form
+			}
+		}
+		return forms["other"]
+	}
+	return key
+}
+
+// format replaces the placeholders of a message. It scans the message once
+// rather than building a strings.Replacer, as hub broadcasts format an
+// announcement per event and locale
+func (l *Locale) format(text string, pairs []any) string {
+	if len(pairs) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			break
+		}
+		b.WriteString(text[:start])
+		text = text[start:]
+		end := strings.IndexByte(text, '}')
+		if end < 0 {
+			break
+		}
+		if value, ok := lookupPair(pairs, text[1:end]); ok {
+			b.WriteString(value)
+			text = text[end+1:]
+			continue
+		}
+		// Not a placeholder of pairs: keep the brace, the name may still
+		// start after it
+		b.WriteByte('{')
+		text = text[1:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// lookupPair returns the value following name in pairs, as text
+func lookupPair(pairs []any, name string) (string, bool) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if toText(pairs[i]) == name {
+			return toText(pairs[i+1]), true
+		}
+	}
+	return "", false
+}
+
+// toText formats a placeholder value, without fmt for the common types
+func toText(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case int:
+		return strconv.Itoa(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Negotiate picks the locale from the switcher cookie, then from the
+// Accept-Language header, then the default
+func Negotiate(cookie, acceptLanguage string) *Locale {
+	if locale, ok := locales[cookie]; ok {
+		return locale
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag != "" && q > 0 {
+			ranges = append(ranges, weighted{strings.ToLower(tag), q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		// "de-CH" is served the "de" catalog
+		base, _, _ := strings.Cut(r.tag, "-")
+		if locale, ok := locales[base]; ok {
+			return locale
+		}
+	}
+	return locales[Default]
+}
+
+// Middleware stores the locale of each request for FromContext
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, _ := c.Cookie(Cookie)
+		locale := Negotiate(cookie, c.GetHeader("Accept-Language"))
+		c.Set(localeKey, locale)
+		c.Header("Content-Language", locale.Tag)
+		c.Next()
+	}
+}
+
+// FromContext returns the locale of the current request
+func FromContext(c *gin.Context) *Locale {
+	if value, ok := c.Get(localeKey); ok {
+		if locale, ok := value.(*Locale); ok {
+			return locale
+		}
+	}
+	return locales[Default]
+}
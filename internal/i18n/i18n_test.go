@@ -0,0 +1,38 @@
+package i18n
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	var l Locale
+	tests := []struct {
+		text  string
+		pairs []any
+		want  string
+	}{
+		{"no placeholders", []any{"name", "x"}, "no placeholders"},
+		{"New room {name}", []any{"name", "General"}, "New room General"},
+		{"{username}: {message}", []any{"username", "alice", "message", "hi"}, "alice: hi"},
+		{"{count} messages", []any{"count", 3}, "3 messages"},
+		{"{unknown} stays", []any{"name", "x"}, "{unknown} stays"},
+		{"{{name}}", []any{"name", "x"}, "{x}"},
+		{"open { brace", []any{"name", "x"}, "open { brace"},
+		{"{name", []any{"name", "x"}, "{name"},
+		{"{name} with no value", []any{"name"}, "{name} with no value"},
+		{"{name}", nil, "{name}"},
+	}
+	for _, tt := range tests {
+		if got := l.format(tt.text, tt.pairs); got != tt.want {
+			t.Errorf("format(%q, %v) = %q, want %q", tt.text, tt.pairs, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkT formats the announcement of a new message, which the hub does
+// for every broadcast and locale
+func BenchmarkT(b *testing.B) {
+	l, _ := Get(Default)
+	b.ReportAllocs()
+	for b.Loop() {
+		l.T("announce.new_chat", "username", "alice", "message", "Hello, everyone!")
+	}
+}
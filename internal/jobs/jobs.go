@@ -0,0 +1,193 @@
+// Package jobs runs background jobs on schedules and keeps the status of
+// their last run.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"htmx/internal/clock"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRunning is returned when a job is asked to run while it already runs
+var ErrRunning = errors.New("job is already running")
+
+// Func is the work of a job; an error marks the run as failed
+type Func func(ctx context.Context) error
+
+// Status is what a runner knows of a job
+type Status struct {
+	Name string
+	// Spec is the schedule as configured, such as "@every 1h"
+	Spec    string
+	Running bool
+	// LastRun is the start of the last run, zero before the first one
+	LastRun      time.Time
+	LastDuration time.Duration
+	// LastError is the error of the last run, empty when it succeeded
+	LastError string
+	NextRun   time.Time
+	Runs      int
+	Failures  int
+}
+
+// job is a registered job with its status
+type job struct {
+	fn       Func
+	schedule Schedule
+	status   Status
+	// trigger asks the loop of the job to run it now
+	trigger chan struct{}
+}
+
+// Runner runs the registered jobs on their schedules
+type Runner struct {
+	jobs map[string]*job
+	// observe is told of every run, such as to count it in the metrics
+	observe func(name string, d time.Duration, err error)
+	clock   clock.Clock
+	mutex   sync.RWMutex
+}
+
+// NewRunner creates a runner without jobs; observe, if not nil, is told of
+// every run
+func NewRunner(observe func(name string, d time.Duration, err error)) *Runner {
+	return &Runner{
+		jobs:    make(map[string]*job),
+		observe: observe,
+		clock:   clock.Real,
+	}
+}
+
+// SetClock replaces the clock the schedules are followed with, before Start
+func (r *Runner) SetClock(c clock.Clock) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clock = c
+}
+
+// Add registers a job running fn on the schedule, described by spec on the
+// dashboard. Jobs are added before Start
+func (r *Runner) Add(name, spec string, schedule Schedule, fn Func) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.jobs[name] = &job{
+		fn:       fn,
+		schedule: schedule,
+		status:   Status{Name: name, Spec: spec},
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Start runs every job on its schedule until ctx is done. A job runs once
+// at a time: a run due while the previous one lasts is skipped
+func (r *Runner) Start(ctx context.Context) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for name, j := range r.jobs {
+		go r.loop(ctx, name, j)
+	}
+}
+
+// loop waits for each run of a job, or to be triggered
+func (r *Runner) loop(ctx context.Context, name string, j *job) {
+	for {
+		next := j.schedule.Next(r.clock.Now())
+		r.mutex.Lock()
+		j.status.NextRun = next
+		r.mutex.Unlock()
+
+		// A schedule that never matches leaves the job to be triggered
+		var due <-chan time.Time
+		var timer clock.Timer
+		if !next.IsZero() {
+			timer = r.clock.NewTimer(next.Sub(r.clock.Now()))
+			due = timer.C()
+		}
+		select {
+		case <-ctx.Done():
+		case <-due:
+		case <-j.trigger:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		r.run(ctx, name, j)
+	}
+}
+
+// run runs a job once, recording its status
+func (r *Runner) run(ctx context.Context, name string, j *job) {
+	start := r.clock.Now()
+	r.mutex.Lock()
+	j.status.Running = true
+	j.status.LastRun = start
+	r.mutex.Unlock()
+
+	err := j.fn(ctx)
+	d := r.clock.Now().Sub(start)
+
+	r.mutex.Lock()
+	j.status.Running = false
+	j.status.LastDuration = d
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+	r.mutex.Unlock()
+
+	if err != nil {
+		slog.Warn("job failed", "job", name, "duration", d, "error", err)
+	} else {
+		slog.Debug("job done", "job", name, "duration", d)
+	}
+	if r.observe != nil {
+		r.observe(name, d, err)
+	}
+}
+
+// Trigger runs a job as soon as possible, off its schedule. It reports
+// false for an unknown job, and ErrRunning when it is already running or
+// about to
+func (r *Runner) Trigger(name string) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	j, exists := r.jobs[name]
+	if !exists {
+		return false, nil
+	}
+	if j.status.Running {
+		return true, ErrRunning
+	}
+	select {
+	case j.trigger <- struct{}{}:
+		return true, nil
+	default:
+		return true, ErrRunning
+	}
+}
+
+// Statuses returns the status of every job, by name
+func (r *Runner) Statuses() []Status {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	statuses := make([]Status, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		statuses = append(statuses, j.status)
+	}
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return statuses
+}
@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next
+type Schedule interface {
+	// Next returns the first time after t the job runs
+	Next(t time.Time) time.Time
+}
+
+// every runs a job at a fixed interval from the previous run
+type every time.Duration
+
+// Every returns a schedule running a job every d
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+// Next returns t plus the interval
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cron runs a job at the minutes matching each of its fields, as crontab
+// does; a bit is set for every value a field matches
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set when the day of the month or the day of
+	// the week is "*"; see dayMatches
+	domAny, dowAny bool
+}
+
+// cronField is the range of the values of a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+// cronFields lists the fields of a cron expression in order
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronAliases are the shorthands of common cron expressions
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse reads a schedule: "@every" and a duration such as "@every 30m", a
+// shorthand such as "@daily", or a cron expression of five fields, minute,
+// hour, day of month, month and day of week (0 or 7 for Sunday), each made
+// of "*", values, ranges such as "1-5" and steps such as "*/15", separated
+// by commas. Cron times are in the server's time zone
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("schedule %q: the interval must be at least 1s", spec)
+		}
+		return Every(d), nil
+	}
+	expr := spec
+	if alias, ok := cronAliases[spec]; ok {
+		expr = alias
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("schedule %q: want @every <duration> or five cron fields", spec)
+	}
+	var c cron
+	targets := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		*targets[i] = bits
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField reads a field of a cron expression into its bits
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step, hasStep := strings.Cut(part, "/")
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s step %q is not a positive number", f.name, step)
+			}
+		}
+
+		low, high := f.min, f.max
+		if values != "*" {
+			first, last, isRange := strings.Cut(values, "-")
+			var err error
+			if low, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("%s %q is not a number", f.name, first)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("%s %q is not a number", f.name, last)
+				}
+			} else if hasStep {
+				// "5/15" steps from 5 to the end of the range
+				high = f.max
+			}
+			if low < f.min || high > f.max || low > high {
+				return 0, fmt.Errorf("%s %q is out of range %d-%d", f.name, values, f.min, f.max)
+			}
+		}
+		for v := low; v <= high; v += n {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first minute after t matching every field
+func (c cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// A matching minute is found within a few years, such as the next
+	// February 29; give up on expressions that never match, like "0 0 31 2 *"
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the fields of the days:
+// the one restricted when the other is "*", or either when both are
+// restricted, as crontab does
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
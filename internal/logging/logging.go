@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Levels lists the level names accepted by SetLevel, most verbose first
+var Levels = []string{"debug", "info", "warn", "error"}
+
+// level is shared by the default handler so it can be changed at runtime
+var level slog.LevelVar
+
+// Setup installs a text handler on stderr as the default slog logger, which the
+// standard log package also writes through, at the given level
+func Setup(name string) error {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &level})))
+	return SetLevel(name)
+}
+
+// SetLevel changes the level of the default logger
+func SetLevel(name string) error {
+	var l slog.Level
+	switch strings.ToLower(name) {
+	case "debug":
+		l = slog.LevelDebug
+	case "info":
+		l = slog.LevelInfo
+	case "warn":
+		l = slog.LevelWarn
+	case "error":
+		l = slog.LevelError
+	default:
+		return fmt.Errorf("unknown log level %q (want one of %s)", name, strings.Join(Levels, ", "))
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level returns the name of the current level
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
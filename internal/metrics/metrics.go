@@ -0,0 +1,276 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Registry holds every metric exported by the application
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RequestsTotal counts HTTP requests by route and status
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_http_requests_total",
+		Help: "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// RequestDuration observes HTTP request latency by route
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "htmx_http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// MessagesCreated counts chat messages created
+	MessagesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "htmx_messages_created_total",
+		Help: "Chat messages created.",
+	})
+
+	// MessagesFlagged counts the messages held for review, MessagesBlocked
+	// those refused, MessagesReported the reports of posted messages, and
+	// MessagesReviewed the reviews by their outcome
+	MessagesFlagged = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "htmx_messages_flagged_total",
+		Help: "Chat messages held for review by the moderation filters.",
+	})
+	MessagesBlocked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "htmx_messages_blocked_total",
+		Help: "Chat messages refused by the blocking filter rules.",
+	})
+	MessagesReported = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_messages_reported_total",
+		Help: "Reports of posted chat messages, by reason.",
+	}, []string{"reason"})
+	MessagesReviewed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_messages_reviewed_total",
+		Help: "Held or reported chat messages reviewed by moderators, by outcome.",
+	}, []string{"outcome"})
+
+	// RoomsCreated counts rooms created
+	RoomsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "htmx_rooms_created_total",
+		Help: "Rooms created.",
+	})
+
+	// BroadcastFanout observes how many clients each hub broadcast is written to
+	BroadcastFanout = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "htmx_broadcast_fanout_clients",
+		Help:    "Number of WebSocket clients each broadcast was written to.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	// BroadcastBatchSize observes how many events each hub broadcast carries:
+	// the new messages of a room collected until the flush, or one
+	BroadcastBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "htmx_broadcast_batch_events",
+		Help:    "Number of events each broadcast carried to the WebSocket clients.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+	})
+
+	// HubQueueDepth is the deepest the broadcast queue got over the last
+	// check of the overload monitor, HubDrops counts the writes dropped by
+	// the hub, and HubOverloaded is 1 while the hub is overloaded
+	HubQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "htmx_hub_queue_depth",
+		Help: "Deepest the hub broadcast queue got over the last overload check.",
+	})
+	HubDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_hub_dropped_total",
+		Help: "Hub writes dropped, by receiver: client (failed write) or subscriber (too slow).",
+	}, []string{"receiver"})
+	HubOverloaded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "htmx_hub_overloaded",
+		Help: "Whether the hub is overloaded (1) or not (0).",
+	})
+
+	// LimitRejections counts requests refused because a resource limit was reached
+	LimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_limit_rejections_total",
+		Help: "Requests refused because a resource limit was reached, by limit.",
+	}, []string{"limit"})
+
+	// IPBanRejections counts requests refused because their address is
+	// banned, and IPBansAutomatic the addresses banned for repeatedly
+	// exceeding the limits
+	IPBanRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "htmx_ip_ban_rejections_total",
+		Help: "Requests refused because their address is banned.",
+	})
+	IPBansAutomatic = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "htmx_ip_bans_automatic_total",
+		Help: "Addresses banned automatically for repeatedly exceeding the limits.",
+	})
+
+	// RetentionPurged counts the records purged past their retention, by
+	// data: messages or audit
+	RetentionPurged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_retention_purged_total",
+		Help: "Records purged past their retention, by data.",
+	}, []string{"data"})
+
+	// JobRuns counts the runs of the background jobs, by job and result:
+	// ok or error
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_job_runs_total",
+		Help: "Runs of the background jobs, by job and result.",
+	}, []string{"job", "result"})
+
+	// RenderDuration observes template render time by template name
+	RenderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "htmx_template_render_duration_seconds",
+		Help:    "Template render time, by template.",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+	}, []string{"template"})
+
+	// RenderCacheLookups counts lookups of the render cache by template and
+	// result, hit or miss
+	RenderCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_render_cache_lookups_total",
+		Help: "Render cache lookups, by template and result.",
+	}, []string{"template", "result"})
+
+	// CompressionResponses counts the responses seen by the compression
+	// middleware by result: compressed, cached (compressed before), small
+	// (below the minimum size of the type) or skipped (not compressible)
+	CompressionResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htmx_compression_responses_total",
+		Help: "Responses seen by the compression middleware, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestsTotal,
+		RequestDuration,
+		MessagesCreated,
+		MessagesFlagged,
+		MessagesBlocked,
+		MessagesReported,
+		MessagesReviewed,
+		RoomsCreated,
+		BroadcastFanout,
+		BroadcastBatchSize,
+		HubQueueDepth,
+		HubDrops,
+		HubOverloaded,
+		LimitRejections,
+		IPBanRejections,
+		IPBansAutomatic,
+		RetentionPurged,
+		JobRuns,
+		RenderDuration,
+		RenderCacheLookups,
+		CompressionResponses,
+	)
+}
+
+// requests gathers the request counter alone, for RequestCounts
+var requests = prometheus.NewRegistry()
+
+func init() {
+	requests.MustRegister(RequestsTotal)
+}
+
+// RequestCounts returns the number of HTTP requests handled so far, and of
+// those answered with a client (4xx) or server (5xx) error
+func RequestCounts() (total, clientErrors, serverErrors float64) {
+	families, _ := requests.Gather()
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			count := metric.GetCounter().GetValue()
+			total += count
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "status" {
+					continue
+				}
+				switch label.GetValue()[0] {
+				case '4':
+					clientErrors += count
+				case '5':
+					serverErrors += count
+				}
+			}
+		}
+	}
+	return total, clientErrors, serverErrors
+}
+
+// RegisterGauge exports a value read from fn at scrape time
+func RegisterGauge(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, fn))
+}
+
+// RegisterCounter exports a total read from fn at scrape time
+func RegisterCounter(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: name,
+		Help: help,
+	}, fn))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware records the count and latency of every HTTP request
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		RequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		RequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// InstrumentHTML wraps a Gin HTML renderer so every template render is timed
+func InstrumentHTML(inner render.HTMLRender) render.HTMLRender {
+	return timedHTML{inner: inner}
+}
+
+// timedHTML is an HTMLRender whose instances report their render duration
+type timedHTML struct {
+	inner render.HTMLRender
+}
+
+// Instance returns a timed render for the named template
+func (t timedHTML) Instance(name string, data any) render.Render {
+	return timedRender{inner: t.inner.Instance(name, data), name: name}
+}
+
+// timedRender times a single template render
+type timedRender struct {
+	inner render.Render
+	name  string
+}
+
+// Render renders the template and observes its duration
+func (r timedRender) Render(w http.ResponseWriter) error {
+	start := time.Now()
+	err := r.inner.Render(w)
+	RenderDuration.WithLabelValues(r.name).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// WriteContentType writes the content type of the wrapped render
+func (r timedRender) WriteContentType(w http.ResponseWriter) {
+	r.inner.WriteContentType(w)
+}
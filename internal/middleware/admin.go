@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/models"
+	"net/http"
+)
+
+// AdminAuth requires HTTP basic credentials matching either the configured
+// admin account or an account in the admin store
+func AdminAuth(username, password string, store *models.AdminStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, pass, ok := c.Request.BasicAuth()
+		if ok && validAdmin(user, pass, username, password, store) {
+			c.Set(gin.AuthUserKey, user)
+			c.Next()
+			return
+		}
+
+		c.Header("WWW-Authenticate", `Basic realm="Admin"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// validAdmin checks the credentials against the configured account and the store
+func validAdmin(user, pass, username, password string, store *models.AdminStore) bool {
+	if subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1 {
+		return true
+	}
+
+	admin, exists := store.GetAdmin(user)
+	return exists && admin.CheckPassword(pass)
+}
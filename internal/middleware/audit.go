@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"htmx/internal/models"
+	"net/http"
+	"time"
+)
+
+const (
+	// auditActorKey is the context key handlers use to name the actor of a request
+	auditActorKey = "auditActor"
+	// auditChangeKey is the context key handlers record what they changed under
+	auditChangeKey = "auditChange"
+	// auditViewKey is the context key naming the action of a request that
+	// only reads but is recorded nonetheless
+	auditViewKey = "auditView"
+)
+
+// auditActions maps route patterns to readable action names
+var auditActions = map[string]string{
+	"POST /api/rooms":                               "room.create",
+	"POST /api/rooms/:id/chats":                     "chat.create",
+	"POST /api/rooms/:id/chats/:chatID/report":      "chat.report",
+	"POST /api/v1/rooms":                            "room.create",
+	"POST /api/v1/rooms/:id/chats":                  "chat.create",
+	"POST /admin/flags":                             "feature.override",
+	"POST /admin/flags/:name":                       "feature.update",
+	"POST /admin/log-level":                         "log.level",
+	"POST /admin/settings":                          "settings.update",
+	"POST /admin/jobs/:name/run":                    "job.run",
+	"POST /admin/clients/:id/disconnect":            "client.disconnect",
+	"POST /admin/impersonate":                       "impersonate.start",
+	"POST /impersonate/stop":                        "impersonate.stop",
+	"POST /admin/webhooks":                          "webhook.create",
+	"DELETE /admin/webhooks/:id":                    "webhook.delete",
+	"POST /admin/webhooks/dead-letters/:id/retry":   "webhook.retry",
+	"POST /admin/webhooks/incoming":                 "webhook.incoming.create",
+	"DELETE /admin/webhooks/incoming/:token":        "webhook.incoming.delete",
+	"POST /admin/webhooks/incoming/:token/template": "webhook.incoming.update",
+	"POST /api/webhooks/:token":                     "chat.webhook",
+	"POST /api/v1/webhooks/:token":                  "chat.webhook",
+	"POST /api/integrations/alertmanager":           "chat.alertmanager",
+	"POST /api/v1/integrations/alertmanager":        "chat.alertmanager",
+	"POST /federation/events":                       "chat.federated",
+	"POST /api/bots/messages":                       "chat.bot",
+	"POST /api/v1/bots/messages":                    "chat.bot",
+	"POST /admin/bots":                              "bot.create",
+	"DELETE /admin/bots/:id":                        "bot.delete",
+	"DELETE /admin/webhooks/dead-letters/:id":       "webhook.discard",
+	"POST /admin/bans":                              "user.ban",
+	"DELETE /admin/bans":                            "user.unban",
+	"DELETE /admin/rooms/:id":                       "room.delete",
+	"POST /admin/announce":                          "announcement.create",
+	"POST /admin/announcements":                     "announcement.schedule",
+	"DELETE /admin/announcements/:id":               "announcement.delete",
+	"POST /admin/moderation/:id/approve":            "moderation.approve",
+	"POST /admin/moderation/:id/ban":                "moderation.ban",
+	"DELETE /admin/moderation/:id":                  "moderation.delete",
+	"POST /admin/ip-bans":                           "ipban.create",
+	"DELETE /admin/ip-bans/:id":                     "ipban.delete",
+	"POST /admin/filters":                           "filter.create",
+	"DELETE /admin/filters/:id":                     "filter.delete",
+}
+
+// unaudited lists mutating routes that do not change state
+var unaudited = map[string]bool{
+	"POST /graphql":                   true,
+	"POST /theme":                     true,
+	"POST /theme/toggle":              true,
+	"POST /lang":                      true,
+	"POST /layout":                    true,
+	"POST /emoji/recent":              true,
+	"POST /announcements/:id/dismiss": true,
+	"POST /shortcuts":                 true,
+	"POST /shortcuts/reset":           true,
+}
+
+// SetAuditActor records who performed the current request
+func SetAuditActor(c *gin.Context, actor string) {
+	c.Set(auditActorKey, actor)
+}
+
+// auditChange is the state before and after a request, as set by its handler
+type auditChange struct {
+	before, after any
+}
+
+// SetAuditChange records what the current request changed, for the audit
+// log; nil leaves a side out, such as the state before a creation
+func SetAuditChange(c *gin.Context, before, after any) {
+	c.Set(auditChangeKey, auditChange{before: before, after: after})
+}
+
+// AuditView records the current request under the action although it only
+// reads, such as a page an admin views as someone else
+func AuditView(c *gin.Context, action string) {
+	c.Set(auditViewKey, action)
+}
+
+// Audit records every mutating request into the given store once it has
+// been handled, and the reads marked with AuditView, at the time now tells
+func Audit(store *models.AuditStore, now func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		action := c.GetString(auditViewKey)
+		if action == "" {
+			if !isMutating(c.Request.Method) || unaudited[c.Request.Method+" "+c.FullPath()] {
+				return
+			}
+			action = auditAction(c)
+		}
+
+		entry := &models.AuditEntry{
+			ID:        uuid.New().String(),
+			Actor:     auditActor(c),
+			Action:    action,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			CreatedAt: now(),
+		}
+		if value, ok := c.Get(auditChangeKey); ok {
+			change := value.(auditChange)
+			entry.SetChange(change.before, change.after)
+		}
+		store.AddEntry(entry)
+	}
+}
+
+// isMutating reports whether the HTTP method changes server state
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// auditActor returns the actor set by the handler, falling back to the authenticated user
+func auditActor(c *gin.Context) string {
+	if actor := c.GetString(auditActorKey); actor != "" {
+		return actor
+	}
+	if user := c.GetString(gin.AuthUserKey); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// auditAction returns the readable action name for the matched route
+func auditAction(c *gin.Context) string {
+	route := c.Request.Method + " " + c.FullPath()
+	if action, ok := auditActions[route]; ok {
+		return action
+	}
+	return route
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"strings"
+)
+
+// BoundaryHeader marks error boundary responses; static/js/events.js swaps
+// them even though the layouts do not swap other 404 and 5xx responses
+const BoundaryHeader = "X-Error-Boundary"
+
+// SwapHeader carries the hx-swap of the element that made an htmx request,
+// sent by static/js/events.js since htmx itself does not send it
+const SwapHeader = "HX-Swap"
+
+// retry holds the hx attributes that repeat a failed request
+type retry struct {
+	Method string
+	URL    string
+	// Target is the selector of the original target, empty when it has no ID
+	Target string
+	Swap   string
+	// Vals holds the submitted form values as JSON, for hx-vals
+	Vals string
+}
+
+// RenderBoundary answers an htmx request that failed on the server with the
+// error boundary partial: the message, the request ID to quote when
+// reporting the problem and a button retrying the request. It lands inside
+// the original target, which the retry then swaps as the request did
+func RenderBoundary(c *gin.Context, status int, message string) {
+	swap := c.GetHeader(SwapHeader)
+	r := &retry{
+		Method: strings.ToLower(c.Request.Method),
+		URL:    c.Request.URL.RequestURI(),
+		Swap:   swap,
+	}
+	if target := c.GetHeader("HX-Target"); target != "" {
+		r.Target = "#" + target
+	}
+	// Handlers may fail before reading the form
+	c.Request.ParseForm()
+	if len(c.Request.PostForm) > 0 {
+		if vals, err := json.Marshal(c.Request.PostForm); err == nil {
+			r.Vals = string(vals)
+		}
+	}
+
+	c.Header(BoundaryHeader, "true")
+	if swap == "none" || strings.HasPrefix(swap, "none ") {
+		// The request swaps nothing, so there is nowhere to show the boundary
+		c.Header("HX-Reswap", "none")
+	} else {
+		c.Header("HX-Reswap", "innerHTML")
+	}
+	c.HTML(status, "partials/error-boundary.html", gin.H{
+		"message":   message,
+		"requestID": RequestIDFromContext(c),
+		"retry":     r,
+		"locale":    i18n.FromContext(c),
+	})
+}
@@ -0,0 +1,318 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"hash/maphash"
+	"htmx/internal/metrics"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressBuffered is how much of a response is held back before it is
+// compressed as a stream. Responses up to it are compressed whole, which
+// lets identical ones be served from the cache
+const compressBuffered = 16 << 10
+
+// Compress gzips the responses of clients accepting it. Each content type
+// compressed has a minimum size in minSizes, below which gzip saves too few
+// bytes to be worth it; types it does not list, such as images, and
+// WebSocket upgrades, ranges and event streams are passed through. Up to
+// cacheEntries responses served identically again and again, such as empty
+// states and loading placeholders, are kept compressed
+func Compress(level int, minSizes map[string]int, cacheEntries int) gin.HandlerFunc {
+	gz := &compressor{
+		minSizes: minSizes,
+		cache:    newCompressCache(cacheEntries),
+	}
+	gz.writers.New = func() any {
+		// The level is validated with the config
+		w, _ := gzip.NewWriterLevel(nil, level)
+		return w
+	}
+
+	return func(c *gin.Context) {
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") ||
+			c.GetHeader("Upgrade") != "" || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, compressor: gz}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// compressor holds what the responses compressed by Compress share
+type compressor struct {
+	minSizes map[string]int
+	writers  sync.Pool
+	cache    *compressCache
+}
+
+// minSize returns the size from which responses of a content type are
+// compressed, and false for types that are not
+func (gz *compressor) minSize(contentType string) (int, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0, false
+	}
+	size, ok := gz.minSizes[mediaType]
+	return size, ok
+}
+
+// compressWriter is a response writer holding back the start of a
+// response until it knows whether to compress it
+type compressWriter struct {
+	gin.ResponseWriter
+	compressor *compressor
+	// buf holds what was written while undecided
+	buf bytes.Buffer
+	// decided is set once the response is passed through or compressed,
+	// which gz is then set for
+	decided bool
+	gz      *gzip.Writer
+	minSize int
+	// checked is set once the first write looked at the content type
+	checked bool
+	// headerNow defers WriteHeaderNow until the headers are final
+	headerNow bool
+}
+
+// Write holds back the start of the response, then compresses it once it
+// reaches the minimum size of its type or passes it through
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.checked {
+		w.check(p)
+	}
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(p)
+	case w.decided:
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() >= compressBuffered {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// WriteString writes to the response as Write does
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// check decides from the status and content type of the response whether
+// it may be compressed, setting the content type from the first bytes when
+// the handler did not, as net/http would
+func (w *compressWriter) check(p []byte) {
+	w.checked = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(p))
+	}
+	minSize, ok := w.compressor.minSize(header.Get("Content-Type"))
+	status := w.Status()
+	if !ok || header.Get("Content-Encoding") != "" || status < http.StatusOK ||
+		status == http.StatusNoContent || status == http.StatusPartialContent || status == http.StatusNotModified {
+		w.passThrough()
+		return
+	}
+	w.minSize = minSize
+	// Added now rather than before the handler, which may set its own
+	header.Add("Vary", "Accept-Encoding")
+}
+
+// passThrough sends the response as it is, starting with what was held back
+func (w *compressWriter) passThrough() {
+	w.decided = true
+	metrics.CompressionResponses.WithLabelValues("skipped").Inc()
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+// startGzip compresses the rest of the response as a stream, starting with
+// what was held back
+func (w *compressWriter) startGzip() error {
+	w.decided = true
+	metrics.CompressionResponses.WithLabelValues("compressed").Inc()
+	w.setEncoding()
+	w.gz = w.compressor.writers.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// setEncoding marks the response as gzipped; its length is no longer known
+func (w *compressWriter) setEncoding() {
+	header := w.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	// A weak validator survives the change of encoding
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// Flush sends what was written so far. A response flushed before its end is
+// streamed, so it is compressed from then on when its type allows
+func (w *compressWriter) Flush() {
+	switch {
+	case w.decided:
+	case w.checked:
+		w.startGzip()
+	default:
+		// Flushed before writing, the response is an event stream or
+		// such, whose headers go out now
+		w.passThrough()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// WriteHeaderNow waits for the end of the response while it is undecided,
+// as the headers may still change
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.headerNow = true
+}
+
+// Written reports whether the handler wrote the status or any of the body
+func (w *compressWriter) Written() bool {
+	return w.headerNow || w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// finish ends the response: what was held back is sent compressed, from
+// the cache when an identical response was compressed before, or as it is
+// when smaller than the minimum size of its type
+func (w *compressWriter) finish() {
+	switch {
+	case w.gz != nil:
+		w.gz.Close()
+		w.compressor.writers.Put(w.gz)
+		return
+	case w.decided:
+		return
+	case w.buf.Len() == 0:
+		if w.headerNow {
+			w.ResponseWriter.WriteHeaderNow()
+		}
+		return
+	case w.buf.Len() < w.minSize:
+		metrics.CompressionResponses.WithLabelValues("small").Inc()
+		w.ResponseWriter.Write(w.buf.Bytes())
+		return
+	}
+
+	body, cached := w.compressor.cache.get(w.buf.Bytes())
+	if !cached {
+		var out bytes.Buffer
+		gz := w.compressor.writers.Get().(*gzip.Writer)
+		gz.Reset(&out)
+		gz.Write(w.buf.Bytes())
+		gz.Close()
+		w.compressor.writers.Put(gz)
+		body = out.Bytes()
+		w.compressor.cache.add(w.buf.Bytes(), body)
+		metrics.CompressionResponses.WithLabelValues("compressed").Inc()
+	} else {
+		metrics.CompressionResponses.WithLabelValues("cached").Inc()
+	}
+	w.setEncoding()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.Write(body)
+}
+
+// compressCache keeps the compressed form of response bodies by their
+// hash. A body is only kept once it was seen twice, so the many responses
+// served once, such as single messages, do not push out the repeated ones
+type compressCache struct {
+	seed       maphash.Seed
+	entries    map[uint64]compressedBody
+	seen       map[uint64]struct{}
+	maxEntries int
+	mutex      sync.RWMutex
+}
+
+// compressedBody is an uncompressed body, compared on lookups in case of a
+// hash collision, and its compressed form
+type compressedBody struct {
+	body       []byte
+	compressed []byte
+}
+
+// newCompressCache creates a cache of at most maxEntries bodies; with
+// none it keeps nothing
+func newCompressCache(maxEntries int) *compressCache {
+	return &compressCache{
+		seed:       maphash.MakeSeed(),
+		entries:    make(map[uint64]compressedBody),
+		seen:       make(map[uint64]struct{}),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the compressed form of a body, if kept
+func (c *compressCache) get(body []byte) ([]byte, bool) {
+	if c.maxEntries <= 0 {
+		return nil, false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, ok := c.entries[maphash.Bytes(c.seed, body)]
+	if !ok || !bytes.Equal(e.body, body) {
+		return nil, false
+	}
+	return e.compressed, true
+}
+
+// add keeps the compressed form of a body seen before, which must not be
+// modified afterwards. A full cache makes
+// room by dropping an arbitrary entry, and the bodies seen once are
+// forgotten when there are as many as the cache holds
+func (c *compressCache) add(body, compressed []byte) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hash := maphash.Bytes(c.seed, body)
+	if _, ok := c.seen[hash]; !ok {
+		if len(c.seen) >= c.maxEntries {
+			clear(c.seen)
+		}
+		c.seen[hash] = struct{}{}
+		return
+	}
+	delete(c.seen, hash)
+	if len(c.entries) >= c.maxEntries {
+		for key := range c.entries {
+			delete(c.entries, key)
+			break
+		}
+	}
+	c.entries[hash] = compressedBody{body: bytes.Clone(body), compressed: compressed}
+}
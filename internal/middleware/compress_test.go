@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// minSizes are the minimum sizes of the default config for the types the
+// tests serve
+var minSizes = map[string]int{"text/html": 1024, "text/javascript": 512}
+
+// page returns HTML of about size bytes, a list of messages as the rooms and
+// messages partials render them
+func page(size int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `<article id="chat-%d" class="card bg-base-100 shadow-sm p-3"><p class="font-medium">user%d</p><p data-message>message number %d of the room</p></article>`+"\n", i, i%7, i)
+	}
+	return b.Bytes()
+}
+
+// compressRouter serves body as contentType through Compress
+func compressRouter(cacheEntries int, contentType string, body []byte) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Compress(gzip.DefaultCompression, minSizes, cacheEntries))
+	router.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, contentType, body)
+	})
+	return router
+}
+
+// get requests / from router, accepting gzip
+func get(router http.Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		size        int
+		gzipped     bool
+	}{
+		{"small page", "text/html; charset=utf-8", 500, false},
+		{"page", "text/html; charset=utf-8", 4 << 10, true},
+		{"streamed page", "text/html; charset=utf-8", 2 * compressBuffered, true},
+		{"script", "text/javascript", 600, true},
+		{"image", "image/png", 4 << 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := page(tt.size)
+			w := get(compressRouter(16, tt.contentType, body))
+			if gzipped := w.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.gzipped {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.gzipped)
+			}
+			got := w.Body.Bytes()
+			if tt.gzipped {
+				r, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err = io.ReadAll(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(got, body) {
+				t.Errorf("body of %d bytes does not match the %d served", len(got), len(body))
+			}
+		})
+	}
+}
+
+func TestCompressCache(t *testing.T) {
+	body := page(2 << 10)
+	router := compressRouter(16, "text/html", body)
+	// A body is cached once it was seen twice, then served from the cache
+	first := get(router).Body.Bytes()
+	for range 3 {
+		if w := get(router); !bytes.Equal(w.Body.Bytes(), first) {
+			t.Fatal("a repeated response was compressed differently")
+		}
+	}
+
+	// A range of the same body is sent as it is
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Range", "bytes=0-99")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("a range request was compressed")
+	}
+}
+
+// BenchmarkCompress serves responses the size of the rooms list, the
+// members list and a room page uncompressed, compressed every time and from
+// the cache of repeated bodies. The room page is past compressBuffered, so
+// it is streamed and never cached
+func BenchmarkCompress(b *testing.B) {
+	responses := []struct {
+		name string
+		size int
+	}{
+		{"rooms-list", 2 << 10},
+		{"members", 5 << 9},
+		{"room-page", 22 << 10},
+	}
+	modes := []struct {
+		name         string
+		compress     bool
+		cacheEntries int
+	}{
+		{"off", false, 0},
+		{"compressed", true, 0},
+		{"cached", true, 16},
+	}
+	for _, response := range responses {
+		body := page(response.size)
+		for _, mode := range modes {
+			b.Run(response.name+"/"+mode.name, func(b *testing.B) {
+				router := compressRouter(mode.cacheEntries, "text/html; charset=utf-8", body)
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				if mode.compress {
+					req.Header.Set("Accept-Encoding", "gzip")
+				}
+				b.ReportAllocs()
+				var sent int
+				for b.Loop() {
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					sent = w.Body.Len()
+				}
+				b.ReportMetric(float64(sent), "B/response")
+			})
+		}
+	}
+}
+
+// BenchmarkCompressLevel compresses a room page at the gzip levels
+// compression.level can be set to, the size it comes to against the time
+func BenchmarkCompressLevel(b *testing.B) {
+	body := page(22 << 10)
+	for _, level := range []int{gzip.BestSpeed, 5, 6, gzip.BestCompression} {
+		b.Run(fmt.Sprint("level=", level), func(b *testing.B) {
+			var out bytes.Buffer
+			w, _ := gzip.NewWriterLevel(&out, level)
+			for b.Loop() {
+				out.Reset()
+				w.Reset(&out)
+				w.Write(body)
+				w.Close()
+			}
+			b.ReportMetric(float64(out.Len()), "B/response")
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/errorreport"
+	"htmx/internal/i18n"
+	"log"
+	"net/http"
+)
+
+// Recovery recovers from panics in handlers, responding with a 500 (the
+// error boundary for htmx requests) and reporting the panic with its stack trace
+func Recovery(reporter *errorreport.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				log.Printf("Panic recovered: %v", err)
+				event := requestEvent(c, fmt.Sprintf("panic: %v", err))
+				event.Level = "fatal"
+				event.Exception = []errorreport.Exception{{
+					Type:       "panic",
+					Value:      fmt.Sprint(err),
+					Stacktrace: errorreport.CaptureStack(2),
+				}}
+				reporter.Report(event)
+
+				if c.GetHeader("HX-Request") == "true" && !c.Writer.Written() {
+					RenderBoundary(c, http.StatusInternalServerError, i18n.FromContext(c).T("errors.unexpected"))
+					c.Abort()
+					return
+				}
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// ReportErrors reports every response with a 5xx status
+func ReportErrors(reporter *errorreport.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			message := fmt.Sprintf("%d %s %s", status, c.Request.Method, c.FullPath())
+			if len(c.Errors) > 0 {
+				message += ": " + c.Errors.String()
+			}
+			reporter.Report(requestEvent(c, message))
+		}
+	}
+}
+
+// requestEvent builds an event carrying the request, user and route of the context
+func requestEvent(c *gin.Context, message string) *errorreport.Event {
+	return &errorreport.Event{
+		Message: message,
+		Request: &errorreport.Request{
+			URL:    c.Request.URL.String(),
+			Method: c.Request.Method,
+			Headers: map[string]string{
+				"User-Agent": c.Request.UserAgent(),
+				"HX-Request": c.GetHeader("HX-Request"),
+			},
+		},
+		User: &errorreport.User{
+			Username:  auditActor(c),
+			IPAddress: c.ClientIP(),
+		},
+		Tags: map[string]string{
+			"route":      c.FullPath(),
+			"request_id": RequestIDFromContext(c),
+		},
+	}
+}
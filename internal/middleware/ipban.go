@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/i18n"
+	"htmx/internal/metrics"
+	"htmx/internal/models"
+	"htmx/internal/toasts"
+	"net/http"
+	"net/netip"
+)
+
+// BlockIPs refuses the requests of the addresses banned in the store with a
+// 403: a toast for htmx requests, a JSON error otherwise. It guards the
+// routes people post and connect through
+func BlockIPs(store *models.IPBanStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil {
+			c.Next()
+			return
+		}
+		if _, banned := store.Banned(addr); !banned {
+			c.Next()
+			return
+		}
+
+		metrics.IPBanRejections.Inc()
+		if c.GetHeader("HX-Request") == "true" {
+			toasts.Add(c, toasts.Error, i18n.FromContext(c).T("errors.ip_banned"))
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this address is banned"})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// LimitBody caps the size of request bodies; reading past the limit fails with
+// an *http.MaxBytesError. A limit of zero or less disables the cap
+func LimitBody(limit int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit > 0 && c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limit))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"regexp"
+)
+
+// RequestIDHeader carries the ID of a request, taken from a proxy in front
+// of the server or generated, and echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of the request ID
+const requestIDKey = "requestID"
+
+// validRequestID matches the request IDs accepted from clients and proxies
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID assigns every request an ID, so errors shown to users can be
+// found in the logs and error reports
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID of the current request
+func RequestIDFromContext(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
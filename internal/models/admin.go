@@ -0,0 +1,89 @@
+package models
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Admin represents an account allowed to use the admin pages
+type Admin struct {
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewAdmin creates an admin account with a hashed password, created at the
+// given time
+func NewAdmin(username, password string, createdAt time.Time) (*Admin, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{
+		Username:     username,
+		PasswordHash: hash,
+		CreatedAt:    createdAt,
+	}, nil
+}
+
+// CheckPassword reports whether the password matches the account
+func (a *Admin) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(a.PasswordHash, []byte(password)) == nil
+}
+
+// AdminStore manages the collection of admin accounts
+type AdminStore struct {
+	ordering
+	admins map[string]*Admin
+	mutex  sync.RWMutex
+}
+
+// NewAdminStore creates a new admin store
+func NewAdminStore() *AdminStore {
+	return &AdminStore{
+		admins: make(map[string]*Admin),
+	}
+}
+
+// GetAdmins returns all admin accounts, by username when the store is
+// deterministic
+func (s *AdminStore) GetAdmins() []*Admin {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	admins := make([]*Admin, 0, len(s.admins))
+	for _, admin := range s.admins {
+		admins = append(admins, admin)
+	}
+	if s.deterministic.Load() {
+		slices.SortFunc(admins, func(a, b *Admin) int {
+			return strings.Compare(a.Username, b.Username)
+		})
+	}
+	return admins
+}
+
+// GetAdmin returns an admin account by username
+func (s *AdminStore) GetAdmin(username string) (*Admin, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	admin, exists := s.admins[username]
+	return admin, exists
+}
+
+// AddAdmin adds a new admin account, returning false if the username is taken
+func (s *AdminStore) AddAdmin(admin *Admin) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.admins[admin.Username]; exists {
+		return false
+	}
+
+	s.admins[admin.Username] = admin
+	return true
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// The levels of an announcement, styling its banner
+var AnnouncementLevels = []string{"info", "success", "warning", "error"}
+
+// Announcement is a banner shown across the site for a time window
+type Announcement struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	// Level is one of AnnouncementLevels
+	Level    string    `json:"level"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// Rooms are cross-posted the message, as a system message, once the
+	// window starts
+	Rooms []string `json:"rooms,omitempty"`
+	// PostedAt is when the message was cross-posted; zero until then
+	PostedAt time.Time `json:"posted_at,omitempty"`
+	// By is the admin who scheduled the announcement
+	By        string    `json:"by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// dismissed holds the visitors who closed the banner
+	dismissed map[string]bool
+}
+
+// Active reports whether the banner shows at a time
+func (a *Announcement) Active(now time.Time) bool {
+	return !now.Before(a.StartsAt) && now.Before(a.EndsAt)
+}
+
+// AnnouncementStore keeps the scheduled announcements
+type AnnouncementStore struct {
+	ordering
+	announcements map[string]*Announcement
+	mutex         sync.RWMutex
+}
+
+// NewAnnouncementStore creates a new announcement store
+func NewAnnouncementStore() *AnnouncementStore {
+	return &AnnouncementStore{
+		announcements: make(map[string]*Announcement),
+	}
+}
+
+// AddAnnouncement schedules an announcement
+func (s *AnnouncementStore) AddAnnouncement(a *Announcement) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	a.dismissed = make(map[string]bool)
+	s.announcements[a.ID] = a
+}
+
+// DeleteAnnouncement removes an announcement, returning it
+func (s *AnnouncementStore) DeleteAnnouncement(id string) (*Announcement, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, exists := s.announcements[id]
+	delete(s.announcements, id)
+	return a, exists
+}
+
+// GetAnnouncements returns copies of every announcement, which
+// cross-posting does not change, by start, the latest first
+func (s *AnnouncementStore) GetAnnouncements() []*Announcement {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	announcements := make([]*Announcement, 0, len(s.announcements))
+	for _, a := range s.announcements {
+		copied := *a
+		announcements = append(announcements, &copied)
+	}
+	slices.SortFunc(announcements, func(a, b *Announcement) int {
+		return s.compareTimes(b.StartsAt, a.StartsAt, b.ID, a.ID)
+	})
+	return announcements
+}
+
+// Showing returns the banners shown to a visitor at a time, those it did
+// not dismiss, by start, the earliest first
+func (s *AnnouncementStore) Showing(visitorID string, now time.Time) []*Announcement {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var showing []*Announcement
+	for _, a := range s.announcements {
+		if a.Active(now) && (visitorID == "" || !a.dismissed[visitorID]) {
+			showing = append(showing, a)
+		}
+	}
+	slices.SortFunc(showing, func(a, b *Announcement) int {
+		return s.compareTimes(a.StartsAt, b.StartsAt, a.ID, b.ID)
+	})
+	return showing
+}
+
+// Dismissed returns the announcements a visitor dismissed, by start, the
+// earliest first
+func (s *AnnouncementStore) Dismissed(visitorID string) []*Announcement {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var dismissed []*Announcement
+	for _, a := range s.announcements {
+		if a.dismissed[visitorID] {
+			dismissed = append(dismissed, a)
+		}
+	}
+	slices.SortFunc(dismissed, func(a, b *Announcement) int {
+		return s.compareTimes(a.StartsAt, b.StartsAt, a.ID, b.ID)
+	})
+	return dismissed
+}
+
+// Dismiss hides a banner from a visitor, reporting whether it exists
+func (s *AnnouncementStore) Dismiss(id, visitorID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, exists := s.announcements[id]
+	if exists {
+		a.dismissed[visitorID] = true
+	}
+	return exists
+}
+
+// TakeDue returns the announcements whose window has started and that are
+// still to be cross-posted, marking them posted at now
+func (s *AnnouncementStore) TakeDue(now time.Time) []*Announcement {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var due []*Announcement
+	for _, a := range s.announcements {
+		if len(a.Rooms) > 0 && a.PostedAt.IsZero() && a.Active(now) {
+			a.PostedAt = now
+			due = append(due, a)
+		}
+	}
+	if s.deterministic.Load() {
+		slices.SortFunc(due, func(a, b *Announcement) int {
+			return s.compareTimes(a.StartsAt, b.StartsAt, a.ID, b.ID)
+		})
+	}
+	return due
+}
+
+// DeleteRoom stops cross-posting to a deleted room
+func (s *AnnouncementStore) DeleteRoom(roomID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, a := range s.announcements {
+		a.Rooms = slices.DeleteFunc(slices.Clone(a.Rooms), func(id string) bool { return id == roomID })
+	}
+}
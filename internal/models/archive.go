@@ -0,0 +1,61 @@
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ChatArchive keeps the messages the chat store evicts from memory
+type ChatArchive interface {
+	// Archive keeps chats of a room, oldest first
+	Archive(roomID string, chats []*Chat) error
+}
+
+// FileArchive keeps evicted chats on disk: each room has a file of JSON
+// lines, one chat per line, that archived chats are appended to
+type FileArchive struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileArchive creates an archive writing to dir, created if missing
+func NewFileArchive(dir string) (*FileArchive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileArchive{dir: dir}, nil
+}
+
+// Archive appends chats to the file of their room
+func (a *FileArchive) Archive(roomID string, chats []*Chat) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, err := os.OpenFile(a.path(roomID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, chat := range chats {
+		if err := encoder.Encode(chat); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// path returns the file of a room, its ID escaped to stay in the directory
+func (a *FileArchive) path(roomID string) string {
+	return filepath.Join(a.dir, fmt.Sprintf("%s.jsonl", url.PathEscape(roomID)))
+}
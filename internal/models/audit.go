@@ -0,0 +1,146 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single mutating request made against the application
+type AuditEntry struct {
+	ID     string `json:"id"`
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	IP     string `json:"ip"`
+	// Before and After are what the action changed, as JSON, for the
+	// actions that record it: nothing existed before a creation, and
+	// nothing is left after a deletion
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SetChange records the state before and after the action; nil leaves a
+// side out. The values are encoded now, so later changes to them do not
+// rewrite the log
+func (e *AuditEntry) SetChange(before, after any) {
+	e.Before = auditJSON(before)
+	e.After = auditJSON(after)
+}
+
+// auditJSON encodes a side of a change, or returns nil for none
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// AuditFilter selects audit entries; its zero value selects all of them
+type AuditFilter struct {
+	// Actor matches the actors containing it, ignoring case
+	Actor string
+	// Action matches one action, such as room.delete, or every action of a
+	// type when it ends in a dot, such as room.
+	Action string
+	// From and To bound the time of the entries, To excluded; zero leaves
+	// the side open
+	From, To time.Time
+}
+
+// Matches reports whether the filter selects an entry
+func (f AuditFilter) Matches(entry *AuditEntry) bool {
+	if f.Actor != "" && !strings.Contains(strings.ToLower(entry.Actor), strings.ToLower(f.Actor)) {
+		return false
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		if !strings.HasPrefix(entry.Action, f.Action) {
+			return false
+		}
+	} else if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if !f.From.IsZero() && entry.CreatedAt.Before(f.From) {
+		return false
+	}
+	return f.To.IsZero() || entry.CreatedAt.Before(f.To)
+}
+
+// AuditStore manages the collection of audit entries
+type AuditStore struct {
+	entries []*AuditEntry
+	mutex   sync.RWMutex
+}
+
+// NewAuditStore creates a new audit store
+func NewAuditStore() *AuditStore {
+	return &AuditStore{
+		entries: make([]*AuditEntry, 0),
+	}
+}
+
+// AddEntry appends a new audit entry
+func (s *AuditStore) AddEntry(entry *AuditEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = append(s.entries, entry)
+}
+
+// DeleteEntriesBefore removes the entries recorded before cutoff, returning
+// how many it removed
+func (s *AuditStore) DeleteEntriesBefore(cutoff time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := len(s.entries)
+	s.entries = slices.DeleteFunc(s.entries, func(entry *AuditEntry) bool {
+		return entry.CreatedAt.Before(cutoff)
+	})
+	return n - len(s.entries)
+}
+
+// GetEntries returns all audit entries, newest first
+func (s *AuditStore) GetEntries() []*AuditEntry {
+	return s.Query(AuditFilter{})
+}
+
+// Query returns the audit entries selected by a filter, newest first
+func (s *AuditStore) Query(filter AuditFilter) []*AuditEntry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var entries []*AuditEntry
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if filter.Matches(s.entries[i]) {
+			entries = append(entries, s.entries[i])
+		}
+	}
+	return entries
+}
+
+// Actions returns the names of the actions recorded so far, sorted
+func (s *AuditStore) Actions() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var actions []string
+	for _, entry := range s.entries {
+		if !seen[entry.Action] {
+			seen[entry.Action] = true
+			actions = append(actions, entry.Action)
+		}
+	}
+	slices.Sort(actions)
+	return actions
+}
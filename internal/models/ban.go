@@ -0,0 +1,89 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ban keeps a name from posting messages
+type Ban struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason,omitempty"`
+	// By is the admin who banned the name
+	By        string    `json:"by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BanStore keeps the banned names. Names are compared ignoring case, as
+// the members list of a room does
+type BanStore struct {
+	ordering
+	bans  map[string]*Ban
+	mutex sync.RWMutex
+}
+
+// NewBanStore creates a new ban store
+func NewBanStore() *BanStore {
+	return &BanStore{
+		bans: make(map[string]*Ban),
+	}
+}
+
+// banKey returns the key a name is banned under
+func banKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// AddBan bans a name, replacing an earlier ban of it
+func (s *BanStore) AddBan(ban *Ban) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.bans[banKey(ban.Username)] = ban
+}
+
+// RemoveBan lifts the ban of a name, reporting whether it was banned
+func (s *BanStore) RemoveBan(username string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := banKey(username)
+	if _, exists := s.bans[key]; !exists {
+		return false
+	}
+	delete(s.bans, key)
+	return true
+}
+
+// GetBan returns the ban of a name
+func (s *BanStore) GetBan(username string) (*Ban, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ban, exists := s.bans[banKey(username)]
+	return ban, exists
+}
+
+// IsBanned reports whether a name is banned
+func (s *BanStore) IsBanned(username string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, banned := s.bans[banKey(username)]
+	return banned
+}
+
+// GetBans returns every ban, newest first
+func (s *BanStore) GetBans() []*Ban {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bans := make([]*Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		bans = append(bans, ban)
+	}
+	slices.SortFunc(bans, func(a, b *Ban) int {
+		return s.compareTimes(b.CreatedAt, a.CreatedAt, b.Username, a.Username)
+	})
+	return bans
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"crypto/subtle"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Bot is an integration registered by an admin that receives the messages of
+// its rooms at CallbackURL and posts replies with its API key
+type Bot struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// APIKey authenticates the bot's API calls and signs its callbacks
+	APIKey string `json:"-"`
+	// Rooms the bot subscribes to; empty means every room
+	Rooms       []string  `json:"rooms"`
+	CallbackURL string    `json:"callback_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subscribed reports whether the bot receives the messages of a room
+func (b *Bot) Subscribed(roomID string) bool {
+	return len(b.Rooms) == 0 || slices.Contains(b.Rooms, roomID)
+}
+
+// BotStore manages the registered bots
+type BotStore struct {
+	ordering
+	bots  map[string]*Bot
+	mutex sync.RWMutex
+}
+
+// NewBotStore creates a new bot store
+func NewBotStore() *BotStore {
+	return &BotStore{
+		bots: make(map[string]*Bot),
+	}
+}
+
+// GetBots returns all bots, oldest first
+func (s *BotStore) GetBots() []*Bot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bots := make([]*Bot, 0, len(s.bots))
+	for _, bot := range s.bots {
+		bots = append(bots, bot)
+	}
+	slices.SortFunc(bots, func(a, b *Bot) int {
+		return s.compareTimes(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+	})
+	return bots
+}
+
+// GetBot returns a bot by ID
+func (s *BotStore) GetBot(id string) (*Bot, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bot, exists := s.bots[id]
+	return bot, exists
+}
+
+// GetBotByKey returns the bot with the given API key
+func (s *BotStore) GetBotByKey(key string) (*Bot, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, bot := range s.bots {
+		if subtle.ConstantTimeCompare([]byte(bot.APIKey), []byte(key)) == 1 {
+			return bot, true
+		}
+	}
+	return nil, false
+}
+
+// AddBot adds a new bot
+func (s *BotStore) AddBot(bot *Bot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.bots[bot.ID] = bot
+}
+
+// DeleteBot removes a bot by ID
+func (s *BotStore) DeleteBot(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.bots[id]; !exists {
+		return false
+	}
+
+	delete(s.bots, id)
+	return true
+}
@@ -1,115 +1,509 @@
 package models
 
 import (
+	"cmp"
+	"htmx/internal/clock"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Chat represents a chat message in a room
 type Chat struct {
-	ID        string    `json:"id"`
-	RoomID    string    `json:"room_id"`
-	Username  string    `json:"username"`
-	Message   string    `json:"message"`
+	ID       string `json:"id"`
+	RoomID   string `json:"room_id"`
+	Username string `json:"username"`
+	Message  string `json:"message"`
+	// Bot marks messages posted by integrations rather than people
+	Bot bool `json:"bot,omitempty"`
+	// Origin is the instance a federated message was posted on; empty for local messages
+	Origin string `json:"origin,omitempty"`
+	// AvatarURL is the image the message was posted with, such as the
+	// icon_url of a Slack payload; empty shows the author's initials
+	AvatarURL string    `json:"avatar_url,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// ChatStore manages the collection of chats
+// ChatStore manages the collection of chats. The chats of each room are
+// kept, oldest first, behind a lock of their own, so messages posted to
+// different rooms do not wait for each other; the store lock is only taken
+// to find the chats of a room, or to add or remove a room
 type ChatStore struct {
-	chats map[string]*Chat
-	// Secondary index by room ID for quick access
-	chatsByRoom map[string][]*Chat
-	mutex       sync.RWMutex
+	ordering
+	// chats indexes every chat by ID, across the rooms
+	chats sync.Map
+	count atomic.Int64
+	rooms map[string]*roomChats
+	// observers is only added to at startup
+	observers []func(roomID string)
+	mutex     sync.RWMutex
+
+	// size is the estimated memory used by the chats, in bytes. Over a
+	// budget, set at startup, the oldest chats of the least recently viewed
+	// rooms move to the archive; one writer evicts at a time
+	size         atomic.Int64
+	budget       int64
+	archive      ChatArchive
+	evicting     sync.Mutex
+	evicted      atomic.Int64
+	evictedBytes atomic.Int64
+
+	// clock tells when rooms are viewed
+	clock clock.Clock
+}
+
+// chatOverhead estimates the memory used by a chat besides its text: the
+// struct, its entries in the indexes and the string headers
+const chatOverhead = 256
+
+// roomChats are the chats of a room, oldest first
+type roomChats struct {
+	chats []*Chat
+	// deleted marks chats whose room was removed from the store while a
+	// writer was waiting for the lock; the writer looks the room up again
+	deleted bool
+	// viewed is when the chats were last read, in Unix nanoseconds
+	viewed atomic.Int64
+	mutex  sync.RWMutex
+}
+
+// view records that the chats of a room are read at now
+func (r *roomChats) view(now time.Time) {
+	r.viewed.Store(now.UnixNano())
+}
+
+// chatSize estimates the memory used by a chat, in bytes
+func chatSize(chat *Chat) int64 {
+	return int64(chatOverhead + len(chat.ID) + len(chat.RoomID) + len(chat.Username) + len(chat.Message) + len(chat.Origin) + len(chat.AvatarURL))
 }
 
 // NewChatStore creates a new chat store
 func NewChatStore() *ChatStore {
 	return &ChatStore{
-		chats:       make(map[string]*Chat),
-		chatsByRoom: make(map[string][]*Chat),
+		rooms: make(map[string]*roomChats),
+		clock: clock.Real,
 	}
 }
 
-// GetChats returns all chats
-func (s *ChatStore) GetChats() []*Chat {
+// room returns the chats of a room, adding them when create is set and
+// the room has none yet
+func (s *ChatStore) room(roomID string, create bool) *roomChats {
 	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	room := s.rooms[roomID]
+	s.mutex.RUnlock()
+	if room != nil || !create {
+		return room
+	}
 
-	chats := make([]*Chat, 0, len(s.chats))
-	for _, chat := range s.chats {
-		chats = append(chats, chat)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if room = s.rooms[roomID]; room == nil {
+		room = &roomChats{}
+		room.view(s.clock.Now())
+		s.rooms[roomID] = room
+	}
+	return room
+}
+
+// GetChats returns all chats, in no particular order unless the store is
+// deterministic, when they are oldest first
+func (s *ChatStore) GetChats() []*Chat {
+	chats := make([]*Chat, 0, s.count.Load())
+	s.chats.Range(func(_, chat any) bool {
+		chats = append(chats, chat.(*Chat))
+		return true
+	})
+	if s.deterministic.Load() {
+		slices.SortFunc(chats, func(a, b *Chat) int {
+			return s.compareTimes(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+		})
 	}
 	return chats
 }
 
 // GetChat returns a chat by ID
 func (s *ChatStore) GetChat(id string) (*Chat, bool) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	chat, exists := s.chats[id]
-	return chat, exists
+	chat, exists := s.chats.Load(id)
+	if !exists {
+		return nil, false
+	}
+	return chat.(*Chat), true
 }
 
 // GetChatsByRoom returns all chats for a specific room
 func (s *ChatStore) GetChatsByRoom(roomID string) []*Chat {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	room := s.room(roomID, false)
+	if room == nil {
+		return []*Chat{}
+	}
+	room.view(s.clock.Now())
+	room.mutex.RLock()
+	defer room.mutex.RUnlock()
 
 	// Return a copy to prevent concurrent modification issues
-	chats := make([]*Chat, len(s.chatsByRoom[roomID]))
-	copy(chats, s.chatsByRoom[roomID])
+	chats := make([]*Chat, len(room.chats))
+	copy(chats, room.chats)
 	return chats
 }
 
-// AddChat adds a new chat message
-func (s *ChatStore) AddChat(chat *Chat) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// GetChatsByRoomPage returns at most limit chats of a room, oldest first,
+// starting at offset, and the number of chats in the room
+func (s *ChatStore) GetChatsByRoomPage(roomID string, offset, limit int) ([]*Chat, int) {
+	room := s.room(roomID, false)
+	if room == nil {
+		return []*Chat{}, 0
+	}
+	room.view(s.clock.Now())
+	room.mutex.RLock()
+	defer room.mutex.RUnlock()
 
-	s.chats[chat.ID] = chat
-	s.chatsByRoom[chat.RoomID] = append(s.chatsByRoom[chat.RoomID], chat)
+	start := min(max(offset, 0), len(room.chats))
+	end := min(start+max(limit, 0), len(room.chats))
+	chats := make([]*Chat, end-start)
+	copy(chats, room.chats[start:end])
+	return chats, len(room.chats)
 }
 
-// DeleteChat removes a chat message
-func (s *ChatStore) DeleteChat(id string) bool {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// ForEachChatInRoom calls fn with each chat of a room, oldest first, until
+// fn returns false. It walks the chats in place under the read lock of the
+// room, without copying them, so fn must not call back into the store for
+// the room. Unlike the getters, walking does not count as viewing the room
+// for the memory budget, so exporters and indexers do not keep rooms in
+// memory
+func (s *ChatStore) ForEachChatInRoom(roomID string, fn func(chat *Chat) bool) {
+	room := s.room(roomID, false)
+	if room == nil {
+		return
+	}
+	room.mutex.RLock()
+	defer room.mutex.RUnlock()
+
+	for _, chat := range room.chats {
+		if !fn(chat) {
+			return
+		}
+	}
+}
+
+// CountSince returns the number of chats of a room created at or after
+// since, found by a binary search as the chats are kept in order
+func (s *ChatStore) CountSince(roomID string, since time.Time) int {
+	room := s.room(roomID, false)
+	if room == nil {
+		return 0
+	}
+	room.mutex.RLock()
+	defer room.mutex.RUnlock()
+
+	i := sort.Search(len(room.chats), func(i int) bool {
+		return !room.chats[i].CreatedAt.Before(since)
+	})
+	return len(room.chats) - i
+}
+
+// CountByRoom returns the number of chats in a room
+func (s *ChatStore) CountByRoom(roomID string) int {
+	room := s.room(roomID, false)
+	if room == nil {
+		return 0
+	}
+	room.mutex.RLock()
+	defer room.mutex.RUnlock()
 
-	chat, exists := s.chats[id]
+	return len(room.chats)
+}
+
+// AddChat adds a new chat message, in the order of its creation time among
+// the chats of its room: messages that arrive late, such as federated
+// ones, are not shown as the newest. A chat with the ID of another replaces
+// it, in its room and in the counts. Memory never fails to keep it, so the
+// error is always nil
+func (s *ChatStore) AddChat(chat *Chat) error {
+	for {
+		room := s.room(chat.RoomID, true)
+		room.mutex.Lock()
+		if room.deleted {
+			room.mutex.Unlock()
+			continue
+		}
+
+		previous, replaced := s.chats.Swap(chat.ID, chat)
+		if !replaced {
+			s.count.Add(1)
+		}
+		// A chat replaced in its own room goes, so the room keeps one copy
+		var old *Chat
+		if replaced {
+			old = previous.(*Chat)
+			if old.RoomID == chat.RoomID {
+				s.removeFromRoom(room, old)
+				old = nil
+			}
+		}
+		s.size.Add(chatSize(chat))
+		// After the chats created at the same time, which keep their order
+		i := sort.Search(len(room.chats), func(i int) bool {
+			return room.chats[i].CreatedAt.After(chat.CreatedAt)
+		})
+		room.chats = slices.Insert(room.chats, i, chat)
+		s.changed(chat.RoomID)
+		room.mutex.Unlock()
+
+		// One moved to another room leaves its old room, locked on its own
+		if old != nil {
+			if oldRoom := s.room(old.RoomID, false); oldRoom != nil {
+				oldRoom.mutex.Lock()
+				if s.removeFromRoom(oldRoom, old) {
+					s.changed(old.RoomID)
+				}
+				oldRoom.mutex.Unlock()
+			}
+		}
+		s.evict()
+		return nil
+	}
+}
+
+// removeFromRoom removes chat from the chats of its room, which the caller
+// holds locked, with its size, reporting whether it was there; archived and
+// deleted chats are not
+func (s *ChatStore) removeFromRoom(room *roomChats, chat *Chat) bool {
+	// From the first chat created at the same time
+	start := sort.Search(len(room.chats), func(i int) bool {
+		return !room.chats[i].CreatedAt.Before(chat.CreatedAt)
+	})
+	for i := start; i < len(room.chats) && !room.chats[i].CreatedAt.After(chat.CreatedAt); i++ {
+		if room.chats[i] == chat {
+			room.chats = slices.Delete(room.chats, i, i+1)
+			s.size.Add(-chatSize(chat))
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteChat removes a chat message
+func (s *ChatStore) DeleteChat(id string) (bool, error) {
+	chat, exists := s.GetChat(id)
 	if !exists {
-		return false
+		return false, nil
 	}
+	room := s.room(chat.RoomID, false)
+	if room == nil {
+		return false, nil
+	}
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
 
-	// Remove from main map
-	delete(s.chats, id)
+	// Remove from the ID index, unless another delete got there first
+	if !s.chats.CompareAndDelete(id, chat) {
+		return false, nil
+	}
+	s.count.Add(-1)
+	s.size.Add(-chatSize(chat))
 
-	// Remove from room index
-	roomChats := s.chatsByRoom[chat.RoomID]
-	for i, c := range roomChats {
-		if c.ID == id {
-			// Remove this chat from the slice
-			s.chatsByRoom[chat.RoomID] = append(roomChats[:i], roomChats[i+1:]...)
+	// Remove from room index, from the first chat created at the same time
+	start := sort.Search(len(room.chats), func(i int) bool {
+		return !room.chats[i].CreatedAt.Before(chat.CreatedAt)
+	})
+	for i := start; i < len(room.chats); i++ {
+		if room.chats[i].ID == id {
+			room.chats = slices.Delete(room.chats, i, i+1)
 			break
 		}
 	}
 
-	return true
+	s.changed(chat.RoomID)
+	return true, nil
 }
 
 // DeleteChatsByRoom removes all chats for a specific room
-func (s *ChatStore) DeleteChatsByRoom(roomID string) {
+func (s *ChatStore) DeleteChatsByRoom(roomID string) error {
+	s.mutex.Lock()
+	room := s.rooms[roomID]
+	delete(s.rooms, roomID)
+	s.mutex.Unlock()
+	if room == nil {
+		s.changed(roomID)
+		return nil
+	}
+
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	// Remove each chat from the ID index
+	for _, chat := range room.chats {
+		if s.chats.CompareAndDelete(chat.ID, chat) {
+			s.count.Add(-1)
+		}
+		s.size.Add(-chatSize(chat))
+	}
+	room.chats = nil
+	room.deleted = true
+	s.changed(roomID)
+	return nil
+}
+
+// DeleteChatsBefore removes the chats created before cutoff, returning how
+// many it removed. Archived chats are left alone
+func (s *ChatStore) DeleteChatsBefore(cutoff time.Time) (int, error) {
+	s.mutex.RLock()
+	rooms := make(map[string]*roomChats, len(s.rooms))
+	maps.Copy(rooms, s.rooms)
+	s.mutex.RUnlock()
+
+	deleted := 0
+	for roomID, room := range rooms {
+		room.mutex.Lock()
+		n := sort.Search(len(room.chats), func(i int) bool {
+			return !room.chats[i].CreatedAt.Before(cutoff)
+		})
+		for _, chat := range room.chats[:n] {
+			if s.chats.CompareAndDelete(chat.ID, chat) {
+				s.count.Add(-1)
+			}
+			s.size.Add(-chatSize(chat))
+		}
+		if n > 0 {
+			room.chats = slices.Delete(room.chats, 0, n)
+			s.changed(roomID)
+		}
+		room.mutex.Unlock()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// Observe calls fn with the ID of the room of each message added or
+// deleted. fn runs with the chats of the room locked, so it must not use
+// the store. Observers are added at startup, before the store is used
+func (s *ChatStore) Observe(fn func(roomID string)) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.observers = append(s.observers, fn)
+}
+
+// changed tells the observers about a change to the messages of a room
+func (s *ChatStore) changed(roomID string) {
+	for _, fn := range s.observers {
+		fn(roomID)
+	}
+}
+
+// SetMemoryBudget caps the estimated memory used by the chats at budget
+// bytes: when a new chat exceeds it, the oldest chats of the least recently
+// viewed rooms are moved to the archive until the chats fit in nine tenths
+// of the budget, so that not every new chat evicts. Rooms are viewed when
+// their chats are read. Call it at startup, before the store is used
+func (s *ChatStore) SetMemoryBudget(budget int64, archive ChatArchive) {
+	s.budget = budget
+	s.archive = archive
+}
+
+// SetClock replaces the clock telling when rooms are viewed, which decides
+// the rooms evicted first. Call it at startup, before the store is used
+func (s *ChatStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// evict moves chats to the archive while the store is over its budget,
+// unless another writer is evicting already
+func (s *ChatStore) evict() {
+	if s.budget <= 0 || s.size.Load() <= s.budget || !s.evicting.TryLock() {
+		return
+	}
+	defer s.evicting.Unlock()
+
+	target := s.budget / 10 * 9
+	for _, roomID := range s.roomsByView() {
+		if s.size.Load() <= target {
+			return
+		}
+		if err := s.evictRoom(roomID, target); err != nil {
+			slog.Error("archiving evicted chats failed, keeping them in memory", "room", roomID, "error", err)
+			return
+		}
+	}
+}
+
+// roomsByView returns the IDs of the rooms with chats, least recently
+// viewed first
+func (s *ChatStore) roomsByView() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ids := make([]string, 0, len(s.rooms))
+	viewed := make(map[string]int64, len(s.rooms))
+	for id, room := range s.rooms {
+		ids = append(ids, id)
+		viewed[id] = room.viewed.Load()
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return cmp.Compare(viewed[a], viewed[b])
+	})
+	return ids
+}
+
+// evictRoom moves the oldest chats of a room to the archive until the store
+// fits in target bytes or the room has no chats left. Chats the archive
+// fails to keep stay in memory
+func (s *ChatStore) evictRoom(roomID string, target int64) error {
+	room := s.room(roomID, false)
+	if room == nil {
+		return nil
+	}
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
 
-	// Get all chats for this room
-	roomChats := s.chatsByRoom[roomID]
+	n, freed := 0, int64(0)
+	for n < len(room.chats) && s.size.Load()-freed > target {
+		freed += chatSize(room.chats[n])
+		n++
+	}
+	if room.deleted || n == 0 {
+		return nil
+	}
+	if err := s.archive.Archive(roomID, room.chats[:n]); err != nil {
+		return err
+	}
 
-	// Remove each chat from the main map
-	for _, chat := range roomChats {
-		delete(s.chats, chat.ID)
+	for _, chat := range room.chats[:n] {
+		if s.chats.CompareAndDelete(chat.ID, chat) {
+			s.count.Add(-1)
+		}
 	}
+	room.chats = slices.Delete(room.chats, 0, n)
+	s.size.Add(-freed)
+	s.evicted.Add(int64(n))
+	s.evictedBytes.Add(freed)
+	s.changed(roomID)
+	return nil
+}
+
+// Size returns the estimated memory used by the chats, in bytes
+func (s *ChatStore) Size() int64 {
+	return s.size.Load()
+}
+
+// Evicted returns the number of chats moved to the archive so far, and
+// their estimated size in bytes
+func (s *ChatStore) Evicted() (chats, bytes int64) {
+	return s.evicted.Load(), s.evictedBytes.Load()
+}
+
+// Count returns the number of chats in the store
+func (s *ChatStore) Count() int {
+	return int(s.count.Load())
+}
+
+// Ping reports whether the store is reachable
+func (s *ChatStore) Ping() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	// Clear the room index
-	delete(s.chatsByRoom, roomID)
+	return nil
 }
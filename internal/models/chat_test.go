@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAddChatReplaceKeepsSize(t *testing.T) {
+	s := NewChatStore()
+	chat := &Chat{ID: "c1", RoomID: "a", Username: "alice", Message: "hello", CreatedAt: time.Now()}
+	s.AddChat(chat)
+	size := s.Size()
+
+	// The same message again, then moved to another room
+	s.AddChat(&Chat{ID: "c1", RoomID: "a", Username: "alice", Message: "hello", CreatedAt: chat.CreatedAt})
+	if got := s.Size(); got != size {
+		t.Errorf("Size after replacing a chat = %d, want %d", got, size)
+	}
+	s.AddChat(&Chat{ID: "c1", RoomID: "b", Username: "alice", Message: "hello", CreatedAt: chat.CreatedAt})
+	if got := s.Size(); got != size {
+		t.Errorf("Size after moving a chat = %d, want %d", got, size)
+	}
+
+	s.DeleteChat("c1")
+	if got := s.Size(); got != 0 {
+		t.Errorf("Size after deleting the chat = %d, want 0", got)
+	}
+}
+
+// TestChatStoreConcurrency adds, deletes and reads chats across rooms while
+// rooms are deleted, for the race detector, then checks the indexes agree
+func TestSetDeterministicPerStore(t *testing.T) {
+	sorted, other := NewChatStore(), NewChatStore()
+	sorted.SetDeterministic(true)
+	if other.deterministic.Load() {
+		t.Fatal("turning one store deterministic turned another on")
+	}
+
+	created := time.Now()
+	for i := range 20 {
+		sorted.AddChat(&Chat{ID: fmt.Sprintf("c%02d", 19-i), RoomID: "a", Username: "alice", Message: "hi", CreatedAt: created})
+	}
+	chats := sorted.GetChats()
+	for i, chat := range chats {
+		if want := fmt.Sprintf("c%02d", i); chat.ID != want {
+			t.Fatalf("GetChats()[%d] = %s, want %s: ties not broken by ID", i, chat.ID, want)
+		}
+	}
+}
+
+func TestChatStoreConcurrency(t *testing.T) {
+	const workers, chats, rooms = 8, 200, 4
+	s := NewChatStore()
+	base := time.Now()
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chats {
+				roomID := fmt.Sprint("room-", (w+i)%rooms)
+				id := fmt.Sprintf("w%d-%d", w, i)
+				s.AddChat(&Chat{ID: id, RoomID: roomID, Username: "alice", Message: "hello", CreatedAt: base.Add(time.Duration(i) * time.Millisecond)})
+				s.GetChatsByRoomPage(roomID, i/2, 10)
+				s.CountByRoom(roomID)
+				s.ForEachChatInRoom(roomID, func(*Chat) bool { return true })
+				switch {
+				case i%5 == 4:
+					s.DeleteChat(id)
+				case i%50 == 49:
+					s.DeleteChatsByRoom(fmt.Sprint("room-", w%rooms))
+				case i%25 == 24:
+					s.GetChats()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	var size int64
+	for r := range rooms {
+		roomID := fmt.Sprint("room-", r)
+		listed := s.GetChatsByRoom(roomID)
+		if n := s.CountByRoom(roomID); n != len(listed) {
+			t.Errorf("CountByRoom(%s) = %d, but %d listed", roomID, n, len(listed))
+		}
+		for _, chat := range listed {
+			if got, ok := s.GetChat(chat.ID); !ok || got != chat {
+				t.Errorf("chat %s of %s is not indexed by ID", chat.ID, roomID)
+			}
+			size += chatSize(chat)
+		}
+		total += len(listed)
+	}
+	if n := s.Count(); n != total {
+		t.Errorf("Count = %d, but %d listed by room", n, total)
+	}
+	if n := len(s.GetChats()); n != total {
+		t.Errorf("len(GetChats) = %d, but %d listed by room", n, total)
+	}
+	if got := s.Size(); got != size {
+		t.Errorf("Size = %d, want %d for the chats listed", got, size)
+	}
+}
+
+// BenchmarkAddChat posts from parallel goroutines into one room, where they
+// take turns on its lock, and into a room each
+func BenchmarkAddChat(b *testing.B) {
+	for _, rooms := range []string{"one-room", "room-each"} {
+		b.Run(rooms, func(b *testing.B) {
+			s := NewChatStore()
+			var next atomic.Int64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				worker := next.Add(1)
+				roomID := "room"
+				if rooms == "room-each" {
+					roomID = fmt.Sprint("room-", worker)
+				}
+				for i := 0; pb.Next(); i++ {
+					s.AddChat(&Chat{ID: fmt.Sprintf("%d-%d", worker, i), RoomID: roomID, Username: "alice", Message: "hello", CreatedAt: time.Now()})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkGetChatsByRoomPage reads the latest page of a room of 10000
+// chats, as the room page does
+func BenchmarkGetChatsByRoomPage(b *testing.B) {
+	s := NewChatStore()
+	base := time.Now()
+	for i := range 10000 {
+		s.AddChat(&Chat{ID: fmt.Sprint(i), RoomID: "room", Username: "alice", Message: "hello", CreatedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		s.GetChatsByRoomPage("room", 9950, 50)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"slices"
+	"sync"
+)
+
+// maxRecentEmoji caps the recently used emoji kept per visitor
+const maxRecentEmoji = 16
+
+// EmojiStore keeps the emoji visitors picked last, for the emoji picker
+type EmojiStore struct {
+	recent map[string][]string
+	mutex  sync.RWMutex
+}
+
+// NewEmojiStore creates a new emoji store
+func NewEmojiStore() *EmojiStore {
+	return &EmojiStore{
+		recent: make(map[string][]string),
+	}
+}
+
+// Recent returns the emoji a visitor used, most recent first
+func (s *EmojiStore) Recent(visitorID string) []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return slices.Clone(s.recent[visitorID])
+}
+
+// Use moves an emoji to the front of the recently used emoji of a visitor
+func (s *EmojiStore) Use(visitorID, emoji string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	recent := slices.DeleteFunc(s.recent[visitorID], func(used string) bool {
+		return used == emoji
+	})
+	recent = append([]string{emoji}, recent...)
+	if len(recent) > maxRecentEmoji {
+		recent = recent[:maxRecentEmoji]
+	}
+	s.recent[visitorID] = recent
+}
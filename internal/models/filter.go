@@ -0,0 +1,136 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The actions of a filter rule
+const (
+	// FilterFlag holds a matching message for review
+	FilterFlag = "flag"
+	// FilterBlock refuses a matching message outright
+	FilterBlock = "block"
+)
+
+// FilterRule is a word or regular expression screened for in the messages
+// posted, managed from the admin pages
+type FilterRule struct {
+	ID string `json:"id"`
+	// Pattern is a word, matched as a whole word ignoring case, or a
+	// regular expression when Regex is set
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex"`
+	// Action is FilterFlag or FilterBlock
+	Action string `json:"action"`
+	// RoomID scopes the rule to a room; empty applies it to every room
+	RoomID string `json:"room_id,omitempty"`
+	// By is the admin who added the rule
+	By        string    `json:"by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	matcher *regexp.Regexp
+}
+
+// Compile prepares the rule for matching, failing on an empty pattern or an
+// invalid regular expression
+func (r *FilterRule) Compile() error {
+	pattern := strings.TrimSpace(r.Pattern)
+	if pattern == "" {
+		return fmt.Errorf("the pattern is empty")
+	}
+	if !r.Regex {
+		pattern = `(?i)\b` + regexp.QuoteMeta(pattern) + `\b`
+	}
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %w", err)
+	}
+	r.matcher = matcher
+	return nil
+}
+
+// FilterRuleStore keeps the filter rules. The moderation filters read it
+// for every message, so changes apply to the next message posted
+type FilterRuleStore struct {
+	ordering
+	rules map[string]*FilterRule
+	mutex sync.RWMutex
+}
+
+// NewFilterRuleStore creates a new filter rule store
+func NewFilterRuleStore() *FilterRuleStore {
+	return &FilterRuleStore{
+		rules: make(map[string]*FilterRule),
+	}
+}
+
+// AddRule adds a compiled rule
+func (s *FilterRuleStore) AddRule(rule *FilterRule) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rules[rule.ID] = rule
+}
+
+// DeleteRule removes a rule, returning it
+func (s *FilterRuleStore) DeleteRule(id string) (*FilterRule, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rule, exists := s.rules[id]
+	delete(s.rules, id)
+	return rule, exists
+}
+
+// DeleteRoomRules removes the rules scoped to a deleted room
+func (s *FilterRuleStore) DeleteRoomRules(roomID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, rule := range s.rules {
+		if rule.RoomID == roomID {
+			delete(s.rules, id)
+		}
+	}
+}
+
+// GetRules returns every rule, oldest first
+func (s *FilterRuleStore) GetRules() []*FilterRule {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rules := make([]*FilterRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+	slices.SortFunc(rules, func(a, b *FilterRule) int {
+		return s.compareTimes(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+	})
+	return rules
+}
+
+// Match returns the oldest rule with the action applying to the room of
+// the message that matches it, with the text it matched
+func (s *FilterRuleStore) Match(chat *Chat, action string) (*FilterRule, string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var found *FilterRule
+	var text string
+	for _, rule := range s.rules {
+		if rule.Action != action || (rule.RoomID != "" && rule.RoomID != chat.RoomID) {
+			continue
+		}
+		if found != nil && s.compareTimes(rule.CreatedAt, found.CreatedAt, rule.ID, found.ID) >= 0 {
+			continue
+		}
+		if loc := rule.matcher.FindStringIndex(chat.Message); loc != nil {
+			found, text = rule, chat.Message[loc[0]:loc[1]]
+		}
+	}
+	return found, text
+}
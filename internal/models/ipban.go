@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"htmx/internal/clock"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// IPBan keeps the addresses of a network from posting and connecting
+type IPBan struct {
+	ID string `json:"id"`
+	// CIDR is the banned network, a single address being a /32 or /128
+	CIDR   string `json:"cidr"`
+	Reason string `json:"reason,omitempty"`
+	// By is the admin who banned the network, empty for an automatic ban
+	By        string    `json:"by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is when the ban lifts; zero never lifts it
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	prefix netip.Prefix
+}
+
+// ParseCIDR returns the network of a CIDR or a single address
+func ParseCIDR(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is neither an IP address nor a CIDR", s)
+	}
+	return prefix.Masked(), nil
+}
+
+// NewIPBan creates a ban of a CIDR or a single address
+func NewIPBan(id, cidr string) (*IPBan, error) {
+	prefix, err := ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return &IPBan{ID: id, CIDR: prefix.String(), prefix: prefix}, nil
+}
+
+// Expired reports whether the ban has lifted
+func (b *IPBan) Expired(now time.Time) bool {
+	return !b.ExpiresAt.IsZero() && !now.Before(b.ExpiresAt)
+}
+
+// IPBanStore keeps the banned networks
+type IPBanStore struct {
+	ordering
+	bans map[string]*IPBan
+	// clock tells which bans have lifted
+	clock clock.Clock
+	mutex sync.RWMutex
+}
+
+// NewIPBanStore creates a new IP ban store
+func NewIPBanStore() *IPBanStore {
+	return &IPBanStore{
+		bans:  make(map[string]*IPBan),
+		clock: clock.Real,
+	}
+}
+
+// SetClock replaces the clock telling which bans have lifted. Call it at
+// startup, before the store is used
+func (s *IPBanStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// AddBan bans a network, replacing an earlier ban of the same network and
+// forgetting the bans that lifted
+func (s *IPBanStore) AddBan(ban *IPBan) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	for id, other := range s.bans {
+		if other.prefix == ban.prefix || other.Expired(now) {
+			delete(s.bans, id)
+		}
+	}
+	s.bans[ban.ID] = ban
+}
+
+// RemoveBan lifts a ban, returning it
+func (s *IPBanStore) RemoveBan(id string) (*IPBan, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ban, exists := s.bans[id]
+	delete(s.bans, id)
+	return ban, exists
+}
+
+// Banned returns the ban in force covering an address, the one lifting
+// last when several do
+func (s *IPBanStore) Banned(addr netip.Addr) (*IPBan, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	addr = addr.Unmap()
+	now := s.clock.Now()
+	var found *IPBan
+	for _, ban := range s.bans {
+		if ban.Expired(now) || !ban.prefix.Contains(addr) {
+			continue
+		}
+		if found == nil || ban.ExpiresAt.IsZero() || (!found.ExpiresAt.IsZero() && ban.ExpiresAt.After(found.ExpiresAt)) {
+			found = ban
+		}
+	}
+	return found, found != nil
+}
+
+// GetBans returns the bans in force, newest first
+func (s *IPBanStore) GetBans() []*IPBan {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := s.clock.Now()
+	bans := make([]*IPBan, 0, len(s.bans))
+	for _, ban := range s.bans {
+		if !ban.Expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	slices.SortFunc(bans, func(a, b *IPBan) int {
+		return s.compareTimes(b.CreatedAt, a.CreatedAt, b.ID, a.ID)
+	})
+	return bans
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventChatFlagged is the hub event of a message held or reported for
+// review; it is sent to the moderators connected to the admin pages only
+const EventChatFlagged = "chat.flagged"
+
+// ReportReasons lists what a message can be reported as
+var ReportReasons = []string{"spam", "harassment", "offensive", "other"}
+
+// Report is a visitor's report of a posted message
+type Report struct {
+	// Reason is one of ReportReasons
+	Reason string `json:"reason"`
+	// Reporter is the name the reporter last posted under, if any
+	Reporter string `json:"reporter,omitempty"`
+	// VisitorID identifies the browser of the reporter, which reports a
+	// message once
+	VisitorID string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FlaggedChat is a message waiting in the moderation queue: either held by
+// the filters, or posted and then reported
+type FlaggedChat struct {
+	ID string `json:"id"`
+	// Chat is the message as it was posted, a copy for a reported one so
+	// the review sees what was reported
+	Chat *Chat `json:"chat"`
+	// Held is set for a message the filters kept from its room
+	Held bool `json:"held"`
+	// Reasons say why the filters flagged it
+	Reasons []string `json:"reasons,omitempty"`
+	// Reports are the reports of a posted message, oldest first
+	Reports []*Report `json:"reports,omitempty"`
+	// ClientID is the composer's ID of a message sent optimistically, so
+	// its pending copy turns into the message once approved
+	ClientID  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModerationQueue holds the messages waiting for review
+type ModerationQueue struct {
+	ordering
+	items map[string]*FlaggedChat
+	mutex sync.RWMutex
+}
+
+// NewModerationQueue creates a new moderation queue
+func NewModerationQueue() *ModerationQueue {
+	return &ModerationQueue{
+		items: make(map[string]*FlaggedChat),
+	}
+}
+
+// Add puts a message in the queue
+func (q *ModerationQueue) Add(item *FlaggedChat) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.items[item.ID] = item
+}
+
+// AddReport adds a report of a posted message, which is queued under its ID
+// along with the earlier reports of it. It returns the queued message, and
+// false when the visitor already reported it
+func (q *ModerationQueue) AddReport(chat *Chat, report *Report) (*FlaggedChat, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	item, exists := q.items[chat.ID]
+	if !exists {
+		snapshot := *chat
+		item = &FlaggedChat{ID: chat.ID, Chat: &snapshot, CreatedAt: report.CreatedAt}
+		q.items[chat.ID] = item
+	}
+	for _, earlier := range item.Reports {
+		if report.VisitorID != "" && earlier.VisitorID == report.VisitorID {
+			return item, false
+		}
+	}
+	// Copies returned by List keep the reports they were listed with
+	item.Reports = append(slices.Clip(item.Reports), report)
+	return item, true
+}
+
+// Remove takes a message out of the queue, returning it; the reviews of
+// two moderators at once cannot both take it
+func (q *ModerationQueue) Remove(id string) (*FlaggedChat, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	item, exists := q.items[id]
+	delete(q.items, id)
+	return item, exists
+}
+
+// RemoveRoom drops the messages held for a deleted room
+func (q *ModerationQueue) RemoveRoom(roomID string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for id, item := range q.items {
+		if item.Chat.RoomID == roomID {
+			delete(q.items, id)
+		}
+	}
+}
+
+// List returns copies of the queued messages, oldest first, which later
+// reports do not change
+func (q *ModerationQueue) List() []*FlaggedChat {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	items := make([]*FlaggedChat, 0, len(q.items))
+	for _, item := range q.items {
+		listed := *item
+		items = append(items, &listed)
+	}
+	slices.SortFunc(items, func(a, b *FlaggedChat) int {
+		return q.compareTimes(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+	})
+	return items
+}
+
+// Count returns how many messages wait for review
+func (q *ModerationQueue) Count() int {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.items)
+}
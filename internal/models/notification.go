@@ -0,0 +1,131 @@
+package models
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxNotifications caps the unread mentions kept per visitor; older ones are dropped
+const maxNotifications = 50
+
+// NotificationStore keeps the messages that mention visitors until they read
+// them. Visitors are known by the name they last posted under
+type NotificationStore struct {
+	ordering
+	names  map[string]string
+	unread map[string][]*Chat
+	mutex  sync.RWMutex
+}
+
+// NewNotificationStore creates a new notification store
+func NewNotificationStore() *NotificationStore {
+	return &NotificationStore{
+		names:  make(map[string]string),
+		unread: make(map[string][]*Chat),
+	}
+}
+
+// SetName records the name a visitor posts under, which their mentions use
+func (s *NotificationStore) SetName(visitorID, name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.names[visitorID] = strings.TrimSpace(name)
+}
+
+// Name returns the name a visitor last posted under, or ""
+func (s *NotificationStore) Name(visitorID string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.names[visitorID]
+}
+
+// Names returns the names the visitors last posted under, by visitor ID
+func (s *NotificationStore) Names() map[string]string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return maps.Clone(s.names)
+}
+
+// Notify stores a message for the visitors it mentions, other than its
+// author, and returns their IDs
+func (s *NotificationStore) Notify(chat *Chat) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var notified []string
+	for visitorID, name := range s.names {
+		if name == "" || strings.EqualFold(name, chat.Username) || !Mentions(chat.Message, name) {
+			continue
+		}
+		unread := append(s.unread[visitorID], chat)
+		if len(unread) > maxNotifications {
+			unread = unread[len(unread)-maxNotifications:]
+		}
+		s.unread[visitorID] = unread
+		notified = append(notified, visitorID)
+	}
+	if s.deterministic.Load() {
+		slices.Sort(notified)
+	}
+	return notified
+}
+
+// Count returns the number of unread mentions of a visitor
+func (s *NotificationStore) Count(visitorID string) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.unread[visitorID])
+}
+
+// MarkRead returns the unread mentions of a visitor, newest first, and
+// marks them read
+func (s *NotificationStore) MarkRead(visitorID string) []*Chat {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	unread := s.unread[visitorID]
+	delete(s.unread, visitorID)
+	return newestFirst(unread)
+}
+
+// Unread returns the unread mentions of a visitor, newest first, leaving
+// them unread
+func (s *NotificationStore) Unread(visitorID string) []*Chat {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return newestFirst(s.unread[visitorID])
+}
+
+// newestFirst returns a copy of mentions, oldest first, in reverse
+func newestFirst(unread []*Chat) []*Chat {
+	chats := make([]*Chat, len(unread))
+	for i, chat := range unread {
+		chats[len(unread)-1-i] = chat
+	}
+	return chats
+}
+
+// Mentions reports whether a message mentions a name as "@name", in any
+// case, not followed by more of a longer name
+func Mentions(message, name string) bool {
+	lower, mention := strings.ToLower(message), "@"+strings.ToLower(name)
+	for i := strings.Index(lower, mention); i >= 0; i = nextIndex(lower, mention, i) {
+		rest := []rune(lower[i+len(mention):])
+		if len(rest) == 0 || !(unicode.IsLetter(rest[0]) || unicode.IsDigit(rest[0]) || rest[0] == '_') {
+			return true
+		}
+	}
+	return false
+}
+
+// nextIndex returns the index of the next substr in s after the one at i, or -1
+func nextIndex(s, substr string, i int) int {
+	next := strings.Index(s[i+1:], substr)
+	if next < 0 {
+		return -1
+	}
+	return i + 1 + next
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ordering is embedded by the stores that list records with equal times,
+// or keep them in maps, to make their order fixed on demand
+type ordering struct {
+	deterministic atomic.Bool
+}
+
+// SetDeterministic turns the deterministic ordering of the store on or off.
+// Lists are then sorted by time and then by ID, and the records otherwise
+// returned in map order, such as GetChats and GetAdmins, are sorted too, so
+// tests and snapshots see the same order on every run. It is off unless a
+// test harness, such as testutil, turns it on
+func (o *ordering) SetDeterministic(on bool) {
+	o.deterministic.Store(on)
+}
+
+// compareTimes orders two records by time, breaking ties by ID in
+// deterministic mode
+func (o *ordering) compareTimes(a, b time.Time, aID, bID string) int {
+	if c := a.Compare(b); c != 0 || !o.deterministic.Load() {
+		return c
+	}
+	return strings.Compare(aID, bID)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// The quotas of a user
+const (
+	QuotaMessages    = "messages"
+	QuotaRooms       = "rooms"
+	QuotaUploadBytes = "upload_bytes"
+)
+
+// QuotaUse is an amount a user uses of a quota within the period starting
+// at Period, which may not go over Limit; a Limit of 0 allows any amount
+type QuotaUse struct {
+	Quota  string
+	Period time.Time
+	Amount int64
+	Limit  int64
+}
+
+// quotaUsage is what a user used of a quota within a period
+type quotaUsage struct {
+	period time.Time
+	used   int64
+}
+
+// QuotaStore tracks the usage of the quotas of each user. Only the current
+// period of each quota is kept
+type QuotaStore struct {
+	usage map[string]map[string]*quotaUsage
+	mutex sync.RWMutex
+}
+
+// NewQuotaStore creates a new quota store
+func NewQuotaStore() *QuotaStore {
+	return &QuotaStore{
+		usage: make(map[string]map[string]*quotaUsage),
+	}
+}
+
+// Use records the uses of a user, all of them or none: it returns the quota
+// of the first use that would go over its limit, or "" once they are recorded
+func (s *QuotaStore) Use(user string, uses ...QuotaUse) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, use := range uses {
+		if use.Limit > 0 && s.used(user, use.Quota, use.Period)+use.Amount > use.Limit {
+			return use.Quota
+		}
+	}
+	quotas, exists := s.usage[user]
+	if !exists {
+		quotas = make(map[string]*quotaUsage)
+		s.usage[user] = quotas
+	}
+	for _, use := range uses {
+		usage, exists := quotas[use.Quota]
+		if !exists || !usage.period.Equal(use.Period) {
+			usage = &quotaUsage{period: use.Period}
+			quotas[use.Quota] = usage
+		}
+		usage.used += use.Amount
+	}
+	return ""
+}
+
+// Used returns what a user used of a quota within the period starting at
+// period
+func (s *QuotaStore) Used(user, quota string, period time.Time) int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.used(user, quota, period)
+}
+
+// used returns the usage of a quota; the caller holds the mutex
+func (s *QuotaStore) used(user, quota string, period time.Time) int64 {
+	usage, exists := s.usage[user][quota]
+	if !exists || !usage.period.Equal(period) {
+		return 0
+	}
+	return usage.used
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// RoomRepository keeps the rooms. RoomStore keeps them in memory; other
+// backends, such as the SQLite one, keep them between runs. A change a
+// backend fails to save is returned as an error and not made, so the rooms
+// shown are those a restart brings back
+type RoomRepository interface {
+	// GetRooms returns all rooms, oldest first, then by ID. Callers must
+	// not modify the slice
+	GetRooms() []*Room
+	// ForEachRoom calls fn with each room, oldest first, until fn returns
+	// false; fn may change the rooms
+	ForEachRoom(fn func(room *Room) bool)
+	GetRoom(id string) (*Room, bool)
+	AddRoom(room *Room) error
+	// UpdateRoom and DeleteRoom report false for unknown rooms
+	UpdateRoom(room *Room) (bool, error)
+	DeleteRoom(id string) (bool, error)
+	// Observe calls fn with the ID of each room added, updated or deleted.
+	// fn must not change the store
+	Observe(fn func(roomID string))
+	Count() int
+	// Ping reports whether the store is reachable
+	Ping() error
+}
+
+// ChatRepository keeps the chat messages. ChatStore keeps them in memory;
+// other backends, such as the SQLite one, keep them between runs. The
+// messages of a room are kept oldest first, those created at the same time
+// in the order they were added. Like rooms, a change a backend fails to
+// save is returned as an error and not made
+type ChatRepository interface {
+	// GetChats returns all chats, oldest first when the store is
+	// deterministic
+	GetChats() []*Chat
+	GetChat(id string) (*Chat, bool)
+	GetChatsByRoom(roomID string) []*Chat
+	// GetChatsByRoomPage returns at most limit chats of a room starting at
+	// offset, and the number of chats in the room
+	GetChatsByRoomPage(roomID string, offset, limit int) ([]*Chat, int)
+	// ForEachChatInRoom calls fn with each chat of a room until fn returns
+	// false; fn must not change the chats of the room
+	ForEachChatInRoom(roomID string, fn func(chat *Chat) bool)
+	// CountSince returns the number of chats of a room created at or after
+	// since
+	CountSince(roomID string, since time.Time) int
+	CountByRoom(roomID string) int
+	AddChat(chat *Chat) error
+	// DeleteChat reports false for unknown chats
+	DeleteChat(id string) (bool, error)
+	DeleteChatsByRoom(roomID string) error
+	// DeleteChatsBefore removes the chats created before cutoff, returning
+	// how many it removed
+	DeleteChatsBefore(cutoff time.Time) (int, error)
+	// Observe calls fn with the ID of the room of each message added or
+	// deleted. fn must not use the store
+	Observe(fn func(roomID string))
+	Count() int
+	// Ping reports whether the store is reachable
+	Ping() error
+}
+
+// SchemaVersioner is a database whose schema is migrated, such as that of
+// the SQLite backend
+type SchemaVersioner interface {
+	// SchemaVersion returns the version of the schema in the database and
+	// the latest version the build migrates it to
+	SchemaVersion() (version, latest int, err error)
+}
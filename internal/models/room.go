@@ -1,7 +1,11 @@
 package models
 
 import (
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,70 +16,133 @@ type Room struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// RoomStore manages the collection of rooms
+// RoomStore manages the collection of rooms. Reads load an immutable
+// snapshot without locking; every change builds a new one under the write
+// lock and swaps it in, which suits rooms, read on every page and rarely
+// changed
 type RoomStore struct {
-	rooms map[string]*Room
-	mutex sync.RWMutex
+	snapshot  atomic.Pointer[roomSnapshot]
+	observers []func(roomID string)
+	mutex     sync.Mutex
+}
+
+// roomSnapshot is the state of the store at one point, never modified
+type roomSnapshot struct {
+	byID map[string]*Room
+	// sorted holds the rooms oldest first, then by ID
+	sorted []*Room
 }
 
 // NewRoomStore creates a new room store
 func NewRoomStore() *RoomStore {
-	return &RoomStore{
-		rooms: make(map[string]*Room),
-	}
+	s := &RoomStore{}
+	// Empty rather than nil, as update keeps it
+	s.snapshot.Store(&roomSnapshot{byID: make(map[string]*Room), sorted: []*Room{}})
+	return s
 }
 
-// GetRooms returns all rooms
+// GetRooms returns all rooms, oldest first. The slice is shared by every
+// reader until the rooms change, so callers must not modify it; clone it
+// to filter or sort it
 func (s *RoomStore) GetRooms() []*Room {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	return s.snapshot.Load().sorted
+}
 
-	rooms := make([]*Room, 0, len(s.rooms))
-	for _, room := range s.rooms {
-		rooms = append(rooms, room)
+// ForEachRoom calls fn with each room, oldest first, until fn returns
+// false. It walks the current snapshot, so fn may change the rooms without
+// affecting the walk
+func (s *RoomStore) ForEachRoom(fn func(room *Room) bool) {
+	for _, room := range s.snapshot.Load().sorted {
+		if !fn(room) {
+			return
+		}
 	}
-	return rooms
 }
 
 // GetRoom returns a room by ID
 func (s *RoomStore) GetRoom(id string) (*Room, bool) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	room, exists := s.rooms[id]
+	room, exists := s.snapshot.Load().byID[id]
 	return room, exists
 }
 
-// AddRoom adds a new room
-func (s *RoomStore) AddRoom(room *Room) {
+// AddRoom adds a new room. Memory never fails to keep it, so the error is
+// always nil
+func (s *RoomStore) AddRoom(room *Room) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.rooms[room.ID] = room
+	s.update(func(rooms map[string]*Room) { rooms[room.ID] = room })
+	s.changed(room.ID)
+	return nil
 }
 
 // UpdateRoom updates an existing room
-func (s *RoomStore) UpdateRoom(room *Room) bool {
+func (s *RoomStore) UpdateRoom(room *Room) (bool, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, exists := s.rooms[room.ID]; !exists {
-		return false
+	if _, exists := s.snapshot.Load().byID[room.ID]; !exists {
+		return false, nil
 	}
 
-	s.rooms[room.ID] = room
-	return true
+	s.update(func(rooms map[string]*Room) { rooms[room.ID] = room })
+	s.changed(room.ID)
+	return true, nil
 }
 
 // DeleteRoom removes a room
-func (s *RoomStore) DeleteRoom(id string) bool {
+func (s *RoomStore) DeleteRoom(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.snapshot.Load().byID[id]; !exists {
+		return false, nil
+	}
+
+	s.update(func(rooms map[string]*Room) { delete(rooms, id) })
+	s.changed(id)
+	return true, nil
+}
+
+// update swaps in a snapshot with a copy of the rooms changed by fn. It
+// runs with the store locked
+func (s *RoomStore) update(fn func(rooms map[string]*Room)) {
+	rooms := maps.Clone(s.snapshot.Load().byID)
+	fn(rooms)
+
+	// Never nil, so no rooms encode as [] in JSON, and sized exactly, so a
+	// reader appending to the shared slice gets a copy
+	sorted := slices.AppendSeq(make([]*Room, 0, len(rooms)), maps.Values(rooms))
+	slices.SortFunc(sorted, func(a, b *Room) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	s.snapshot.Store(&roomSnapshot{byID: rooms, sorted: sorted})
+}
+
+// Observe calls fn with the ID of each room added, updated or deleted. fn
+// runs with the store locked, so it must not change the store
+func (s *RoomStore) Observe(fn func(roomID string)) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.observers = append(s.observers, fn)
+}
 
-	if _, exists := s.rooms[id]; !exists {
-		return false
+// changed tells the observers about a change to a room
+func (s *RoomStore) changed(roomID string) {
+	for _, fn := range s.observers {
+		fn(roomID)
 	}
+}
+
+// Count returns the number of rooms in the store
+func (s *RoomStore) Count() int {
+	return len(s.snapshot.Load().byID)
+}
 
-	delete(s.rooms, id)
-	return true
+// Ping reports whether the store is reachable
+func (s *RoomStore) Ping() error {
+	return nil
 }
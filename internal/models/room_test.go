@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestGetRoomsEmptyEncodesAsArray(t *testing.T) {
+	s := NewRoomStore()
+	assertJSON := func(when string) {
+		t.Helper()
+		data, err := json.Marshal(s.GetRooms())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "[]" {
+			t.Errorf("GetRooms %s encodes as %s, want []", when, data)
+		}
+	}
+
+	assertJSON("of a new store")
+	s.AddRoom(&Room{ID: "r", Name: "Room", CreatedAt: time.Now()})
+	s.DeleteRoom("r")
+	assertJSON("after deleting the last room")
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// Settings are what admins change at runtime from the settings page,
+// starting from the configuration
+type Settings struct {
+	// MessageRetentionDays purges the messages older than this many days,
+	// and AuditRetentionDays the audit entries; 0 keeps them forever
+	MessageRetentionDays int `json:"message_retention_days"`
+	AuditRetentionDays   int `json:"audit_retention_days"`
+	// UpdatedBy is the admin who last changed the settings, empty while
+	// they are those of the configuration
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// SettingsStore keeps the current settings
+type SettingsStore struct {
+	settings Settings
+	mutex    sync.RWMutex
+}
+
+// NewSettingsStore creates a settings store starting with the settings
+func NewSettingsStore(settings Settings) *SettingsStore {
+	return &SettingsStore{settings: settings}
+}
+
+// Get returns the current settings
+func (s *SettingsStore) Get() Settings {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.settings
+}
+
+// Set replaces the settings, returning those it replaced
+func (s *SettingsStore) Set(settings Settings) Settings {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	before := s.settings
+	s.settings = settings
+	return before
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"maps"
+	"sync"
+)
+
+// Keyboard shortcut actions
+const (
+	ShortcutSearchRooms = "search_rooms"
+	ShortcutNextUnread  = "next_unread"
+	ShortcutEditLast    = "edit_last"
+	ShortcutHelp        = "help"
+)
+
+// ShortcutActions lists the shortcut actions in the order of the help overlay
+var ShortcutActions = []string{ShortcutSearchRooms, ShortcutNextUnread, ShortcutEditLast, ShortcutHelp}
+
+// Keymap maps shortcut actions to keys, written as the modifiers ctrl, alt,
+// shift and meta in that order followed by the key, such as "/" or
+// "alt+arrowdown"
+type Keymap map[string]string
+
+// DefaultKeymap returns the bindings of visitors who changed none
+func DefaultKeymap() Keymap {
+	return Keymap{
+		ShortcutSearchRooms: "/",
+		ShortcutNextUnread:  "alt+arrowdown",
+		ShortcutEditLast:    "alt+arrowup",
+		ShortcutHelp:        "?",
+	}
+}
+
+// ShortcutStore manages the keyboard shortcuts customized by visitors
+type ShortcutStore struct {
+	keymaps map[string]Keymap
+	mutex   sync.RWMutex
+}
+
+// NewShortcutStore creates a new shortcut store
+func NewShortcutStore() *ShortcutStore {
+	return &ShortcutStore{
+		keymaps: make(map[string]Keymap),
+	}
+}
+
+// GetKeymap returns the bindings of a visitor, the defaults for the actions
+// they did not change
+func (s *ShortcutStore) GetKeymap(visitorID string) Keymap {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keymap := DefaultKeymap()
+	maps.Copy(keymap, s.keymaps[visitorID])
+	return keymap
+}
+
+// SetKeymap stores the bindings of a visitor
+func (s *ShortcutStore) SetKeymap(visitorID string, keymap Keymap) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keymaps[visitorID] = maps.Clone(keymap)
+}
+
+// ResetKeymap restores the default bindings of a visitor
+func (s *ShortcutStore) ResetKeymap(visitorID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keymaps, visitorID)
+}
@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"fmt"
+	"htmx/internal/models"
+)
+
+// Admins returns the admin accounts kept in the database, oldest first. The
+// server loads them into its admin store at startup
+func (d *DB) Admins() ([]*models.Admin, error) {
+	rows, err := d.db.Query("SELECT username, password_hash, created_at FROM admins ORDER BY created_at, username")
+	if err != nil {
+		return nil, fmt.Errorf("reading admins: %w", err)
+	}
+	defer rows.Close()
+	admins := []*models.Admin{}
+	for rows.Next() {
+		var admin models.Admin
+		var createdAt int64
+		if err := rows.Scan(&admin.Username, &admin.PasswordHash, &createdAt); err != nil {
+			return nil, fmt.Errorf("reading admins: %w", err)
+		}
+		admin.CreatedAt = unixTime(createdAt)
+		admins = append(admins, &admin)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading admins: %w", err)
+	}
+	return admins, nil
+}
+
+// AddAdmin keeps an admin account, returning false if the username is taken
+func (d *DB) AddAdmin(admin *models.Admin) (bool, error) {
+	result, err := d.db.Exec("INSERT INTO admins (username, password_hash, created_at) VALUES (?, ?, ?) ON CONFLICT (username) DO NOTHING",
+		admin.Username, admin.PasswordHash, admin.CreatedAt.UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("saving admin %s: %w", admin.Username, err)
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("saving admin %s: %w", admin.Username, err)
+	}
+	return added == 1, nil
+}
@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"htmx/internal/models"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chatColumns are the columns scanChat reads, in order
+const chatColumns = "id, room_id, username, message, bot, origin, avatar_url, created_at"
+
+// ChatStore keeps the chat messages in the database, reading them from it
+// on every call. Only the number of messages is kept in memory
+type ChatStore struct {
+	db    *sql.DB
+	count atomic.Int64
+	// observers is only added to at startup
+	observers []func(roomID string)
+	// mutex serializes the writes, which SQLite runs one at a time anyway,
+	// so the count and the observers follow the order of the changes
+	mutex sync.Mutex
+}
+
+// newChatStore counts the messages of the database
+func newChatStore(db *sql.DB) (*ChatStore, error) {
+	s := &ChatStore{db: db}
+	var count int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM chats").Scan(&count); err != nil {
+		return nil, err
+	}
+	s.count.Store(count)
+	return s, nil
+}
+
+// scanner is a row being read, from sql.Row or sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanChat reads a row of chatColumns
+func scanChat(row scanner) (*models.Chat, error) {
+	var chat models.Chat
+	var createdAt int64
+	err := row.Scan(&chat.ID, &chat.RoomID, &chat.Username, &chat.Message, &chat.Bot, &chat.Origin, &chat.AvatarURL, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	chat.CreatedAt = unixTime(createdAt)
+	return &chat, nil
+}
+
+// queryChats returns the chats a query selects, logging a failure and
+// returning the chats read until then
+func queryChats(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, query string, args ...any) []*models.Chat {
+	chats := []*models.Chat{}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		slog.Error("reading messages failed", "error", err)
+		return chats
+	}
+	defer rows.Close()
+	for rows.Next() {
+		chat, err := scanChat(rows)
+		if err != nil {
+			slog.Error("reading messages failed", "error", err)
+			return chats
+		}
+		chats = append(chats, chat)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("reading messages failed", "error", err)
+	}
+	return chats
+}
+
+// queryCount returns the number a count query selects, or 0 when it fails
+func queryCount(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, query string, args ...any) int {
+	var count int
+	if err := q.QueryRow(query, args...).Scan(&count); err != nil {
+		slog.Error("counting messages failed", "error", err)
+		return 0
+	}
+	return count
+}
+
+// GetChats returns all chats, oldest first
+func (s *ChatStore) GetChats() []*models.Chat {
+	return queryChats(s.db, "SELECT "+chatColumns+" FROM chats ORDER BY created_at, id")
+}
+
+// GetChat returns a chat by ID
+func (s *ChatStore) GetChat(id string) (*models.Chat, bool) {
+	chat, err := scanChat(s.db.QueryRow("SELECT "+chatColumns+" FROM chats WHERE id = ?", id))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("reading message failed", "chat", id, "error", err)
+		}
+		return nil, false
+	}
+	return chat, true
+}
+
+// GetChatsByRoom returns all chats for a specific room, oldest first
+func (s *ChatStore) GetChatsByRoom(roomID string) []*models.Chat {
+	return queryChats(s.db, "SELECT "+chatColumns+" FROM chats WHERE room_id = ? ORDER BY created_at, seq", roomID)
+}
+
+// GetChatsByRoomPage returns at most limit chats of a room, oldest first,
+// starting at offset, and the number of chats in the room. Both are read
+// in one transaction, so they agree
+func (s *ChatStore) GetChatsByRoomPage(roomID string, offset, limit int) ([]*models.Chat, int) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("reading messages failed", "room", roomID, "error", err)
+		return []*models.Chat{}, 0
+	}
+	defer tx.Rollback()
+
+	total := queryCount(tx, "SELECT COUNT(*) FROM chats WHERE room_id = ?", roomID)
+	chats := queryChats(tx, "SELECT "+chatColumns+" FROM chats WHERE room_id = ? ORDER BY created_at, seq LIMIT ? OFFSET ?",
+		roomID, max(limit, 0), max(offset, 0))
+	return chats, total
+}
+
+// ForEachChatInRoom calls fn with each chat of a room, oldest first, until
+// fn returns false. The chats are read as fn goes, so a large room is not
+// loaded at once; fn must not change the chats of the room
+func (s *ChatStore) ForEachChatInRoom(roomID string, fn func(chat *models.Chat) bool) {
+	rows, err := s.db.Query("SELECT "+chatColumns+" FROM chats WHERE room_id = ? ORDER BY created_at, seq", roomID)
+	if err != nil {
+		slog.Error("reading messages failed", "room", roomID, "error", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		chat, err := scanChat(rows)
+		if err != nil {
+			slog.Error("reading messages failed", "room", roomID, "error", err)
+			return
+		}
+		if !fn(chat) {
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("reading messages failed", "room", roomID, "error", err)
+	}
+}
+
+// CountSince returns the number of chats of a room created at or after since
+func (s *ChatStore) CountSince(roomID string, since time.Time) int {
+	return queryCount(s.db, "SELECT COUNT(*) FROM chats WHERE room_id = ? AND created_at >= ?", roomID, since.UnixNano())
+}
+
+// CountByRoom returns the number of chats in a room
+func (s *ChatStore) CountByRoom(roomID string) int {
+	return queryCount(s.db, "SELECT COUNT(*) FROM chats WHERE room_id = ?", roomID)
+}
+
+// AddChat adds a new chat message, replacing one with the same ID. A
+// replaced message keeps its place among those created at the same time,
+// and one moved to another room changes its old room too
+func (s *ChatStore) AddChat(chat *models.Chat) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var oldRoomID string
+	err := s.db.QueryRow("SELECT room_id FROM chats WHERE id = ?", chat.ID).Scan(&oldRoomID)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("saving message %s: %w", chat.ID, err)
+	}
+	_, err = s.db.Exec(`INSERT INTO chats (`+chatColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET room_id = excluded.room_id, username = excluded.username,
+			message = excluded.message, bot = excluded.bot, origin = excluded.origin,
+			avatar_url = excluded.avatar_url, created_at = excluded.created_at`,
+		chat.ID, chat.RoomID, chat.Username, chat.Message, chat.Bot, chat.Origin, chat.AvatarURL, chat.CreatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("saving message %s: %w", chat.ID, err)
+	}
+	if !exists {
+		s.count.Add(1)
+	}
+	s.changed(chat.RoomID)
+	if exists && oldRoomID != chat.RoomID {
+		s.changed(oldRoomID)
+	}
+	return nil
+}
+
+// DeleteChat removes a chat message
+func (s *ChatStore) DeleteChat(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var roomID string
+	err := s.db.QueryRow("DELETE FROM chats WHERE id = ? RETURNING room_id", id).Scan(&roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("deleting message %s: %w", id, err)
+	}
+	s.count.Add(-1)
+	s.changed(roomID)
+	return true, nil
+}
+
+// DeleteChatsByRoom removes all chats for a specific room
+func (s *ChatStore) DeleteChatsByRoom(roomID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.db.Exec("DELETE FROM chats WHERE room_id = ?", roomID)
+	if err != nil {
+		return fmt.Errorf("deleting messages of room %s: %w", roomID, err)
+	}
+	deleted, _ := result.RowsAffected()
+	s.count.Add(-deleted)
+	s.changed(roomID)
+	return nil
+}
+
+// DeleteChatsBefore removes the chats created before cutoff, returning how
+// many it removed. The chats are deleted in a transaction, so a failure
+// removes none
+func (s *ChatStore) DeleteChatsBefore(cutoff time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("DELETE FROM chats WHERE created_at < ? RETURNING room_id", cutoff.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	deleted := 0
+	rooms := make(map[string]bool)
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("deleting messages: %w", err)
+		}
+		deleted++
+		rooms[roomID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+
+	s.count.Add(int64(-deleted))
+	for roomID := range rooms {
+		s.changed(roomID)
+	}
+	return deleted, nil
+}
+
+// Observe calls fn with the ID of the room of each message added or
+// deleted, once the change is saved. fn runs with the store locked, so it
+// must not use the store. Observers are added at startup, before the store
+// is used
+func (s *ChatStore) Observe(fn func(roomID string)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.observers = append(s.observers, fn)
+}
+
+// changed tells the observers about a change to the messages of a room
+func (s *ChatStore) changed(roomID string) {
+	for _, fn := range s.observers {
+		fn(roomID)
+	}
+}
+
+// Count returns the number of chats in the store
+func (s *ChatStore) Count() int {
+	return int(s.count.Load())
+}
+
+// Ping reports whether the database is reachable
+func (s *ChatStore) Ping() error {
+	return s.db.Ping()
+}
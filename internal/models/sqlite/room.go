@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"htmx/internal/models"
+	"sync"
+)
+
+// RoomStore keeps the rooms in the database. Every room is also kept in
+// memory, as the rooms are read on every page: reads never reach the
+// database, and changes reach the memory only once saved
+type RoomStore struct {
+	db    *sql.DB
+	cache *models.RoomStore
+	// mutex keeps the cache in the order the changes were saved
+	mutex sync.Mutex
+}
+
+// newRoomStore loads the rooms of the database
+func newRoomStore(db *sql.DB) (*RoomStore, error) {
+	s := &RoomStore{db: db, cache: models.NewRoomStore()}
+	rows, err := db.Query("SELECT id, name, created_at FROM rooms")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var room models.Room
+		var createdAt int64
+		if err := rows.Scan(&room.ID, &room.Name, &createdAt); err != nil {
+			return nil, err
+		}
+		room.CreatedAt = unixTime(createdAt)
+		s.cache.AddRoom(&room)
+	}
+	return s, rows.Err()
+}
+
+// GetRooms returns all rooms, oldest first. Callers must not modify the
+// slice
+func (s *RoomStore) GetRooms() []*models.Room {
+	return s.cache.GetRooms()
+}
+
+// ForEachRoom calls fn with each room, oldest first, until fn returns false
+func (s *RoomStore) ForEachRoom(fn func(room *models.Room) bool) {
+	s.cache.ForEachRoom(fn)
+}
+
+// GetRoom returns a room by ID
+func (s *RoomStore) GetRoom(id string) (*models.Room, bool) {
+	return s.cache.GetRoom(id)
+}
+
+// AddRoom adds a new room, replacing one with the same ID
+func (s *RoomStore) AddRoom(room *models.Room) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := s.db.Exec(`INSERT INTO rooms (id, name, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, created_at = excluded.created_at`,
+		room.ID, room.Name, room.CreatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("saving room %s: %w", room.ID, err)
+	}
+	return s.cache.AddRoom(room)
+}
+
+// UpdateRoom updates an existing room
+func (s *RoomStore) UpdateRoom(room *models.Room) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.cache.GetRoom(room.ID); !exists {
+		return false, nil
+	}
+	_, err := s.db.Exec("UPDATE rooms SET name = ?, created_at = ? WHERE id = ?", room.Name, room.CreatedAt.UnixNano(), room.ID)
+	if err != nil {
+		return false, fmt.Errorf("saving room %s: %w", room.ID, err)
+	}
+	return s.cache.UpdateRoom(room)
+}
+
+// DeleteRoom removes a room
+func (s *RoomStore) DeleteRoom(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.cache.GetRoom(id); !exists {
+		return false, nil
+	}
+	if _, err := s.db.Exec("DELETE FROM rooms WHERE id = ?", id); err != nil {
+		return false, fmt.Errorf("deleting room %s: %w", id, err)
+	}
+	return s.cache.DeleteRoom(id)
+}
+
+// Observe calls fn with the ID of each room added, updated or deleted, once
+// the change is saved. fn runs with the store locked, so it must not change
+// the store
+func (s *RoomStore) Observe(fn func(roomID string)) {
+	s.cache.Observe(fn)
+}
+
+// Count returns the number of rooms in the store
+func (s *RoomStore) Count() int {
+	return s.cache.Count()
+}
+
+// Ping reports whether the database is reachable
+func (s *RoomStore) Ping() error {
+	return s.db.Ping()
+}
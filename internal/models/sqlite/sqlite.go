@@ -0,0 +1,153 @@
+// Package sqlite keeps the rooms and messages in a SQLite database, so they
+// survive restarts, along with the admin accounts made by create-admin. Its
+// stores implement models.RoomRepository and models.ChatRepository and pass
+// the storetest suite, behaving as the in-memory stores do. The driver is
+// pure Go, so builds need no C compiler.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pragmas are applied to every connection: writers wait for each other
+// rather than fail, and readers do not block the writer
+const pragmas = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+
+// migrations build the schema, one version each. A change of the schema
+// adds a migration at the end, never changes one already released. Times are Unix nanoseconds,
+// so they sort and compare exactly; seq keeps the messages created at the
+// same time in the order they were added
+var migrations = []string{
+	`CREATE TABLE rooms (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE TABLE chats (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL UNIQUE,
+		room_id TEXT NOT NULL,
+		username TEXT NOT NULL,
+		message TEXT NOT NULL,
+		bot INTEGER NOT NULL DEFAULT 0,
+		origin TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX chats_room ON chats (room_id, created_at, seq);
+	CREATE INDEX chats_created ON chats (created_at);`,
+	`CREATE TABLE admins (
+		username TEXT PRIMARY KEY,
+		password_hash BLOB NOT NULL,
+		created_at INTEGER NOT NULL
+	);`,
+}
+
+// DB is an open database and the stores over it
+type DB struct {
+	db    *sql.DB
+	rooms *RoomStore
+	chats *ChatStore
+}
+
+// Open opens the database at path, creating it if missing, and migrates its
+// schema to the latest version
+func Open(path string) (*DB, error) {
+	// SQLite reports a missing directory as a mysterious failure to open
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path+pragmas)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	applied, err := migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+	if applied > 0 {
+		slog.Info("database migrated", "path", path, "version", len(migrations), "applied", applied)
+	}
+
+	d := &DB{db: db}
+	if d.rooms, err = newRoomStore(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("loading rooms: %w", err)
+	}
+	if d.chats, err = newChatStore(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("counting messages: %w", err)
+	}
+	return d, nil
+}
+
+// migrate applies the migrations the database lacks, each in a transaction
+// of its own, returning how many it applied. The version is kept in the
+// user_version of the database
+func migrate(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("schema version %d is newer than this build supports (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return i - version, err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return i - version, fmt.Errorf("version %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return i - version, err
+		}
+		if err := tx.Commit(); err != nil {
+			return i - version, err
+		}
+	}
+	return len(migrations) - version, nil
+}
+
+// Rooms returns the room store of the database
+func (d *DB) Rooms() *RoomStore {
+	return d.rooms
+}
+
+// Chats returns the chat store of the database
+func (d *DB) Chats() *ChatStore {
+	return d.chats
+}
+
+// SchemaVersion returns the version of the schema, read from the database,
+// and the latest version this build migrates it to
+func (d *DB) SchemaVersion() (version, latest int, err error) {
+	err = d.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, len(migrations), err
+}
+
+// Close closes the database, once the stores are no longer used
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// unixTime converts a time column back to a time
+func unixTime(nanos int64) time.Time {
+	return time.Unix(0, nanos)
+}
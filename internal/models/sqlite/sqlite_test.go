@@ -0,0 +1,158 @@
+package sqlite_test
+
+import (
+	"database/sql"
+	"htmx/internal/models"
+	"htmx/internal/models/sqlite"
+	"htmx/internal/models/storetest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// open opens the database at path, closed when the test ends
+func open(t *testing.T, path string) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db := open(t, filepath.Join(t.TempDir(), "test.db"))
+		return storetest.Stores{Rooms: db.Rooms(), Chats: db.Chats()}
+	})
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.Rooms().AddRoom(&models.Room{ID: "r", Name: "General", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Chats().AddChat(&models.Chat{ID: "c", RoomID: "r", Username: "alice", Message: "hello", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = open(t, path)
+	if room, ok := db.Rooms().GetRoom("r"); !ok || room.Name != "General" || !room.CreatedAt.Equal(created) {
+		t.Errorf("room after reopening = %+v, %v", room, ok)
+	}
+	if chat, ok := db.Chats().GetChat("c"); !ok || chat.Message != "hello" {
+		t.Errorf("chat after reopening = %+v, %v", chat, ok)
+	}
+	if n := db.Chats().Count(); n != 1 {
+		t.Errorf("Count after reopening = %d, want 1", n)
+	}
+}
+
+func TestFailedWrites(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "test.db"))
+	rooms, chats := db.Rooms(), db.Chats()
+	room := &models.Room{ID: "r", Name: "General", CreatedAt: time.Now()}
+	if err := rooms.AddRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	if err := chats.AddChat(&models.Chat{ID: "c", RoomID: "r", Username: "alice", Message: "hello", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	observed := 0
+	rooms.Observe(func(string) { observed++ })
+	chats.Observe(func(string) { observed++ })
+
+	// Every write fails once the database is closed, changing nothing
+	db.Close()
+	if err := rooms.AddRoom(&models.Room{ID: "s", Name: "Other", CreatedAt: time.Now()}); err == nil {
+		t.Error("AddRoom on a closed database succeeded")
+	}
+	if _, ok := rooms.GetRoom("s"); ok {
+		t.Error("a room that failed to save is listed")
+	}
+	if ok, err := rooms.UpdateRoom(&models.Room{ID: "r", Name: "Renamed", CreatedAt: room.CreatedAt}); ok || err == nil {
+		t.Errorf("UpdateRoom on a closed database = %v, %v, want an error", ok, err)
+	}
+	if got, _ := rooms.GetRoom("r"); got.Name != "General" {
+		t.Errorf("name after a failed update = %q, want General", got.Name)
+	}
+	if ok, err := rooms.DeleteRoom("r"); ok || err == nil {
+		t.Errorf("DeleteRoom on a closed database = %v, %v, want an error", ok, err)
+	}
+	if _, ok := rooms.GetRoom("r"); !ok {
+		t.Error("a room that failed to be deleted is gone")
+	}
+
+	if err := chats.AddChat(&models.Chat{ID: "d", RoomID: "r", Username: "bob", Message: "hi", CreatedAt: time.Now()}); err == nil {
+		t.Error("AddChat on a closed database succeeded")
+	}
+	if ok, err := chats.DeleteChat("c"); ok || err == nil {
+		t.Errorf("DeleteChat on a closed database = %v, %v, want an error", ok, err)
+	}
+	if err := chats.DeleteChatsByRoom("r"); err == nil {
+		t.Error("DeleteChatsByRoom on a closed database succeeded")
+	}
+	if n, err := chats.DeleteChatsBefore(time.Now().Add(time.Hour)); n != 0 || err == nil {
+		t.Errorf("DeleteChatsBefore on a closed database = %d, %v, want an error", n, err)
+	}
+	if n := chats.Count(); n != 1 {
+		t.Errorf("Count after failed writes = %d, want 1", n)
+	}
+	if observed != 0 {
+		t.Errorf("observers told of %d failed writes, want none", observed)
+	}
+}
+
+func TestAdmins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	admin, err := models.NewAdmin("alice", "secret", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, err := db.AddAdmin(admin); err != nil || !added {
+		t.Fatalf("AddAdmin = %v, %v, want true", added, err)
+	}
+	taken, _ := models.NewAdmin("alice", "other", time.Now())
+	if added, err := db.AddAdmin(taken); err != nil || added {
+		t.Errorf("AddAdmin of a taken username = %v, %v, want false", added, err)
+	}
+	db.Close()
+
+	admins, err := open(t, path).Admins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(admins) != 1 || admins[0].Username != "alice" || !admins[0].CreatedAt.Equal(admin.CreatedAt) {
+		t.Fatalf("admins after reopening = %+v", admins)
+	}
+	if !admins[0].CheckPassword("secret") || admins[0].CheckPassword("other") {
+		t.Error("the password of the admin changed on reopening")
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	version, latest, err := db.SchemaVersion()
+	if err != nil || version != latest || latest < 2 {
+		t.Fatalf("SchemaVersion = %d, %d, %v after opening", version, latest, err)
+	}
+
+	// Another process rolling the schema back shows on the next read
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec("PRAGMA user_version = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if version, _, err := db.SchemaVersion(); err != nil || version != 1 {
+		t.Errorf("SchemaVersion = %d, %v, want 1", version, err)
+	}
+}
@@ -0,0 +1,10 @@
+package models_test
+
+import (
+	"htmx/internal/models/storetest"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Memory)
+}
@@ -0,0 +1,572 @@
+// Package storetest is the conformance suite of the room and chat stores.
+// Every backend runs it from its own tests, the in-memory one from those of
+// package models, so they all behave as the in-memory stores the handlers
+// were written against:
+//
+//	func TestStores(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storetest.Stores {
+//			return openTestStores(t)
+//		})
+//	}
+//
+// Run the suite with -race: the concurrency tests rely on it to catch
+// unsynchronized access.
+package storetest
+
+import (
+	"fmt"
+	"htmx/internal/models"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stores are the stores of one backend, empty when handed to a test
+type Stores struct {
+	Rooms models.RoomRepository
+	Chats models.ChatRepository
+}
+
+// Memory returns empty in-memory stores, the reference implementation,
+// ordering their messages deterministically
+func Memory(t *testing.T) Stores {
+	chats := models.NewChatStore()
+	chats.SetDeterministic(true)
+	return Stores{Rooms: models.NewRoomStore(), Chats: chats}
+}
+
+// contract is a test of the suite, run against fresh stores
+type contract struct {
+	name string
+	test func(t *testing.T, s Stores)
+}
+
+var contracts = []contract{
+	{"RoomCRUD", testRoomCRUD},
+	{"RoomOrder", testRoomOrder},
+	{"RoomObservers", testRoomObservers},
+	{"ChatCRUD", testChatCRUD},
+	{"ChatOrder", testChatOrder},
+	{"ChatPagination", testChatPagination},
+	{"ChatCounts", testChatCounts},
+	{"ChatObservers", testChatObservers},
+	{"DeleteChatsBefore", testDeleteChatsBefore},
+	{"RoomCascade", testRoomCascade},
+	{"ConcurrentRooms", testConcurrentRooms},
+	{"ConcurrentChats", testConcurrentChats},
+	{"Ping", testPing},
+}
+
+// Run runs every test of the suite as a subtest, each against the fresh
+// stores newStores returns
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	for _, c := range contracts {
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newStores(t))
+		})
+	}
+}
+
+// base is the time the sample data is created around, truncated so
+// backends storing times with less precision compare equal
+var base = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func room(id string, age time.Duration) *models.Room {
+	return &models.Room{ID: id, Name: "Room " + id, CreatedAt: base.Add(-age)}
+}
+
+func chat(id, roomID string, at time.Duration) *models.Chat {
+	return &models.Chat{ID: id, RoomID: roomID, Username: "user-" + id, Message: "message " + id, CreatedAt: base.Add(at)}
+}
+
+// roomIDs returns the IDs of rooms, in order
+func roomIDs(rooms []*models.Room) []string {
+	ids := make([]string, len(rooms))
+	for i, room := range rooms {
+		ids[i] = room.ID
+	}
+	return ids
+}
+
+// chatIDs returns the IDs of chats, in order
+func chatIDs(chats []*models.Chat) []string {
+	ids := make([]string, len(chats))
+	for i, chat := range chats {
+		ids[i] = chat.ID
+	}
+	return ids
+}
+
+// equalIDs fails the test if got is not want, naming what was compared
+func equalIDs(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+// The changes below fail the test when the store fails to save them. They
+// report with Errorf, as the concurrency tests call them from goroutines
+
+func addRoom(t *testing.T, s Stores, room *models.Room) {
+	t.Helper()
+	if err := s.Rooms.AddRoom(room); err != nil {
+		t.Errorf("AddRoom(%s): %v", room.ID, err)
+	}
+}
+
+func updateRoom(t *testing.T, s Stores, room *models.Room) bool {
+	t.Helper()
+	ok, err := s.Rooms.UpdateRoom(room)
+	if err != nil {
+		t.Errorf("UpdateRoom(%s): %v", room.ID, err)
+	}
+	return ok
+}
+
+func deleteRoom(t *testing.T, s Stores, id string) bool {
+	t.Helper()
+	ok, err := s.Rooms.DeleteRoom(id)
+	if err != nil {
+		t.Errorf("DeleteRoom(%s): %v", id, err)
+	}
+	return ok
+}
+
+func addChat(t *testing.T, s Stores, chat *models.Chat) {
+	t.Helper()
+	if err := s.Chats.AddChat(chat); err != nil {
+		t.Errorf("AddChat(%s): %v", chat.ID, err)
+	}
+}
+
+func deleteChat(t *testing.T, s Stores, id string) bool {
+	t.Helper()
+	ok, err := s.Chats.DeleteChat(id)
+	if err != nil {
+		t.Errorf("DeleteChat(%s): %v", id, err)
+	}
+	return ok
+}
+
+func deleteChatsByRoom(t *testing.T, s Stores, roomID string) {
+	t.Helper()
+	if err := s.Chats.DeleteChatsByRoom(roomID); err != nil {
+		t.Errorf("DeleteChatsByRoom(%s): %v", roomID, err)
+	}
+}
+
+func deleteChatsBefore(t *testing.T, s Stores, cutoff time.Time) int {
+	t.Helper()
+	n, err := s.Chats.DeleteChatsBefore(cutoff)
+	if err != nil {
+		t.Errorf("DeleteChatsBefore(%s): %v", cutoff, err)
+	}
+	return n
+}
+
+func testRoomCRUD(t *testing.T, s Stores) {
+	if _, ok := s.Rooms.GetRoom("missing"); ok {
+		t.Error("GetRoom found a room in an empty store")
+	}
+	if updateRoom(t, s, room("missing", 0)) {
+		t.Error("UpdateRoom of a missing room reported success")
+	}
+	if deleteRoom(t, s, "missing") {
+		t.Error("DeleteRoom of a missing room reported success")
+	}
+
+	addRoom(t, s, room("a", time.Hour))
+	got, ok := s.Rooms.GetRoom("a")
+	if !ok || got.Name != "Room a" || !got.CreatedAt.Equal(base.Add(-time.Hour)) {
+		t.Fatalf("GetRoom after AddRoom = %+v, %v", got, ok)
+	}
+	if n := s.Rooms.Count(); n != 1 {
+		t.Errorf("Count = %d, want 1", n)
+	}
+
+	updated := room("a", time.Hour)
+	updated.Name = "Renamed"
+	if !updateRoom(t, s, updated) {
+		t.Fatal("UpdateRoom of an existing room failed")
+	}
+	if got, _ := s.Rooms.GetRoom("a"); got.Name != "Renamed" {
+		t.Errorf("name after UpdateRoom = %q, want Renamed", got.Name)
+	}
+	if n := s.Rooms.Count(); n != 1 {
+		t.Errorf("Count after UpdateRoom = %d, want 1", n)
+	}
+
+	if !deleteRoom(t, s, "a") {
+		t.Fatal("DeleteRoom of an existing room failed")
+	}
+	if _, ok := s.Rooms.GetRoom("a"); ok {
+		t.Error("GetRoom found a deleted room")
+	}
+	if deleteRoom(t, s, "a") {
+		t.Error("DeleteRoom of a deleted room reported success")
+	}
+	if n := s.Rooms.Count(); n != 0 {
+		t.Errorf("Count after DeleteRoom = %d, want 0", n)
+	}
+}
+
+func testRoomOrder(t *testing.T, s Stores) {
+	addRoom(t, s, room("c", time.Minute))
+	addRoom(t, s, room("b", time.Hour))
+	addRoom(t, s, room("a", time.Minute))
+	addRoom(t, s, room("d", 2*time.Hour))
+
+	// Oldest first, rooms created at the same time by ID
+	want := []string{"d", "b", "a", "c"}
+	equalIDs(t, "GetRooms", roomIDs(s.Rooms.GetRooms()), want)
+
+	var walked []string
+	s.Rooms.ForEachRoom(func(room *models.Room) bool {
+		walked = append(walked, room.ID)
+		return len(walked) < 3
+	})
+	equalIDs(t, "ForEachRoom stopped after 3", walked, want[:3])
+
+	// Renaming keeps the place of a room
+	renamed := room("b", time.Hour)
+	renamed.Name = "Renamed"
+	updateRoom(t, s, renamed)
+	equalIDs(t, "GetRooms after UpdateRoom", roomIDs(s.Rooms.GetRooms()), want)
+}
+
+func testRoomObservers(t *testing.T, s Stores) {
+	var mutex sync.Mutex
+	var seen []string
+	s.Rooms.Observe(func(roomID string) {
+		mutex.Lock()
+		seen = append(seen, roomID)
+		mutex.Unlock()
+	})
+
+	addRoom(t, s, room("a", 0))
+	updateRoom(t, s, room("a", 0))
+	deleteRoom(t, s, "a")
+	deleteRoom(t, s, "missing")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	equalIDs(t, "observed room changes", seen, []string{"a", "a", "a"})
+}
+
+func testChatCRUD(t *testing.T, s Stores) {
+	if _, ok := s.Chats.GetChat("missing"); ok {
+		t.Error("GetChat found a chat in an empty store")
+	}
+	if deleteChat(t, s, "missing") {
+		t.Error("DeleteChat of a missing chat reported success")
+	}
+	if chats := s.Chats.GetChatsByRoom("missing"); chats == nil || len(chats) != 0 {
+		t.Errorf("GetChatsByRoom of an unknown room = %#v, want an empty slice", chats)
+	}
+
+	addChat(t, s, chat("1", "r", 0))
+	got, ok := s.Chats.GetChat("1")
+	if !ok || got.RoomID != "r" || got.Username != "user-1" || got.Message != "message 1" || !got.CreatedAt.Equal(base) {
+		t.Fatalf("GetChat after AddChat = %+v, %v", got, ok)
+	}
+	if n := s.Chats.Count(); n != 1 {
+		t.Errorf("Count = %d, want 1", n)
+	}
+
+	if !deleteChat(t, s, "1") {
+		t.Fatal("DeleteChat of an existing chat failed")
+	}
+	if _, ok := s.Chats.GetChat("1"); ok {
+		t.Error("GetChat found a deleted chat")
+	}
+	if deleteChat(t, s, "1") {
+		t.Error("DeleteChat of a deleted chat reported success")
+	}
+	if n, m := s.Chats.Count(), s.Chats.CountByRoom("r"); n != 0 || m != 0 {
+		t.Errorf("Count, CountByRoom after DeleteChat = %d, %d, want 0, 0", n, m)
+	}
+	equalIDs(t, "GetChatsByRoom after DeleteChat", chatIDs(s.Chats.GetChatsByRoom("r")), []string{})
+}
+
+func testChatOrder(t *testing.T, s Stores) {
+	addChat(t, s, chat("2", "r", 2*time.Second))
+	addChat(t, s, chat("3", "r", 3*time.Second))
+	// Arrives late, as federated messages do, and goes in its place
+	addChat(t, s, chat("1", "r", time.Second))
+	// Created at the same time as 3, after it
+	addChat(t, s, chat("3b", "r", 3*time.Second))
+
+	want := []string{"1", "2", "3", "3b"}
+	equalIDs(t, "GetChatsByRoom", chatIDs(s.Chats.GetChatsByRoom("r")), want)
+
+	var walked []string
+	s.Chats.ForEachChatInRoom("r", func(chat *models.Chat) bool {
+		walked = append(walked, chat.ID)
+		return len(walked) < 2
+	})
+	equalIDs(t, "ForEachChatInRoom stopped after 2", walked, want[:2])
+
+	all := chatIDs(s.Chats.GetChats())
+	slices.Sort(all)
+	equalIDs(t, "GetChats", all, []string{"1", "2", "3", "3b"})
+}
+
+func testChatPagination(t *testing.T, s Stores) {
+	for i := range 10 {
+		addChat(t, s, chat(fmt.Sprintf("%02d", i), "r", time.Duration(i)*time.Second))
+	}
+
+	pages := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 3, []string{"00", "01", "02"}},
+		{3, 3, []string{"03", "04", "05"}},
+		{8, 5, []string{"08", "09"}},
+		{10, 5, []string{}},
+		{20, 5, []string{}},
+		{-5, 2, []string{"00", "01"}},
+		{4, 0, []string{}},
+		{4, -1, []string{}},
+	}
+	for _, page := range pages {
+		chats, total := s.Chats.GetChatsByRoomPage("r", page.offset, page.limit)
+		equalIDs(t, fmt.Sprintf("page at %d of %d", page.offset, page.limit), chatIDs(chats), page.want)
+		if total != 10 {
+			t.Errorf("total of page at %d of %d = %d, want 10", page.offset, page.limit, total)
+		}
+	}
+
+	if chats, total := s.Chats.GetChatsByRoomPage("missing", 0, 10); len(chats) != 0 || total != 0 {
+		t.Errorf("page of an unknown room = %d chats, total %d, want none", len(chats), total)
+	}
+}
+
+func testChatCounts(t *testing.T, s Stores) {
+	for i := range 5 {
+		addChat(t, s, chat(fmt.Sprintf("a%d", i), "a", time.Duration(i)*time.Minute))
+	}
+	addChat(t, s, chat("b0", "b", 0))
+
+	if n := s.Chats.Count(); n != 6 {
+		t.Errorf("Count = %d, want 6", n)
+	}
+	if n := s.Chats.CountByRoom("a"); n != 5 {
+		t.Errorf("CountByRoom(a) = %d, want 5", n)
+	}
+	if n := s.Chats.CountByRoom("missing"); n != 0 {
+		t.Errorf("CountByRoom of an unknown room = %d, want 0", n)
+	}
+	// At or after since
+	if n := s.Chats.CountSince("a", base.Add(2*time.Minute)); n != 3 {
+		t.Errorf("CountSince(a, +2m) = %d, want 3", n)
+	}
+	if n := s.Chats.CountSince("a", base.Add(time.Hour)); n != 0 {
+		t.Errorf("CountSince(a, +1h) = %d, want 0", n)
+	}
+
+	// Adding a chat with an existing ID replaces it
+	replaced := chat("a0", "a", 0)
+	replaced.Message = "edited"
+	addChat(t, s, replaced)
+	if n := s.Chats.Count(); n != 6 {
+		t.Errorf("Count after replacing a chat = %d, want 6", n)
+	}
+	if got, _ := s.Chats.GetChat("a0"); got.Message != "edited" {
+		t.Errorf("message after replacing a chat = %q, want edited", got.Message)
+	}
+	// The room keeps one copy, the edited one, in its place
+	if n := s.Chats.CountByRoom("a"); n != 5 {
+		t.Errorf("CountByRoom(a) after replacing a chat = %d, want 5", n)
+	}
+	chats := s.Chats.GetChatsByRoom("a")
+	equalIDs(t, "chats of a after replacing a chat", chatIDs(chats), []string{"a0", "a1", "a2", "a3", "a4"})
+	if len(chats) > 0 && chats[0].Message != "edited" {
+		t.Errorf("first chat of a after replacing it = %q, want edited", chats[0].Message)
+	}
+
+	// A replacement in another room moves the chat there
+	moved := chat("a1", "b", time.Minute)
+	addChat(t, s, moved)
+	if n := s.Chats.Count(); n != 6 {
+		t.Errorf("Count after moving a chat = %d, want 6", n)
+	}
+	equalIDs(t, "chats of a after moving a chat", chatIDs(s.Chats.GetChatsByRoom("a")), []string{"a0", "a2", "a3", "a4"})
+	equalIDs(t, "chats of b after moving a chat", chatIDs(s.Chats.GetChatsByRoom("b")), []string{"b0", "a1"})
+
+	// Deleting a replaced chat leaves nothing of it behind
+	if !deleteChat(t, s, "a0") {
+		t.Fatal("DeleteChat of a replaced chat = false, want true")
+	}
+	if n := s.Chats.Count(); n != 5 {
+		t.Errorf("Count after deleting a replaced chat = %d, want 5", n)
+	}
+	if n := s.Chats.CountByRoom("a"); n != 3 {
+		t.Errorf("CountByRoom(a) after deleting a replaced chat = %d, want 3", n)
+	}
+	equalIDs(t, "chats of a after deleting a replaced chat", chatIDs(s.Chats.GetChatsByRoom("a")), []string{"a2", "a3", "a4"})
+}
+
+func testChatObservers(t *testing.T, s Stores) {
+	var mutex sync.Mutex
+	var seen []string
+	s.Chats.Observe(func(roomID string) {
+		mutex.Lock()
+		seen = append(seen, roomID)
+		mutex.Unlock()
+	})
+
+	addChat(t, s, chat("1", "a", 0))
+	addChat(t, s, chat("2", "b", 0))
+	// Moved to another room, it changes both, the new one first
+	addChat(t, s, chat("2", "c", 0))
+	deleteChat(t, s, "1")
+	deleteChatsByRoom(t, s, "c")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	equalIDs(t, "observed chat changes", seen, []string{"a", "b", "c", "b", "a", "c"})
+}
+
+func testDeleteChatsBefore(t *testing.T, s Stores) {
+	for i := range 4 {
+		addChat(t, s, chat(fmt.Sprintf("a%d", i), "a", time.Duration(i)*time.Hour))
+		addChat(t, s, chat(fmt.Sprintf("b%d", i), "b", time.Duration(i)*time.Hour))
+	}
+
+	// Strictly before the cutoff
+	if n := deleteChatsBefore(t, s, base.Add(2*time.Hour)); n != 4 {
+		t.Errorf("DeleteChatsBefore = %d, want 4", n)
+	}
+	equalIDs(t, "room a after DeleteChatsBefore", chatIDs(s.Chats.GetChatsByRoom("a")), []string{"a2", "a3"})
+	equalIDs(t, "room b after DeleteChatsBefore", chatIDs(s.Chats.GetChatsByRoom("b")), []string{"b2", "b3"})
+	if _, ok := s.Chats.GetChat("a0"); ok {
+		t.Error("GetChat found a chat deleted by DeleteChatsBefore")
+	}
+	if n := s.Chats.Count(); n != 4 {
+		t.Errorf("Count after DeleteChatsBefore = %d, want 4", n)
+	}
+	if n := deleteChatsBefore(t, s, base); n != 0 {
+		t.Errorf("DeleteChatsBefore with nothing older = %d, want 0", n)
+	}
+}
+
+// testRoomCascade checks deleting a room as the handlers do: the room, then
+// its chats, leaving the other rooms alone
+func testRoomCascade(t *testing.T, s Stores) {
+	addRoom(t, s, room("a", time.Hour))
+	addRoom(t, s, room("b", time.Hour))
+	for i := range 3 {
+		addChat(t, s, chat(fmt.Sprintf("a%d", i), "a", time.Duration(i)*time.Second))
+		addChat(t, s, chat(fmt.Sprintf("b%d", i), "b", time.Duration(i)*time.Second))
+	}
+
+	deleteRoom(t, s, "a")
+	deleteChatsByRoom(t, s, "a")
+
+	if _, ok := s.Chats.GetChat("a1"); ok {
+		t.Error("GetChat found a chat of a deleted room")
+	}
+	equalIDs(t, "chats of the deleted room", chatIDs(s.Chats.GetChatsByRoom("a")), []string{})
+	if n := s.Chats.CountByRoom("a"); n != 0 {
+		t.Errorf("CountByRoom of the deleted room = %d, want 0", n)
+	}
+	equalIDs(t, "chats of the other room", chatIDs(s.Chats.GetChatsByRoom("b")), []string{"b0", "b1", "b2"})
+	if n := s.Chats.Count(); n != 3 {
+		t.Errorf("Count after the cascade = %d, want 3", n)
+	}
+	equalIDs(t, "rooms after the cascade", roomIDs(s.Rooms.GetRooms()), []string{"b"})
+
+	// Deleting the chats of a room twice, or of an unknown one, is harmless
+	deleteChatsByRoom(t, s, "a")
+	deleteChatsByRoom(t, s, "missing")
+
+	// A room created again with the same ID starts empty and takes chats
+	addRoom(t, s, room("a", 0))
+	addChat(t, s, chat("a-new", "a", 0))
+	equalIDs(t, "chats of the room created again", chatIDs(s.Chats.GetChatsByRoom("a")), []string{"a-new"})
+}
+
+func testConcurrentRooms(t *testing.T, s Stores) {
+	const workers, rooms = 8, 50
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rooms {
+				id := fmt.Sprintf("w%d-%d", w, i)
+				addRoom(t, s, room(id, time.Duration(i)*time.Second))
+				s.Rooms.GetRooms()
+				if i%2 == 1 {
+					deleteRoom(t, s, id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, want := s.Rooms.Count(), workers*rooms/2; n != want {
+		t.Errorf("Count = %d, want %d", n, want)
+	}
+	if n, want := len(s.Rooms.GetRooms()), workers*rooms/2; n != want {
+		t.Errorf("len(GetRooms) = %d, want %d", n, want)
+	}
+}
+
+func testConcurrentChats(t *testing.T, s Stores) {
+	const workers, chats = 8, 100
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			roomID := fmt.Sprintf("room-%d", w%2)
+			for i := range chats {
+				addChat(t, s, chat(fmt.Sprintf("w%d-%d", w, i), roomID, time.Duration(i)*time.Millisecond))
+				s.Chats.GetChatsByRoomPage(roomID, i/2, 10)
+				s.Chats.CountByRoom(roomID)
+				if i%4 == 3 {
+					deleteChat(t, s, fmt.Sprintf("w%d-%d", w, i))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := workers * chats * 3 / 4
+	if n := s.Chats.Count(); n != want {
+		t.Errorf("Count = %d, want %d", n, want)
+	}
+	total := 0
+	for _, roomID := range []string{"room-0", "room-1"} {
+		chats := s.Chats.GetChatsByRoom(roomID)
+		total += len(chats)
+		if !slices.IsSortedFunc(chats, func(a, b *models.Chat) int { return a.CreatedAt.Compare(b.CreatedAt) }) {
+			t.Errorf("chats of %s are out of order", roomID)
+		}
+		seen := make(map[string]bool)
+		for _, chat := range chats {
+			if seen[chat.ID] {
+				t.Errorf("chat %s listed twice in %s", chat.ID, roomID)
+			}
+			seen[chat.ID] = true
+		}
+	}
+	if total != want {
+		t.Errorf("chats listed by room = %d, want %d", total, want)
+	}
+}
+
+func testPing(t *testing.T, s Stores) {
+	if err := s.Rooms.Ping(); err != nil {
+		t.Errorf("Rooms.Ping = %v", err)
+	}
+	if err := s.Chats.Ping(); err != nil {
+		t.Errorf("Chats.Ping = %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Webhook events
+const (
+	EventRoomCreated = "room.created"
+	EventChatCreated = "chat.created"
+	// EventHubOverloaded and EventHubRecovered alert operators when the
+	// hub starts and stops falling behind its clients
+	EventHubOverloaded = "hub.overloaded"
+	EventHubRecovered  = "hub.recovered"
+)
+
+// WebhookEvents lists the events a webhook can subscribe to
+var WebhookEvents = []string{EventRoomCreated, EventChatCreated, EventHubOverloaded, EventHubRecovered}
+
+// Webhook is an outgoing webhook registered by an admin
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// RoomID limits chat events to one room; empty means every room
+	RoomID string `json:"room_id,omitempty"`
+	// Secret signs the payloads delivered to URL
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the webhook subscribes to the event in the given room
+func (w *Webhook) Matches(event, roomID string) bool {
+	if !slices.Contains(w.Events, event) {
+		return false
+	}
+	return w.RoomID == "" || event != EventChatCreated || w.RoomID == roomID
+}
+
+// Delivery is a webhook payload that could not be delivered after all retries
+type Delivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	URL       string `json:"url"`
+	Event     string `json:"event"`
+	Payload   []byte `json:"payload"`
+	Attempts  int    `json:"attempts"`
+	// Retries is how many times the delivery was queued again after it
+	// was dead-lettered
+	Retries   int       `json:"retries"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// IncomingWebhook lets an external service post into a room through a secret URL
+type IncomingWebhook struct {
+	Token  string `json:"-"`
+	RoomID string `json:"room_id"`
+	// Name is the username of messages that do not set one
+	Name string `json:"name"`
+	// Template, when set, is a text/template that formats any JSON payload
+	// into the message instead of expecting a Slack-style one
+	Template  string    `json:"template,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookStore manages the registered webhooks and failed deliveries
+type WebhookStore struct {
+	ordering
+	webhooks    map[string]*Webhook
+	deadLetters map[string]*Delivery
+	incoming    map[string]*IncomingWebhook
+	mutex       sync.RWMutex
+}
+
+// NewWebhookStore creates a new webhook store
+func NewWebhookStore() *WebhookStore {
+	return &WebhookStore{
+		webhooks:    make(map[string]*Webhook),
+		deadLetters: make(map[string]*Delivery),
+		incoming:    make(map[string]*IncomingWebhook),
+	}
+}
+
+// GetWebhooks returns all webhooks, oldest first
+func (s *WebhookStore) GetWebhooks() []*Webhook {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhooks := make([]*Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	slices.SortFunc(webhooks, func(a, b *Webhook) int {
+		return s.compareTimes(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+	})
+	return webhooks
+}
+
+// GetWebhook returns a webhook by ID
+func (s *WebhookStore) GetWebhook(id string) (*Webhook, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhook, exists := s.webhooks[id]
+	return webhook, exists
+}
+
+// AddWebhook adds a new webhook
+func (s *WebhookStore) AddWebhook(webhook *Webhook) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.webhooks[webhook.ID] = webhook
+}
+
+// DeleteWebhook removes a webhook by ID
+func (s *WebhookStore) DeleteWebhook(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.webhooks[id]; !exists {
+		return false
+	}
+
+	delete(s.webhooks, id)
+	return true
+}
+
+// GetDeadLetters returns the failed deliveries, newest first
+func (s *WebhookStore) GetDeadLetters() []*Delivery {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	deliveries := make([]*Delivery, 0, len(s.deadLetters))
+	for _, delivery := range s.deadLetters {
+		deliveries = append(deliveries, delivery)
+	}
+	slices.SortFunc(deliveries, func(a, b *Delivery) int {
+		return s.compareTimes(b.FailedAt, a.FailedAt, b.ID, a.ID)
+	})
+	return deliveries
+}
+
+// AddDeadLetter records a delivery that failed after all retries
+func (s *WebhookStore) AddDeadLetter(delivery *Delivery) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deadLetters[delivery.ID] = delivery
+}
+
+// TakeDeadLetter removes a failed delivery and returns it
+func (s *WebhookStore) TakeDeadLetter(id string) (*Delivery, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delivery, exists := s.deadLetters[id]
+	delete(s.deadLetters, id)
+	return delivery, exists
+}
+
+// GetIncomingWebhooks returns all incoming webhooks, oldest first
+func (s *WebhookStore) GetIncomingWebhooks() []*IncomingWebhook {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhooks := make([]*IncomingWebhook, 0, len(s.incoming))
+	for _, webhook := range s.incoming {
+		webhooks = append(webhooks, webhook)
+	}
+	slices.SortFunc(webhooks, func(a, b *IncomingWebhook) int {
+		return s.compareTimes(a.CreatedAt, b.CreatedAt, a.Token, b.Token)
+	})
+	return webhooks
+}
+
+// GetIncomingWebhook returns an incoming webhook by token
+func (s *WebhookStore) GetIncomingWebhook(token string) (*IncomingWebhook, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhook, exists := s.incoming[token]
+	return webhook, exists
+}
+
+// AddIncomingWebhook adds a new incoming webhook
+func (s *WebhookStore) AddIncomingWebhook(webhook *IncomingWebhook) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.incoming[webhook.Token] = webhook
+}
+
+// UpdateIncomingWebhook replaces an existing incoming webhook
+func (s *WebhookStore) UpdateIncomingWebhook(webhook *IncomingWebhook) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.incoming[webhook.Token]; !exists {
+		return false
+	}
+
+	s.incoming[webhook.Token] = webhook
+	return true
+}
+
+// DeleteIncomingWebhook removes an incoming webhook by token
+func (s *WebhookStore) DeleteIncomingWebhook(token string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.incoming[token]; !exists {
+		return false
+	}
+
+	delete(s.incoming, token)
+	return true
+}
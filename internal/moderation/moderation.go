@@ -0,0 +1,142 @@
+// Package moderation screens the messages people post for spam and
+// profanity. Each filter of a pipeline may flag a message with a reason;
+// the handlers hold flagged messages in the moderation queue for review
+// instead of posting them, and refuse those a blocking filter flags.
+package moderation
+
+import (
+	"fmt"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"htmx/internal/ratelimit"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter checks a message, returning why it is flagged or "" to let it
+// through. Filters are called concurrently
+type Filter interface {
+	Check(chat *models.Chat) string
+}
+
+// FilterFunc adapts a function to a Filter
+type FilterFunc func(chat *models.Chat) string
+
+// Check calls f
+func (f FilterFunc) Check(chat *models.Chat) string {
+	return f(chat)
+}
+
+// Pipeline runs messages through a list of filters
+type Pipeline struct {
+	filters []Filter
+	// blockers are the filters whose messages are refused rather than held
+	blockers []Filter
+}
+
+// NewPipeline creates a pipeline of the filters, run in order
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// Block adds filters refusing the messages they flag, run before the others
+func (p *Pipeline) Block(filters ...Filter) *Pipeline {
+	p.blockers = append(p.blockers, filters...)
+	return p
+}
+
+// New creates the pipeline of the filters the config enables, along with
+// the rules managed from the admin pages
+func New(cfg config.ModerationConfig, rules *models.FilterRuleStore) *Pipeline {
+	filters := []Filter{Rules(rules, models.FilterFlag)}
+	if len(cfg.Words) > 0 {
+		filters = append(filters, Words(cfg.Words))
+	}
+	if cfg.MaxLinks > 0 {
+		filters = append(filters, Links(cfg.MaxLinks))
+	}
+	if cfg.MaxRepeats > 0 {
+		filters = append(filters, Repeats(cfg.MaxRepeats, cfg.RepeatWindow))
+	}
+	return NewPipeline(filters...).Block(Rules(rules, models.FilterBlock))
+}
+
+// Blocked returns the reason of the first blocking filter flagging the
+// message, "" when it may go on to the other filters
+func (p *Pipeline) Blocked(chat *models.Chat) string {
+	for _, filter := range p.blockers {
+		if reason := filter.Check(chat); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// Check returns the reasons of every filter flagging the message, none when
+// it may be posted
+func (p *Pipeline) Check(chat *models.Chat) []string {
+	var reasons []string
+	for _, filter := range p.filters {
+		if reason := filter.Check(chat); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// Words flags the messages containing any of the words as a whole word,
+// ignoring case
+func Words(words []string) Filter {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, regexp.QuoteMeta(strings.TrimSpace(word)))
+	}
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return FilterFunc(func(chat *models.Chat) string {
+		if word := pattern.FindString(chat.Message); word != "" {
+			return fmt.Sprintf("Profanity: %q", word)
+		}
+		return ""
+	})
+}
+
+// Rules flags the messages matching a rule of the store with the action,
+// reading the store for each message so edits apply at once
+func Rules(rules *models.FilterRuleStore, action string) Filter {
+	return FilterFunc(func(chat *models.Chat) string {
+		if rule, text := rules.Match(chat, action); rule != nil {
+			if rule.Regex {
+				return fmt.Sprintf("Filter rule %q: %q", rule.Pattern, text)
+			}
+			return fmt.Sprintf("Filtered word: %q", text)
+		}
+		return ""
+	})
+}
+
+// linkPattern matches the links of a message, with or without a scheme
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// Links flags the messages with more than max links
+func Links(max int) Filter {
+	return FilterFunc(func(chat *models.Chat) string {
+		if n := len(linkPattern.FindAllStringIndex(chat.Message, -1)); n > max {
+			return fmt.Sprintf("Spam: %d links", n)
+		}
+		return ""
+	})
+}
+
+// Repeats flags a message posted under the same name, ignoring case, more
+// than max times within the window
+func Repeats(max int, window time.Duration) Filter {
+	limiter := ratelimit.New(max, window)
+	return FilterFunc(func(chat *models.Chat) string {
+		key := strings.ToLower(chat.Username) + "\x00" + strings.TrimSpace(chat.Message)
+		if !limiter.Allow(key) {
+			return fmt.Sprintf("Spam: posted more than %d times within %s", max, window)
+		}
+		return ""
+	})
+}
@@ -0,0 +1,228 @@
+// Package openapi builds an OpenAPI 3 document from a typed route registry.
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operation describes a single API route
+type Operation struct {
+	// Method and Path use Gin's syntax, e.g. "/api/rooms/:id"
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	// Deprecated marks operations kept only for existing clients
+	Deprecated bool
+	// Query lists the query parameters
+	Query []Field
+	// Form lists the fields of a form-encoded request body
+	Form []Field
+	// Body is a value whose type describes a JSON request body
+	Body      any
+	Responses []Response
+}
+
+// Field is a query parameter or request body field
+type Field struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Response describes one possible response of an operation
+type Response struct {
+	Status      int
+	Description string
+	// ContentType is "application/json" or "text/html"; empty for no body
+	ContentType string
+	// Body is a value whose type describes a JSON response
+	Body any
+}
+
+// Info describes the API as a whole
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// pathParam matches Gin path parameters
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// Document builds the OpenAPI 3 document for the operations
+func Document(info Info, ops []Operation) map[string]any {
+	paths := make(map[string]map[string]any)
+	for _, op := range ops {
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.Method)] = operation(op)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths": paths,
+	}
+}
+
+// operation builds the OpenAPI operation object
+func operation(op Operation) map[string]any {
+	doc := map[string]any{
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+	if op.Tag != "" {
+		doc["tags"] = []string{op.Tag}
+	}
+	if op.Deprecated {
+		doc["deprecated"] = true
+	}
+
+	var params []map[string]any
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, map[string]any{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	for _, field := range op.Query {
+		params = append(params, map[string]any{
+			"name":        field.Name,
+			"in":          "query",
+			"required":    field.Required,
+			"description": field.Description,
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+	if params != nil {
+		doc["parameters"] = params
+	}
+
+	content := make(map[string]any)
+	if op.Body != nil {
+		content["application/json"] = map[string]any{"schema": Schema(op.Body)}
+	}
+	if len(op.Form) > 0 {
+		properties := make(map[string]any)
+		var required []string
+		for _, field := range op.Form {
+			properties[field.Name] = map[string]any{"type": "string", "description": field.Description}
+			if field.Required {
+				required = append(required, field.Name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if required != nil {
+			schema["required"] = required
+		}
+		content["application/x-www-form-urlencoded"] = map[string]any{"schema": schema}
+	}
+	if len(content) > 0 {
+		doc["requestBody"] = map[string]any{"required": true, "content": content}
+	}
+
+	// Responses sharing a status, such as HTML and JSON variants, are merged
+	responses := make(map[string]map[string]any)
+	for _, resp := range op.Responses {
+		status := strconv.Itoa(resp.Status)
+		entry, ok := responses[status]
+		if !ok {
+			entry = map[string]any{"description": resp.Description}
+			responses[status] = entry
+		} else {
+			entry["description"] = entry["description"].(string) + "; " + resp.Description
+		}
+
+		var schema map[string]any
+		switch {
+		case resp.Body != nil:
+			schema = Schema(resp.Body)
+		case resp.ContentType != "":
+			schema = map[string]any{"type": "string"}
+		default:
+			continue
+		}
+		content, _ := entry["content"].(map[string]any)
+		if content == nil {
+			content = make(map[string]any)
+			entry["content"] = content
+		}
+		content[resp.ContentType] = map[string]any{"schema": schema}
+	}
+	doc["responses"] = responses
+
+	return doc
+}
+
+// operationID derives a stable identifier such as "postApiRoomsIdChats"
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '-' || r == '.'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// Schema describes the JSON encoding of v's type using its json struct tags
+func Schema(v any) map[string]any {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+// timeType is encoded as an RFC 3339 string
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes the JSON encoding of t
+func schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type)
+		}
+		return map[string]any{"type": "object", "properties": properties}
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,81 @@
+// Package ratelimit caps how often each client may do something, such as
+// reporting a message, within a sliding window.
+package ratelimit
+
+import (
+	"htmx/internal/clock"
+	"sync"
+	"time"
+)
+
+// Limiter allows each key a number of attempts within a window
+type Limiter struct {
+	limit  int
+	window time.Duration
+	// attempts holds the times of the allowed attempts of each key, oldest
+	// first, within the window
+	attempts map[string][]time.Time
+	// swept is when the keys without an attempt in the window were last
+	// forgotten
+	swept time.Time
+	clock clock.Clock
+	mutex sync.Mutex
+}
+
+// New creates a limiter allowing limit attempts per key within the window;
+// a limit of 0 allows any number
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string][]time.Time),
+		swept:    clock.Real.Now(),
+		clock:    clock.Real,
+	}
+}
+
+// SetClock replaces the clock the window is measured with, before the
+// limiter is used
+func (l *Limiter) SetClock(c clock.Clock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.clock = c
+	l.swept = c.Now()
+}
+
+// Allow records an attempt of the key, reporting whether it is within the
+// limit. Denied attempts are not recorded, so a key retrying too soon is
+// allowed again once its oldest attempts leave the window
+func (l *Limiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.clock.Now()
+	cutoff := now.Add(-l.window)
+	// Forget the keys without recent attempts once per window, so the map
+	// does not grow with every client ever seen
+	if now.Sub(l.swept) >= l.window {
+		for k, times := range l.attempts {
+			if times[len(times)-1].Before(cutoff) {
+				delete(l.attempts, k)
+			}
+		}
+		l.swept = now
+	}
+
+	times := l.attempts[key]
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	times = times[i:]
+	if len(times) >= l.limit {
+		l.attempts[key] = times
+		return false
+	}
+	l.attempts[key] = append(times, now)
+	return true
+}
@@ -0,0 +1,108 @@
+// Package rendercache keeps rendered partials in memory, so requests for a
+// partial that has not changed since it was last rendered, such as every
+// browser refreshing the rooms list after a broadcast, copy the bytes
+// instead of executing the template again. Entries are tagged with what
+// they show and dropped when it changes.
+package rendercache
+
+import (
+	"sync"
+)
+
+// entry is a rendered partial
+type entry struct {
+	body []byte
+	tags []string
+}
+
+// Cache holds rendered partials by key, up to a number of entries
+type Cache struct {
+	entries    map[string]entry
+	tagged     map[string]map[string]struct{}
+	generation uint64
+	maxEntries int
+	mutex      sync.RWMutex
+}
+
+// New creates a cache of at most maxEntries rendered partials
+func New(maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[string]entry),
+		tagged:     make(map[string]map[string]struct{}),
+		maxEntries: maxEntries,
+	}
+}
+
+// Get returns the partial rendered for a key, if still valid
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, ok := c.entries[key]
+	return e.body, ok
+}
+
+// Generation returns the number of invalidations so far. A render reads it
+// before loading its data and passes it to Set, which drops the render if
+// its data changed in between
+func (c *Cache) Generation() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.generation
+}
+
+// Set stores the partial rendered for a key with the tags of what it
+// shows, unless an invalidation happened since generation. A full cache
+// makes room by dropping an arbitrary entry
+func (c *Cache) Set(key string, body []byte, generation uint64, tags ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		for old := range c.entries {
+			c.remove(old)
+			break
+		}
+	}
+	c.entries[key] = entry{body: body, tags: tags}
+	for _, tag := range tags {
+		if c.tagged[tag] == nil {
+			c.tagged[tag] = make(map[string]struct{})
+		}
+		c.tagged[tag][key] = struct{}{}
+	}
+}
+
+// Invalidate drops the partials tagged with any of the tags
+func (c *Cache) Invalidate(tags ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	for _, tag := range tags {
+		for key := range c.tagged[tag] {
+			c.remove(key)
+		}
+	}
+}
+
+// Len returns the number of cached partials
+func (c *Cache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.entries)
+}
+
+// remove drops an entry and its tags
+func (c *Cache) remove(key string) {
+	for _, tag := range c.entries[key].tags {
+		delete(c.tagged[tag], key)
+		if len(c.tagged[tag]) == 0 {
+			delete(c.tagged, tag)
+		}
+	}
+	delete(c.entries, key)
+}
@@ -0,0 +1,119 @@
+// Package sanitize normalizes the text people type before it is stored or
+// rendered: messages, room names, usernames and search queries.
+//
+// Every function returns valid UTF-8 in Unicode normalization form C, with
+// no control characters other than the newlines and tabs of messages, no
+// bidirectional overrides that would make text display in a different order
+// than it is stored, and no surrounding whitespace. Names and queries are
+// single lines with runs of whitespace collapsed and no zero-width
+// characters, so two names that look alike are alike. The templates escape
+// the result like any other value, so hostile input cannot change the
+// markup it is rendered into.
+package sanitize
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Length limits, in characters
+const (
+	MaxMessage  = 2000
+	MaxRoomName = 64
+	MaxUsername = 32
+	MaxQuery    = 100
+)
+
+// Message normalizes a chat message, keeping its line breaks
+func Message(s string) string {
+	s = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(clean(s))
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		return drop(r, false)
+	}, s))
+}
+
+// Name normalizes a room name or username to a single line
+func Name(s string) string {
+	return strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return drop(r, true)
+	}, clean(s))), " ")
+}
+
+// Query normalizes a search query as a name, cut to MaxQuery characters
+func Query(s string) string {
+	return Truncate(Name(s), MaxQuery)
+}
+
+// Truncate cuts s to at most max characters, never inside one, dropping
+// the whitespace the cut leaves at the end
+func Truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	for n := range s {
+		if max == 0 {
+			return strings.TrimRightFunc(s[:n], unicode.IsSpace)
+		}
+		max--
+	}
+	return s
+}
+
+// Fits reports whether s is not empty and at most max characters, for the
+// inputs not bound from a form
+func Fits(s string, max int) bool {
+	return s != "" && utf8.RuneCountInString(s) <= max
+}
+
+// Struct normalizes the string fields of the struct input points to by their
+// sanitize tag: "message", "name" or "query"
+func Struct(input any) {
+	v := reflect.Indirect(reflect.ValueOf(input))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := range t.NumField() {
+		field := v.Field(i)
+		if field.Kind() != reflect.String || !field.CanSet() {
+			continue
+		}
+		switch t.Field(i).Tag.Get("sanitize") {
+		case "message":
+			field.SetString(Message(field.String()))
+		case "name":
+			field.SetString(Name(field.String()))
+		case "query":
+			field.SetString(Query(field.String()))
+		}
+	}
+}
+
+// clean replaces invalid UTF-8 and composes characters into NFC, so the
+// same text typed on different systems is stored the same
+func clean(s string) string {
+	return norm.NFC.String(strings.ToValidUTF8(s, "\ufffd"))
+}
+
+// drop returns -1 for the characters removed from every input, and for
+// names the invisible ones as well
+func drop(r rune, name bool) rune {
+	switch {
+	case unicode.IsControl(r), unicode.Is(unicode.Bidi_Control, r):
+		return -1
+	case name && (unicode.Is(unicode.Cf, r) || r == '\u3164' || r == '\u115f' || r == '\u1160'):
+		// Format characters such as zero-width spaces and joiners, and the
+		// Hangul fillers that render as blanks
+		return -1
+	}
+	return r
+}
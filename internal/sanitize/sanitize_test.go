@@ -0,0 +1,124 @@
+package sanitize
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"html/template"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hostile are inputs that try to break out of the markup they are rendered
+// into, or to display differently than they are stored
+var hostile = []string{
+	"",
+	"hello",
+	"<script>alert(1)</script>",
+	`<img src=x onerror="alert(1)">`,
+	`"><svg onload=alert(1)>`,
+	"' onmouseover='alert(1)",
+	`<a href="javascript:alert(1)">link</a>`,
+	"<iframe srcdoc='&lt;script&gt;alert(1)&lt;/script&gt;'></iframe>",
+	"<!--<script>-->",
+	"<scr\x00ipt>alert(1)</scr\x00ipt>",
+	"\xff\xfe<script>",
+	"abc\u202etxt.exe",
+	"zero\u200bwidth\u200djoin",
+	"\u3164",
+	"line\r\nbreak\rand\ttab",
+	"e\u0301",
+	"  \t padded \n ",
+}
+
+// checkSafe fails the test when s, escaped as the templates escape text,
+// could open a tag or leave the attribute value it is rendered into
+func checkSafe(t *testing.T, s string) {
+	t.Helper()
+	if escaped := template.HTMLEscapeString(s); strings.ContainsAny(escaped, `<>"'`) {
+		t.Errorf("%q escapes to markup: %q", s, escaped)
+	}
+}
+
+// checkText fails the test when s breaks the guarantees of every function of
+// the package; allowed are the control characters kept
+func checkText(t *testing.T, s, allowed string) {
+	t.Helper()
+	if !utf8.ValidString(s) {
+		t.Errorf("%q is not valid UTF-8", s)
+	}
+	if !norm.NFC.IsNormalString(s) {
+		t.Errorf("%q is not in NFC", s)
+	}
+	if s != strings.TrimSpace(s) {
+		t.Errorf("%q has surrounding whitespace", s)
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) && !strings.ContainsRune(allowed, r) {
+			t.Errorf("%q keeps the control character %U", s, r)
+		}
+		if unicode.Is(unicode.Bidi_Control, r) {
+			t.Errorf("%q keeps the bidirectional control %U", s, r)
+		}
+	}
+	checkSafe(t, s)
+}
+
+func FuzzMessage(f *testing.F) {
+	for _, s := range hostile {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got := Message(s)
+		checkText(t, got, "\n\t")
+		if strings.ContainsRune(got, '\r') {
+			t.Errorf("Message(%q) = %q keeps a carriage return", s, got)
+		}
+		if again := Message(got); again != got {
+			t.Errorf("Message is not idempotent: %q, then %q", got, again)
+		}
+	})
+}
+
+func FuzzName(f *testing.F) {
+	for _, s := range hostile {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got := Name(s)
+		checkText(t, got, "")
+		if strings.Contains(got, "  ") {
+			t.Errorf("Name(%q) = %q keeps a run of spaces", s, got)
+		}
+		for _, r := range got {
+			if unicode.IsSpace(r) && r != ' ' || unicode.Is(unicode.Cf, r) {
+				t.Errorf("Name(%q) = %q keeps %U", s, got, r)
+			}
+		}
+		if again := Name(got); again != got {
+			t.Errorf("Name is not idempotent: %q, then %q", got, again)
+		}
+		if q := Query(s); utf8.RuneCountInString(q) > MaxQuery {
+			t.Errorf("Query(%q) has %d characters, want at most %d", s, utf8.RuneCountInString(q), MaxQuery)
+		}
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 6, "hello"},
+		{"héllo", 2, "hé"},
+		{"日本語", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.s, tt.max); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
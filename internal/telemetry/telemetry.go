@@ -0,0 +1,88 @@
+// Package telemetry reports coarse, anonymous usage statistics to help
+// prioritize development: the version, rounded counts and the features
+// turned on. Nothing identifying the instance, its people or their messages
+// is sent, and the next report can be read at /admin/telemetry beforehand.
+package telemetry
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultEndpoint receives the reports when telemetry.endpoint is empty. It
+// is set at build time with
+//
+//	go build -ldflags "-X htmx/internal/telemetry.DefaultEndpoint=https://collector.example/v1/reports"
+//
+// Builds without it send nothing unless an endpoint is configured.
+var DefaultEndpoint = ""
+
+// Report is everything a report sends
+type Report struct {
+	// Instance is random, chosen when the process starts, so the reports of
+	// one run can be told apart; it is not derived from the host and
+	// changes on every restart
+	Instance  string `json:"instance"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Store     string `json:"store"`
+	// The counts are rounded with Round
+	Rooms       int `json:"rooms"`
+	Messages    int `json:"messages"`
+	Connections int `json:"connections"`
+	// Features are the optional features turned on, such as "grpc"
+	Features []string `json:"features"`
+}
+
+// Endpoint returns the endpoint the reports go to: the configured one, or
+// the one of the build. Empty means nothing is sent
+func Endpoint(configured string) string {
+	return cmp.Or(configured, DefaultEndpoint)
+}
+
+// Round keeps the leading digit of n, so counts tell the scale of an
+// instance rather than its size: 57 is 50 and 1234 is 1000
+func Round(n int) int {
+	if n < 0 {
+		return 0
+	}
+	unit := 1
+	for n/unit >= 10 {
+		unit *= 10
+	}
+	return n / unit * unit
+}
+
+// client sends the reports, giving up on a collector that does not answer
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Send posts the report to the endpoint as JSON
+func Send(ctx context.Context, endpoint string, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "htmx-chat-telemetry")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
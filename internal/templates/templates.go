@@ -0,0 +1,70 @@
+// Package templates embeds the HTML templates rendered by the handlers and
+// parses them with the application's template functions.
+package templates
+
+import (
+	"embed"
+	"html/template"
+	"htmx/internal/assets"
+	"htmx/internal/avatars"
+	"htmx/internal/branding"
+	"htmx/internal/components"
+	"htmx/internal/config"
+	"htmx/internal/forms"
+	"htmx/internal/version"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FS holds the layouts and partials
+//
+//go:embed layouts partials
+var FS embed.FS
+
+// Patterns match every template file in FS
+var Patterns = []string{"layouts/*.gohtml", "partials/*.gohtml"}
+
+// Load parses every template with the application's template functions,
+// from disk in dev mode and from the embedded files otherwise
+func Load(cfg *config.Config, manifest *assets.Manifest) (*template.Template, error) {
+	funcMap := template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Format("Jan 02, 2006 15:04:05")
+		},
+		"devMode": func() bool {
+			return cfg.Dev
+		},
+		"buildInfo": version.Get,
+		"branding": func() config.BrandingConfig {
+			return cfg.Branding
+		},
+		"fieldError": forms.Slot,
+		"avatar":     avatars.For,
+		"themeColor": func() string {
+			return branding.ThemeColor(cfg.Branding)
+		},
+		"asset": manifest.URL,
+	}
+
+	// Slots render the components of modules from the same template set
+	var tmpl *template.Template
+	funcMap["slot"] = func(slot string, page map[string]any, item any) (template.HTML, error) {
+		return components.Render(tmpl, components.Slot(slot), page, item)
+	}
+
+	var fsys fs.FS = FS
+	if cfg.Dev {
+		fsys = os.DirFS("internal/templates")
+	}
+	tmpl, err := template.New("").Funcs(funcMap).ParseFS(fsys, Patterns...)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range components.Sources() {
+		if tmpl, err = tmpl.ParseFS(source.FS, source.Patterns...); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,133 @@
+package testutil
+
+import (
+	"context"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"net/http"
+	"net/http/cookiejar"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hooks run at the stages of an App's life, for end-to-end tests to seed
+// data, drive a browser or check what the app left behind; any may be nil
+type Hooks struct {
+	// Configure changes the configuration, after the data directory is set
+	Configure func(cfg *config.Config)
+	// Setup runs before the app serves and its background jobs start, to
+	// seed the stores or add jobs
+	Setup func(app *App)
+	// Started runs once the app answers on its URL
+	Started func(app *App)
+	// Stopping runs before the app shuts down, while it still serves
+	Stopping func(app *App)
+	// Stopped runs once it has shut down, before the data directory is
+	// removed
+	Stopped func(app *App)
+}
+
+// App is the whole application running in-process: the stores of the
+// configured backend, the routes and middleware, the hub, webhook delivery,
+// announcements, the overload monitor, the background jobs with the backups
+// and the demo when enabled, on a random loopback port with its files in a
+// temporary directory. Its Client keeps cookies as a
+// browser does, so sessions and flashes carry over between requests
+type App struct {
+	*Server
+	// DataDir holds the sqlite database and the archive, backup and
+	// certificate directories of the configuration, removed when the test
+	// ends
+	DataDir string
+
+	hooks  Hooks
+	cancel context.CancelFunc
+	stop   sync.Once
+}
+
+// StartApp starts the application as the serve command does, with the
+// default configuration and its data in a temporary directory, running the hooks along the way, and stops
+// it when the test ends. The URL is fixed for the life of the app, so a
+// browser can be pointed at it from Started
+func StartApp(t testing.TB, hooks Hooks) *App {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := testConfig(t, func(cfg *config.Config) {
+		cfg.Store.ArchiveDir = filepath.Join(dir, "archive")
+		cfg.Jobs.Backup.Dir = filepath.Join(dir, "backups")
+		cfg.Server.TLS.Autocert.CacheDir = filepath.Join(dir, "certs")
+		cfg.Store.Path = filepath.Join(dir, "htmx.db")
+		if hooks.Configure != nil {
+			hooks.Configure(cfg)
+		}
+	})
+
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		t.Fatalf("opening the stores: %v", err)
+	}
+	stores := &Stores{st}
+	stores.setDeterministic()
+	server, wired := newServer(t, cfg, stores)
+	a := &App{Server: server, DataDir: dir, hooks: hooks}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("creating cookie jar: %v", err)
+	}
+	if hooks.Setup != nil {
+		hooks.Setup(a)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	if err := wired.Start(ctx); err != nil {
+		cancel()
+		st.Close()
+		t.Fatalf("starting the application: %v", err)
+	}
+
+	a.Server.Server.Config.ReadHeaderTimeout = cfg.Server.ReadHeaderTimeout
+	a.Start()
+	a.Client().Jar = jar
+	t.Cleanup(a.Stop)
+
+	if hooks.Started != nil {
+		hooks.Started(a)
+	}
+	return a
+}
+
+// Stop shuts the app down as the serve command does: it closes the
+// WebSocket connections, waits for requests in flight and stops the
+// background work. It runs once, when the test ends unless called before
+func (a *App) Stop() {
+	a.stop.Do(func() {
+		if a.hooks.Stopping != nil {
+			a.hooks.Stopping(a)
+		}
+		a.Handler.Hub.CloseAll(time.Second)
+		a.Close()
+		a.cancel()
+		if err := a.Stores.Close(); err != nil {
+			a.t.Errorf("closing the stores: %v", err)
+		}
+		if a.hooks.Stopped != nil {
+			a.hooks.Stopped(a)
+		}
+	})
+}
+
+// NewClient returns another client with its own cookies, for a second person
+// using the app
+func (a *App) NewClient() *http.Client {
+	a.t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		a.t.Fatalf("creating cookie jar: %v", err)
+	}
+	client := *a.Client()
+	client.Jar = jar
+	return &client
+}
@@ -0,0 +1,196 @@
+package testutil
+
+import (
+	"compress/gzip"
+	"context"
+	"htmx/internal/config"
+	"htmx/internal/jobs"
+	"htmx/internal/models/sqlite"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartAppHooks(t *testing.T) {
+	var stages []string
+	var room string
+	app := StartApp(t, Hooks{
+		Configure: func(cfg *config.Config) {
+			stages = append(stages, "configure")
+			cfg.Limits.MaxRooms = 3
+		},
+		Setup: func(app *App) {
+			stages = append(stages, "setup")
+			if app.Handler.Hub.Running() {
+				t.Error("hub running before Setup returned")
+			}
+			room = app.Stores.SeedRoom("Seeded").ID
+		},
+		Started: func(app *App) {
+			stages = append(stages, "started")
+			res, body := app.HXGet("/api/rooms")
+			if res.StatusCode != http.StatusOK || !strings.Contains(body, "Seeded") {
+				t.Errorf("rooms list: status %d, seeded room listed %v", res.StatusCode, strings.Contains(body, "Seeded"))
+			}
+		},
+		Stopping: func(app *App) {
+			stages = append(stages, "stopping")
+			if res, _ := app.Get("/rooms/" + room); res.StatusCode != http.StatusOK {
+				t.Errorf("room page while stopping: status %d", res.StatusCode)
+			}
+		},
+		Stopped: func(app *App) {
+			stages = append(stages, "stopped")
+			if _, err := app.Client().Get(app.URL + "/"); err == nil {
+				t.Error("app still serving once stopped")
+			}
+			if _, err := os.Stat(app.DataDir); err != nil {
+				t.Errorf("data directory removed before Stopped: %v", err)
+			}
+		},
+	})
+
+	if app.Config.Limits.MaxRooms != 3 {
+		t.Errorf("MaxRooms = %d, Configure not applied", app.Config.Limits.MaxRooms)
+	}
+
+	app.Stop()
+	app.Stop()
+	if want := []string{"configure", "setup", "started", "stopping", "stopped"}; !slices.Equal(stages, want) {
+		t.Errorf("stages = %v, want %v", stages, want)
+	}
+}
+
+func TestStartAppSQLite(t *testing.T) {
+	app := StartApp(t, Hooks{
+		Configure: func(cfg *config.Config) {
+			cfg.Store.Backend = "sqlite"
+		},
+		Stopped: func(app *App) {
+			// The database is closed, and its file holds what was served
+			db, err := sqlite.Open(app.Config.Store.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rooms := db.Rooms().GetRooms()
+			if len(rooms) != 1 || rooms[0].Name != "Lobby" {
+				t.Errorf("database holds rooms %v, want Lobby", rooms)
+			}
+		},
+	})
+	if filepath.Dir(app.Config.Store.Path) != app.DataDir {
+		t.Errorf("database %q outside %q", app.Config.Store.Path, app.DataDir)
+	}
+
+	if res, body := app.HXPost("/api/rooms", url.Values{"name": {"Lobby"}}); res.StatusCode != http.StatusOK {
+		t.Fatalf("creating a room: status %d: %s", res.StatusCode, body)
+	}
+	if res, _ := app.Get("/readyz"); res.StatusCode != http.StatusOK {
+		t.Errorf("readiness over the migrated database: status %d", res.StatusCode)
+	}
+}
+
+func TestStartAppBackup(t *testing.T) {
+	app := StartApp(t, Hooks{
+		Setup: func(app *App) {
+			app.Stores.SeedChat(app.Stores.SeedRoom("General").ID, "alice", "Hello")
+		},
+	})
+
+	// The backup job of the configuration writes to the data directory
+	res, body := app.Do(app.AsAdmin(app.NewRequest(http.MethodPost, "/admin/jobs/backup/run", nil)))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("running the backup: status %d: %s", res.StatusCode, body)
+	}
+	var snapshots []string
+	for deadline := time.Now().Add(DefaultTimeout); len(snapshots) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot in %s", app.Config.Jobs.Backup.Dir)
+		}
+		time.Sleep(time.Millisecond)
+		snapshots, _ = filepath.Glob(filepath.Join(app.DataDir, "backups", "snapshot-*.json.gz"))
+	}
+
+	f, err := os.Open(snapshots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"message": "Hello"`) {
+		t.Errorf("snapshot lacks the seeded message:\n%s", data)
+	}
+}
+
+func TestStartAppJobs(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	app := StartApp(t, Hooks{
+		Setup: func(app *App) {
+			app.Handler.Jobs.Add("probe", "@every 1h", jobs.Every(time.Hour), func(ctx context.Context) error {
+				ran <- struct{}{}
+				return nil
+			})
+		},
+	})
+
+	res, body := app.Do(app.AsAdmin(app.NewRequest(http.MethodPost, "/admin/jobs/probe/run", nil)))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("running the job: status %d: %s", res.StatusCode, body)
+	}
+	select {
+	case <-ran:
+	case <-time.After(DefaultTimeout):
+		t.Fatal("job added in Setup did not run")
+	}
+}
+
+func TestStartAppStopClosesWebSockets(t *testing.T) {
+	app := StartApp(t, Hooks{})
+	client := app.DialWS("/ws", nil)
+	app.WaitClients(1)
+
+	app.Stop()
+	client.ExpectClosed()
+}
+
+func TestAppClients(t *testing.T) {
+	app := StartApp(t, Hooks{})
+	visitorID := func(client *http.Client) string {
+		t.Helper()
+		res, err := client.Get(app.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		for _, cookie := range client.Jar.Cookies(res.Request.URL) {
+			if cookie.Name == "visitor_id" {
+				return cookie.Value
+			}
+		}
+		t.Fatal("no visitor cookie kept")
+		return ""
+	}
+
+	// The app's client keeps its visitor, and another client is another one
+	first := visitorID(app.Client())
+	if again := visitorID(app.Client()); again != first {
+		t.Errorf("visitor changed from %q to %q between requests", first, again)
+	}
+	if other := visitorID(app.NewClient()); other == first {
+		t.Errorf("a new client shares visitor %q", first)
+	}
+}
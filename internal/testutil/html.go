@@ -0,0 +1,81 @@
+package testutil
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// betweenTags matches the whitespace between two tags, which templates add
+// freely and browsers ignore
+var betweenTags = regexp.MustCompile(`>\s+<`)
+
+// spaces matches any run of whitespace
+var spaces = regexp.MustCompile(`\s+`)
+
+// NormalizeHTML removes the whitespace between tags and collapses the rest,
+// so fragments compare the same however the templates are indented
+func NormalizeHTML(html string) string {
+	html = betweenTags.ReplaceAllString(strings.TrimSpace(html), "><")
+	return spaces.ReplaceAllString(html, " ")
+}
+
+// AssertHTML fails the test unless body contains every fragment, ignoring
+// differences in whitespace
+func AssertHTML(t testing.TB, body string, fragments ...string) {
+	t.Helper()
+	normalized := NormalizeHTML(body)
+	for _, fragment := range fragments {
+		if !strings.Contains(normalized, NormalizeHTML(fragment)) {
+			t.Errorf("body does not contain %q\nbody: %s", fragment, normalized)
+		}
+	}
+}
+
+// AssertNoHTML fails the test if body contains any of the fragments,
+// ignoring differences in whitespace
+func AssertNoHTML(t testing.TB, body string, fragments ...string) {
+	t.Helper()
+	normalized := NormalizeHTML(body)
+	for _, fragment := range fragments {
+		if strings.Contains(normalized, NormalizeHTML(fragment)) {
+			t.Errorf("body contains %q\nbody: %s", fragment, normalized)
+		}
+	}
+}
+
+// AssertHTMLCount fails the test unless body contains fragment exactly n
+// times, such as one list item per seeded message
+func AssertHTMLCount(t testing.TB, body, fragment string, n int) {
+	t.Helper()
+	normalized := NormalizeHTML(body)
+	if got := strings.Count(normalized, NormalizeHTML(fragment)); got != n {
+		t.Errorf("body contains %q %d times, want %d\nbody: %s", fragment, got, n, normalized)
+	}
+}
+
+// AssertOrder fails the test unless body contains the fragments in the
+// order given, such as messages listed oldest first
+func AssertOrder(t testing.TB, body string, fragments ...string) {
+	t.Helper()
+	normalized := NormalizeHTML(body)
+	rest := normalized
+	for _, fragment := range fragments {
+		i := strings.Index(rest, NormalizeHTML(fragment))
+		if i < 0 {
+			t.Errorf("body does not contain %q after the fragments before it\nbody: %s", fragment, normalized)
+			return
+		}
+		rest = rest[i+len(NormalizeHTML(fragment)):]
+	}
+}
+
+// AssertAttr fails the test unless body has an element with the attribute
+// set to value, such as hx-swap-oob="true"
+func AssertAttr(t testing.TB, body, attr, value string) {
+	t.Helper()
+	pattern := regexp.MustCompile(`<[^>]*\s` + regexp.QuoteMeta(attr) + `\s*=\s*["']` + regexp.QuoteMeta(value) + `["']`)
+	if !pattern.MatchString(body) {
+		t.Errorf("body has no element with %s=%q\nbody: %s", attr, value, NormalizeHTML(body))
+	}
+}
@@ -0,0 +1,35 @@
+package testutil
+
+import "testing"
+
+func TestHTMLAssertions(t *testing.T) {
+	body := `<ul>
+		<li data-id="1">first</li>
+		<li data-id="2">second</li>
+	</ul>`
+
+	// Whitespace between and inside tags does not matter
+	AssertHTML(t, body, `<li data-id="1">first</li><li data-id="2">second</li>`)
+	AssertNoHTML(t, body, "third")
+	AssertHTMLCount(t, body, "<li", 2)
+	AssertOrder(t, body, "first", "second")
+	AssertAttr(t, body, "data-id", "2")
+
+	failing := []struct {
+		name   string
+		assert func(t testing.TB)
+	}{
+		{"AssertHTML", func(t testing.TB) { AssertHTML(t, body, "third") }},
+		{"AssertNoHTML", func(t testing.TB) { AssertNoHTML(t, body, "first") }},
+		{"AssertHTMLCount", func(t testing.TB) { AssertHTMLCount(t, body, "<li", 3) }},
+		{"AssertOrder", func(t testing.TB) { AssertOrder(t, body, "second", "first") }},
+		{"AssertAttr", func(t testing.TB) { AssertAttr(t, body, "data-id", "3") }},
+	}
+	for _, tt := range failing {
+		r := &recorder{TB: t}
+		tt.assert(r)
+		if len(r.errors) != 1 {
+			t.Errorf("%s reported %d errors, want 1", tt.name, len(r.errors))
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package testutil
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/handlers"
+	"htmx/internal/i18n"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Credentials of the configured admin account of every test server
+const (
+	AdminUsername = "admin"
+	AdminPassword = "test-password"
+)
+
+// Server is a running test server with the application's routes, templates
+// and middleware over its stores, in memory unless StartApp configures
+// another backend
+type Server struct {
+	*httptest.Server
+	Config  *config.Config
+	Handler *handlers.Handler
+	Stores  *Stores
+	tmpl    *template.Template
+	t       testing.TB
+}
+
+// NewServer starts a test server with the default configuration, changed by
+// configure when it is not nil, and stops it when the test ends
+func NewServer(t testing.TB, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+	cfg := testConfig(t, configure)
+	s, _ := newServer(t, cfg, NewStores(cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Handler.StartHub()
+	s.Handler.StartWebhooks(ctx)
+	s.Start()
+	t.Cleanup(func() {
+		cancel()
+		s.Close()
+	})
+	return s
+}
+
+// testConfig returns the default configuration with the test admin account,
+// changed by configure when it is not nil
+func testConfig(t testing.TB, configure func(cfg *config.Config)) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Admin.Username, cfg.Admin.Password = AdminUsername, AdminPassword
+	cfg.Features.Secret = "test-secret"
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+	return cfg
+}
+
+// newServer wires the application up over the stores as the serve command
+// does, without the request log, leaving the server unstarted
+func newServer(t testing.TB, cfg *config.Config, st *Stores) (*Server, *app.App) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	a, err := app.New(cfg, st.Stores, app.Options{})
+	if err != nil {
+		t.Fatalf("starting the application: %v", err)
+	}
+	return &Server{
+		Server:  httptest.NewUnstartedServer(a.Router),
+		Config:  cfg,
+		Handler: a.Handler,
+		Stores:  st,
+		tmpl:    a.Templates.Template(),
+		t:       t,
+	}, a
+}
+
+// Do sends the request to the server and returns the response with its body
+// read, failing the test if it cannot be sent
+func (s *Server) Do(req *http.Request) (*http.Response, string) {
+	s.t.Helper()
+	res, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.t.Fatalf("%s %s: reading body: %v", req.Method, req.URL.Path, err)
+	}
+	return res, string(body)
+}
+
+// NewRequest creates a request for a path on the server, failing the test if
+// it cannot be built
+func (s *Server) NewRequest(method, path string, body io.Reader) *http.Request {
+	s.t.Helper()
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return req
+}
+
+// Get requests a full page
+func (s *Server) Get(path string) (*http.Response, string) {
+	s.t.Helper()
+	return s.Do(s.NewRequest(http.MethodGet, path, nil))
+}
+
+// HXGet requests a fragment the way htmx does
+func (s *Server) HXGet(path string) (*http.Response, string) {
+	s.t.Helper()
+	req := s.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("HX-Request", "true")
+	return s.Do(req)
+}
+
+// HXPost submits a form the way htmx does
+func (s *Server) HXPost(path string, form url.Values) (*http.Response, string) {
+	s.t.Helper()
+	req := s.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	return s.Do(req)
+}
+
+// Render renders a template with data as the handlers do, in the default
+// locale, failing the test on a template error
+func (s *Server) Render(name string, data map[string]any) string {
+	s.t.Helper()
+	html, err := s.Execute(name, data)
+	if err != nil {
+		s.t.Fatalf("rendering %s: %v", name, err)
+	}
+	return html
+}
+
+// Execute renders a template with data as Render does, returning the error
+// instead of failing the test, for fuzz targets and goroutines
+func (s *Server) Execute(name string, data map[string]any) (string, error) {
+	locale, _ := i18n.Get(i18n.Default)
+	page := map[string]any{"locale": locale}
+	maps.Copy(page, data)
+	var b strings.Builder
+	err := s.tmpl.ExecuteTemplate(&b, name, page)
+	return b.String(), err
+}
+
+// AsAdmin adds the configured admin credentials to the request
+func (s *Server) AsAdmin(req *http.Request) *http.Request {
+	req.SetBasicAuth(s.Config.Admin.Username, s.Config.Admin.Password)
+	return req
+}
@@ -0,0 +1,123 @@
+package testutil
+
+import (
+	"flag"
+	"fmt"
+	"htmx/internal/version"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files, as in go test ./... -update
+var update = flag.Bool("update", false, "rewrite the golden files of snapshot tests with the current output")
+
+// SnapshotDir is where the golden files are kept, relative to the package of
+// the test
+const SnapshotDir = "testdata/snapshots"
+
+// uuidPattern matches the IDs the stores and request IDs use, different on
+// every run
+var uuidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// assetHash matches the fingerprint in the URLs of static files, which
+// changes with their content
+var assetHash = regexp.MustCompile(`/static/[0-9a-f]{16}/`)
+
+// timePatterns match the times the templates render, longest layouts first
+// so a date is not replaced before the time it starts
+var timePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2})?`),
+	regexp.MustCompile(`(Monday|Tuesday|Wednesday|Thursday|Friday|Saturday|Sunday), (January|February|March|April|May|June|July|August|September|October|November|December) \d{1,2}, \d{4}`),
+	regexp.MustCompile(`(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{1,2}, \d{4} \d{2}:\d{2}:\d{2}`),
+	regexp.MustCompile(`(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{1,2}, \d{1,2}:\d{2} [AP]M`),
+	regexp.MustCompile(`(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{1,2}, \d{4}`),
+	regexp.MustCompile(`(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{2}( \d{2}:\d{2})?`),
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}`),
+	regexp.MustCompile(`\b\d{2}:\d{2}\b`),
+}
+
+// NormalizeSnapshot makes html stable across runs: IDs are numbered in the
+// order they first appear, times, asset fingerprints and the build details
+// replaced by placeholders, and every tag put on a line of its own so golden
+// files diff readably
+func NormalizeSnapshot(html string) string {
+	ids := make(map[string]string)
+	html = uuidPattern.ReplaceAllStringFunc(html, func(id string) string {
+		if _, ok := ids[id]; !ok {
+			ids[id] = fmt.Sprintf("id-%d", len(ids)+1)
+		}
+		return ids[id]
+	})
+
+	// The full commit before its short form, which it starts with
+	info := version.Get()
+	for _, build := range [][2]string{
+		{info.Commit, "COMMIT"},
+		{info.ShortCommit(), "COMMIT"},
+		{info.BuildDate, "BUILD-DATE"},
+		{info.GoVersion, "GO-VERSION"},
+	} {
+		if build[0] != "" {
+			html = strings.ReplaceAll(html, build[0], build[1])
+		}
+	}
+
+	html = assetHash.ReplaceAllString(html, "/static/")
+	for _, pattern := range timePatterns {
+		html = pattern.ReplaceAllString(html, "TIME")
+	}
+	return strings.ReplaceAll(NormalizeHTML(html), "><", ">\n<") + "\n"
+}
+
+// AssertSnapshot fails the test unless html, normalized, matches the golden
+// file named after the snapshot, such as testdata/snapshots/rooms/empty.html
+// for "rooms/empty". With -update it writes the file instead, to create a
+// snapshot or accept a change of the markup
+func AssertSnapshot(t testing.TB, name, html string) {
+	t.Helper()
+	got := NormalizeSnapshot(html)
+	path := filepath.Join(SnapshotDir, filepath.FromSlash(name)+".html")
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("snapshot %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("snapshot %s: %v", name, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("snapshot %s: no golden file %s, run the test with -update to create it", name, path)
+	}
+	if err != nil {
+		t.Fatalf("snapshot %s: %v", name, err)
+	}
+	if got != string(want) {
+		t.Errorf("snapshot %s differs from %s, run the test with -update to accept the change\n%s", name, path, snapshotDiff(string(want), got))
+	}
+}
+
+// snapshotDiff shows the first line where got departs from want, with the
+// lines around it
+func snapshotDiff(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(wantLines) && i < len(gotLines) && wantLines[i] == gotLines[i] {
+		i++
+	}
+	start := max(0, i-3)
+	var b strings.Builder
+	for _, line := range wantLines[start:min(len(wantLines), i+3)] {
+		b.WriteString("- " + line + "\n")
+	}
+	for _, line := range gotLines[start:min(len(gotLines), i+3)] {
+		b.WriteString("+ " + line + "\n")
+	}
+	return fmt.Sprintf("from line %d:\n%s", start+1, b.String())
+}
@@ -0,0 +1,64 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recorder is a test that records its errors instead of failing
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestNormalizeSnapshot(t *testing.T) {
+	html := `<p id="a1b2c3d4-0000-4000-8000-000000000001"><time datetime="2024-05-01T12:00:00Z">May 1, 12:00 PM</time></p>` +
+		`<a href="/rooms/a1b2c3d4-0000-4000-8000-000000000001"><img src="/static/0123456789abcdef/logo.svg"></a>` +
+		`<p id="a1b2c3d4-0000-4000-8000-000000000002"></p>`
+	want := `<p id="id-1">
+<time datetime="TIME">TIME</time>
+</p>
+<a href="/rooms/id-1">
+<img src="/static/logo.svg">
+</a>
+<p id="id-2">
+</p>
+`
+	if got := NormalizeSnapshot(html); got != want {
+		t.Errorf("NormalizeSnapshot =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAssertSnapshotUpdate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func(was bool) { *update = was }(*update)
+
+	// -update writes the golden file
+	*update = true
+	AssertSnapshot(t, "rooms/list", "<ul><li>General</li></ul>")
+	data, err := os.ReadFile(filepath.Join(SnapshotDir, "rooms", "list.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<ul>\n<li>General</li>\n</ul>\n"; string(data) != want {
+		t.Errorf("golden file = %q, want %q", data, want)
+	}
+
+	// Without it the same markup matches, and a change fails with a diff
+	*update = false
+	AssertSnapshot(t, "rooms/list", "<ul>  <li>General</li></ul>")
+	r := &recorder{TB: t}
+	AssertSnapshot(r, "rooms/list", "<ul><li>Random</li></ul>")
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "- <li>General</li>") || !strings.Contains(r.errors[0], "+ <li>Random</li>") {
+		t.Errorf("errors of a changed snapshot = %q", r.errors)
+	}
+}
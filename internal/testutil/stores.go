@@ -0,0 +1,93 @@
+// Package testutil wires the application up for handler and end-to-end
+// tests: stores with seeding helpers, a running test server with the real
+// routes and templates, and assertions on the HTML fragments it returns.
+package testutil
+
+import (
+	"github.com/google/uuid"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"testing"
+	"time"
+)
+
+// Stores holds every data store of the application, with helpers to seed
+// them
+type Stores struct {
+	*app.Stores
+}
+
+// NewStores creates empty in-memory stores, with the settings taken from
+// cfg. It turns the deterministic ordering of the stores on, so tests and
+// snapshots see the same order on every run
+func NewStores(cfg *config.Config) *Stores {
+	s := &Stores{app.NewStores(cfg, models.NewRoomStore(), models.NewChatStore())}
+	s.setDeterministic()
+	return s
+}
+
+// setDeterministic turns the deterministic ordering on for every store that
+// has it, which the sqlite chat store, ordered by the database, does not
+func (s *Stores) setDeterministic() {
+	for _, store := range []any{s.Chats, s.Admins, s.Webhooks, s.Bots, s.Notifications, s.Bans, s.Moderation, s.Filters, s.IPBans, s.Announcements} {
+		if store, ok := store.(interface{ SetDeterministic(bool) }); ok {
+			store.SetDeterministic(true)
+		}
+	}
+}
+
+// SeedRoom adds a room with the given name, created now
+func (s *Stores) SeedRoom(name string) *models.Room {
+	room := &models.Room{
+		ID:        uuid.New().String(),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	s.Rooms.AddRoom(room)
+	return room
+}
+
+// SeedChat adds a message to a room, created now
+func (s *Stores) SeedChat(roomID, username, message string) *models.Chat {
+	chat := &models.Chat{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Username:  username,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	s.Chats.AddChat(chat)
+	return chat
+}
+
+// SeedChats adds the messages to a room as the given user, a second apart
+// and ending now, so they list in the order given
+func (s *Stores) SeedChats(roomID, username string, messages ...string) []*models.Chat {
+	start := time.Now().Add(-time.Duration(len(messages)-1) * time.Second)
+	chats := make([]*models.Chat, len(messages))
+	for i, message := range messages {
+		chats[i] = &models.Chat{
+			ID:        uuid.New().String(),
+			RoomID:    roomID,
+			Username:  username,
+			Message:   message,
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		s.Chats.AddChat(chats[i])
+	}
+	return chats
+}
+
+// SeedAdmin adds an admin account, failing the test if it cannot be created
+func (s *Stores) SeedAdmin(t testing.TB, username, password string) *models.Admin {
+	t.Helper()
+	admin, err := models.NewAdmin(username, password, time.Now())
+	if err != nil {
+		t.Fatalf("creating admin %q: %v", username, err)
+	}
+	if !s.Admins.AddAdmin(admin) {
+		t.Fatalf("admin %q already exists", username)
+	}
+	return admin
+}
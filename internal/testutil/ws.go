@@ -0,0 +1,200 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long the WebSocket assertions wait for a message
+const DefaultTimeout = 2 * time.Second
+
+// Event is one update pushed by the hub
+type Event struct {
+	Type         string `json:"type"`
+	RoomID       string `json:"room_id"`
+	Announcement string `json:"announcement"`
+	ChatID       string `json:"chat_id"`
+	ClientID     string `json:"client_id"`
+	// Raw is the JSON of the update, for the fields of other types
+	Raw json.RawMessage `json:"-"`
+}
+
+// WSClient is a connection to the hub reading the updates it pushes
+type WSClient struct {
+	conn *websocket.Conn
+	// Events receives every update pushed, in order, and is closed when the
+	// connection ends
+	Events <-chan Event
+	done   chan struct{}
+	closed sync.Once
+	t      testing.TB
+}
+
+// DialWS connects to the hub endpoint at path, such as /ws or /admin/ws,
+// with the header added to the handshake, and closes the connection when
+// the test ends
+func (s *Server) DialWS(path string, header http.Header) *WSClient {
+	s.t.Helper()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	conn, res, err := websocket.DefaultDialer.Dial(url, header)
+	if res != nil && res.Body != nil {
+		res.Body.Close()
+	}
+	if err != nil {
+		s.t.Fatalf("connecting to %s: %v", path, err)
+	}
+
+	events := make(chan Event, 64)
+	client := &WSClient{conn: conn, Events: events, done: make(chan struct{}), t: s.t}
+	go func() {
+		defer close(events)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			for _, event := range decodeEvents(data) {
+				select {
+				case events <- event:
+				case <-client.done:
+					return
+				}
+			}
+		}
+	}()
+
+	s.t.Cleanup(client.Close)
+	return client
+}
+
+// DialAdminWS connects to the moderators' hub endpoint as the admin
+func (s *Server) DialAdminWS() *WSClient {
+	s.t.Helper()
+	req := s.AsAdmin(s.NewRequest(http.MethodGet, "/admin/ws", nil))
+	return s.DialWS("/admin/ws", req.Header)
+}
+
+// WaitClients waits up to DefaultTimeout for the hub to register n clients,
+// as it does after the handshake of DialWS returned, so a broadcast that
+// follows reaches them
+func (s *Server) WaitClients(n int) {
+	s.t.Helper()
+	for deadline := time.Now().Add(DefaultTimeout); s.Handler.Hub.ClientCount() < n; {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("%d of %d clients registered", s.Handler.Hub.ClientCount(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// decodeEvents decodes a message pushed by the hub, which is a single update
+// or, for the new messages of a room flushed together, an array of them
+func decodeEvents(data []byte) []Event {
+	var raws []json.RawMessage
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if json.Unmarshal(data, &raws) != nil {
+			return nil
+		}
+	} else {
+		raws = []json.RawMessage{data}
+	}
+
+	events := make([]Event, 0, len(raws))
+	for _, raw := range raws {
+		var event Event
+		if json.Unmarshal(raw, &event) != nil {
+			continue
+		}
+		event.Raw = raw
+		events = append(events, event)
+	}
+	return events
+}
+
+// View tells the hub the room the client shows, as pages do, so it gets the
+// updates meant for the viewers of the room; empty is none
+func (c *WSClient) View(roomID string) {
+	c.t.Helper()
+	message, _ := json.Marshal(map[string]string{"type": "viewing", "room_id": roomID})
+	if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		c.t.Fatalf("sending the viewed room: %v", err)
+	}
+}
+
+// Expect waits up to DefaultTimeout for an update of the given type,
+// skipping the others, and fails the test if none arrives
+func (c *WSClient) Expect(eventType string) Event {
+	c.t.Helper()
+	return c.ExpectFunc(eventType, DefaultTimeout, func(Event) bool { return true })
+}
+
+// ExpectFunc waits up to timeout for an update of the given type that match
+// accepts, skipping the others, and fails the test if none arrives
+func (c *WSClient) ExpectFunc(eventType string, timeout time.Duration, match func(Event) bool) Event {
+	c.t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case event, ok := <-c.Events:
+			if !ok {
+				c.t.Fatalf("connection closed waiting for a %q update", eventType)
+			}
+			if event.Type == eventType && match(event) {
+				return event
+			}
+		case <-deadline:
+			c.t.Fatalf("no %q update within %s", eventType, timeout)
+		}
+	}
+}
+
+// ExpectNone fails the test if an update of the given type arrives within
+// wait, skipping the others
+func (c *WSClient) ExpectNone(eventType string, wait time.Duration) {
+	c.t.Helper()
+	deadline := time.After(wait)
+	for {
+		select {
+		case event, ok := <-c.Events:
+			if !ok {
+				return
+			}
+			if event.Type == eventType {
+				c.t.Fatalf("unexpected %q update: %s", eventType, event.Raw)
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// ExpectClosed waits up to DefaultTimeout for the server to end the
+// connection, skipping the updates before it
+func (c *WSClient) ExpectClosed() {
+	c.t.Helper()
+	deadline := time.After(DefaultTimeout)
+	for {
+		select {
+		case _, ok := <-c.Events:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			c.t.Fatalf("connection still open after %s", DefaultTimeout)
+		}
+	}
+}
+
+// Close ends the connection
+func (c *WSClient) Close() {
+	c.closed.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
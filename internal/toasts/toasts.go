@@ -0,0 +1,104 @@
+// Package toasts shows notifications in the browser from request handlers.
+//
+// Handlers queue toasts with Add. Once the handler is done, Middleware
+// appends them to htmx HTML responses as an out-of-band swap into the #toasts
+// container of the layouts. Responses without a body get them as a
+// toast:show HX-Trigger event instead, which static/js/events.js displays.
+package toasts
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"htmx/internal/bufpool"
+	"log/slog"
+	"strings"
+)
+
+// Levels of toasts
+const (
+	Success = "success"
+	Info    = "info"
+	Error   = "error"
+)
+
+// Event is the HX-Trigger event that carries a toast
+const Event = "toast:show"
+
+// toastsKey is the context key of the toasts queued for the current request
+const toastsKey = "toasts"
+
+// Toast is a notification queued by a handler
+type Toast struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// fragment renders toasts as an out-of-band swap
+var fragment = template.Must(template.New("toasts").Parse(
+	`<div id="toasts" hx-swap-oob="beforeend">` +
+		`{{ range . }}<div role="alert" class="alert {{ if eq .Level "success" }}alert-success{{ else if eq .Level "error" }}alert-error{{ else }}alert-info{{ end }}">{{ .Message }}</div>{{ end }}` +
+		`</div>`,
+))
+
+// Add queues a toast for the response to the current request
+func Add(c *gin.Context, level, message string) {
+	queued, _ := c.Get(toastsKey)
+	toasts, _ := queued.([]Toast)
+	c.Set(toastsKey, append(toasts, Toast{Level: level, Message: message}))
+}
+
+// FromContext returns the toasts queued for the current request
+func FromContext(c *gin.Context) []Toast {
+	queued, _ := c.Get(toastsKey)
+	toasts, _ := queued.([]Toast)
+	return toasts
+}
+
+// Middleware delivers the toasts queued by handlers with their response
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		toasts := FromContext(c)
+		if len(toasts) == 0 || c.GetHeader("HX-Request") != "true" {
+			return
+		}
+
+		if !c.Writer.Written() {
+			trigger(c, toasts[len(toasts)-1])
+			return
+		}
+		// Rendered in full before it is appended, so a failure does not
+		// leave half a fragment in the response
+		if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/html") {
+			buf := bufpool.Get()
+			defer bufpool.Put(buf)
+			if err := fragment.Execute(buf, toasts); err != nil {
+				slog.Error("rendering toasts", "error", err)
+				return
+			}
+			c.Writer.Write(buf.Bytes())
+		}
+	}
+}
+
+// trigger adds the toast to the HX-Trigger header, keeping the events set by
+// the handler. The header carries a single toast:show event, so only the
+// last toast is shown
+func trigger(c *gin.Context, toast Toast) {
+	events := make(map[string]any)
+	if header := c.Writer.Header().Get("HX-Trigger"); header != "" {
+		if err := json.Unmarshal([]byte(header), &events); err != nil {
+			// A bare event name rather than a JSON object
+			events = map[string]any{header: nil}
+		}
+	}
+	events[Event] = toast
+
+	header, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+	c.Header("HX-Trigger", string(header))
+}
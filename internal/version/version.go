@@ -0,0 +1,65 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with
+//
+//	go build -ldflags "-X htmx/internal/version.Version=1.2.3 -X htmx/internal/version.Commit=$(git rev-parse HEAD) -X htmx/internal/version.BuildDate=$(date -u +%FT%TZ)"
+//
+// When left empty, Commit and BuildDate fall back to the VCS details Go embeds
+// in the binary.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build info of the running binary
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// ShortCommit returns the first 7 characters of the commit hash
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 7 {
+		return i.Commit[:7]
+	}
+	return i.Commit
+}
@@ -0,0 +1,235 @@
+// Package webhooks delivers chat events to the URLs registered by admins.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"htmx/internal/clock"
+	"htmx/internal/config"
+	"htmx/internal/models"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Request headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// workers is the number of deliveries made concurrently
+	workers = 4
+	// queueSize bounds the deliveries waiting for a worker
+	queueSize = 256
+)
+
+// Event is something that happened in the application
+type Event struct {
+	Type   string
+	RoomID string
+	Data   any
+}
+
+// payload is the JSON body delivered to webhooks
+type payload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// job is a single pending delivery of a payload to a webhook
+type job struct {
+	id        string
+	webhookID string
+	event     string
+	body      []byte
+	attempts  int
+	// retries counts the times the delivery came back from the dead letters
+	retries int
+}
+
+// Dispatcher queues events for the matching webhooks and delivers them with retries
+type Dispatcher struct {
+	store       *models.WebhookStore
+	client      *http.Client
+	queue       chan *job
+	maxAttempts int
+	retryDelay  time.Duration
+	clock       clock.Clock
+}
+
+// NewDispatcher creates a dispatcher for the webhooks in the store
+func NewDispatcher(store *models.WebhookStore, cfg config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		queue:       make(chan *job, queueSize),
+		maxAttempts: cfg.MaxAttempts,
+		retryDelay:  time.Second,
+		clock:       clock.Real,
+	}
+}
+
+// SetClock replaces the clock timing the retries and stamping the payloads
+// and dead letters. Call it at startup, before the dispatcher runs
+func (d *Dispatcher) SetClock(c clock.Clock) {
+	d.clock = c
+}
+
+// Run delivers queued payloads until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+// Dispatch queues the event for every webhook subscribed to it
+func (d *Dispatcher) Dispatch(event Event) {
+	var body []byte
+	for _, webhook := range d.store.GetWebhooks() {
+		if !webhook.Matches(event.Type, event.RoomID) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+			body, err = json.Marshal(payload{
+				ID:        uuid.New().String(),
+				Event:     event.Type,
+				CreatedAt: d.clock.Now(),
+				Data:      event.Data,
+			})
+			if err != nil {
+				slog.Error("encoding webhook payload", "event", event.Type, "error", err)
+				return
+			}
+		}
+
+		d.enqueue(&job{
+			id:        uuid.New().String(),
+			webhookID: webhook.ID,
+			event:     event.Type,
+			body:      body,
+		}, webhook.URL)
+	}
+}
+
+// Retry queues a dead-lettered delivery again with a fresh set of attempts
+func (d *Dispatcher) Retry(delivery *models.Delivery) {
+	d.enqueue(&job{
+		id:        delivery.ID,
+		webhookID: delivery.WebhookID,
+		event:     delivery.Event,
+		body:      delivery.Payload,
+		retries:   delivery.Retries + 1,
+	}, delivery.URL)
+}
+
+// enqueue queues a job without blocking, dead-lettering it when the queue is full
+func (d *Dispatcher) enqueue(j *job, url string) {
+	select {
+	case d.queue <- j:
+	default:
+		d.deadLetter(j, url, "delivery queue full")
+	}
+}
+
+// deliver posts the payload once, scheduling a retry or dead-lettering it on failure
+func (d *Dispatcher) deliver(ctx context.Context, j *job) {
+	webhook, exists := d.store.GetWebhook(j.webhookID)
+	if !exists {
+		return // Deleted since the event was queued
+	}
+
+	j.attempts++
+	err := d.post(ctx, webhook, j)
+	if err == nil {
+		slog.Debug("webhook delivered", "webhook", webhook.ID, "event", j.event, "attempts", j.attempts)
+		return
+	}
+
+	if j.attempts >= d.maxAttempts {
+		slog.Warn("webhook delivery failed, moved to dead letters", "webhook", webhook.ID, "event", j.event, "attempts", j.attempts, "error", err)
+		d.deadLetter(j, webhook.URL, err.Error())
+		return
+	}
+
+	// Back off exponentially: 1s, 2s, 4s, ...
+	delay := d.retryDelay << (j.attempts - 1)
+	slog.Debug("webhook delivery failed, retrying", "webhook", webhook.ID, "event", j.event, "in", delay, "error", err)
+	timer := d.clock.NewTimer(delay)
+	go func() {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C():
+			d.enqueue(j, webhook.URL)
+		}
+	}()
+}
+
+// post sends the signed payload to the webhook URL
+func (d *Dispatcher) post(ctx context.Context, webhook *models.Webhook, j *job) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "htmx-chat-webhooks")
+	req.Header.Set(EventHeader, j.event)
+	req.Header.Set(DeliveryHeader, j.id)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, j.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// deadLetter records a job that will not be retried
+func (d *Dispatcher) deadLetter(j *job, url, reason string) {
+	d.store.AddDeadLetter(&models.Delivery{
+		ID:        j.id,
+		WebhookID: j.webhookID,
+		URL:       url,
+		Event:     j.event,
+		Payload:   j.body,
+		Attempts:  j.attempts,
+		Retries:   j.retries,
+		LastError: reason,
+		FailedAt:  d.clock.Now(),
+	})
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed with secret, as sent in the
+// signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
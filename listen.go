@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/acme/autocert"
+	"htmx/internal/config"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// namedListener is a listener that can be handed over to a new process by name
+type namedListener struct {
+	name string
+	net.Listener
+}
+
+// serve runs the server on the listener over plain HTTP or HTTPS depending on the TLS config
+func serve(server *http.Server, ln net.Listener, cfg config.ServerConfig) error {
+	switch tls := cfg.TLS; {
+	case tls.Autocert.Enabled:
+		log.Printf("Server starting on %s with HTTPS (Let's Encrypt for %v)", cfg.Addr, tls.Autocert.Domains)
+		return server.ServeTLS(ln, "", "")
+	case tls.CertFile != "":
+		log.Printf("Server starting on %s with HTTPS", cfg.Addr)
+		return server.ServeTLS(ln, tls.CertFile, tls.KeyFile)
+	default:
+		log.Printf("Server starting on %s", cfg.Addr)
+		return server.Serve(ln)
+	}
+}
+
+// newCertManager creates the Let's Encrypt certificate manager for the autocert config
+func newCertManager(cfg config.AutocertConfig) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		Email:      cfg.Email,
+	}
+}
+
+// listen returns the listener handed over under name by a previous process, or
+// opens the TCP or Unix socket listener for the configured address
+func listen(name string, cfg config.ServerConfig) (namedListener, error) {
+	if ln, ok := inheritedListener(name); ok {
+		log.Printf("Reusing %s listener on %s from previous process", name, cfg.Addr)
+		return namedListener{name, ln}, nil
+	}
+
+	path, ok := cfg.SocketPath()
+	if !ok {
+		ln, err := net.Listen("tcp", cfg.Addr)
+		return namedListener{name, ln}, err
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return namedListener{}, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return namedListener{}, err
+	}
+	if err := os.Chmod(path, cfg.SocketFileMode()); err != nil {
+		ln.Close()
+		return namedListener{}, fmt.Errorf("setting socket permissions: %w", err)
+	}
+	return namedListener{name, ln}, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a previous run, refusing
+// to touch it if another process is still accepting connections on it
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
@@ -1,95 +1,79 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	"html/template"
-	"htmx/internal/handlers"
-	"htmx/internal/models"
-	"log"
-	"time"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 )
 
-func main() {
-	// Create data stores
-	roomStore := models.NewRoomStore()
-	chatStore := models.NewChatStore()
-
-	// Add some sample data
-	addSampleData(roomStore, chatStore)
-
-	// Create handler
-	handler := handlers.NewHandler(roomStore, chatStore)
-
-	// Set up Gin router
-	router := gin.Default()
-
-	// Load all templates in one go
-	templ := template.Must(template.ParseGlob("internal/templates/**/*.gohtml"))
-
-	// Set the template
-	router.SetHTMLTemplate(templ)
+// command is a CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-	// Set up template functions
-	router.SetFuncMap(template.FuncMap{
-		"formatTime": func(t time.Time) string {
-			return t.Format("Jan 02, 2006 15:04:05")
-		},
-	})
+var commands = []command{
+	{"serve", "Start the chat server (default)", runServe},
+	{"dev", "Run the server in dev mode, rebuilding it when Go sources change", runDev},
+	{"migrate", "Apply store schema migrations", runMigrate},
+	{"seed", "Add sample rooms and messages to the store", runSeed},
+	{"export", "Write all rooms and messages as JSON", runExport},
+	{"create-admin", "Create an admin account", runCreateAdmin},
+	{"replay", "Replay recorded traffic fixtures and report differences", runReplay},
+	{"doctor", "Check the configuration and the environment the server runs in", runDoctor},
+	{"version", "Print version and build info", runVersion},
+}
 
-	// Set up routes
-	handler.SetupRoutes(router)
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	// Start WebSocket hub
-	handlers.StartHub()
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-	// Start server
-	log.Println("Server starting on http://localhost:8080")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if name != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
 	}
+	usage()
+	os.Exit(2)
 }
 
-// addSampleData adds some sample rooms and chats for demonstration
-func addSampleData(roomStore *models.RoomStore, chatStore *models.ChatStore) {
-	now := time.Now()
-
-	// Add sample rooms
-	generalRoom := &models.Room{
-		ID:        "1",
-		Name:      "General",
-		CreatedAt: now.Add(-24 * time.Hour),
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: htmx <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
 	}
-	techRoom := &models.Room{
-		ID:        "2",
-		Name:      "Technology",
-		CreatedAt: now.Add(-2 * time.Hour),
-	}
-
-	roomStore.AddRoom(generalRoom)
-	roomStore.AddRoom(techRoom)
-
-	// Add sample chats
-	chatStore.AddChat(&models.Chat{
-		ID:        "1",
-		RoomID:    "1",
-		Username:  "Alice",
-		Message:   "Hello everyone!",
-		CreatedAt: now.Add(-20 * time.Minute),
-	})
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'htmx <command> -h' for the flags of a command.")
+}
 
-	chatStore.AddChat(&models.Chat{
-		ID:        "2",
-		RoomID:    "1",
-		Username:  "Bob",
-		Message:   "Hi Alice, how are you?",
-		CreatedAt: now.Add(-15 * time.Minute),
-	})
+// newFlagSet creates the flag set for a subcommand, including the shared -config flag
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv("HTMX_CONFIG"), "path to the YAML config file")
+	return fs, configPath
+}
 
-	chatStore.AddChat(&models.Chat{
-		ID:        "3",
-		RoomID:    "2",
-		Username:  "Charlie",
-		Message:   "Anyone interested in Go programming?",
-		CreatedAt: now.Add(-5 * time.Minute),
+// flagSet reports whether the flag was given on the command line, rather
+// than left at its default
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
 	})
+	return set
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/dev"
+	"log"
+	"time"
+)
+
+// runReplay feeds recorded traffic fixtures back through the handlers and
+// reports where the responses or hub events differ from the recording
+func runReplay(args []string) error {
+	fs, configPath := newFlagSet("replay")
+	seed := fs.Bool("seed", true, "add the sample data first, as 'serve' does unless -seed=false was recorded")
+	settle := fs.Duration("settle", 500*time.Millisecond, "how long to wait for the last hub events of a fixture")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no fixture files given")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	// Fixtures are recorded in dev mode, which links the static files by
+	// their plain URLs, and replayed over fresh stores, never the database
+	cfg.Dev = true
+	cfg.Store.Backend = "memory"
+	generateSecrets(cfg)
+	gin.SetMode(gin.ReleaseMode)
+
+	failed := 0
+	for _, path := range fs.Args() {
+		entries, err := dev.ReadFixture(path)
+		if err != nil {
+			return err
+		}
+		mismatches, err := replayFixture(cfg, *seed, entries, *settle)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, m := range mismatches {
+			fmt.Printf("%s: %s\n", path, m)
+		}
+		if len(mismatches) > 0 {
+			failed++
+		}
+		log.Printf("%s: %d entries, %d mismatches", path, len(entries), len(mismatches))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures differ", failed, fs.NArg())
+	}
+	return nil
+}
+
+// replayFixture starts the application over fresh stores, without
+// listeners, and replays the entries of a fixture through it
+func replayFixture(cfg *config.Config, seed bool, entries []dev.Entry, settle time.Duration) ([]dev.Mismatch, error) {
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if seed {
+		if err := addSampleData(st.Rooms, st.Chats); err != nil {
+			return nil, fmt.Errorf("adding sample data: %w", err)
+		}
+	}
+
+	a, err := app.New(cfg, st, app.Options{})
+	if err != nil {
+		return nil, err
+	}
+	a.Handler.StartHub()
+
+	replayer := dev.NewReplayer(a.Router)
+	events, cancel := a.Handler.Hub.Subscribe()
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case event := <-events:
+				replayer.Event(event)
+			}
+		}
+	}()
+
+	return replayer.Run(entries, settle), nil
+}
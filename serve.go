@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/dev"
+	"htmx/internal/errorreport"
+	"htmx/internal/handlers"
+	"htmx/internal/logging"
+	"htmx/internal/models"
+	"htmx/internal/telemetry"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// runServe starts the chat server and blocks until it is interrupted
+func runServe(args []string) error {
+	fs, configPath := newFlagSet("serve")
+	seed := fs.Bool("seed", true, "add sample data on startup when the store is empty; off by default for a store kept between runs, which 'seed' fills")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file, overrides server.tls.cert_file")
+	tlsKey := fs.String("tls-key", "", "TLS key file, overrides server.tls.key_file")
+	devMode := fs.Bool("dev", false, "reload templates and refresh browsers on file changes, overrides dev")
+	demo := fs.Bool("demo", false, "simulate people joining rooms and chatting, overrides demo.enabled")
+	record := fs.String("record", "", "dev mode: write requests, responses and hub events to a fixture file in this directory")
+	pidFile := fs.String("pid-file", "", "write the process ID to this file, rewritten by each upgraded process")
+	fs.Parse(args)
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if *tlsCert != "" || *tlsKey != "" {
+		cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile = *tlsCert, *tlsKey
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	if *devMode {
+		cfg.Dev = true
+	}
+	if *record != "" && !cfg.Dev {
+		return errors.New("-record needs dev mode")
+	}
+	if *demo && !cfg.Demo.Enabled {
+		cfg.Demo.Enabled = true
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	if err := logging.Setup(cfg.LogLevel); err != nil {
+		return err
+	}
+	generateSecrets(cfg)
+
+	// Stop on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Create data stores
+	st, err := app.OpenStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	// Add some sample data, to a store kept between runs only when asked,
+	// as it would stay there for good
+	if app.Persistent(cfg) && !flagSet(fs, "seed") {
+		*seed = false
+	}
+	if *seed && len(st.Rooms.GetRooms()) == 0 {
+		if err := addSampleData(st.Rooms, st.Chats); err != nil {
+			return fmt.Errorf("adding sample data: %w", err)
+		}
+	}
+
+	// Report panics and server errors
+	reporter, err := errorreport.New(cfg.Errors.DSN, cfg.Errors.Environment)
+	if err != nil {
+		return err
+	}
+	opts := app.Options{Reporter: reporter, AccessLog: gin.DefaultWriter}
+
+	// Inject faults in dev mode, ahead of the recorder so fixtures do not
+	// capture them
+	if cfg.Chaos.Enabled() {
+		if cfg.Dev {
+			opts.Middleware = append(opts.Middleware, dev.Chaos(cfg.Chaos))
+			log.Printf("Dev mode: injecting faults, latency %s, jitter %s, %d%% errors, disconnects after %s", cfg.Chaos.Latency, cfg.Chaos.Jitter, cfg.Chaos.ErrorPercent, cfg.Chaos.DisconnectAfter)
+		} else {
+			log.Println("Chaos settings ignored outside dev mode")
+		}
+	}
+
+	// Record the traffic for replaying, before compression applies
+	var recorder *dev.Recorder
+	if *record != "" {
+		if recorder, err = dev.NewRecorder(*record); err != nil {
+			return fmt.Errorf("recording traffic: %w", err)
+		}
+		defer recorder.Close()
+		opts.Middleware = append(opts.Middleware, recorder.Middleware())
+		log.Printf("Dev mode: recording traffic to %s", recorder.Path())
+	}
+
+	// Create the handler, templates and routes
+	a, err := app.New(cfg, st, opts)
+	if err != nil {
+		return err
+	}
+	handler, router := a.Handler, a.Router
+
+	// Reload templates and browsers when sources change
+	if cfg.Dev {
+		reloader := dev.NewReloader()
+		router.GET("/__dev/reload", reloader.Handler)
+		go watchSources(ctx, a.Templates, reloader)
+	}
+
+	// Start the hub and the background work
+	if t := cfg.Telemetry; t.Enabled && telemetry.Endpoint(t.Endpoint) != "" {
+		log.Printf("Sending anonymous usage statistics every %s, shown at /admin/telemetry; turn them off with telemetry.enabled: false, HTMX_TELEMETRY=false or DO_NOT_TRACK=1", t.Interval)
+	}
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+	if recorder != nil {
+		go recordEvents(ctx, handler.Hub, recorder)
+	}
+
+	// Open every listener up front so they can be handed over on upgrade
+	var listeners []namedListener
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+
+	mainLn, err := listen("main", cfg.Server)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	listeners = append(listeners, mainLn)
+
+	server := newServer(cfg.Server, router)
+	serveErr := make(chan error, 3)
+	go func() {
+		if err := serve(server, mainLn, cfg.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	// Answer ACME HTTP challenges and redirect everything else to HTTPS
+	if autocertCfg := cfg.Server.TLS.Autocert; autocertCfg.Enabled {
+		manager := newCertManager(autocertCfg)
+		server.TLSConfig = manager.TLSConfig()
+
+		acmeLn, err := listen("acme", config.ServerConfig{Addr: autocertCfg.HTTPAddr})
+		if err != nil {
+			return fmt.Errorf("ACME challenge listener: %w", err)
+		}
+		listeners = append(listeners, acmeLn)
+
+		go func() {
+			log.Printf("ACME challenge listener starting on %s", autocertCfg.HTTPAddr)
+			if err := http.Serve(acmeLn, manager.HTTPHandler(nil)); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("ACME challenge listener error: %v", err)
+			}
+		}()
+	}
+
+	// Start the admin listener
+	var adminServer *http.Server
+	if cfg.Admin.Addr != "" {
+		adminRouter, err := app.NewRouter(cfg.Server, reporter, gin.DefaultWriter)
+		if err != nil {
+			return err
+		}
+		adminRouter.HTMLRender = router.HTMLRender
+		handler.SetupAdminRoutes(adminRouter)
+
+		adminCfg := config.ServerConfig{Addr: cfg.Admin.Addr, SocketMode: cfg.Server.SocketMode}
+		adminLn, err := listen("admin", adminCfg)
+		if err != nil {
+			return fmt.Errorf("admin listener: %w", err)
+		}
+		listeners = append(listeners, adminLn)
+
+		adminServer = newServer(cfg.Server, adminRouter)
+		go func() {
+			log.Printf("Admin server starting on %s", cfg.Admin.Addr)
+			if err := adminServer.Serve(adminLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("admin listener: %w", err)
+			}
+		}()
+	}
+
+	// Start the gRPC listener
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Addr != "" {
+		grpcLn, err := listen("grpc", config.ServerConfig{Addr: cfg.GRPC.Addr, SocketMode: cfg.Server.SocketMode})
+		if err != nil {
+			return fmt.Errorf("grpc listener: %w", err)
+		}
+		listeners = append(listeners, grpcLn)
+
+		grpcServer = handler.NewGRPCServer()
+		go func() {
+			log.Printf("gRPC server starting on %s", cfg.GRPC.Addr)
+			if err := grpcServer.Serve(grpcLn); err != nil {
+				serveErr <- fmt.Errorf("grpc listener: %w", err)
+			}
+		}()
+	}
+
+	// Start the IRC gateway
+	var ircServer *handlers.IRCServer
+	if cfg.IRC.Addr != "" {
+		ircLn, err := listen("irc", config.ServerConfig{Addr: cfg.IRC.Addr, SocketMode: cfg.Server.SocketMode})
+		if err != nil {
+			return fmt.Errorf("irc listener: %w", err)
+		}
+		listeners = append(listeners, ircLn)
+
+		ircServer = handler.NewIRCServer()
+		go func() {
+			log.Printf("IRC gateway starting on %s", cfg.IRC.Addr)
+			if err := ircServer.Serve(ircLn); err != nil {
+				serveErr <- fmt.Errorf("irc listener: %w", err)
+			}
+		}()
+	}
+
+	// Let the previous process, if any, know it can stop
+	notifyReady()
+	if *pidFile != "" {
+		if err := writePIDFile(*pidFile); err != nil {
+			return err
+		}
+	}
+
+	// Wait for an interrupt or an upgrade, then drain in-flight requests
+	upgrade := upgradeSignal()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case err := <-serveErr:
+			return fmt.Errorf("failed to start server: %w", err)
+		case <-ctx.Done():
+			break wait
+		case <-reload:
+			reloadLogLevel(*configPath)
+		case <-upgrade:
+			log.Println("Upgrade requested, handing listeners to a new process")
+			if err := handOver(listeners); err != nil {
+				log.Printf("Upgrade failed, continuing to serve: %v", err)
+				continue
+			}
+			break wait
+		}
+	}
+
+	log.Println("Server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Admin server shutdown error: %v", err)
+		}
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	if ircServer != nil {
+		ircServer.Close()
+	}
+	handler.Hub.CloseAll(time.Second)
+	return server.Shutdown(shutdownCtx)
+}
+
+// stopGRPC waits for in-flight RPCs to finish, cancelling the rest, such as
+// open Subscribe streams, once ctx is done
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+// reloadLogLevel re-reads the configuration and applies its log level
+func reloadLogLevel(path string) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		slog.Error("reloading configuration, keeping log level", "level", logging.Level(), "error", err)
+		return
+	}
+	logging.SetLevel(cfg.LogLevel)
+	slog.Info("log level reloaded", "level", logging.Level())
+}
+
+// writePIDFile records the process ID so process managers can signal the
+// current process after an upgrade
+func writePIDFile(path string) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return fmt.Errorf("writing PID file: %w", err)
+	}
+	return nil
+}
+
+// newServer creates an HTTP server for the handler with the configured timeouts
+func newServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           localPeers(handler),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// localPeers gives the requests of peers without an IP address, those over a
+// Unix socket, the loopback address: such a peer is a proxy on this host,
+// which server.trusted_proxies can then trust
+func localPeers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := net.SplitHostPort(r.RemoteAddr); err != nil {
+			r.RemoteAddr = "127.0.0.1:0"
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// watchSources reloads the templates and refreshes browsers whenever a template
+// or static file changes
+func watchSources(ctx context.Context, renderer *dev.Templates, reloader *dev.Reloader) {
+	log.Println("Dev mode: watching internal/templates and static for changes")
+	watcher := dev.NewWatcher(500*time.Millisecond, "internal/templates", "static")
+	watcher.Watch(ctx, func(paths []string) {
+		log.Printf("Dev mode: %d file(s) changed, reloading", len(paths))
+		if err := renderer.Reload(); err != nil {
+			log.Printf("Dev mode: template error, keeping previous templates: %v", err)
+			return
+		}
+		reloader.Reload()
+	})
+}
+
+// recordEvents writes every event the hub broadcasts to the fixture, until
+// ctx is done
+func recordEvents(ctx context.Context, hub *handlers.Hub, recorder *dev.Recorder) {
+	events, cancel := hub.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			recorder.Event(event)
+		}
+	}
+}
+
+// generateSecrets fills in the admin password and feature flag secret when
+// they are not configured
+func generateSecrets(cfg *config.Config) {
+	if cfg.Admin.Password == "" {
+		cfg.Admin.Password = uuid.New().String()
+		log.Printf("Admin password not configured, using generated password: %s", cfg.Admin.Password)
+	}
+	if cfg.Features.Secret == "" {
+		cfg.Features.Secret = uuid.New().String()
+	}
+}
+
+// addSampleData adds some sample rooms and chats for demonstration,
+// stopping at the first the store fails to save
+func addSampleData(roomStore models.RoomRepository, chatStore models.ChatRepository) error {
+	now := time.Now()
+
+	// Add sample rooms
+	generalRoom := &models.Room{
+		ID:        "1",
+		Name:      "General",
+		CreatedAt: now.Add(-24 * time.Hour),
+	}
+	techRoom := &models.Room{
+		ID:        "2",
+		Name:      "Technology",
+		CreatedAt: now.Add(-2 * time.Hour),
+	}
+
+	for _, room := range []*models.Room{generalRoom, techRoom} {
+		if err := roomStore.AddRoom(room); err != nil {
+			return err
+		}
+	}
+
+	// Add sample chats
+	chats := []*models.Chat{
+		{
+			ID:        "1",
+			RoomID:    "1",
+			Username:  "Alice",
+			Message:   "Hello everyone!",
+			CreatedAt: now.Add(-20 * time.Minute),
+		},
+		{
+			ID:        "2",
+			RoomID:    "1",
+			Username:  "Bob",
+			Message:   "Hi Alice, how are you?",
+			CreatedAt: now.Add(-15 * time.Minute),
+		},
+		{
+			ID:        "3",
+			RoomID:    "2",
+			Username:  "Charlie",
+			Message:   "Anyone interested in Go programming?",
+			CreatedAt: now.Add(-5 * time.Minute),
+		},
+	}
+	for _, chat := range chats {
+		if err := chatStore.AddChat(chat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"htmx/internal/app"
+	"htmx/internal/config"
+	"htmx/internal/middleware"
+	"htmx/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpoofedForwardingDoesNotUnban(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bans := models.NewIPBanStore()
+	ban, err := models.NewIPBan("1", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans.AddBan(ban)
+
+	tests := []struct {
+		name    string
+		trusted []string
+		remote  string
+		want    int
+	}{
+		// The banned client names another address
+		{"no trusted proxies", nil, "127.0.0.1:40000", http.StatusForbidden},
+		{"other proxy trusted", []string{"10.0.0.1"}, "127.0.0.1:40000", http.StatusForbidden},
+		// A trusted proxy forwards for a client that is not banned
+		{"from a trusted proxy", []string{"127.0.0.0/8"}, "127.0.0.1:40000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, err := app.NewRouter(config.ServerConfig{TrustedProxies: tt.trusted}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			router.GET("/ws", middleware.BlockIPs(bans), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Real-IP", "203.0.113.7")
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+			if res.Code != tt.want {
+				t.Errorf("status = %d, want %d", res.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalPeers(t *testing.T) {
+	var got string
+	handler := localPeers(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.RemoteAddr }))
+	for remote, want := range map[string]string{
+		"":                "127.0.0.1:0",
+		"@":               "127.0.0.1:0",
+		"192.0.2.1:51234": "192.0.2.1:51234",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != want {
+			t.Errorf("peer %q seen as %q, want %q", remote, got, want)
+		}
+	}
+}
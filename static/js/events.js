@@ -0,0 +1,351 @@
+// Handlers for the client events the server sets in HX-Trigger headers
+// (see internal/handlers/triggers.go and internal/toasts), plus the
+// accessibility glue of htmx swaps. Pages hook the other events, such as
+// chat:created and room:updated, from their own markup.
+(function () {
+    const toastClasses = {success: "alert-success", info: "alert-info", error: "alert-error"};
+    const container = document.getElementById("toasts");
+    const announcer = document.getElementById("announcer");
+    // Content replaced by a data-skeleton placeholder, by swap target
+    const skeletons = new WeakMap();
+
+    // Toasts disappear after a few seconds, whether they were swapped in
+    // out of band or created from a toast:show event
+    if (container) {
+        new MutationObserver(function (mutations) {
+            mutations.forEach(function (mutation) {
+                mutation.addedNodes.forEach(function (toast) {
+                    if (toast.nodeType === Node.ELEMENT_NODE) {
+                        setTimeout(() => toast.remove(), 4000);
+                    }
+                });
+            });
+        }).observe(container, {childList: true});
+    }
+
+    // toast:show {message, level} shows a notification
+    document.body.addEventListener("toast:show", function (event) {
+        if (!container) {
+            return;
+        }
+        const toast = document.createElement("div");
+        toast.setAttribute("role", "alert");
+        toast.className = "alert " + (toastClasses[event.detail.level] || toastClasses.info);
+        toast.textContent = event.detail.message;
+        container.appendChild(toast);
+    });
+
+    // Requests that get no response, such as when the connection drops,
+    // show the offline message of the toasts container
+    document.body.addEventListener("htmx:sendError", function () {
+        if (container && container.dataset.offline) {
+            htmx.trigger(document.body, "toast:show", {message: container.dataset.offline, level: "error"});
+        }
+    });
+
+    // theme:changed {theme} switches the page to the theme stored by the server
+    document.body.addEventListener("theme:changed", function (event) {
+        document.documentElement.dataset.theme = event.detail.theme;
+    });
+
+    // live:announce {message} reads a message out to screen readers through
+    // the #announcer live region; the layouts fire it for WebSocket updates
+    document.body.addEventListener("live:announce", function (event) {
+        if (!announcer || !event.detail.message) {
+            return;
+        }
+        // Clear first so the same text is announced again
+        announcer.textContent = "";
+        setTimeout(() => announcer.textContent = event.detail.message, 50);
+    });
+
+    // Requests tell the server how their element swaps, so an error boundary
+    // can retry them the same way (see middleware.RenderBoundary)
+    document.body.addEventListener("htmx:configRequest", function (event) {
+        const swapper = event.detail.elt.closest && event.detail.elt.closest("[hx-swap]");
+        if (swapper) {
+            event.detail.headers["HX-Swap"] = swapper.getAttribute("hx-swap");
+        }
+    });
+
+    // Error boundaries are swapped in even though the layouts leave other
+    // 404 and 5xx responses unswapped
+    document.body.addEventListener("htmx:beforeSwap", function (event) {
+        if (event.detail.xhr.getResponseHeader("X-Error-Boundary") === "true") {
+            event.detail.shouldSwap = true;
+            event.detail.isError = true;
+        }
+    });
+
+    // Swap targets are marked busy while their request runs
+    document.body.addEventListener("htmx:beforeRequest", function (event) {
+        if (event.detail.target) {
+            event.detail.target.setAttribute("aria-busy", "true");
+        }
+    });
+    document.body.addEventListener("htmx:afterRequest", function (event) {
+        if (event.detail.target) {
+            event.detail.target.removeAttribute("aria-busy");
+        }
+    });
+
+    // Elements with data-skeleton="<template id>" fill their swap target with
+    // that placeholder as soon as their request starts, and put the previous
+    // content back if the request fails without swapping
+    document.body.addEventListener("htmx:beforeRequest", function (event) {
+        const elt = event.detail.elt;
+        const target = event.detail.target;
+        const skeleton = elt.dataset && elt.dataset.skeleton && document.getElementById(elt.dataset.skeleton);
+        if (!skeleton || !target) {
+            return;
+        }
+        const placeholder = skeleton.content.cloneNode(true);
+        skeletons.set(target, {previous: Array.from(target.childNodes), placeholder: placeholder.firstElementChild});
+        target.replaceChildren(placeholder);
+    });
+    document.body.addEventListener("htmx:afterRequest", function (event) {
+        const target = event.detail.target;
+        const saved = target && skeletons.get(target);
+        if (!saved) {
+            return;
+        }
+        skeletons.delete(target);
+        if (!event.detail.successful && target.contains(saved.placeholder)) {
+            target.replaceChildren(...saved.previous);
+        }
+    });
+
+    // Forms with data-optimistic="<template id>" show what they send at once:
+    // a copy of the template, filled from the submitted fields named by its
+    // data-pending-field elements, is appended to the swap target with the
+    // ID "pending-<client_id>". The server replaces it by the stored message
+    // or marks it failed by that ID (see internal/handlers/optimistic.go);
+    // submissions missing a field are left to server-side validation
+    document.body.addEventListener("htmx:configRequest", function (event) {
+        const form = event.detail.elt;
+        const template = form instanceof HTMLFormElement && form.dataset.optimistic && document.getElementById(form.dataset.optimistic);
+        if (!template || !event.detail.target) {
+            return;
+        }
+        const pending = template.content.firstElementChild.cloneNode(true);
+        for (const field of pending.querySelectorAll("[data-pending-field]")) {
+            const value = String(event.detail.parameters[field.dataset.pendingField] || "").trim();
+            if (!value) {
+                return;
+            }
+            field.textContent = value;
+        }
+        const id = crypto.randomUUID ? crypto.randomUUID() : Date.now().toString(36) + Math.random().toString(36).slice(2);
+        event.detail.parameters.client_id = id;
+        pending.id = "pending-" + id;
+        event.detail.target.querySelectorAll("[data-empty]").forEach((placeholder) => placeholder.remove());
+        event.detail.target.appendChild(pending);
+        pending.scrollIntoView({block: "nearest"});
+    });
+
+    // Lists marked data-deltas="<url>", such as the messages of a room, are
+    // not refetched as a whole when a message is posted: they get a new-chat
+    // event with its chatID and append what <url><chatID> returns, and the
+    // response to a form posting into them is appended the same way.
+    // Messages already shown, returned to their sender or still pending, are
+    // left alone, and the list's data-empty placeholder goes away
+    function appendMessages(list, html) {
+        const template = document.createElement("template");
+        template.innerHTML = html;
+        for (const item of Array.from(template.content.children)) {
+            if (item.id.startsWith("chat-") && document.getElementById(item.id)) {
+                item.remove();
+            }
+        }
+        if (template.content.querySelector("[id^='chat-']")) {
+            list.querySelectorAll("[data-empty]").forEach((placeholder) => placeholder.remove());
+        }
+        htmx.swap(list, template.innerHTML, {swapStyle: "beforeend"});
+    }
+
+    // Fetches are chained, so messages are appended in the order announced
+    let deltas = Promise.resolve();
+    document.body.addEventListener("new-chat", function (event) {
+        const list = event.target;
+        const {chatID, clientID} = event.detail || {};
+        if (!list.dataset || list.dataset.deltas === undefined || !chatID) {
+            return;
+        }
+        if (document.getElementById("chat-" + chatID) || (clientID && document.getElementById("pending-" + clientID))) {
+            return;
+        }
+        deltas = deltas.then(() => fetch(list.dataset.deltas + encodeURIComponent(chatID), {headers: {"HX-Request": "true"}})
+            .then((response) => response.ok ? response.text() : "")
+            .then((html) => appendMessages(list, html)))
+            .catch(() => {});
+    });
+
+    document.body.addEventListener("htmx:beforeSwap", function (event) {
+        const list = event.detail.target;
+        if (!list || !list.dataset || list.dataset.deltas === undefined || event.detail.xhr.getResponseHeader("HX-Reswap") !== "beforeend") {
+            return;
+        }
+        event.detail.shouldSwap = false;
+        appendMessages(list, event.detail.serverResponse);
+    });
+
+    // Retrying a failed message shows it as sending again
+    document.body.addEventListener("htmx:beforeRequest", function (event) {
+        const pending = event.detail.elt.matches("[data-pending-retry]") && event.detail.elt.closest("[data-pending]");
+        if (pending) {
+            pending.dataset.pending = "sending";
+        }
+    });
+
+    // Pending messages whose request failed without a word from the server,
+    // such as on network errors, are marked failed here, with a retry button
+    // sending the same values
+    document.body.addEventListener("htmx:afterRequest", function (event) {
+        const parameters = event.detail.requestConfig && event.detail.requestConfig.parameters;
+        const id = parameters && parameters.client_id;
+        const pending = id && document.getElementById("pending-" + id);
+        if (event.detail.successful || !pending || pending.dataset.pending !== "sending") {
+            return;
+        }
+        pending.dataset.pending = "failed";
+        const retry = pending.querySelector("[data-pending-retry]");
+        if (retry && !retry.hasAttribute("hx-post")) {
+            const vals = {client_id: id};
+            pending.querySelectorAll("[data-pending-field]").forEach((field) => vals[field.dataset.pendingField] = field.textContent);
+            retry.setAttribute("hx-post", event.detail.requestConfig.path);
+            retry.setAttribute("hx-vals", JSON.stringify(vals));
+            retry.setAttribute("hx-target", "closest article");
+            retry.setAttribute("hx-swap", "outerHTML");
+            htmx.process(retry);
+        }
+    });
+
+    // Field error slots swapped in by the server (see internal/forms) mark
+    // the fields that point at them with aria-describedby as invalid, and
+    // the first field found invalid takes the focus
+    document.body.addEventListener("htmx:load", function (event) {
+        const slot = event.target;
+        if (!slot.matches || !slot.matches("[data-field-error]")) {
+            return;
+        }
+        const invalid = slot.textContent.trim() !== "";
+        document.querySelectorAll('[aria-describedby~="' + slot.id + '"]').forEach(function (field) {
+            field.setAttribute("aria-invalid", invalid ? "true" : "false");
+            if (invalid && !document.activeElement.matches('[aria-invalid="true"]')) {
+                field.focus();
+            }
+        });
+    });
+
+    // Opening a page from a drawer marked data-close-on-navigate="<url>"
+    // closes it, by swapping in what the URL returns
+    document.body.addEventListener("htmx:afterRequest", function (event) {
+        const elt = event.detail.elt;
+        const drawer = elt.closest && elt.closest("[data-close-on-navigate]");
+        if (drawer && event.detail.successful && elt.hasAttribute("hx-push-url")) {
+            htmx.ajax("GET", drawer.dataset.closeOnNavigate, {target: drawer, swap: "outerHTML"});
+        }
+    });
+
+    // The history snapshots the markup of the page, which leaves out what
+    // was typed into fields: the typed search is kept as its value
+    document.body.addEventListener("htmx:beforeHistorySave", function () {
+        const search = document.getElementById("room-search");
+        if (search) {
+            search.setAttribute("value", search.value);
+        }
+    });
+
+    // Emoji picked with data-emoji-insert="<field id>" are typed into that
+    // field at the cursor, which takes the focus back
+    document.body.addEventListener("click", function (event) {
+        const button = event.target.closest && event.target.closest("[data-emoji-insert]");
+        const field = button && document.getElementById(button.dataset.emojiInsert);
+        if (!field) {
+            return;
+        }
+        const start = field.selectionStart ?? field.value.length;
+        const end = field.selectionEnd ?? start;
+        field.value = field.value.slice(0, start) + button.textContent + field.value.slice(end);
+        field.focus();
+        field.setSelectionRange(start + button.textContent.length, start + button.textContent.length);
+        field.dispatchEvent(new Event("input", {bubbles: true}));
+    });
+
+    // Dialogs marked data-show-modal open as modals once swapped in
+    document.body.addEventListener("htmx:load", function (event) {
+        if (event.target.matches && event.target.matches("dialog[data-show-modal]")) {
+            event.target.showModal();
+        }
+    });
+
+    // Forms with data-clear-on-success="field ..." empty those fields after a
+    // successful submission and put the focus back in the first one
+    document.body.addEventListener("htmx:afterRequest", function (event) {
+        const form = event.detail.elt;
+        if (!event.detail.successful || !(form instanceof HTMLFormElement) || !form.dataset.clearOnSuccess) {
+            return;
+        }
+        const fields = form.dataset.clearOnSuccess.split(" ").map((name) => form.elements[name]).filter(Boolean);
+        fields.forEach((field) => field.value = "");
+        if (fields.length) {
+            fields[0].focus();
+        }
+    });
+
+    // Navigation targets marked data-focus-after-swap take the focus once new
+    // content is swapped in, so keyboard and screen reader users land on it;
+    // content with an autofocus element, which htmx focuses, is left alone
+    document.body.addEventListener("htmx:afterSettle", function (event) {
+        const target = event.detail.target;
+        if (target && target.hasAttribute("data-focus-after-swap") && !target.querySelector("[autofocus]")) {
+            target.focus();
+        }
+    });
+
+    // Links to the page shown inside data-mark-current navigation are marked
+    // aria-current, also after htmx navigation pushes a new URL
+    function markCurrent() {
+        document.querySelectorAll("[data-mark-current] a[href]").forEach(function (link) {
+            if (link.getAttribute("href") === location.pathname) {
+                link.setAttribute("aria-current", "page");
+            } else {
+                link.removeAttribute("aria-current");
+            }
+        });
+    }
+    document.body.addEventListener("htmx:afterSettle", markCurrent);
+    document.body.addEventListener("htmx:pushedIntoHistory", markCurrent);
+    window.addEventListener("popstate", markCurrent);
+    markCurrent();
+
+    // hub:status {overloaded, message} shows or hides the #hub-status banner
+    // while live updates lag; requests from a page showing it ask the server
+    // to say when the hub recovered
+    const hubStatus = document.getElementById("hub-status");
+    document.body.addEventListener("hub:status", function (event) {
+        if (hubStatus) {
+            hubStatus.textContent = event.detail.message;
+            hubStatus.classList.toggle("hidden", !event.detail.overloaded);
+        }
+    });
+    document.body.addEventListener("htmx:configRequest", function (event) {
+        if (hubStatus && !hubStatus.classList.contains("hidden")) {
+            event.detail.headers["X-Hub-Overloaded"] = "true";
+        }
+    });
+
+    // badge:update {key, count, label} updates every element with
+    // data-badge="key", using the translated label as its title
+    document.body.addEventListener("badge:update", function (event) {
+        document.querySelectorAll("[data-badge]").forEach(function (badge) {
+            if (badge.dataset.badge === event.detail.key) {
+                badge.textContent = event.detail.count;
+                if (event.detail.label) {
+                    badge.title = event.detail.label;
+                    badge.setAttribute("aria-label", event.detail.label);
+                }
+            }
+        });
+    });
+})();
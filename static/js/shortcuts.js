@@ -0,0 +1,134 @@
+// Keyboard shortcuts. The bindings are the browser's keymap, loaded as JSON
+// from GET /shortcuts and replaced by shortcuts:changed events when the help
+// overlay saves them (see internal/handlers/shortcuts.go). Keys are written
+// as in models.Keymap: "ctrl", "alt", "shift" and "meta" in that order, then
+// the key, such as "alt+arrowdown"; shift is left out of printable keys,
+// which already show it, like "?".
+(function () {
+    let keymap = {};
+    // Message counts of the rooms when they were last open, by room ID
+    const seen = JSON.parse(localStorage.getItem("seenCounts") || "{}");
+
+    fetch("/shortcuts", {headers: {Accept: "application/json"}})
+        .then((response) => response.ok ? response.json() : {})
+        .then((loaded) => keymap = loaded);
+    document.body.addEventListener("shortcuts:changed", (event) => keymap = event.detail);
+
+    // keyName writes a key press as a binding, or returns "" for modifiers
+    function keyName(event) {
+        if (["Control", "Alt", "Shift", "Meta"].includes(event.key)) {
+            return "";
+        }
+        const printable = event.key.length === 1 && event.key !== " ";
+        const parts = [];
+        if (event.ctrlKey) {
+            parts.push("ctrl");
+        }
+        if (event.altKey) {
+            parts.push("alt");
+        }
+        if (event.shiftKey && !printable) {
+            parts.push("shift");
+        }
+        if (event.metaKey) {
+            parts.push("meta");
+        }
+        parts.push(event.key === " " ? "space" : event.key.toLowerCase());
+        return parts.join("+");
+    }
+
+    // roomCount returns the message count shown in the badge of a room
+    function roomCount(roomID) {
+        const badge = document.querySelector('[data-badge="room-' + roomID + '-messages"]');
+        return badge ? parseInt(badge.textContent, 10) || 0 : 0;
+    }
+
+    // The open room counts as read up to its current message count
+    function markSeen() {
+        const chats = document.getElementById("chats-list");
+        if (chats && chats.dataset.roomId) {
+            seen[chats.dataset.roomId] = roomCount(chats.dataset.roomId);
+            localStorage.setItem("seenCounts", JSON.stringify(seen));
+        }
+    }
+    document.body.addEventListener("htmx:afterSettle", markSeen);
+    document.body.addEventListener("badge:update", () => setTimeout(markSeen));
+
+    const actions = {
+        // Focus the rooms search
+        search_rooms: function () {
+            const search = document.getElementById("room-search");
+            if (search) {
+                search.focus();
+                search.select();
+            }
+        },
+        // Open the next room, after the open one, with messages not seen yet
+        next_unread: function () {
+            const list = document.getElementById("rooms-list");
+            if (!list) {
+                return;
+            }
+            const links = Array.from(list.querySelectorAll('a[href^="/rooms/"]'));
+            const current = links.findIndex((link) => link.getAttribute("href") === location.pathname);
+            const ordered = links.slice(current + 1).concat(links.slice(0, current + 1));
+            const next = ordered.find(function (link) {
+                const roomID = link.getAttribute("href").slice("/rooms/".length);
+                return link.getAttribute("href") !== location.pathname && roomCount(roomID) > (seen[roomID] || 0);
+            });
+            if (next) {
+                next.click();
+            } else if (list.dataset.noUnread) {
+                htmx.trigger(document.body, "live:announce", {message: list.dataset.noUnread});
+            }
+        },
+        // Put the last message sent under the composer's name back into the
+        // composer, to correct and send again
+        edit_last: function () {
+            const form = document.querySelector("form[data-optimistic]");
+            const username = form && form.elements.username.value.trim();
+            if (!username) {
+                return;
+            }
+            const mine = Array.from(document.querySelectorAll("#chats-list article[data-author]"))
+                .filter((article) => article.dataset.author === username);
+            const last = mine[mine.length - 1];
+            if (last) {
+                form.elements.message.value = last.querySelector("[data-message]").textContent;
+                form.elements.message.focus();
+            }
+        },
+        // Open the shortcuts help
+        help: function () {
+            const button = document.getElementById("shortcuts-button");
+            if (button) {
+                button.click();
+            }
+        },
+    };
+
+    document.addEventListener("keydown", function (event) {
+        // Fields of the help overlay record the key pressed as their binding
+        if (event.target.matches && event.target.matches("[data-key-capture]")) {
+            const name = keyName(event);
+            if (name && name !== "tab" && name !== "shift+tab" && name !== "escape") {
+                event.preventDefault();
+                event.target.value = name;
+            }
+            return;
+        }
+
+        // Keys typed into fields are left alone, unless combined with ctrl,
+        // alt or meta
+        const typing = event.target.closest && event.target.closest("input, textarea, select, [contenteditable]");
+        if (event.defaultPrevented || (typing && !event.ctrlKey && !event.altKey && !event.metaKey)) {
+            return;
+        }
+        const name = keyName(event);
+        const action = name && Object.keys(keymap).find((action) => keymap[action] === name);
+        if (action && actions[action]) {
+            event.preventDefault();
+            actions[action]();
+        }
+    });
+})();
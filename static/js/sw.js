@@ -0,0 +1,68 @@
+// Service worker of the installable app, served at /sw.js so it controls the
+// whole site (see internal/handlers/pwa.go). The layouts register it as
+// /sw.js?v=<build>, and each build gets its own cache. It keeps the static
+// assets and an offline page: pages load from the network and fall back to
+// the offline page, static assets load from the cache and are refreshed in
+// the background, and everything else, such as htmx requests, the API and
+// WebSockets, always goes to the network.
+const version = new URL(self.location).searchParams.get("v") || "dev";
+const cacheName = "chat-" + version;
+const offlinePage = "/offline";
+const precached = [
+    offlinePage,
+    "/static/css/output.css",
+    "/static/js/events.js",
+    "/static/js/shortcuts.js",
+    "/branding.css",
+    "/manifest.webmanifest",
+    "/icons/icon-192.png",
+];
+
+self.addEventListener("install", function (event) {
+    event.waitUntil(caches.open(cacheName).then((cache) => cache.addAll(precached)).then(() => self.skipWaiting()));
+});
+
+// Caches of earlier builds are dropped
+self.addEventListener("activate", function (event) {
+    event.waitUntil(caches.keys()
+        .then((names) => Promise.all(names.filter((name) => name !== cacheName).map((name) => caches.delete(name))))
+        .then(() => self.clients.claim()));
+});
+
+// isStatic reports whether a URL is a static asset, including the htmx script
+function isStatic(url) {
+    if (url.origin !== self.location.origin) {
+        return url.hostname === "cdnjs.cloudflare.com";
+    }
+    return url.pathname.startsWith("/static/") || url.pathname.startsWith("/icons/") || url.pathname === "/branding.css" || url.pathname === "/manifest.webmanifest";
+}
+
+self.addEventListener("fetch", function (event) {
+    const request = event.request;
+    if (request.method !== "GET" || request.headers.get("HX-Request")) {
+        return;
+    }
+    const url = new URL(request.url);
+
+    if (request.mode === "navigate") {
+        event.respondWith(fetch(request).catch(() => caches.match(offlinePage)));
+        return;
+    }
+    if (isStatic(url)) {
+        event.respondWith(caches.open(cacheName).then(function (cache) {
+            return cache.match(request).then(function (cached) {
+                const fetched = fetch(request).then(function (response) {
+                    if (response.ok) {
+                        cache.put(request, response.clone());
+                    }
+                    return response;
+                });
+                if (cached) {
+                    event.waitUntil(fetched.catch(() => {}));
+                    return cached;
+                }
+                return fetched;
+            });
+        }));
+    }
+});
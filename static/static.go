@@ -0,0 +1,11 @@
+// Package static embeds the stylesheets and scripts served under /static, so the binary
+// does not depend on the working directory. Run `npm run build` before
+// `go build` to embed an up-to-date output.css.
+package static
+
+import "embed"
+
+// FS holds the static assets
+//
+//go:embed css js
+var FS embed.FS
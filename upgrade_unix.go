@@ -0,0 +1,158 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// listenersEnv names the listeners passed to a new process, in file descriptor order from 3
+	listenersEnv = "HTMX_LISTENERS"
+	// readyEnv holds the descriptor a new process writes to once it is serving
+	readyEnv = "HTMX_READY_FD"
+
+	// upgradeTimeout bounds how long the old process waits for the new one to become ready
+	upgradeTimeout = 30 * time.Second
+)
+
+var (
+	inheritOnce sync.Once
+	inherited   map[string]net.Listener
+)
+
+// inheritedListener returns the listener handed over under name by the previous process
+func inheritedListener(name string) (net.Listener, bool) {
+	inheritOnce.Do(func() {
+		inherited = make(map[string]net.Listener)
+		names := os.Getenv(listenersEnv)
+		if names == "" {
+			return
+		}
+		os.Unsetenv(listenersEnv)
+
+		for i, name := range strings.Split(names, ",") {
+			f := os.NewFile(uintptr(3+i), name)
+			ln, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				log.Printf("Ignoring inherited %s listener: %v", name, err)
+				continue
+			}
+			inherited[name] = ln
+		}
+	})
+
+	ln, ok := inherited[name]
+	return ln, ok
+}
+
+// notifyReady tells the previous process, if any, that this process is serving
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(readyEnv))
+	if err != nil {
+		return
+	}
+	os.Unsetenv(readyEnv)
+
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// upgradeSignal returns the channel receiving upgrade requests (SIGUSR2)
+func upgradeSignal() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	return ch
+}
+
+// handOver starts a new copy of the binary that inherits the listeners and
+// returns once it is serving. The caller should then drain and exit
+func handOver(listeners []namedListener) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	names := make([]string, 0, len(listeners))
+	for _, ln := range listeners {
+		filer, ok := ln.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("%s listener cannot be handed over", ln.name)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return fmt.Errorf("%s listener: %w", ln.name, err)
+		}
+		defer f.Close()
+
+		files = append(files, f)
+		names = append(names, ln.name)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	defer readyWriter.Close()
+	files = append(files, readyWriter)
+
+	env := append(os.Environ(),
+		listenersEnv+"="+strings.Join(names, ","),
+		readyEnv+"="+strconv.Itoa(3+len(names)),
+	)
+	process, err := os.StartProcess(executable, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if err != nil {
+		return err
+	}
+	readyWriter.Close()
+	log.Printf("Started new process %d, waiting for it to become ready", process.Pid)
+
+	// Wait for the ready byte; EOF means the new process exited first
+	result := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := ready.Read(b); err != nil {
+			result <- errors.New("new process exited before becoming ready")
+			return
+		}
+		result <- nil
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			process.Wait()
+			return err
+		}
+	case <-time.After(upgradeTimeout):
+		process.Kill()
+		process.Wait()
+		return errors.New("new process did not become ready in time")
+	}
+
+	// The new process now owns Unix socket files; closing ours must not remove them
+	for _, ln := range listeners {
+		if unix, ok := ln.Listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+	process.Release()
+	return nil
+}
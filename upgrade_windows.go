@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// inheritedListener reports no inherited listeners; handover is not supported on Windows
+func inheritedListener(name string) (net.Listener, bool) {
+	return nil, false
+}
+
+// notifyReady does nothing on Windows
+func notifyReady() {}
+
+// upgradeSignal returns a channel that never receives on Windows
+func upgradeSignal() <-chan os.Signal {
+	return nil
+}
+
+// handOver is not supported on Windows
+func handOver(listeners []namedListener) error {
+	return errors.New("zero-downtime restart is not supported on Windows")
+}